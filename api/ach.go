@@ -0,0 +1,165 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// the content type of NACHA files.
+const nachaContentType = "text/plain; charset=us-ascii"
+
+type achTransferRequest struct {
+	Direction   string               `json:"direction"`
+	Beneficiary *core.ACHBeneficiary `json:"beneficiary"`
+	Amount      float64              `json:"amount"`
+}
+
+// OriginateACH posts an ACH credit or debit of the account in USD, which is sent in the next NACHA file.
+func OriginateACH(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r achTransferRequest
+	err = c.BindJSON(&r)
+	if err != nil || r.Beneficiary == nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	e, err := nb.OriginateACH(id, r.Direction, r.Beneficiary, r.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrLimitExceeded) {
+		respondLimitExceeded(c, err)
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, e)
+	}
+}
+
+// GetACHEntries lists the ACH entries in ?status, or all entries without it.
+func GetACHEntries(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	es, err := nb.GetACHEntries(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, es)
+	}
+}
+
+// ExportNACHA generates a NACHA file of the pending entries and downloads it. the id of the file is in X-ACH-File-ID.
+func ExportNACHA(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	f, err := nb.ExportNACHA(time.Now())
+	if errors.Is(err, core.ErrNoACHEntries) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		respondNACHA(c, f)
+	}
+}
+
+// GetACHFile downloads a NACHA file generated before.
+func GetACHFile(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	f, err := nb.GetACHFile(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("ACH file(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		respondNACHA(c, f)
+	}
+}
+
+func respondNACHA(c *gin.Context, f *core.ACHFile) {
+	filename := fmt.Sprintf("ach-%v-%v.txt", f.ID, f.CreatedAt.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-ACH-File-ID", strconv.FormatInt(f.ID, 10))
+	c.Data(http.StatusOK, nachaContentType, f.Content)
+}
+
+// ProcessACHReturns reads the return file in the body, reverses the returned entries and responds the report.
+func ProcessACHReturns(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	// a file which cannot be parsed is rejected before anything is reversed.
+	_, err = core.ParseNACHA(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := nb.ProcessACHReturns(data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestACH(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.Use(ResolveAccountID)
+	router.POST("/accounts/:id/ach-transfers", OriginateACH)
+	router.PATCH("/accounts/:id/balance", FinancialTransaction)
+	admin := router.Group("/admin", AdminOnly)
+	admin.GET("/ach-entries", GetACHEntries)
+	admin.POST("/ach-files", ExportNACHA)
+	admin.GET("/ach-files/:id", GetACHFile)
+	admin.POST("/ach-returns", ProcessACHReturns)
+
+	beneficiary := `{"routing":"021000021","account_number":"123456789","name":"Jane Roe"}`
+	var (
+		fileID  string
+		content string
+	)
+	fs := make([]*fixture, 8)
+	fs[0] = &fixture{
+		name:      "Successfully originate a credit.",
+		method:    "POST",
+		uri:       "/accounts/1001/ach-transfers",
+		bodyParam: `{"direction":"credit","beneficiary":` + beneficiary + `,"amount":30}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var e core.ACHEntry
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &e))
+			assert.Equal(t, core.ACHPending, e.Status)
+			assert.Equal(t, "JANE ROE", e.Beneficiary.Name)
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Invalid direction.",
+		method:    "POST",
+		uri:       "/accounts/1001/ach-transfers",
+		bodyParam: `{"direction":"push","beneficiary":` + beneficiary + `,"amount":30}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[2] = &fixture{
+		name:      "Account not found.",
+		method:    "POST",
+		uri:       "/accounts/404/ach-transfers",
+		bodyParam: `{"direction":"credit","beneficiary":` + beneficiary + `,"amount":30}`,
+		code:      http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:      "Without beneficiary.",
+		method:    "POST",
+		uri:       "/accounts/1001/ach-transfers",
+		bodyParam: `{"direction":"credit","amount":30}`,
+		code:      http.StatusBadRequest,
+	}
+	// the overdraft of the clearing account is not reachable by customers.
+	fs[4] = &fixture{
+		name:      "Transfer from the clearing account.",
+		method:    "PATCH",
+		uri:       "/accounts/-5/balance",
+		bodyParam: `{"class":"transfer","to":1001,"amount":1000}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[5] = &fixture{
+		name:      "Originate from the clearing account.",
+		method:    "POST",
+		uri:       "/accounts/-5/ach-transfers",
+		bodyParam: `{"direction":"credit","beneficiary":` + beneficiary + `,"amount":30}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[6] = &fixture{
+		name:   "Successfully get the pending entries.",
+		method: "GET",
+		uri:    "/admin/ach-entries?status=pending",
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var es []*core.ACHEntry
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &es))
+			assert.Equal(t, 1, len(es))
+		},
+	}
+	fs[7] = &fixture{
+		name:   "Successfully export a NACHA file.",
+		method: "POST",
+		uri:    "/admin/ach-files",
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			_, err := core.ParseNACHA(rr.Body.Bytes())
+			assert.NoError(t, err)
+			fileID, content = rr.Header().Get("X-ACH-File-ID"), rr.Body.String()
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	// the file exported above is downloaded again and returned by the receiving bank.
+	fs = make([]*fixture, 5)
+	fs[0] = &fixture{
+		name:   "Successfully get the exported file.",
+		method: "GET",
+		uri:    "/admin/ach-files/" + fileID,
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Equal(t, content, rr.Body.String())
+		},
+	}
+	fs[1] = &fixture{
+		name:   "No entry to export.",
+		method: "POST",
+		uri:    "/admin/ach-files",
+		header: adminHeader,
+		code:   http.StatusNotFound,
+	}
+	fs[2] = &fixture{
+		name:   "File not found.",
+		method: "GET",
+		uri:    "/admin/ach-files/404",
+		header: adminHeader,
+		code:   http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:      "Invalid return file.",
+		method:    "POST",
+		uri:       "/admin/ach-returns",
+		header:    adminHeader,
+		bodyParam: "not a nacha file",
+		code:      http.StatusBadRequest,
+	}
+	fs[4] = &fixture{
+		name:      "A file without returns reverses nothing.",
+		method:    "POST",
+		uri:       "/admin/ach-returns",
+		header:    adminHeader,
+		bodyParam: content,
+		code:      http.StatusOK,
+		body:      `{"reversed":0,"flagged":0,"unmatched":0,"ignored":0,"returns":[]}`,
+	}
+	serveFixtures(t, router, fs)
+}
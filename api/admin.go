@@ -0,0 +1,155 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// AdminOnly lets only requests having ADMIN_TOKEN in X-Admin-Token header through.
+// the admin api is disabled when ADMIN_TOKEN is not set.
+func AdminOnly(c *gin.Context) {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin api is disabled"})
+		return
+	}
+
+	got := c.GetHeader("X-Admin-Token")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+	c.Next()
+}
+
+func CreateWebhook(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var w core.Webhook
+	err = c.BindJSON(&w)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	created, err := nb.CreateWebhook(&w)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		// the secret is shown only once.
+		c.IndentedJSON(http.StatusCreated, created)
+	}
+}
+
+func GetWebhooks(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	ws, err := nb.GetWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, ws)
+	}
+}
+
+func DeleteWebhook(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err = nb.DeleteWebhook(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("webhook(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ds, err := nb.GetWebhookDeliveries(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, ds)
+	}
+}
+
+// RedeliverWebhook makes a delivery pending again, typically a dead one.
+func RedeliverWebhook(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	d, err := nb.RedeliverWebhook(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("delivery(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusAccepted, d)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestAdminOnly(t *testing.T) {
+	router := gin.Default()
+	router.GET("/admin/ping", AdminOnly, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"msg": "ok"})
+	})
+
+	os.Setenv("ADMIN_TOKEN", "")
+	fs := make([]*fixture, 1)
+	fs[0] = &fixture{
+		name:   "Admin api is disabled.",
+		uri:    "/admin/ping",
+		header: adminHeader,
+		code:   http.StatusForbidden,
+		body:   `{"error":"admin api is disabled"}`,
+	}
+	serveFixtures(t, router, fs)
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	fs = make([]*fixture, 2)
+	fs[0] = &fixture{
+		name:   "Invalid admin token.",
+		uri:    "/admin/ping",
+		header: map[string]string{"X-Admin-Token": "user-token"},
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"invalid admin token"}`,
+	}
+	fs[1] = &fixture{
+		name:   "Successfully authorized.",
+		uri:    "/admin/ping",
+		header: adminHeader,
+		code:   http.StatusOK,
+		body:   `{"msg":"ok"}`,
+	}
+	serveFixtures(t, router, fs)
+}
+
+func TestWebhooks(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.POST("/admin/webhooks", CreateWebhook)
+	router.GET("/admin/webhooks", GetWebhooks)
+	router.DELETE("/admin/webhooks/:id", DeleteWebhook)
+	router.POST("/admin/webhook-deliveries/:id/redeliver", RedeliverWebhook)
+
+	var created core.Webhook
+	fs := make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:      "Invalid url.",
+		method:    "POST",
+		uri:       "/admin/webhooks",
+		bodyParam: `{"url":"ftp://accounting.example.com","event":"FundsTransferred"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got ftp://accounting.example.com as invalid webhook url"}`,
+	}
+	fs[1] = &fixture{
+		name:      "Empty event.",
+		method:    "POST",
+		uri:       "/admin/webhooks",
+		bodyParam: `{"url":"https://accounting.example.com/hooks"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"webhook has empty event"}`,
+	}
+	fs[2] = &fixture{
+		name:      "Unknown event.",
+		method:    "POST",
+		uri:       "/admin/webhooks",
+		bodyParam: `{"url":"https://accounting.example.com/hooks","event":"FundTransferred"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got FundTransferred as unknown webhook event"}`,
+	}
+	fs[3] = &fixture{
+		name:      "Successfully register a webhook.",
+		method:    "POST",
+		uri:       "/admin/webhooks",
+		bodyParam: `{"url":"https://accounting.example.com/hooks","event":"FundsTransferred","secret":"secret"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &created)
+			assert.Equal(t, "secret", created.Secret)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 4)
+	// the secret is not listed.
+	fs[0] = &fixture{
+		name: "Successfully list the webhooks.",
+		uri:  "/admin/webhooks",
+		code: http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var ws []core.Webhook
+			json.Unmarshal(rr.Body.Bytes(), &ws)
+			assert.Equal(t, []core.Webhook{{ID: created.ID, URL: created.URL, Event: created.Event}}, ws)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Successfully delete the webhook.",
+		method: "DELETE",
+		uri:    fmt.Sprintf("/admin/webhooks/%v", created.ID),
+		code:   http.StatusNoContent,
+	}
+	fs[2] = &fixture{
+		name:   "Webhook is already deleted.",
+		method: "DELETE",
+		uri:    fmt.Sprintf("/admin/webhooks/%v", created.ID),
+		code:   http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:   "Delivery not found.",
+		method: "POST",
+		uri:    "/admin/webhook-deliveries/404/redeliver",
+		code:   http.StatusNotFound,
+		body:   `{"error":"delivery(ID: 404) doesnt exist"}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -4,12 +4,16 @@ import (
 	// "_" in import means blank import
 
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/hiroyuki-takayama-RAIX/core"
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
@@ -87,9 +91,18 @@ func CreateAccount(c *gin.Context) {
 	}
 	defer nb.Close()
 
-	// mapping request body into empty customer variable
-	var customer core.Customer
-	err = c.BindJSON(&customer)
+	// mapping request body into empty customer variable. product is optional and checking by default,
+	// and currency is optional and USD by default.
+	var r struct {
+		core.Customer
+		Product  string `json:"product"`
+		Currency string `json:"currency"`
+	}
+	err = c.BindJSON(&r)
+	customer := r.Customer
+	if r.Product == "" {
+		r.Product = core.ProductChecking
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
 	} else if customer.Name == "" {
@@ -99,8 +112,10 @@ func CreateAccount(c *gin.Context) {
 	} else if customer.Phone == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "request has empty phone number"})
 	} else {
-		account, err := nb.CreateAccount(&customer)
-		if err != nil {
+		account, err := nb.OpenAccount(&customer, r.Product, r.Currency)
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, core.ErrUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create a new account"})
 		} else {
 			c.IndentedJSON(http.StatusCreated, account)
@@ -124,7 +139,9 @@ func DeleteAccount(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
 	} else {
 		err := nb.DeleteAccount(id)
-		if err != nil {
+		if errors.Is(err, core.ErrAccountInUse) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if err != nil {
 			msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
 			c.JSON(http.StatusNotFound, gin.H{"error": msg})
 		} else {
@@ -198,12 +215,20 @@ func FinancialTransaction(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": msg})
 		} else {
 			var t core.Trade
-			err = c.BindJSON(&t)
+			var raw struct {
+				To json.RawMessage `json:"to"`
+			}
+			err = c.ShouldBindBodyWith(&t, binding.JSON)
+			if err == nil {
+				err = c.ShouldBindBodyWith(&raw, binding.JSON)
+			}
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+				respondInvalidRequest(c, err)
 			} else if t.Amount <= 0 {
 				msg := fmt.Sprintf("amount is less than zero. your input is %v", t.Amount)
 				c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			} else if err := nb.CheckTrade(id, &t); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			} else {
 				/*
 					accounts, err := nb.Execute(ft)
@@ -223,16 +248,27 @@ func FinancialTransaction(c *gin.Context) {
 					}
 				case WITHDRAW:
 					account, err := nb.Withdraw(id, t.Amount)
-					if err != nil {
+					if errors.Is(err, core.ErrLimitExceeded) {
+						respondLimitExceeded(c, err)
+					} else if err != nil {
 						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 					} else {
 						c.JSON(http.StatusOK, account)
 					}
 				case TRANSFER:
-					accounts, err := nb.Transfer(id, t.To, t.Amount)
+					// the id is still taken from the clients made before the identifier until idSunset.
+					if err := deprecateID(c, "to", raw.To); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+						return
+					}
+					accounts, err := nb.TransferAtQuote(id, int(t.To), t.Amount, t.Quote)
 					if err != nil {
 						if errors.Is(err, sql.ErrNoRows) {
 							c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+						} else if errors.Is(err, core.ErrLimitExceeded) {
+							respondLimitExceeded(c, err)
+						} else if errors.Is(err, core.ErrQuoteExpired) || errors.Is(err, core.ErrQuoteRedeemed) {
+							c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 						} else {
 							c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 						}
@@ -271,11 +307,104 @@ func GetBalance(c *gin.Context) {
 		if err != nil {
 			msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
 			c.JSON(http.StatusNotFound, gin.H{"error": msg})
-		} else {
-			r := make(map[string]any)
-			r["balance"] = account.Balance
-			r["id"] = account.Number
-			c.IndentedJSON(http.StatusOK, r)
+			return
+		}
+
+		available, err := nb.GetAvailableBalance(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// balance is the ledger balance, and available is the balance without holds.
+		r := make(map[string]any)
+		r["balance"] = account.Balance
+		r["available"] = available
+		r["id"] = account.Number
+		c.IndentedJSON(http.StatusOK, r)
+	}
+}
+
+// AccountEvents streams events of the account as Server-Sent Events.
+// when a client reconnects with Last-Event-ID header, events recorded after it are replayed from the journal.
+// the route must be behind AccountHolder, because the events show the balance of the account.
+func AccountEvents(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var last int64
+	header := c.GetHeader("Last-Event-ID")
+	if header != "" {
+		last, err = strconv.ParseInt(header, 10, 64)
+		if err != nil {
+			msg := fmt.Sprintf("got %v as invalied Last-Event-ID", header)
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
 		}
 	}
+
+	// subscribe before reading the journal so that no event is missed between them.
+	ch, cancel := core.Subscribe(id)
+	defer cancel()
+
+	var replay []*core.Event
+	if header != "" {
+		replay, err = nb.EventsSince(id, last)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// a closed account can be streamed only to replay its last events.
+	_, err = nb.GetAccount(id)
+	if err != nil && len(replay) == 0 {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	}
+
+	send := func(e *core.Event) bool {
+		if e.ID <= last {
+			return true
+		}
+		c.Render(-1, sse.Event{
+			Id:    strconv.FormatInt(e.ID, 10),
+			Event: e.Type,
+			Data:  e,
+		})
+		last = e.ID
+		return e.Type != core.AccountClosed
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		if len(replay) > 0 {
+			e := replay[0]
+			replay = replay[1:]
+			return send(e)
+		}
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				// the subscriber was dropped. the client will resume with Last-Event-ID.
+				return false
+			}
+			return send(e)
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
 }
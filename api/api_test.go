@@ -2,12 +2,15 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -17,10 +20,49 @@ import (
 
 type fixture struct {
 	name      string
+	method    string
 	uri       string
+	header    map[string]string
 	bodyParam string
 	code      int
 	body      string
+	check     func(t *testing.T, rr *httptest.ResponseRecorder)
+}
+
+// adminHeader authorizes the fixtures of admin routes. the tests set ADMIN_TOKEN to admin-token.
+var adminHeader = map[string]string{"X-Admin-Token": "admin-token"}
+
+// serveFixtures sends the request of each fixture to the router in order and checks the response.
+// the method is GET when it is empty, and the body is compared only when it is given.
+// check looks at the rest of the response, e.g. to keep an id for the following fixtures.
+func serveFixtures(t *testing.T, router *gin.Engine, fs []*fixture) {
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			method := f.method
+			if method == "" {
+				method = "GET"
+			}
+			req, err := http.NewRequest(method, f.uri, bytes.NewBufferString(f.bodyParam))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.bodyParam != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for k, v := range f.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			assert.Equal(t, f.code, rr.Code)
+			if f.body != "" {
+				assert.JSONEq(t, f.body, rr.Body.String())
+			}
+			if f.check != nil {
+				f.check(t, rr)
+			}
+		})
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -54,7 +96,7 @@ func TestGetAccounts(t *testing.T) {
 		name: "Successfully Get all accounts.",
 		uri:  "/accounts",
 		code: http.StatusOK,
-		body: `[{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"balance":100},{"name":"Ide Non No","address":"Ta No Tsu","phone":"(0120) 117 117","id":3003,"balance":100}]`,
+		body: `[{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":100,"currency":"USD"},{"name":"Ide Non No","address":"Ta No Tsu","phone":"(0120) 117 117","id":3003,"iban":"JP47NETB0000003003","balance":100,"currency":"USD"}]`,
 	}
 
 	for _, f := range fs {
@@ -92,12 +134,12 @@ func TestGetAccount(t *testing.T) {
 	}
 	defer core.DeleteTestData()
 
-	fs := make([]*fixture, 3)
+	fs := make([]*fixture, 4)
 	fs[0] = &fixture{
 		name: "Successfully Get an account.",
 		uri:  "/accounts/1001",
 		code: http.StatusOK,
-		body: `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"balance":100}`,
+		body: `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":100,"currency":"USD"}`,
 	}
 	fs[1] = &fixture{
 		name: "Invalied id number.",
@@ -111,6 +153,12 @@ func TestGetAccount(t *testing.T) {
 		code: http.StatusNotFound,
 		body: `{"error":"account(ID: 404) doesnt exist"}`,
 	}
+	fs[3] = &fixture{
+		name: "Internal account of the bank.",
+		uri:  "/accounts/-1",
+		code: http.StatusNotFound,
+		body: `{"error":"account(ID: -1) doesnt exist"}`,
+	}
 
 	for _, f := range fs {
 		t.Run(f.name, func(t *testing.T) {
@@ -141,7 +189,7 @@ func TestCreateAccount(t *testing.T) {
 		uri:       "/accounts",
 		bodyParam: `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147"}`,
 		code:      http.StatusCreated,
-		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":0,"balance":0}`,
+		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":0,"iban":"JP36NETB0000000000","balance":0,"currency":"USD"}`,
 	}
 	fs[1] = &fixture{
 		name:      "Invalied id number.",
@@ -261,7 +309,7 @@ func TestDeleteAccount(t *testing.T) {
 	}
 	defer core.DeleteTestData()
 
-	fs := make([]*fixture, 3)
+	fs := make([]*fixture, 4)
 	fs[0] = &fixture{
 		name: "Successfully delete an account.",
 		uri:  "/accounts/1001",
@@ -280,6 +328,12 @@ func TestDeleteAccount(t *testing.T) {
 		code: http.StatusNotFound,
 		body: `{"error":"account(ID: 404) doesnt exist"}`,
 	}
+	fs[3] = &fixture{
+		name: "Internal account of the bank",
+		uri:  "/accounts/-1",
+		code: http.StatusNotFound,
+		body: `{"error":"account(ID: -1) doesnt exist"}`,
+	}
 
 	for _, f := range fs {
 		t.Run(f.name, func(t *testing.T) {
@@ -314,7 +368,7 @@ func TestUpdateAccount(t *testing.T) {
 		uri:       "/accounts/3003",
 		bodyParam: `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147"}`,
 		code:      http.StatusCreated,
-		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":3003,"balance":100}`,
+		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":3003,"iban":"JP47NETB0000003003","balance":100,"currency":"USD"}`,
 	}
 	fs[1] = &fixture{
 		name:      "Invalied id number.",
@@ -419,7 +473,7 @@ func TestGetBalance(t *testing.T) {
 		name: "Successfully Get a balance.",
 		uri:  "/accounts/1001/balance",
 		code: http.StatusOK,
-		body: `{"id":1001,"balance":100}`,
+		body: `{"id":1001,"balance":100,"available":100}`,
 	}
 	fs[1] = &fixture{
 		name: "Invalied id number.",
@@ -462,7 +516,7 @@ func TestDeposit(t *testing.T) {
 		uri:       "/accounts/1001/balance",
 		bodyParam: `{"class":"deposit","amount":20}`,
 		code:      http.StatusOK,
-		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"balance":120}`,
+		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":120,"currency":"USD"}`,
 	}
 
 	router := gin.Default()
@@ -486,7 +540,7 @@ func TestWithdraw(t *testing.T) {
 		uri:       "/accounts/1001/balance",
 		bodyParam: `{"class":"withdraw","amount":20}`,
 		code:      http.StatusOK,
-		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"balance":80}`,
+		body:      `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":80,"currency":"USD"}`,
 	}
 	fs[1] = &fixture{
 		name:      "Amount is grater than balance",
@@ -520,13 +574,13 @@ func TestWithdraw(t *testing.T) {
 }
 
 func TestTransfer(t *testing.T) {
-	fs := make([]*fixture, 3)
+	fs := make([]*fixture, 4)
 	fs[0] = &fixture{
 		name:      "Successfully transfer",
 		uri:       "/accounts/1001/balance",
 		bodyParam: `{"class":"transfer","amount":20,"from":1001,"to":3003}`,
 		code:      http.StatusOK,
-		body:      `[{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"balance":80},{"name":"Ide Non No","address":"Ta No Tsu","phone":"(0120) 117 117","id":3003,"balance":120}]`,
+		body:      `[{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":80,"currency":"USD"},{"name":"Ide Non No","address":"Ta No Tsu","phone":"(0120) 117 117","id":3003,"iban":"JP47NETB0000003003","balance":120,"currency":"USD"}]`,
 	}
 	fs[1] = &fixture{
 		name:      "Amount is grater than balance",
@@ -542,6 +596,13 @@ func TestTransfer(t *testing.T) {
 		code:      http.StatusNotFound,
 		body:      `{"error":"reciever's account(ID: 404) is not found: sql: no rows in result set"}`,
 	}
+	fs[3] = &fixture{
+		name:      "Reciever is an internal account of the bank",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"transfer","amount":20,"from":1001,"to":-5}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"Invalied request"}`,
+	}
 
 	for _, f := range fs {
 		t.Run(f.name, func(t *testing.T) {
@@ -564,6 +625,47 @@ func TestTransfer(t *testing.T) {
 			core.DeleteTestData()
 		})
 	}
+
+	t.Run("The id of the reciever is deprecated.", func(t *testing.T) {
+		err := core.InsertTestData()
+		if err != nil {
+			t.Errorf("failed to insertTestData(): %v", err)
+		}
+		defer core.DeleteTestData()
+
+		defer func(sunset time.Time) { idSunset = sunset }(idSunset)
+		idSunset = time.Date(time.Now().Year()+1, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+		router := gin.Default()
+		router.PATCH("/accounts/:id/balance", FinancialTransaction)
+		transfer := func(to string) *httptest.ResponseRecorder {
+			body := fmt.Sprintf(`{"class":"transfer","amount":20,"to":%v}`, to)
+			req, err := http.NewRequest("PATCH", "/accounts/1001/balance", bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+		for to, deprecation := range map[string]string{`3003`: "true", `"JP47NETB0000003003"`: ""} {
+			rr := transfer(to)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, deprecation, rr.Header().Get("Deprecation"))
+			if deprecation != "" {
+				assert.Equal(t, idSunset.Format(http.TimeFormat), rr.Header().Get("Sunset"))
+			}
+		}
+
+		// the id is rejected from the sunset.
+		idSunset = time.Now().Add(-time.Hour)
+		rr := transfer(`3003`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"error":"to must be the account identifier like JP72NETB0000001001. the id 3003 is deprecated"}`, rr.Body.String())
+		rr = transfer(`"JP47NETB0000003003"`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
 }
 
 func TestFinancialTransaction(t *testing.T) {
@@ -573,7 +675,7 @@ func TestFinancialTransaction(t *testing.T) {
 	}
 	defer core.DeleteTestData()
 
-	fs := make([]*fixture, 5)
+	fs := make([]*fixture, 7)
 	fs[0] = &fixture{
 		name:      "Amount is less than zero",
 		uri:       "/accounts/1001/balance",
@@ -609,6 +711,20 @@ func TestFinancialTransaction(t *testing.T) {
 		code:      http.StatusOK,
 		body:      `{"msg":"FinancialTransaction() is executed collectlly."}`,
 	}
+	fs[5] = &fixture{
+		name:      "Withdraw from an internal account of the bank",
+		uri:       "/accounts/-1/balance",
+		bodyParam: `{"class":"withdraw","amount":20}`,
+		code:      http.StatusNotFound,
+		body:      `{"error":"account(ID: -1) doesnt exist"}`,
+	}
+	fs[6] = &fixture{
+		name:      "Transfer from an internal account of the bank",
+		uri:       "/accounts/-5/balance",
+		bodyParam: `{"class":"transfer","amount":20,"to":1001}`,
+		code:      http.StatusNotFound,
+		body:      `{"error":"account(ID: -5) doesnt exist"}`,
+	}
 
 	for _, f := range fs {
 		t.Run(f.name, func(t *testing.T) {
@@ -627,3 +743,96 @@ func TestFinancialTransaction(t *testing.T) {
 		})
 	}
 }
+
+func TestAccountEvents(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+
+	_, err = nb.Deposit(1001, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nb.Withdraw(1001, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := nb.EventsSince(1001, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := nb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.Default()
+	router.GET("/accounts/:id/events", AccountHolder, AccountEvents)
+
+	// the errors are returned before the stream starts.
+	fs := make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:   "Invalied Last-Event-ID.",
+		uri:    "/accounts/1001/events",
+		header: map[string]string{"Last-Event-ID": "first", "X-Account-Token": credential.Token},
+		code:   http.StatusBadRequest,
+		body:   `{"error":"got first as invalied Last-Event-ID"}`,
+	}
+	fs[1] = &fixture{
+		name:   "Invalied id number.",
+		uri:    "/accounts/千百一/events",
+		header: map[string]string{"X-Account-Token": credential.Token},
+		code:   http.StatusBadRequest,
+		body:   `{"error":"got 千百一 as invalied id"}`,
+	}
+	fs[2] = &fixture{
+		name: "Without the credential.",
+		uri:  "/accounts/1001/events",
+		code: http.StatusUnauthorized,
+		body: `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+	fs[3] = &fixture{
+		name:   "Credential of another account.",
+		uri:    "/accounts/3003/events",
+		header: map[string]string{"X-Account-Token": credential.Token},
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 3003): invalid credential"}`,
+	}
+	serveFixtures(t, router, fs)
+
+	// httptest.ResponseRecorder cannot be used for streaming because it doesn't implement http.CloseNotifier.
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("Resume from the first event.", func(t *testing.T) {
+		// the stream never ends by itself, so read it until the deadline.
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/accounts/1001/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Last-Event-ID", fmt.Sprint(es[0].ID))
+		req.Header.Set("X-Account-Token", credential.Token)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, string(body), fmt.Sprintf("id:%v\nevent:balance-changed\n", es[1].ID))
+		assert.Contains(t, string(body), `"balance":80`)
+		assert.NotContains(t, string(body), fmt.Sprintf("id:%v\n", es[0].ID))
+	})
+}
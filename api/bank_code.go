@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+type domesticTransferRequest struct {
+	Beneficiary *core.Beneficiary `json:"beneficiary"`
+	Amount      float64           `json:"amount"`
+}
+
+func GetFinancialInstitution(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	code := c.Param("code")
+	bank, err := nb.GetFinancialInstitution(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("bank(code: %v) doesnt exist", code)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, bank)
+	}
+}
+
+func GetBranches(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	code := c.Param("code")
+	branches, err := nb.GetBranches(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("bank(code: %v) doesnt exist", code)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, branches)
+	}
+}
+
+func GetBranch(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	code := c.Param("code")
+	branch, err := nb.GetBranch(code, c.Param("branch"))
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("branch(code: %v) of bank(code: %v) doesnt exist", c.Param("branch"), code)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, branch)
+	}
+}
+
+// LoadBankCodes replaces the bank and branch codes with the CSV of the body.
+func LoadBankCodes(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	result, err := nb.LoadBankCodes(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, result)
+	}
+}
+
+// CheckBeneficiary looks up the account of another bank in the body, and responds it normalized with the names of the bank and the branch.
+func CheckBeneficiary(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var b core.Beneficiary
+	err = c.BindJSON(&b)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	beneficiary, err := nb.CheckBeneficiary(&b)
+	if errors.Is(err, core.ErrInvalidBeneficiary) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, beneficiary)
+	}
+}
+
+// SendDomesticTransfer sends the money from the account to the account of another bank after the beneficiary is checked.
+func SendDomesticTransfer(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r domesticTransferRequest
+	err = c.BindJSON(&r)
+	if err != nil || r.Beneficiary == nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	transfer, err := nb.SendDomesticTransfer(id, r.Beneficiary, r.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrLimitExceeded) {
+		respondLimitExceeded(c, err)
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, transfer)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestBankCodes(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.GET("/banks/:code", GetFinancialInstitution)
+	router.GET("/banks/:code/branches", GetBranches)
+	router.GET("/banks/:code/branches/:branch", GetBranch)
+	router.POST("/beneficiaries/check", CheckBeneficiary)
+	router.POST("/accounts/:id/domestic-transfers", SendDomesticTransfer)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/banks", LoadBankCodes)
+
+	beneficiary := `{"bank":"0001","branch":"110","account_type":"1","account_number":"1234","name":"ﾔﾏﾀﾞ ﾀﾛｳ"}`
+
+	// the fixtures run in order, so the codes loaded by the first one are read by the later ones.
+	fs := make([]*fixture, 11)
+	fs[0] = &fixture{
+		name:      "Successfully load the bank codes.",
+		method:    "PUT",
+		uri:       "/admin/banks",
+		header:    adminHeader,
+		bodyParam: "0001,みずほ銀行,ミズホ,110,新宿支店,シンジユク\n",
+		code:      http.StatusOK,
+		body:      `{"banks":1,"branches":1}`,
+	}
+	fs[1] = &fixture{
+		name:      "Invalid bank code in the file.",
+		method:    "PUT",
+		uri:       "/admin/banks",
+		header:    adminHeader,
+		bodyParam: "1,みずほ銀行,ミズホ,110,新宿支店,シンジユク\n",
+		code:      http.StatusBadRequest,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully get the bank.",
+		method: "GET",
+		uri:    "/banks/0001",
+		code:   http.StatusOK,
+		body:   `{"code":"0001","name":"みずほ銀行","kana":"ﾐｽﾞﾎ"}`,
+	}
+	fs[3] = &fixture{
+		name:   "Successfully get the branches.",
+		method: "GET",
+		uri:    "/banks/0001/branches",
+		code:   http.StatusOK,
+		body:   `[{"bank":"0001","code":"110","name":"新宿支店","kana":"ｼﾝｼﾞﾕｸ"}]`,
+	}
+	fs[4] = &fixture{
+		name:   "Bank not found.",
+		method: "GET",
+		uri:    "/banks/0002/branches",
+		code:   http.StatusNotFound,
+	}
+	fs[5] = &fixture{
+		name:   "Branch not found.",
+		method: "GET",
+		uri:    "/banks/0001/branches/001",
+		code:   http.StatusNotFound,
+	}
+	fs[6] = &fixture{
+		name:      "Successfully check the beneficiary.",
+		method:    "POST",
+		uri:       "/beneficiaries/check",
+		bodyParam: beneficiary,
+		code:      http.StatusOK,
+		body: `{"bank":"0001","bank_name":"みずほ銀行","branch":"110","branch_name":"新宿支店",
+			"account_type":"1","account_number":"0001234","name":"ﾔﾏﾀﾞ ﾀﾛｳ"}`,
+	}
+	fs[7] = &fixture{
+		name:      "Invalid account type.",
+		method:    "POST",
+		uri:       "/beneficiaries/check",
+		bodyParam: `{"bank":"0001","branch":"110","account_type":"3","account_number":"1234","name":"ﾔﾏﾀﾞ"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"account type must be 1, 2, 4 or 9. your input is 3: invalid beneficiary"}`,
+	}
+	// accounts of the test data are in USD.
+	fs[8] = &fixture{
+		name:      "Domestic transfer from an account in USD.",
+		method:    "POST",
+		uri:       "/accounts/1001/domestic-transfers",
+		bodyParam: `{"beneficiary":` + beneficiary + `,"amount":10}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[9] = &fixture{
+		name:      "Account not found.",
+		method:    "POST",
+		uri:       "/accounts/404/domestic-transfers",
+		bodyParam: `{"beneficiary":` + beneficiary + `,"amount":10}`,
+		code:      http.StatusNotFound,
+	}
+	fs[10] = &fixture{
+		name:      "Without beneficiary.",
+		method:    "POST",
+		uri:       "/accounts/1001/domestic-transfers",
+		bodyParam: `{"amount":10}`,
+		code:      http.StatusBadRequest,
+	}
+
+	serveFixtures(t, router, fs)
+}
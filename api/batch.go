@@ -0,0 +1,74 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+type batchRequest struct {
+	Mode   string        `json:"mode"`
+	Trades []*core.Trade `json:"trades"`
+}
+
+// BatchTransfer responds the status of every line. a rolled back atomic batch is 400 with the same body.
+func BatchTransfer(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r batchRequest
+	err = c.ShouldBindBodyWith(&r, binding.JSON)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	var raw struct {
+		Trades []struct {
+			To json.RawMessage `json:"to"`
+		} `json:"trades"`
+	}
+	err = c.ShouldBindBodyWith(&raw, binding.JSON)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	for i, t := range raw.Trades {
+		err := requireIdentifier(fmt.Sprintf("to of line %v", i+1), t.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := nb.BatchTransfer(id, r.Trades, r.Mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if !result.Committed {
+		c.IndentedJSON(http.StatusBadRequest, result)
+	} else {
+		c.IndentedJSON(http.StatusOK, result)
+	}
+}
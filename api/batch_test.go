@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestBatchTransfer(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.POST("/accounts/:id/batch-transfers", BatchTransfer)
+	router.GET("/accounts/:id/balance", GetBalance)
+
+	statuses := func(want ...string) func(t *testing.T, rr *httptest.ResponseRecorder) {
+		return func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var result core.BatchResult
+			json.Unmarshal(rr.Body.Bytes(), &result)
+			got := []string{}
+			for _, line := range result.Lines {
+				got = append(got, line.Status)
+			}
+			assert.Equal(t, want, got)
+		}
+	}
+
+	// the fixtures run in order, so the balance of 1001 is carried over from the previous batch.
+	fs := make([]*fixture, 10)
+	fs[0] = &fixture{
+		name:      "An atomic batch is rolled back.",
+		method:    "POST",
+		uri:       "/accounts/1001/batch-transfers",
+		bodyParam: `{"trades":[{"to":"JP47NETB0000003003","amount":30},{"to":"JP89NETB0000000404","amount":10},{"to":"JP47NETB0000003003","amount":10}]}`,
+		code:      http.StatusBadRequest,
+		check:     statuses(core.LineRolledBack, core.LineFailed, core.LineSkipped),
+	}
+	fs[1] = &fixture{
+		name: "Nothing is sent by the rolled back batch.",
+		uri:  "/accounts/1001/balance",
+		code: http.StatusOK,
+		body: `{"id":1001,"balance":100,"available":100}`,
+	}
+	fs[2] = &fixture{
+		name:      "Sender doesnt exist.",
+		method:    "POST",
+		uri:       "/accounts/404/batch-transfers",
+		bodyParam: `{"trades":[{"to":"JP47NETB0000003003","amount":30}]}`,
+		code:      http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:      "Reciever by the deprecated id.",
+		method:    "POST",
+		uri:       "/accounts/1001/batch-transfers",
+		bodyParam: `{"trades":[{"to":"JP47NETB0000003003","amount":30},{"to":3003,"amount":30}]}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[4] = &fixture{
+		name: "Nothing is sent by the invalid batches.",
+		uri:  "/accounts/1001/balance",
+		code: http.StatusOK,
+		body: `{"id":1001,"balance":100,"available":100}`,
+	}
+	fs[5] = &fixture{
+		name:      "A best-effort batch commits the rest.",
+		method:    "POST",
+		uri:       "/accounts/1001/batch-transfers",
+		bodyParam: `{"mode":"best-effort","trades":[{"to":"JP47NETB0000003003","amount":30},{"to":"JP47NETB0000003003","amount":90},{"to":"JP47NETB0000003003","amount":10}]}`,
+		code:      http.StatusOK,
+		check:     statuses(core.LineSucceeded, core.LineFailed, core.LineSucceeded),
+	}
+	fs[6] = &fixture{
+		name: "Only the succeeded lines are sent.",
+		uri:  "/accounts/1001/balance",
+		code: http.StatusOK,
+		body: `{"id":1001,"balance":60,"available":60}`,
+	}
+	fs[7] = &fixture{
+		name:      "Successfully send an atomic batch.",
+		method:    "POST",
+		uri:       "/accounts/1001/batch-transfers",
+		bodyParam: `{"mode":"atomic","trades":[{"to":"JP47NETB0000003003","amount":30},{"to":"JP47NETB0000003003","amount":20}]}`,
+		code:      http.StatusOK,
+		check:     statuses(core.LineSucceeded, core.LineSucceeded),
+	}
+	fs[8] = &fixture{
+		name: "All the lines are sent.",
+		uri:  "/accounts/1001/balance",
+		code: http.StatusOK,
+		body: `{"id":1001,"balance":10,"available":10}`,
+	}
+	fs[9] = &fixture{
+		name: "The reciever got all of them.",
+		uri:  "/accounts/3003/balance",
+		code: http.StatusOK,
+		body: `{"id":3003,"balance":190,"available":190}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// IssueCard issues a virtual debit card. the card number and the cvv are only shown in this response.
+func IssueCard(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	card, err := nb.IssueCard(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, card)
+	}
+}
+
+func GetCards(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	cs, err := nb.GetCards(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, cs)
+	}
+}
+
+// SetCardStatus freezes, unfreezes or cancels the card.
+func SetCardStatus(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	param = c.Param("card")
+	card, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied card id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r struct {
+		Status string `json:"status"`
+	}
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	updated, err := nb.SetCardStatus(id, card, r.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("card(ID: %v) of account(ID: %v) doesnt exist", card, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrCardCancelled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, updated)
+	}
+}
+
+// Authorize is called by merchants. an approved payment returns 201, and a declined one returns 402 with the reason.
+func Authorize(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var r core.AuthorizationRequest
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	a, err := nb.Authorize(&r)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "card doesnt exist"})
+	} else if errors.Is(err, core.ErrNoCardSecret) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if a.Status == core.AuthorizationDeclined {
+		c.IndentedJSON(http.StatusPaymentRequired, a)
+	} else {
+		c.IndentedJSON(http.StatusCreated, a)
+	}
+}
+
+func GetAuthorization(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseAuthorizationID(c)
+	if !ok {
+		return
+	}
+
+	a, err := nb.GetAuthorization(id)
+	respondAuthorization(c, id, a, err)
+}
+
+// ClearAuthorization withdraws the amount in the body, or the whole authorization when the body is empty.
+func ClearAuthorization(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseAuthorizationID(c)
+	if !ok {
+		return
+	}
+
+	var r struct {
+		Amount float64 `json:"amount"`
+	}
+	if c.Request.ContentLength != 0 {
+		err = c.BindJSON(&r)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+			return
+		}
+	}
+
+	a, err := nb.ClearAuthorization(id, r.Amount)
+	respondAuthorization(c, id, a, err)
+}
+
+func VoidAuthorization(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseAuthorizationID(c)
+	if !ok {
+		return
+	}
+
+	a, err := nb.VoidAuthorization(id)
+	respondAuthorization(c, id, a, err)
+}
+
+func parseAuthorizationID(c *gin.Context) (int64, bool) {
+	param := c.Param("id")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied authorization id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondAuthorization(c *gin.Context, id int64, a *core.CardAuthorization, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("authorization(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrAuthorizationNotOpen) || errors.Is(err, core.ErrHoldNotActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	} else if errors.Is(err, core.ErrLimitExceeded) {
+		respondLimitExceeded(c, err)
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, a)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestCards(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+	t.Setenv("CARD_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("ADMIN_TOKEN", "admin-token")
+
+	router := gin.Default()
+	router.POST("/accounts/:id/cards", IssueCard)
+	router.GET("/accounts/:id/cards", GetCards)
+	router.PATCH("/accounts/:id/cards/:card", SetCardStatus)
+	router.POST("/card-authorizations", Authorize)
+	router.GET("/card-authorizations/:id", GetAuthorization)
+	router.POST("/card-authorizations/:id/clear", AdminOnly, ClearAuthorization)
+	router.POST("/card-authorizations/:id/void", AdminOnly, VoidAuthorization)
+
+	// the number and the cvv of a card are shown only when it is issued.
+	var c core.Card
+	fs := make([]*fixture, 2)
+	fs[0] = &fixture{
+		name:   "Successfully issue a card.",
+		method: "POST",
+		uri:    "/accounts/1001/cards",
+		code:   http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &c)
+			assert.Equal(t, core.CardActive, c.Status)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Account not found.",
+		method: "POST",
+		uri:    "/accounts/9999/cards",
+		code:   http.StatusNotFound,
+	}
+	serveFixtures(t, router, fs)
+
+	authorization := func(amount float64) string {
+		return fmt.Sprintf(`{"pan":"%v","expiry":"%v","cvv":"%v","amount":%v,"merchant":"simulator"}`, c.PAN, c.Expiry, c.CVV, amount)
+	}
+	var a core.CardAuthorization
+	fs = make([]*fixture, 2)
+	fs[0] = &fixture{
+		name:      "Successfully authorize a payment.",
+		method:    "POST",
+		uri:       "/card-authorizations",
+		bodyParam: authorization(60),
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &a)
+			assert.Equal(t, core.AuthorizationApproved, a.Status)
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Declined by insufficient funds.",
+		method:    "POST",
+		uri:       "/card-authorizations",
+		bodyParam: authorization(50),
+		code:      http.StatusPaymentRequired,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var declined core.CardAuthorization
+			json.Unmarshal(rr.Body.Bytes(), &declined)
+			assert.Equal(t, "insufficient_funds", declined.Reason)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 10)
+	// only staff settles the payments of the merchants.
+	fs[0] = &fixture{
+		name:   "Clear without the admin token.",
+		method: "POST",
+		uri:    fmt.Sprintf("/card-authorizations/%v/clear", a.ID),
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"invalid admin token"}`,
+	}
+	fs[1] = &fixture{
+		name:   "Void without the admin token.",
+		method: "POST",
+		uri:    fmt.Sprintf("/card-authorizations/%v/void", a.ID),
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"invalid admin token"}`,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully clear the authorization.",
+		method: "POST",
+		uri:    fmt.Sprintf("/card-authorizations/%v/clear", a.ID),
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var cleared core.CardAuthorization
+			json.Unmarshal(rr.Body.Bytes(), &cleared)
+			assert.Equal(t, float64(60), cleared.Cleared)
+		},
+	}
+	fs[3] = &fixture{
+		name:   "Cleared authorization cannot be voided.",
+		method: "POST",
+		uri:    fmt.Sprintf("/card-authorizations/%v/void", a.ID),
+		header: adminHeader,
+		code:   http.StatusConflict,
+	}
+	fs[4] = &fixture{
+		name:      "Successfully freeze the card.",
+		method:    "PATCH",
+		uri:       fmt.Sprintf("/accounts/1001/cards/%v", c.ID),
+		bodyParam: `{"status":"frozen"}`,
+		code:      http.StatusOK,
+	}
+	fs[5] = &fixture{
+		name:      "Frozen card is declined.",
+		method:    "POST",
+		uri:       "/card-authorizations",
+		bodyParam: authorization(10),
+		code:      http.StatusPaymentRequired,
+	}
+	fs[6] = &fixture{
+		name:      "Invalid status.",
+		method:    "PATCH",
+		uri:       fmt.Sprintf("/accounts/1001/cards/%v", c.ID),
+		bodyParam: `{"status":"lost"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"status of card must be active, frozen or cancelled. your input is lost"}`,
+	}
+	fs[7] = &fixture{
+		name:      "Card of another account.",
+		method:    "PATCH",
+		uri:       fmt.Sprintf("/accounts/3003/cards/%v", c.ID),
+		bodyParam: `{"status":"active"}`,
+		code:      http.StatusNotFound,
+	}
+	fs[8] = &fixture{
+		name:      "Invalid card number.",
+		method:    "POST",
+		uri:       "/card-authorizations",
+		bodyParam: `{"pan":"4111111111111112","expiry":"01/30","cvv":"123","amount":10}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got ************1112 as invalid card number"}`,
+	}
+	fs[9] = &fixture{
+		name:   "Authorization not found.",
+		method: "GET",
+		uri:    "/card-authorizations/0",
+		code:   http.StatusNotFound,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// AccountHolder lets only requests having the credential of the account of :id in X-Account-Token header through.
+// the credential is issued to the holder by staff with IssueAccountCredential.
+func AccountHolder(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err = nb.CheckAccountCredential(id, c.GetHeader("X-Account-Token"))
+	if errors.Is(err, core.ErrInvalidCredential) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// TransferSender lets only requests having the credential of the sender of the transfer of :id in X-Account-Token header through.
+func TransferSender(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	t, err := nb.GetTransfer(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("transfer(ID: %v) doesnt exist", id)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = nb.CheckAccountCredential(t.From, c.GetHeader("X-Account-Token"))
+	if errors.Is(err, core.ErrInvalidCredential) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// IssueAccountCredential issues the credential of the account holder by staff. the token is shown only once.
+func IssueAccountCredential(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	credential, err := nb.IssueAccountCredential(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, credential)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestFees(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.PATCH("/accounts/:id/balance", FinancialTransaction)
+	router.GET("/accounts/:id/fees/quote", QuoteFee)
+	admin := router.Group("/admin", AdminOnly)
+	admin.GET("/products/:product/fees", GetFeeSchedules)
+	admin.PUT("/products/:product/fees/:operation", SetFeeSchedule)
+
+	// the fixtures run in order on the same data, so a fee set by one is charged by the later ones.
+	fs := make([]*fixture, 6)
+	fs[0] = &fixture{
+		name:      "Successfully set a tiered fee.",
+		method:    "PUT",
+		uri:       "/admin/products/checking/fees/transfer",
+		header:    adminHeader,
+		bodyParam: `{"kind":"tiered","tiers":[{"up_to":50,"fee":1},{"up_to":0,"fee":3}]}`,
+		code:      http.StatusOK,
+	}
+	fs[1] = &fixture{
+		name:   "Successfully get the fees of the product.",
+		method: "GET",
+		uri:    "/admin/products/checking/fees",
+		header: adminHeader,
+		code:   http.StatusOK,
+		body:   `[{"product":"checking","operation":"transfer","currency":"USD","kind":"tiered","tiers":[{"up_to":50,"fee":1},{"up_to":0,"fee":3}]}]`,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully quote the fee.",
+		method: "GET",
+		uri:    "/accounts/1001/fees/quote?operation=transfer&amount=60",
+		code:   http.StatusOK,
+		body:   `{"account":1001,"operation":"transfer","amount":60,"fee":3,"free_remaining":0}`,
+	}
+	fs[3] = &fixture{
+		name:      "The fee is charged on a transfer.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"transfer","amount":60,"from":1001,"to":3003}`,
+		code:      http.StatusOK,
+		body: `[
+			{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":37,"currency":"USD","fee":3},
+			{"name":"Ide Non No","address":"Ta No Tsu","phone":"(0120) 117 117","id":3003,"iban":"JP47NETB0000003003","balance":160,"currency":"USD"}
+		]`,
+	}
+	fs[4] = &fixture{
+		name:   "Invalid operation.",
+		method: "GET",
+		uri:    "/accounts/1001/fees/quote?operation=deposit&amount=60",
+		code:   http.StatusBadRequest,
+		body:   `{"error":"operation of fee must be withdraw or transfer. your input is deposit"}`,
+	}
+	fs[5] = &fixture{
+		name:      "Product not found.",
+		method:    "PUT",
+		uri:       "/admin/products/gold/fees/withdraw",
+		header:    adminHeader,
+		bodyParam: `{"kind":"flat","flat":1}`,
+		code:      http.StatusNotFound,
+		body:      `{"error":"product(gold) is not found: sql: no rows in result set"}`,
+	}
+
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+	"github.com/hiroyuki-takayama-RAIX/core/rates"
+)
+
+func GetFXRates(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	rs, err := nb.GetFXRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, rs)
+	}
+}
+
+// GetFXRateHistory returns the rates of the pair set by staff from the newest.
+func GetFXRateHistory(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	rs, err := nb.GetFXRateHistory(strings.ToUpper(c.Param("base")), strings.ToUpper(c.Param("quote")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, rs)
+	}
+}
+
+// QuoteFX fixes the rate of ?from=USD&to=JPY for a while. the id of the quote is redeemed once by a transfer.
+// with &amount, the converted amount is quoted and the transfer must be of the amount.
+func QuoteFX(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var amount float64
+	if query := c.Query("amount"); query != "" {
+		amount, err = strconv.ParseFloat(query, 64)
+		if err != nil {
+			msg := fmt.Sprintf("got %v as invalied amount", query)
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	}
+
+	quote, err := nb.QuoteFX(strings.ToUpper(c.Query("from")), strings.ToUpper(c.Query("to")), amount)
+	if errors.Is(err, rates.ErrNoRate) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, quote)
+	}
+}
+
+// SetFXRate adds the mid rate of the pair to the history by staff. the spread is taken from it on conversions.
+func SetFXRate(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var r core.FXRate
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+	r.Base = strings.ToUpper(c.Param("base"))
+	r.Quote = strings.ToUpper(c.Param("quote"))
+
+	updated, err := nb.SetFXRate(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, updated)
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestFXRates(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.POST("/accounts", CreateAccount)
+	router.PATCH("/accounts/:id", FinancialTransaction)
+	router.GET("/fx-rates", GetFXRates)
+	router.GET("/fx-rates/:base/:quote/history", GetFXRateHistory)
+	router.GET("/fx/quote", QuoteFX)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/fx-rates/:base/:quote", SetFXRate)
+
+	var a core.Account
+	fs := make([]*fixture, 5)
+	fs[0] = &fixture{
+		name:      "Successfully set a rate.",
+		method:    "PUT",
+		uri:       "/admin/fx-rates/usd/jpy",
+		header:    adminHeader,
+		bodyParam: `{"rate":150}`,
+		code:      http.StatusOK,
+	}
+	fs[1] = &fixture{
+		name:      "Rate of the same currency.",
+		method:    "PUT",
+		uri:       "/admin/fx-rates/USD/USD",
+		header:    adminHeader,
+		bodyParam: `{"rate":1}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully get the rates.",
+		method: "GET",
+		uri:    "/fx-rates",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var rs []*core.FXRate
+			json.Unmarshal(rr.Body.Bytes(), &rs)
+			assert.Equal(t, 1, len(rs))
+			assert.Equal(t, "JPY", rs[0].Quote)
+		},
+	}
+	fs[3] = &fixture{
+		name:      "Account in an unknown currency.",
+		method:    "POST",
+		uri:       "/accounts",
+		bodyParam: `{"name":"Yen","address":"Tokyo","phone":"000","currency":"XXX"}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[4] = &fixture{
+		name:      "Successfully create an account in JPY.",
+		method:    "POST",
+		uri:       "/accounts",
+		bodyParam: `{"name":"Yen","address":"Tokyo","phone":"000","currency":"JPY"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &a)
+			assert.Equal(t, "JPY", a.Currency)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	var fq core.FXQuote
+	fs = make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:      "Deposit in another currency.",
+		method:    "PATCH",
+		uri:       fmt.Sprintf("/accounts/%v", a.Number),
+		bodyParam: `{"class":"deposit","amount":100,"currency":"USD"}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[1] = &fixture{
+		name:      "Successfully transfer converting the currency.",
+		method:    "PATCH",
+		uri:       "/accounts/1001",
+		bodyParam: fmt.Sprintf(`{"class":"transfer","amount":10,"currency":"USD","to":%q}`, a.IBAN),
+		code:      http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var as []*core.Account
+			json.Unmarshal(rr.Body.Bytes(), &as)
+			assert.Equal(t, float64(1485), as[1].Balance)
+		},
+	}
+	fs[2] = &fixture{
+		name:   "Rate not found.",
+		method: "GET",
+		uri:    "/fx/quote?from=USD&to=EUR",
+		code:   http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:   "Successfully quote a conversion.",
+		method: "GET",
+		uri:    "/fx/quote?from=usd&to=jpy&amount=10",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &fq)
+			assert.Equal(t, float64(1485), fq.Converted)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	quoted := fmt.Sprintf(`{"class":"transfer","amount":10,"to":%q,"quote":"%v"}`, a.IBAN, fq.ID)
+	fs = make([]*fixture, 3)
+	fs[0] = &fixture{
+		name:      "Successfully transfer at the quote.",
+		method:    "PATCH",
+		uri:       "/accounts/1001",
+		bodyParam: quoted,
+		code:      http.StatusOK,
+	}
+	fs[1] = &fixture{
+		name:      "Quote is already redeemed.",
+		method:    "PATCH",
+		uri:       "/accounts/1001",
+		bodyParam: quoted,
+		code:      http.StatusConflict,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully get the history of the rate.",
+		method: "GET",
+		uri:    "/fx-rates/USD/JPY/history",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var rs []*core.FXRate
+			json.Unmarshal(rr.Body.Bytes(), &rs)
+			assert.Equal(t, 1, len(rs))
+		},
+	}
+	serveFixtures(t, router, fs)
+}
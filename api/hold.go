@@ -0,0 +1,159 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+type holdRequest struct {
+	Amount    float64   `json:"amount"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Reference string    `json:"reference"`
+}
+
+func PlaceHold(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r holdRequest
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	h, err := nb.PlaceHold(id, r.Amount, r.ExpiresAt, r.Reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, h)
+	}
+}
+
+func GetHolds(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	hs, err := nb.GetHolds(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, hs)
+	}
+}
+
+// CaptureHold captures the amount in the body, or the whole hold when the body is empty.
+func CaptureHold(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, hold, ok := parseHoldParams(c)
+	if !ok {
+		return
+	}
+
+	var r holdRequest
+	if c.Request.ContentLength != 0 {
+		err = c.BindJSON(&r)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+			return
+		}
+	}
+
+	h, err := nb.CaptureHold(id, hold, r.Amount)
+	respondHold(c, id, hold, h, err)
+}
+
+func ReleaseHold(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, hold, ok := parseHoldParams(c)
+	if !ok {
+		return
+	}
+
+	h, err := nb.ReleaseHold(id, hold)
+	respondHold(c, id, hold, h, err)
+}
+
+func parseHoldParams(c *gin.Context) (int, int64, bool) {
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+
+	param = c.Param("hold")
+	hold, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied hold id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+	return id, hold, true
+}
+
+func respondHold(c *gin.Context, id int, hold int64, h *core.Hold, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("hold(ID: %v) of account(ID: %v) doesnt exist", hold, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrHoldNotActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	} else if errors.Is(err, core.ErrLimitExceeded) {
+		respondLimitExceeded(c, err)
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, h)
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestHolds(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+	credential, err := nb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := map[string]string{"X-Account-Token": credential.Token}
+
+	router := gin.Default()
+	router.POST("/accounts/:id/holds", AccountHolder, PlaceHold)
+	router.POST("/accounts/:id/holds/:hold/capture", AccountHolder, CaptureHold)
+	router.POST("/accounts/:id/holds/:hold/release", AccountHolder, ReleaseHold)
+	router.GET("/accounts/:id/balance", GetBalance)
+
+	var h core.Hold
+	fs := make([]*fixture, 3)
+	fs[0] = &fixture{
+		name:      "Successfully place a hold.",
+		method:    "POST",
+		uri:       "/accounts/1001/holds",
+		header:    holder,
+		bodyParam: `{"amount":70,"reference":"merchant-1"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &h)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "The hold is not available.",
+		method: "GET",
+		uri:    "/accounts/1001/balance",
+		code:   http.StatusOK,
+		body:   `{"id":1001,"balance":100,"available":30}`,
+	}
+	fs[2] = &fixture{
+		name:      "Amount is grater than the available balance.",
+		method:    "POST",
+		uri:       "/accounts/1001/holds",
+		header:    holder,
+		bodyParam: `{"amount":40}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"amount is grater than the available balance. your amount is 40, but the available balance is 30"}`,
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 6)
+	// only the holder can place and settle the holds of the account.
+	fs[0] = &fixture{
+		name:   "Capture without the credential.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/1001/holds/%v/capture", h.ID),
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+	fs[1] = &fixture{
+		name:   "Capture by the credential of another account.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/3003/holds/%v/capture", h.ID),
+		header: holder,
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 3003): invalid credential"}`,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully capture the whole hold without a body.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/1001/holds/%v/capture", h.ID),
+		header: holder,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var captured core.Hold
+			json.Unmarshal(rr.Body.Bytes(), &captured)
+			assert.Equal(t, core.HoldCaptured, captured.Status)
+			assert.Equal(t, float64(70), captured.Captured)
+		},
+	}
+	fs[3] = &fixture{
+		name:   "The captured hold is withdrawn.",
+		method: "GET",
+		uri:    "/accounts/1001/balance",
+		code:   http.StatusOK,
+		body:   `{"id":1001,"balance":30,"available":30}`,
+	}
+	fs[4] = &fixture{
+		name:   "Captured hold cannot be released.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/1001/holds/%v/release", h.ID),
+		header: holder,
+		code:   http.StatusConflict,
+		body:   fmt.Sprintf(`{"error":"hold(ID: %v) is already captured: hold is not active"}`, h.ID),
+	}
+	fs[5] = &fixture{
+		name:   "Hold not found.",
+		method: "POST",
+		uri:    "/accounts/1001/holds/404/release",
+		header: holder,
+		code:   http.StatusNotFound,
+		body:   `{"error":"hold(ID: 404) of account(ID: 1001) doesnt exist"}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// ResolveAccountID lets the routes under /accounts/:id and /customers/:id take the identifier by core.IBAN() in place of the id.
+// the identifier is checked and replaced with the id before the handler, so a mistyped one never reaches the db.
+// the internal accounts of the bank are rejected here, so they are never reached by the routes of customers.
+func ResolveAccountID(c *gin.Context) {
+	path := c.FullPath()
+	if !strings.Contains(path, "/accounts/:id") && !strings.Contains(path, "/customers/:id") {
+		c.Next()
+		return
+	}
+
+	for i, p := range c.Params {
+		if p.Key != "id" {
+			continue
+		}
+		num, err := core.ParseAccountID(p.Value)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Params[i].Value = strconv.Itoa(num)
+		break
+	}
+	c.Next()
+}
+
+// respondInvalidRequest tells what is wrong with the account identifier in the body, which is checked when it is decoded.
+func respondInvalidRequest(c *gin.Context, err error) {
+	if errors.Is(err, core.ErrInvalidIBAN) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+	}
+}
+
+// isID reports whether the account in a request body is the internal id, which is deprecated for the identifier
+// by core.IBAN() because a mistyped id is another account.
+func isID(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) > 0 && raw[0] != '"' && string(raw) != "null"
+}
+
+// requireIdentifier rejects the id of the account in field, which new requests must give by the identifier.
+func requireIdentifier(field string, raw json.RawMessage) error {
+	if isID(raw) {
+		return fmt.Errorf("%v must be the account identifier like %v. the id %v is deprecated", field, core.IBAN(1001), string(raw))
+	}
+	return nil
+}
+
+// idSunset is when the id of the account stops working in the requests which still take it.
+var idSunset = time.Date(2027, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+// deprecateID tells the client that the id of the account in field still works but is deprecated, and when it stops working.
+// from idSunset, the id is rejected like requireIdentifier().
+func deprecateID(c *gin.Context, field string, raw json.RawMessage) error {
+	if !isID(raw) {
+		return nil
+	}
+	if !time.Now().Before(idSunset) {
+		return requireIdentifier(field, raw)
+	}
+	c.Header("Deprecation", "true")
+	c.Header("Sunset", idSunset.Format(http.TimeFormat))
+	c.Header("Warning", fmt.Sprintf(`299 - "the id in %v is deprecated and rejected from %v. use the account identifier like %v"`,
+		field, idSunset.Format("2006-01-02"), core.IBAN(1001)))
+	return nil
+}
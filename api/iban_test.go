@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestResolveAccountID(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.Use(ResolveAccountID)
+	router.GET("/accounts/:id", GetAccount)
+	router.PATCH("/accounts/:id", FinancialTransaction)
+	router.GET("/customers/:id", GetPortfolio)
+
+	fs := make([]*fixture, 8)
+	fs[0] = &fixture{
+		name: "Successfully get the account by the identifier.",
+		uri:  "/accounts/JP72NETB0000001001",
+		code: http.StatusOK,
+		body: `{"name":"John","address":"Los Angeles, California","phone":"(213) 444 0147","id":1001,"iban":"JP72NETB0000001001","balance":100,"currency":"USD"}`,
+	}
+	fs[1] = &fixture{
+		name: "Wrong check digits.",
+		uri:  "/accounts/JP72NETB0000001010",
+		code: http.StatusBadRequest,
+		body: `{"error":"check digits of JP72NETB0000001010 are wrong: invalid account identifier"}`,
+	}
+	fs[2] = &fixture{
+		name:      "Successfully transfer to the identifier.",
+		method:    "PATCH",
+		uri:       "/accounts/JP72NETB0000001001",
+		bodyParam: `{"class":"transfer","amount":20,"to":"JP47NETB0000003003"}`,
+		code:      http.StatusOK,
+	}
+	fs[3] = &fixture{
+		name:      "Wrong check digits of the reciever.",
+		method:    "PATCH",
+		uri:       "/accounts/1001",
+		bodyParam: `{"class":"transfer","amount":20,"to":"JP47NETB0000003030"}`,
+		code:      http.StatusBadRequest,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), "check digits of JP47NETB0000003030 are wrong")
+		},
+	}
+	// the customer of an account is found by the identifier as well.
+	fs[4] = &fixture{
+		name: "Successfully get the customer by the identifier.",
+		uri:  "/customers/JP72NETB0000001001",
+		code: http.StatusOK,
+	}
+	fs[5] = &fixture{
+		name: "Wrong check digits of the customer.",
+		uri:  "/customers/JP72NETB0000001010",
+		code: http.StatusBadRequest,
+	}
+	// the id of the account is INT in the db, so a larger number is rejected before the db.
+	fs[6] = &fixture{
+		name: "Identifier beyond the largest account.",
+		uri:  "/accounts/" + core.IBAN(math.MaxInt32+1),
+		code: http.StatusBadRequest,
+		body: fmt.Sprintf(`{"error":"account number of %v is more than 2147483647: invalid account identifier"}`, core.IBAN(math.MaxInt32+1)),
+	}
+	fs[7] = &fixture{
+		name: "Id beyond the largest account.",
+		uri:  "/accounts/2147483648",
+		code: http.StatusBadRequest,
+		body: `{"error":"got 2147483648 as invalied id"}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+	"github.com/hiroyuki-takayama-RAIX/core/iso20022"
+)
+
+// ImportPain001 sends the credit transfers of the pain.001 message of the body, and responds the pain.002 status report.
+// nothing is sent with ?dry-run=true, and ?mode is the mode of the batch. a rejected message is 400 with the report.
+func ImportPain001(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+	dryRun := c.Query("dry-run") == "true"
+
+	report, err := nb.ImportPain001(id, data, c.Query("mode"), dryRun)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	bs, err := report.Encode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else if report.Group.Status == iso20022.StatusRejected {
+		c.Data(http.StatusBadRequest, "application/xml; charset=utf-8", bs)
+	} else {
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", bs)
+	}
+}
+
+// StatementCamt053 downloads the statement of the account on ?date (YYYY-MM-DD, today by default) as camt.053.
+func StatementCamt053(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	date, ok := parseDateQuery(c, "date")
+	if !ok {
+		return
+	}
+
+	bs, err := nb.StatementCamt053(id, date)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		filename := fmt.Sprintf("camt053-%v-%v.xml", id, date.Format("20060102"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", bs)
+	}
+}
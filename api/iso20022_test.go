@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestISO20022(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+	credential, err := nb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := map[string]string{"X-Account-Token": credential.Token}
+
+	router := gin.Default()
+	router.POST("/accounts/:id/pain001", AccountHolder, ImportPain001)
+	router.GET("/accounts/:id/camt053", AccountHolder, StatementCamt053)
+
+	data, err := os.ReadFile("../core/iso20022/testdata/pain001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := make([]*fixture, 10)
+	fs[0] = &fixture{
+		name:      "Successfully validate the pain.001 without booking it.",
+		method:    "POST",
+		uri:       "/accounts/1001/pain001?dry-run=true",
+		header:    holder,
+		bodyParam: string(data),
+		code:      http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), "<GrpSts>ACTC</GrpSts>")
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Successfully import the pain.001.",
+		method:    "POST",
+		uri:       "/accounts/1001/pain001",
+		header:    holder,
+		bodyParam: string(data),
+		code:      http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), "<GrpSts>ACSC</GrpSts>")
+		},
+	}
+	fs[2] = &fixture{
+		name:      "Number of transactions is wrong.",
+		method:    "POST",
+		uri:       "/accounts/1001/pain001",
+		header:    holder,
+		bodyParam: strings.Replace(string(data), "<NbOfTxs>2</NbOfTxs>", "<NbOfTxs>3</NbOfTxs>", 1),
+		code:      http.StatusBadRequest,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), "<Cd>AM18</Cd>")
+		},
+	}
+	fs[3] = &fixture{
+		name:      "Credential of another account.",
+		method:    "POST",
+		uri:       "/accounts/404/pain001",
+		header:    holder,
+		bodyParam: string(data),
+		code:      http.StatusUnauthorized,
+		body:      `{"error":"the token is not the credential of account(ID: 404): invalid credential"}`,
+	}
+	fs[4] = &fixture{
+		name:   "Without pain.001.",
+		method: "POST",
+		uri:    "/accounts/1001/pain001",
+		header: holder,
+		code:   http.StatusBadRequest,
+	}
+	fs[5] = &fixture{
+		name:   "Successfully get the camt.053.",
+		method: "GET",
+		uri:    "/accounts/1001/camt053",
+		header: holder,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), `<Amt Ccy="USD">59.50</Amt>`)
+		},
+	}
+	fs[6] = &fixture{
+		name:   "Invalid date.",
+		method: "GET",
+		uri:    "/accounts/1001/camt053?date=2023/10/31",
+		header: holder,
+		code:   http.StatusBadRequest,
+	}
+	fs[7] = &fixture{
+		name:   "Credential of another account for the camt.053.",
+		method: "GET",
+		uri:    "/accounts/404/camt053",
+		header: holder,
+		code:   http.StatusUnauthorized,
+	}
+	// the statements and the payments of an account are only for its holder.
+	fs[8] = &fixture{
+		name:      "Import the pain.001 without the credential.",
+		method:    "POST",
+		uri:       "/accounts/1001/pain001",
+		bodyParam: string(data),
+		code:      http.StatusUnauthorized,
+		body:      `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+	fs[9] = &fixture{
+		name:   "Get the camt.053 without the credential.",
+		method: "GET",
+		uri:    "/accounts/1001/camt053",
+		code:   http.StatusUnauthorized,
+	}
+
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// respondLimitExceeded responds 422 with the code of the exceeded limit, e.g. daily_limit_exceeded.
+func respondLimitExceeded(c *gin.Context, err error) {
+	var le *core.LimitError
+	if !errors.As(err, &le) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "limit_exceeded"})
+		return
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": le.Error(), "code": le.Code(), "remaining": le.Remaining})
+}
+
+func GetLimits(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ls, err := nb.GetLimits(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, ls)
+	}
+}
+
+func SetDefaultLimits(c *gin.Context) {
+	setLimitRule(c, core.LimitDefault, "")
+}
+
+func SetTierLimits(c *gin.Context) {
+	setLimitRule(c, core.LimitTier, c.Param("tier"))
+}
+
+func SetAccountLimits(c *gin.Context) {
+	setLimitRule(c, core.LimitAccount, c.Param("id"))
+}
+
+func setLimitRule(c *gin.Context, scope string, key string) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var r core.LimitRule
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	rule, err := nb.SetLimitRule(scope, key, &r)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", key)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, rule)
+	}
+}
+
+func SetCustomerTier(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var r struct {
+		Tier string `json:"tier"`
+	}
+	err = c.BindJSON(&r)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	err = nb.SetCustomerTier(id, r.Tier)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("customer(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, gin.H{"id": id, "tier": r.Tier})
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestLimits(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.PATCH("/accounts/:id/balance", FinancialTransaction)
+	router.GET("/accounts/:id/limits", GetLimits)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/limits", SetDefaultLimits)
+	admin.PUT("/tiers/:tier/limits", SetTierLimits)
+	admin.PUT("/accounts/:id/limits", SetAccountLimits)
+	admin.PUT("/customers/:id/tier", SetCustomerTier)
+
+	fs := make([]*fixture, 8)
+	fs[0] = &fixture{
+		name:      "Successfully set the default limits.",
+		method:    "PUT",
+		uri:       "/admin/limits",
+		header:    adminHeader,
+		bodyParam: `{"daily":50}`,
+		code:      http.StatusOK,
+	}
+	fs[1] = &fixture{
+		name:      "Successfully set the limits of a tier.",
+		method:    "PUT",
+		uri:       "/admin/tiers/gold/limits",
+		header:    adminHeader,
+		bodyParam: `{"per_transaction":40}`,
+		code:      http.StatusOK,
+	}
+	fs[2] = &fixture{
+		name:      "Successfully set the tier of a customer.",
+		method:    "PUT",
+		uri:       "/admin/customers/1001/tier",
+		header:    adminHeader,
+		bodyParam: `{"tier":"gold"}`,
+		code:      http.StatusOK,
+		body:      `{"id":1001,"tier":"gold"}`,
+	}
+	fs[3] = &fixture{
+		name:      "Successfully withdraw within the limits.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"withdraw","amount":30}`,
+		code:      http.StatusOK,
+	}
+	fs[4] = &fixture{
+		name:      "Daily limit is exceeded.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"transfer","amount":30,"from":1001,"to":3003}`,
+		code:      http.StatusUnprocessableEntity,
+		body:      `{"error":"daily limit is exceeded. the limit is 50 and 20 remains, but the amount is 30","code":"daily_limit_exceeded","remaining":20}`,
+	}
+	fs[5] = &fixture{
+		name:   "Successfully get the limits.",
+		method: "GET",
+		uri:    "/accounts/1001/limits",
+		code:   http.StatusOK,
+		body: `[
+			{"kind":"per_transaction","currency":"USD","limit":40,"source":"tier","used":0,"remaining":40},
+			{"kind":"daily","currency":"USD","limit":50,"source":"default","used":30,"remaining":20}
+		]`,
+	}
+	fs[6] = &fixture{
+		name:      "Account not found.",
+		method:    "PUT",
+		uri:       "/admin/accounts/404/limits",
+		header:    adminHeader,
+		bodyParam: `{"daily":50}`,
+		code:      http.StatusNotFound,
+	}
+	fs[7] = &fixture{
+		name:      "Limit is less than zero.",
+		method:    "PUT",
+		uri:       "/admin/limits",
+		header:    adminHeader,
+		bodyParam: `{"daily":-1}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"limit is less than zero. your input is -1"}`,
+	}
+
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// DisburseLoan lends money to an account by staff.
+func DisburseLoan(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	var l core.Loan
+	err = c.BindJSON(&l)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	disbursed, err := nb.DisburseLoan(l.Account, l.Principal, l.Rate, l.TermMonths, l.Method)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", l.Account)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, disbursed)
+	}
+}
+
+func GetLoans(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ls, err := nb.GetLoans(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, ls)
+	}
+}
+
+func GetLoan(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	l, err := nb.GetLoan(id)
+	respondLoan(c, id, http.StatusOK, l, err)
+}
+
+func GetLoanSchedule(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	is, err := nb.GetLoanSchedule(id)
+	respondLoan(c, id, http.StatusOK, is, err)
+}
+
+func GetLoanStatement(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	s, err := nb.GetLoanStatement(id)
+	respondLoan(c, id, http.StatusOK, s, err)
+}
+
+// QuotePayoff returns the amount which pays off the loan today.
+func QuotePayoff(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	q, err := nb.QuotePayoff(id, time.Now())
+	respondLoan(c, id, http.StatusOK, q, err)
+}
+
+// PayOffLoan collects the payoff amount of today from the account and closes the loan.
+func PayOffLoan(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, ok := parseLoanID(c)
+	if !ok {
+		return
+	}
+
+	p, err := nb.PayOffLoan(id)
+	respondLoan(c, id, http.StatusCreated, p, err)
+}
+
+func parseLoanID(c *gin.Context) (int64, bool) {
+	param := c.Param("id")
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied loan id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondLoan(c *gin.Context, id int64, code int, v any, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("loan(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if errors.Is(err, core.ErrLoanNotActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	} else if errors.Is(err, core.ErrInsufficientFunds) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(code, v)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestLoans(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.GET("/customers/:id", GetPortfolio)
+	router.GET("/accounts/:id/loans", GetLoans)
+	router.GET("/loans/:id", GetLoan)
+	router.GET("/loans/:id/schedule", GetLoanSchedule)
+	router.GET("/loans/:id/statement", GetLoanStatement)
+	router.GET("/loans/:id/payoff", QuotePayoff)
+	router.POST("/loans/:id/payoff", PayOffLoan)
+	admin := router.Group("/admin", AdminOnly)
+	admin.POST("/loans", DisburseLoan)
+
+	var l core.Loan
+	fs := make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:      "Successfully disburse a loan.",
+		method:    "POST",
+		uri:       "/admin/loans",
+		header:    adminHeader,
+		bodyParam: `{"account":1001,"principal":1200,"rate":0.12,"term_months":12}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &l)
+			assert.Equal(t, core.LoanAnnuity, l.Method)
+			assert.Equal(t, core.LoanActive, l.Status)
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Account not found.",
+		method:    "POST",
+		uri:       "/admin/loans",
+		header:    adminHeader,
+		bodyParam: `{"account":9999,"principal":1200,"rate":0.12,"term_months":12}`,
+		code:      http.StatusNotFound,
+	}
+	fs[2] = &fixture{
+		name:      "Invalid term.",
+		method:    "POST",
+		uri:       "/admin/loans",
+		header:    adminHeader,
+		bodyParam: `{"account":1001,"principal":1200,"rate":0.12,"term_months":0}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"term of loan must be between 1 and 360 months. your input is 0"}`,
+	}
+	fs[3] = &fixture{
+		name:   "Successfully get the loans of the account.",
+		method: "GET",
+		uri:    "/accounts/1001/loans",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var ls []*core.Loan
+			json.Unmarshal(rr.Body.Bytes(), &ls)
+			assert.Equal(t, 1, len(ls))
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 7)
+	fs[0] = &fixture{
+		name:   "Successfully get the schedule.",
+		method: "GET",
+		uri:    fmt.Sprintf("/loans/%v/schedule", l.ID),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var is []*core.Installment
+			json.Unmarshal(rr.Body.Bytes(), &is)
+			assert.Equal(t, 12, len(is))
+			assert.Equal(t, 106.62, is[0].Amount)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "The loan is in the portfolio as a debt.",
+		method: "GET",
+		uri:    "/customers/1001",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var p core.Portfolio
+			json.Unmarshal(rr.Body.Bytes(), &p)
+			assert.Equal(t, float64(1300), p.Total)
+			assert.Equal(t, float64(1200), p.Debt)
+		},
+	}
+	fs[2] = &fixture{
+		name:   "Successfully quote the payoff.",
+		method: "GET",
+		uri:    fmt.Sprintf("/loans/%v/payoff", l.ID),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var q core.PayoffQuote
+			json.Unmarshal(rr.Body.Bytes(), &q)
+			assert.Equal(t, float64(1200), q.Total)
+		},
+	}
+	fs[3] = &fixture{
+		name:   "Successfully pay off the loan.",
+		method: "POST",
+		uri:    fmt.Sprintf("/loans/%v/payoff", l.ID),
+		code:   http.StatusCreated,
+	}
+	fs[4] = &fixture{
+		name:   "Loan is already paid off.",
+		method: "POST",
+		uri:    fmt.Sprintf("/loans/%v/payoff", l.ID),
+		code:   http.StatusConflict,
+	}
+	fs[5] = &fixture{
+		name:   "Successfully get the statement.",
+		method: "GET",
+		uri:    fmt.Sprintf("/loans/%v/statement", l.ID),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var s core.LoanStatement
+			json.Unmarshal(rr.Body.Bytes(), &s)
+			assert.Equal(t, core.LoanPaidOff, s.Loan.Status)
+			assert.Equal(t, 1, len(s.Payments))
+			assert.Equal(t, float64(1200), s.PaidPrincipal)
+		},
+	}
+	fs[6] = &fixture{
+		name:   "Loan not found.",
+		method: "GET",
+		uri:    "/loans/0",
+		code:   http.StatusNotFound,
+		body:   `{"error":"loan(ID: 0) doesnt exist"}`,
+	}
+	serveFixtures(t, router, fs)
+}
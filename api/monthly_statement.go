@@ -0,0 +1,118 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// GetMonthlyStatements lists the archived monthly statements of the account from the newest month.
+func GetMonthlyStatements(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	mss, err := nb.GetMonthlyStatements(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, mss)
+	}
+}
+
+// GetMonthlyStatement downloads the document of the statement. the hash and the signature are in the headers.
+func GetMonthlyStatement(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	param = c.Param("statement")
+	statement, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied statement id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	ms, err := nb.GetMonthlyStatement(id, statement)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("statement(ID: %v) of account(ID: %v) doesnt exist", statement, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		filename := fmt.Sprintf("statement-%v-%v.html", id, ms.Month)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Header("X-Content-SHA256", ms.ContentHash)
+		c.Header("X-Signature", ms.Signature)
+		c.Data(http.StatusOK, core.StatementContentType, ms.Content)
+	}
+}
+
+// VerifyStatement confirms that the document in the body is a statement issued by the bank and not altered.
+func VerifyStatement(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+
+	v, err := nb.VerifyStatement(data)
+	if errors.Is(err, core.ErrNoSigningKey) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, v)
+	}
+}
+
+// GetStatementPublicKey returns the ed25519 public key which verifies the signatures of statements without the bank.
+func GetStatementPublicKey(c *gin.Context) {
+	key, err := core.StatementPublicKey()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"algorithm": "ed25519", "public_key": base64.StdEncoding.EncodeToString(key)})
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestMonthlyStatements(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.GET("/accounts/:id/statements/mt940", ExportMT940)
+	router.GET("/accounts/:id/statements", GetMonthlyStatements)
+	router.GET("/accounts/:id/statements/:statement", GetMonthlyStatement)
+	router.POST("/statements/verify", VerifyStatement)
+	router.GET("/statements/public-key", GetStatementPublicKey)
+
+	fs := make([]*fixture, 1)
+	fs[0] = &fixture{
+		name:   "Signing key is not configured.",
+		method: "GET",
+		uri:    "/statements/public-key",
+		code:   http.StatusServiceUnavailable,
+	}
+	serveFixtures(t, router, fs)
+
+	os.Setenv("STATEMENT_SIGNING_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	defer os.Unsetenv("STATEMENT_SIGNING_KEY")
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+	now := time.Now().UTC()
+	_, err = nb.GenerateMonthlyStatements(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0))
+	assert.NoError(t, err)
+
+	var ms core.MonthlyStatement
+	fs = make([]*fixture, 1)
+	fs[0] = &fixture{
+		name:   "Successfully get the statements.",
+		method: "GET",
+		uri:    "/accounts/1001/statements",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var mss []*core.MonthlyStatement
+			err := json.Unmarshal(rr.Body.Bytes(), &mss)
+			assert.NoError(t, err)
+			if assert.Equal(t, 1, len(mss)) {
+				ms = *mss[0]
+			}
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	var document string
+	fs = make([]*fixture, 1)
+	fs[0] = &fixture{
+		name:   "Successfully download the statement.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/" + fmt.Sprint(ms.ID),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Equal(t, core.StatementContentType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, ms.ContentHash, rr.Header().Get("X-Content-SHA256"))
+			document = rr.Body.String()
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	verified := func(valid bool) func(t *testing.T, rr *httptest.ResponseRecorder) {
+		return func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var v core.StatementVerification
+			err := json.Unmarshal(rr.Body.Bytes(), &v)
+			assert.NoError(t, err)
+			assert.Equal(t, valid, v.Valid)
+		}
+	}
+	fs = make([]*fixture, 7)
+	fs[0] = &fixture{
+		name:      "Successfully verify the statement.",
+		method:    "POST",
+		uri:       "/statements/verify",
+		bodyParam: document,
+		code:      http.StatusOK,
+		check:     verified(true),
+	}
+	fs[1] = &fixture{
+		name:      "Tampered statement is not valid.",
+		method:    "POST",
+		uri:       "/statements/verify",
+		bodyParam: document + " ",
+		code:      http.StatusOK,
+		check:     verified(false),
+	}
+	fs[2] = &fixture{
+		name:   "Successfully get the public key.",
+		method: "GET",
+		uri:    "/statements/public-key",
+		code:   http.StatusOK,
+	}
+	fs[3] = &fixture{
+		name:   "Successfully export the MT940.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/mt940",
+		code:   http.StatusOK,
+	}
+	fs[4] = &fixture{
+		name:   "Statement of another account.",
+		method: "GET",
+		uri:    "/accounts/3003/statements/" + fmt.Sprint(ms.ID),
+		code:   http.StatusNotFound,
+	}
+	fs[5] = &fixture{
+		name:   "Invalid statement ID.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/abc",
+		code:   http.StatusBadRequest,
+	}
+	fs[6] = &fixture{
+		name:   "Account not found.",
+		method: "GET",
+		uri:    "/accounts/404/statements",
+		code:   http.StatusNotFound,
+	}
+	serveFixtures(t, router, fs)
+}
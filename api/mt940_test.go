@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestExportMT940(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+	credential, err := nb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := map[string]string{"X-Account-Token": credential.Token}
+
+	router := gin.Default()
+	router.GET("/accounts/:id/statements/mt940", AccountHolder, ExportMT940)
+
+	fs := make([]*fixture, 5)
+	fs[0] = &fixture{
+		name:   "Successfully export the MT940.",
+		uri:    "/accounts/1001/statements/mt940",
+		header: holder,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.True(t, strings.HasPrefix(rr.Body.String(), ":20:"))
+			assert.True(t, strings.HasSuffix(rr.Body.String(), ":62F:C"+time.Now().UTC().Format("060102")+"USD100,00\r\n-\r\n"))
+		},
+	}
+	fs[1] = &fixture{
+		name:   "From is after to.",
+		uri:    "/accounts/1001/statements/mt940?from=2023-11-01&to=2023-10-31",
+		header: holder,
+		code:   http.StatusBadRequest,
+		body:   `{"error":"from 2023-11-01 is after to 2023-10-31"}`,
+	}
+	fs[2] = &fixture{
+		name:   "Invalid date.",
+		uri:    "/accounts/1001/statements/mt940?to=20231031",
+		header: holder,
+		code:   http.StatusBadRequest,
+	}
+	fs[3] = &fixture{
+		name:   "Credential of another account.",
+		uri:    "/accounts/404/statements/mt940",
+		header: holder,
+		code:   http.StatusUnauthorized,
+	}
+	fs[4] = &fixture{
+		name: "Without the credential.",
+		uri:  "/accounts/1001/statements/mt940",
+		code: http.StatusUnauthorized,
+		body: `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+
+	serveFixtures(t, router, fs)
+}
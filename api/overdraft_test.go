@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestOverdraft(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.GET("/accounts/:id/balance", GetBalance)
+	router.PATCH("/accounts/:id/balance", FinancialTransaction)
+	router.GET("/accounts/:id/overdraft", GetOverdraft)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/accounts/:id/overdraft", SetOverdraft)
+
+	fs := make([]*fixture, 7)
+	fs[0] = &fixture{
+		name:   "Successfully get the overdraft.",
+		method: "GET",
+		uri:    "/accounts/1001/overdraft",
+		code:   http.StatusOK,
+		body:   `{"account":1001,"limit":0,"rate":0}`,
+	}
+	fs[1] = &fixture{
+		name:      "Successfully set the overdraft.",
+		method:    "PUT",
+		uri:       "/admin/accounts/1001/overdraft",
+		header:    adminHeader,
+		bodyParam: `{"limit":50,"rate":0.1}`,
+		code:      http.StatusOK,
+	}
+	fs[2] = &fixture{
+		name:      "Successfully withdraw within the overdraft.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"withdraw","amount":120}`,
+		code:      http.StatusOK,
+	}
+	fs[3] = &fixture{
+		name:   "The overdraft is available.",
+		method: "GET",
+		uri:    "/accounts/1001/balance",
+		code:   http.StatusOK,
+		body:   `{"id":1001,"balance":-20,"available":30}`,
+	}
+	fs[4] = &fixture{
+		name:      "Successfully deposit to the overdrawn account.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"deposit","amount":20}`,
+		code:      http.StatusOK,
+	}
+	fs[5] = &fixture{
+		name:      "Account not found.",
+		method:    "PUT",
+		uri:       "/admin/accounts/404/overdraft",
+		header:    adminHeader,
+		bodyParam: `{"limit":50}`,
+		code:      http.StatusNotFound,
+		body:      `{"error":"account(ID: 404) doesnt exist"}`,
+	}
+	fs[6] = &fixture{
+		name:      "Invalid rate.",
+		method:    "PUT",
+		uri:       "/admin/accounts/1001/overdraft",
+		header:    adminHeader,
+		bodyParam: `{"limit":50,"rate":2}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"overdraft rate must be between 0 and 1. your input is 2"}`,
+	}
+
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestProducts(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.POST("/accounts", CreateAccount)
+	router.GET("/accounts/:id/interest", GetInterest)
+	router.GET("/products", GetProducts)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/products/:product", SetProduct)
+
+	var a core.Account
+	fs := make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:   "Successfully get the products.",
+		method: "GET",
+		uri:    "/products",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var ps []*core.Product
+			json.Unmarshal(rr.Body.Bytes(), &ps)
+			codes := []string{}
+			for _, p := range ps {
+				codes = append(codes, p.Code)
+			}
+			assert.Contains(t, codes, core.ProductSavings)
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Successfully open a savings account.",
+		method:    "POST",
+		uri:       "/accounts",
+		bodyParam: `{"name":"Saver","address":"Tokyo","phone":"000","product":"savings"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &a)
+		},
+	}
+	fs[2] = &fixture{
+		name:      "Product not found.",
+		method:    "POST",
+		uri:       "/accounts",
+		bodyParam: `{"name":"Saver","address":"Tokyo","phone":"000","product":"gold"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"product(gold) is not found: sql: no rows in result set"}`,
+	}
+	fs[3] = &fixture{
+		name:      "Invalid interest rate.",
+		method:    "PUT",
+		uri:       "/admin/products/savings",
+		header:    adminHeader,
+		bodyParam: `{"name":"Savings account","interest_rate":2}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"interest rate must be between 0 and 1. your input is 2"}`,
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 1)
+	fs[0] = &fixture{
+		name:   "Successfully get the interest of the savings account.",
+		method: "GET",
+		uri:    fmt.Sprintf("/accounts/%v/interest", a.Number),
+		code:   http.StatusOK,
+		body:   fmt.Sprintf(`{"account":%v,"product":"savings","rate":0.001,"accrued":0}`, a.Number),
+	}
+	serveFixtures(t, router, fs)
+}
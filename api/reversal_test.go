@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestReverseTransfer(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+	os.Setenv("REVERSAL_APPROVAL_THRESHOLD", "30")
+	defer os.Unsetenv("REVERSAL_APPROVAL_THRESHOLD")
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+	sender, err := nb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reciever, err := nb.IssueAccountCredential(3003)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holder := map[string]string{"X-Account-Token": sender.Token}
+
+	router := gin.Default()
+	router.PATCH("/accounts/:id/balance", FinancialTransaction)
+	router.GET("/accounts/:id/transfers", GetTransfers)
+	router.GET("/transfers/:id", GetTransfer)
+	router.POST("/transfers/:id/reversals", TransferSender, ReverseTransfer)
+	admin := router.Group("/admin", AdminOnly)
+	admin.GET("/reversals", GetPendingReversals)
+	admin.POST("/reversals/:id/approve", ApproveReversal)
+	admin.POST("/reversals/:id/reject", RejectReversal)
+
+	var id int64
+	fs := make([]*fixture, 2)
+	fs[0] = &fixture{
+		name:      "Successfully transfer.",
+		method:    "PATCH",
+		uri:       "/accounts/1001/balance",
+		bodyParam: `{"class":"transfer","amount":60,"from":1001,"to":3003}`,
+		code:      http.StatusOK,
+	}
+	fs[1] = &fixture{
+		name:   "Successfully get the transfers.",
+		method: "GET",
+		uri:    "/accounts/1001/transfers",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var ts []*core.TransferRecord
+			json.Unmarshal(rr.Body.Bytes(), &ts)
+			if assert.Equal(t, 1, len(ts)) {
+				id = ts[0].ID
+			}
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	var r core.Reversal
+	fs = make([]*fixture, 7)
+	// only the sender can ask for the money back.
+	fs[0] = &fixture{
+		name:   "Without the credential.",
+		method: "POST",
+		uri:    fmt.Sprintf("/transfers/%v/reversals", id),
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+	fs[1] = &fixture{
+		name:   "Credential of the reciever.",
+		method: "POST",
+		uri:    fmt.Sprintf("/transfers/%v/reversals", id),
+		header: map[string]string{"X-Account-Token": reciever.Token},
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 1001): invalid credential"}`,
+	}
+	fs[2] = &fixture{
+		name:   "Transfer not found.",
+		method: "POST",
+		uri:    "/transfers/404/reversals",
+		header: holder,
+		code:   http.StatusNotFound,
+		body:   `{"error":"transfer(ID: 404) doesnt exist"}`,
+	}
+	// a small refund is done at once.
+	fs[3] = &fixture{
+		name:      "Successfully refund a part of the transfer.",
+		method:    "POST",
+		uri:       fmt.Sprintf("/transfers/%v/reversals", id),
+		header:    holder,
+		bodyParam: `{"amount":10,"reason":"overcharged"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var completed core.Reversal
+			json.Unmarshal(rr.Body.Bytes(), &completed)
+			assert.Equal(t, core.ReversalCompleted, completed.Status)
+		},
+	}
+	// the rest is above the threshold and waits for approval.
+	fs[4] = &fixture{
+		name:   "Reversal above the threshold waits for approval.",
+		method: "POST",
+		uri:    fmt.Sprintf("/transfers/%v/reversals", id),
+		header: holder,
+		code:   http.StatusAccepted,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &r)
+			assert.Equal(t, core.ReversalPending, r.Status)
+			assert.Equal(t, float64(50), r.Amount)
+		},
+	}
+	fs[5] = &fixture{
+		name:   "Transfer is already reversed.",
+		method: "POST",
+		uri:    fmt.Sprintf("/transfers/%v/reversals", id),
+		header: holder,
+		code:   http.StatusBadRequest,
+		body:   fmt.Sprintf(`{"error":"transfer(ID: %v) is already reversed"}`, id),
+	}
+	fs[6] = &fixture{
+		name:   "Successfully get the pending reversals.",
+		method: "GET",
+		uri:    "/admin/reversals",
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var rs []*core.Reversal
+			json.Unmarshal(rr.Body.Bytes(), &rs)
+			assert.Equal(t, 1, len(rs))
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:   "Successfully approve the reversal.",
+		method: "POST",
+		uri:    fmt.Sprintf("/admin/reversals/%v/approve", r.ID),
+		header: adminHeader,
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var approved core.Reversal
+			json.Unmarshal(rr.Body.Bytes(), &approved)
+			assert.Equal(t, core.ReversalCompleted, approved.Status)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Completed reversal cannot be rejected.",
+		method: "POST",
+		uri:    fmt.Sprintf("/admin/reversals/%v/reject", r.ID),
+		header: adminHeader,
+		code:   http.StatusConflict,
+		body:   fmt.Sprintf(`{"error":"reversal(ID: %v) is already completed: reversal is not pending"}`, r.ID),
+	}
+	fs[2] = &fixture{
+		name:   "Successfully get the reversed transfer.",
+		method: "GET",
+		uri:    fmt.Sprintf("/transfers/%v", id),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var tr core.TransferRecord
+			json.Unmarshal(rr.Body.Bytes(), &tr)
+			assert.Equal(t, float64(60), tr.Refunded)
+			assert.Equal(t, 2, len(tr.Reversals))
+		},
+	}
+	fs[3] = &fixture{
+		name:   "Transfer not found.",
+		method: "GET",
+		uri:    "/transfers/404",
+		code:   http.StatusNotFound,
+		body:   `{"error":"transfer(ID: 404) doesnt exist"}`,
+	}
+	serveFixtures(t, router, fs)
+}
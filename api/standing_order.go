@@ -0,0 +1,161 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func CreateStandingOrder(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var o core.StandingOrder
+	err = c.ShouldBindBodyWith(&o, binding.JSON)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	var raw struct {
+		To json.RawMessage `json:"to"`
+	}
+	err = c.ShouldBindBodyWith(&raw, binding.JSON)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	err = requireIdentifier("to", raw.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	o.From = id
+
+	created, err := nb.CreateStandingOrder(&o)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, created)
+	}
+}
+
+func GetStandingOrders(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	orders, err := nb.GetStandingOrders(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, orders)
+	}
+}
+
+// CancelStandingOrder stops a standing order. the order and its runs remain to be read.
+func CancelStandingOrder(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, order, ok := parseStandingOrderParams(c)
+	if !ok {
+		return
+	}
+
+	o, err := nb.CancelStandingOrder(id, order)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("standing order(ID: %v) of account(ID: %v) doesnt exist", order, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, o)
+	}
+}
+
+func GetStandingOrderRuns(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	id, order, ok := parseStandingOrderParams(c)
+	if !ok {
+		return
+	}
+
+	o, err := nb.GetStandingOrder(order)
+	if err != nil || o.From != id {
+		msg := fmt.Sprintf("standing order(ID: %v) of account(ID: %v) doesnt exist", order, id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+		return
+	}
+
+	runs, err := nb.GetStandingOrderRuns(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusOK, runs)
+	}
+}
+
+func parseStandingOrderParams(c *gin.Context) (int, int, bool) {
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+
+	param = c.Param("order")
+	order, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied standing order id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return 0, 0, false
+	}
+	return id, order, true
+}
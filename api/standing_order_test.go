@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestCreateStandingOrder(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	// a start in the past is rejected, so the orders start next month.
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	next := start.AddDate(0, 0, 24)
+
+	fs := make([]*fixture, 7)
+	fs[0] = &fixture{
+		name:      "Successfully create a standing order.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: fmt.Sprintf(`{"to":"JP47NETB0000003003","amount":500,"schedule":"monthly:25","start":"%v"}`, start.Format("2006-01-02")),
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			// the id is assigned by the db.
+			var got map[string]any
+			json.Unmarshal(rr.Body.Bytes(), &got)
+			delete(got, "id")
+			bs, _ := json.Marshal(got)
+			expected := fmt.Sprintf(`{"from":1001,"to":3003,"amount":500,"schedule":"monthly:25","start":"%v","next_run":"%v","retries":0,"retry_hours":24,"status":"active"}`, start.Format("2006-01-02"), next.Format("2006-01-02"))
+			assert.JSONEq(t, expected, string(bs))
+		},
+	}
+	fs[1] = &fixture{
+		name:      "Invalid schedule.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: `{"to":"JP47NETB0000003003","amount":500,"schedule":"yearly","start":"2023-10-01"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got yearly as invalid schedule. use daily, weekly:<0-6> or monthly:<1-31>"}`,
+	}
+	fs[2] = &fixture{
+		name:      "Invalid start date.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: `{"to":"JP47NETB0000003003","amount":500,"schedule":"daily","start":"2023/10/01"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got 2023/10/01 as invalid start date"}`,
+	}
+	fs[3] = &fixture{
+		name:      "Start date in the past.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: `{"to":"JP47NETB0000003003","amount":500,"schedule":"daily","start":"2023-10-01"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"start date of standing order is before today. your input is 2023-10-01"}`,
+	}
+	fs[4] = &fixture{
+		name:      "Reciever's account not found.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: fmt.Sprintf(`{"to":"JP89NETB0000000404","amount":500,"schedule":"daily","start":"%v"}`, start.Format("2006-01-02")),
+		code:      http.StatusNotFound,
+		body:      `{"error":"reciever's account(ID: 404) is not found: sql: no rows in result set"}`,
+	}
+	fs[5] = &fixture{
+		name:      "Invalied id number.",
+		method:    "POST",
+		uri:       "/accounts/千百一/standing-orders",
+		bodyParam: `{"to":"JP47NETB0000003003","amount":500,"schedule":"daily","start":"2023-10-01"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"got 千百一 as invalied id"}`,
+	}
+	fs[6] = &fixture{
+		name:      "Reciever by the deprecated id.",
+		method:    "POST",
+		uri:       "/accounts/1001/standing-orders",
+		bodyParam: `{"to":3003,"amount":500,"schedule":"daily","start":"2023-10-01"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"to must be the account identifier like JP72NETB0000001001. the id 3003 is deprecated"}`,
+	}
+
+	router := gin.Default()
+	router.POST("/accounts/:id/standing-orders", CreateStandingOrder)
+	serveFixtures(t, router, fs)
+}
+
+func TestCancelStandingOrder(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	nb, err := core.NewNetBank()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nb.Close()
+
+	start := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	o, err := nb.CreateStandingOrder(&core.StandingOrder{From: 1001, To: 3003, Amount: 500, Schedule: "daily", Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := make([]*fixture, 3)
+	fs[0] = &fixture{
+		name:   "Successfully cancel a standing order.",
+		method: "DELETE",
+		uri:    fmt.Sprintf("/accounts/1001/standing-orders/%v", o.ID),
+		code:   http.StatusOK,
+		body:   fmt.Sprintf(`{"id":%v,"from":1001,"to":3003,"amount":500,"schedule":"daily","start":"%v","next_run":"%v","retries":0,"retry_hours":24,"status":"cancelled"}`, o.ID, start, start),
+	}
+	fs[1] = &fixture{
+		name:   "Standing order of another account.",
+		method: "DELETE",
+		uri:    fmt.Sprintf("/accounts/3003/standing-orders/%v", o.ID),
+		code:   http.StatusNotFound,
+		body:   fmt.Sprintf(`{"error":"standing order(ID: %v) of account(ID: 3003) doesnt exist"}`, o.ID),
+	}
+	fs[2] = &fixture{
+		name:   "Invalid standing order id.",
+		method: "DELETE",
+		uri:    "/accounts/1001/standing-orders/first",
+		code:   http.StatusBadRequest,
+		body:   `{"error":"got first as invalied standing order id"}`,
+	}
+
+	router := gin.Default()
+	router.DELETE("/accounts/:id/standing-orders/:order", CancelStandingOrder)
+	serveFixtures(t, router, fs)
+}
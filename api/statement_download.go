@@ -0,0 +1,94 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// the content types of the statement formats.
+var statementContentTypes = map[string]string{
+	core.StatementOFX: "application/x-ofx; charset=utf-8",
+	core.StatementQIF: "application/qif; charset=utf-8",
+	core.StatementCSV: "text/csv; charset=utf-8",
+}
+
+// IssueDownloadToken issues a token to download the statements of the account by a personal finance app.
+// it is routed behind AccountHolder, so only the holder of the account can issue it.
+func IssueDownloadToken(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	token, err := nb.IssueDownloadToken(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	} else {
+		c.IndentedJSON(http.StatusCreated, token)
+	}
+}
+
+// ExportStatement downloads the statement of the account between ?from and ?to (YYYY-MM-DD, today by default)
+// in ?format, ofx, qif or csv. X-Download-Token header is a download token of the account,
+// which is not taken from the URL so that it is not written in the access logs.
+func ExportStatement(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	format := c.Query("format")
+	bs, err := nb.ExportStatement(id, c.GetHeader("X-Download-Token"), format, from, to)
+	if errors.Is(err, core.ErrInvalidDownloadToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	} else if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		filename := fmt.Sprintf("statement-%v-%v.%v", id, to.Format("20060102"), format)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, statementContentTypes[format], bs)
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestStatementDownload(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.POST("/admin/accounts/:id/credentials", AdminOnly, IssueAccountCredential)
+	router.POST("/accounts/:id/statements/tokens", AccountHolder, IssueDownloadToken)
+	router.GET("/accounts/:id/statements/download", ExportStatement)
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+
+	var credential core.AccountCredential
+	fs := make([]*fixture, 2)
+	fs[0] = &fixture{
+		name:   "Successfully issue a credential.",
+		method: "POST",
+		uri:    "/admin/accounts/1001/credentials",
+		header: adminHeader,
+		code:   http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			err := json.Unmarshal(rr.Body.Bytes(), &credential)
+			assert.NoError(t, err)
+			assert.Equal(t, 1001, credential.Account)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Account of the credential not found.",
+		method: "POST",
+		uri:    "/admin/accounts/404/credentials",
+		header: adminHeader,
+		code:   http.StatusNotFound,
+	}
+	serveFixtures(t, router, fs)
+
+	// only the holder of the account can issue a token.
+	var token core.DownloadToken
+	fs = make([]*fixture, 3)
+	fs[0] = &fixture{
+		name:   "Without credential.",
+		method: "POST",
+		uri:    "/accounts/1001/statements/tokens",
+		code:   http.StatusUnauthorized,
+	}
+	fs[1] = &fixture{
+		name:   "Credential of another account.",
+		method: "POST",
+		uri:    "/accounts/3003/statements/tokens",
+		header: map[string]string{"X-Account-Token": credential.Token},
+		code:   http.StatusUnauthorized,
+		body:   `{"error":"the token is not the credential of account(ID: 3003): invalid credential"}`,
+	}
+	fs[2] = &fixture{
+		name:   "Successfully issue a download token.",
+		method: "POST",
+		uri:    "/accounts/1001/statements/tokens",
+		header: map[string]string{"X-Account-Token": credential.Token},
+		code:   http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			err := json.Unmarshal(rr.Body.Bytes(), &token)
+			assert.NoError(t, err)
+			assert.Equal(t, 1001, token.Account)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 5)
+	fs[0] = &fixture{
+		name:   "Successfully download the statement in CSV.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/download?format=csv",
+		header: map[string]string{"X-Download-Token": token.Token},
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.True(t, strings.HasPrefix(rr.Body.String(), "id,date,type,description,counterparty,amount,currency,balance\r\n"))
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Successfully download the statement in OFX.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/download?format=ofx",
+		header: map[string]string{"X-Download-Token": token.Token},
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			assert.Contains(t, rr.Body.String(), "<ACCTID>JP72NETB0000001001</ACCTID>")
+			assert.Contains(t, rr.Header().Get("Content-Disposition"), ".ofx")
+		},
+	}
+	// the token in the URL is not accepted, so that it is not left in the access logs.
+	fs[2] = &fixture{
+		name:   "Token in the URL.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/download?format=qif&token=" + token.Token,
+		code:   http.StatusUnauthorized,
+	}
+	fs[3] = &fixture{
+		name:   "Token of another account.",
+		method: "GET",
+		uri:    "/accounts/3003/statements/download?format=qif",
+		header: map[string]string{"X-Download-Token": token.Token},
+		code:   http.StatusUnauthorized,
+	}
+	fs[4] = &fixture{
+		name:   "Unknown format.",
+		method: "GET",
+		uri:    "/accounts/1001/statements/download?format=pdf",
+		header: map[string]string{"X-Download-Token": token.Token},
+		code:   http.StatusBadRequest,
+		body:   `{"error":"format pdf is not one of ofx, qif and csv"}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestTermDeposits(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	os.Setenv("ADMIN_TOKEN", "admin-token")
+	defer os.Unsetenv("ADMIN_TOKEN")
+
+	router := gin.Default()
+	router.POST("/accounts/:id/term-deposits", OpenTermDeposit)
+	router.GET("/accounts/:id/term-deposits", GetTermDeposits)
+	router.POST("/accounts/:id/term-deposits/:deposit/break", BreakTermDeposit)
+	router.GET("/customers/:id", GetPortfolio)
+	admin := router.Group("/admin", AdminOnly)
+	admin.PUT("/term-rates/:term", SetTermRate)
+
+	var d core.TermDeposit
+	fs := make([]*fixture, 6)
+	fs[0] = &fixture{
+		name:      "Successfully set the rate of a term.",
+		method:    "PUT",
+		uri:       "/admin/term-rates/24",
+		header:    adminHeader,
+		bodyParam: `{"rate":0.1,"penalty_rate":0.05}`,
+		code:      http.StatusOK,
+		body:      `{"term_months":24,"rate":0.1,"penalty_rate":0.05}`,
+	}
+	fs[1] = &fixture{
+		name:      "Successfully open a term deposit.",
+		method:    "POST",
+		uri:       "/accounts/1001/term-deposits",
+		bodyParam: `{"amount":60,"term_months":24,"instruction":"rollover"}`,
+		code:      http.StatusCreated,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			json.Unmarshal(rr.Body.Bytes(), &d)
+			assert.Equal(t, core.DepositActive, d.Status)
+		},
+	}
+	fs[2] = &fixture{
+		name:      "Insufficient balance.",
+		method:    "POST",
+		uri:       "/accounts/1001/term-deposits",
+		bodyParam: `{"amount":60,"term_months":24,"instruction":"rollover"}`,
+		code:      http.StatusBadRequest,
+	}
+	fs[3] = &fixture{
+		name:      "Invalid maturity instruction.",
+		method:    "POST",
+		uri:       "/accounts/1001/term-deposits",
+		bodyParam: `{"amount":10,"term_months":24,"instruction":"renew"}`,
+		code:      http.StatusBadRequest,
+		body:      `{"error":"maturity instruction must be rollover or payout. your input is renew"}`,
+	}
+	fs[4] = &fixture{
+		name:      "Account not found.",
+		method:    "POST",
+		uri:       "/accounts/9999/term-deposits",
+		bodyParam: `{"amount":10,"term_months":24}`,
+		code:      http.StatusNotFound,
+	}
+	fs[5] = &fixture{
+		name:   "The term deposit is in the portfolio.",
+		method: "GET",
+		uri:    "/customers/1001",
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var p core.Portfolio
+			json.Unmarshal(rr.Body.Bytes(), &p)
+			assert.Equal(t, "John", p.Name)
+			assert.Equal(t, 1, len(p.Accounts))
+			assert.Equal(t, float64(40), p.Accounts[0].Balance)
+			assert.Equal(t, 1, len(p.TermDeposits))
+			assert.Equal(t, float64(100), p.Total)
+		},
+	}
+	serveFixtures(t, router, fs)
+
+	fs = make([]*fixture, 4)
+	fs[0] = &fixture{
+		name:   "Successfully break the term deposit.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/1001/term-deposits/%v/break", d.ID),
+		code:   http.StatusOK,
+		check: func(t *testing.T, rr *httptest.ResponseRecorder) {
+			var broken core.TermDeposit
+			json.Unmarshal(rr.Body.Bytes(), &broken)
+			assert.Equal(t, core.DepositBroken, broken.Status)
+			assert.Equal(t, float64(3), broken.Penalty)
+		},
+	}
+	fs[1] = &fixture{
+		name:   "Term deposit is already broken.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/1001/term-deposits/%v/break", d.ID),
+		code:   http.StatusConflict,
+	}
+	fs[2] = &fixture{
+		name:   "Term deposit of another account.",
+		method: "POST",
+		uri:    fmt.Sprintf("/accounts/3003/term-deposits/%v/break", d.ID),
+		code:   http.StatusNotFound,
+	}
+	fs[3] = &fixture{
+		name:   "Customer not found.",
+		method: "GET",
+		uri:    "/customers/9999",
+		code:   http.StatusNotFound,
+		body:   `{"error":"customer(ID: 9999) doesnt exist"}`,
+	}
+	serveFixtures(t, router, fs)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+// ExportZengin downloads the transfers sent from the account between ?from and ?to (YYYY-MM-DD, today by default)
+// as a zengin 総合振込 file in Shift_JIS.
+func ExportZengin(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	from, ok := parseDateQuery(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := parseDateQuery(c, "to")
+	if !ok {
+		return
+	}
+
+	bs, err := nb.ExportZengin(id, from, to)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else {
+		filename := fmt.Sprintf("zengin-%v-%v.txt", id, to.Format("20060102"))
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "text/plain; charset=Shift_JIS", bs)
+	}
+}
+
+// ImportZengin sends the transfers in the zengin file of the body as a batch, and responds the validation report.
+// nothing is sent with ?dry-run=true, and ?mode is the mode of the batch. a file with issues is 400 with the report.
+func ImportZengin(c *gin.Context) {
+	nb, err := core.NewNetBank()
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize netbank instance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		return
+	}
+	defer nb.Close()
+
+	param := c.Param("id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied id", param)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	data, err := c.GetRawData()
+	if err != nil || len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalied request"})
+		return
+	}
+	dryRun := c.Query("dry-run") == "true"
+
+	report, err := nb.ImportZengin(id, data, c.Query("mode"), dryRun)
+	if errors.Is(err, sql.ErrNoRows) {
+		msg := fmt.Sprintf("account(ID: %v) doesnt exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"error": msg})
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	} else if !report.Valid || (report.Result != nil && !report.Result.Committed) {
+		c.IndentedJSON(http.StatusBadRequest, report)
+	} else {
+		c.IndentedJSON(http.StatusOK, report)
+	}
+}
+
+// parseDateQuery reads the query as YYYY-MM-DD. an empty one is today.
+func parseDateQuery(c *gin.Context, key string) (time.Time, bool) {
+	query := c.Query(key)
+	if query == "" {
+		return time.Now(), true
+	}
+	date, err := time.ParseInLocation("2006-01-02", query, time.Local)
+	if err != nil {
+		msg := fmt.Sprintf("got %v as invalied %v date. it must be like 2006-01-02", query, key)
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return time.Time{}, false
+	}
+	return date, true
+}
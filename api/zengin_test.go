@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core"
+)
+
+func TestZengin(t *testing.T) {
+	err := core.InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer core.DeleteTestData()
+
+	router := gin.Default()
+	router.PATCH("/accounts/:id", FinancialTransaction)
+	router.GET("/accounts/:id/zengin", ExportZengin)
+	router.POST("/accounts/:id/zengin", ImportZengin)
+
+	zf := &core.ZenginFile{
+		Header: &core.ZenginHeader{RequesterCode: "1001", RequesterName: "JOHN", Date: "1031", Bank: "9999", BankName: "ﾈﾂﾄﾊﾞﾝｸ",
+			Branch: "001", BranchName: "ﾎﾝﾃﾝ", DepositType: "1", Account: "1001"},
+		Records: []*core.ZenginRecord{
+			{Bank: "9999", BankName: "ﾈﾂﾄﾊﾞﾝｸ", Branch: "001", BranchName: "ﾎﾝﾃﾝ", DepositType: "1", Account: "3003", Name: "IDE NON NO", Amount: 30},
+		},
+	}
+	file, err := core.EncodeZengin(zf)
+	assert.Nil(t, err)
+
+	// accounts of the test data are in USD.
+	fs := make([]*fixture, 5)
+	fs[0] = &fixture{
+		name:   "Export from an account in USD.",
+		method: "GET",
+		uri:    "/accounts/1001/zengin",
+		code:   http.StatusBadRequest,
+	}
+	fs[1] = &fixture{
+		name:   "Invalid from date.",
+		method: "GET",
+		uri:    "/accounts/1001/zengin?from=2023/10/01",
+		code:   http.StatusBadRequest,
+		body:   `{"error":"got 2023/10/01 as invalied from date. it must be like 2006-01-02"}`,
+	}
+	fs[2] = &fixture{
+		name:      "Import to an account in USD.",
+		method:    "POST",
+		uri:       "/accounts/1001/zengin?dry-run=true",
+		bodyParam: string(file),
+		code:      http.StatusBadRequest,
+		body:      `{"error":"account(ID: 1001) is in USD, but zengin files are in JPY: currency mismatch"}`,
+	}
+	fs[3] = &fixture{
+		name:      "Account not found.",
+		method:    "POST",
+		uri:       "/accounts/404/zengin",
+		bodyParam: string(file),
+		code:      http.StatusNotFound,
+	}
+	fs[4] = &fixture{
+		name:   "Without zengin file.",
+		method: "POST",
+		uri:    "/accounts/1001/zengin",
+		code:   http.StatusBadRequest,
+	}
+
+	serveFixtures(t, router, fs)
+}
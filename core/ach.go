@@ -0,0 +1,629 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// ACHClearingAccount holds the money of ACH credits until they settle, and advances the money of ACH debits.
+	ACHClearingAccount = -5
+
+	ACHCredit = "credit"
+	ACHDebit  = "debit"
+
+	ACHChecking = "checking"
+	ACHSavings  = "savings"
+
+	// the statuses of ACH entries.
+	ACHPending  = "pending"
+	ACHSent     = "sent"
+	ACHReturned = "returned"
+	ACHFlagged  = "flagged"
+
+	// the actions taken on returns.
+	ACHActionReversed  = "reversed"
+	ACHActionFlagged   = "flagged"
+	ACHActionUnmatched = "unmatched"
+	ACHActionIgnored   = "ignored"
+
+	// the routing numbers of the bank and the receiving point unless ACH_ROUTING_NUMBER and ACH_DESTINATION are set.
+	defaultACHRouting     = "091000019"
+	defaultACHDestination = "011000015"
+	// the company identification of the bank in batch headers unless ACH_COMPANY_ID is set.
+	defaultACHCompanyID = "1000000001"
+	achOriginName       = "NETBANK"
+	achDestinationName  = "FEDERAL RESERVE BANK"
+	achSEC              = "PPD"
+	achNameLength       = 22
+	// the amount of an entry is 10 digits in cents.
+	maxACHAmount = 99999999.99
+	// the money of a debit is held for this many business days unless ACH_DEBIT_HOLD_DAYS is set,
+	// which covers the effective date and the return window of insufficient funds.
+	defaultACHDebitHoldDays = 4
+)
+
+var (
+	// ErrNoACHEntries is matched by errors.Is() when there is no entry to send in a file.
+	ErrNoACHEntries = errors.New("no ACH entries to send")
+
+	achAccountPattern = regexp.MustCompile(`^[0-9A-Za-z-]{1,17}$`)
+
+	// achReturnReasons are the return reason codes which are reversed automatically. other codes are flagged for staff.
+	achReturnReasons = map[string]string{
+		"R01": "Insufficient Funds",
+		"R02": "Account Closed",
+		"R03": "No Account/Unable to Locate Account",
+		"R04": "Invalid Account Number",
+		"R05": "Unauthorized Debit to Consumer Account",
+		"R06": "Returned per ODFI's Request",
+		"R07": "Authorization Revoked by Customer",
+		"R08": "Payment Stopped",
+		"R09": "Uncollected Funds",
+		"R10": "Customer Advises Not Authorized",
+		"R16": "Account Frozen",
+		"R20": "Non-Transaction Account",
+		"R29": "Corporate Customer Advises Not Authorized",
+	}
+)
+
+// ACHBeneficiary is an account in a US bank. Routing is the 9 digit routing number and Name is up to 22 characters.
+type ACHBeneficiary struct {
+	Routing       string `json:"routing"`
+	AccountNumber string `json:"account_number"`
+	AccountType   string `json:"account_type"`
+	Name          string `json:"name"`
+}
+
+// ACHEntry is an ACH credit to the beneficiary or an ACH debit from it, which is sent in a NACHA file.
+// Trace is the trace number in the file, and Reversal is the reversal of Transfer made by a return.
+type ACHEntry struct {
+	ID          int64           `json:"id"`
+	Account     int             `json:"account"`
+	Transfer    int64           `json:"transfer"`
+	Direction   string          `json:"direction"`
+	Beneficiary *ACHBeneficiary `json:"beneficiary"`
+	Amount      float64         `json:"amount"`
+	Trace       string          `json:"trace"`
+	Status      string          `json:"status"`
+	File        int64           `json:"file,omitempty"`
+	ReturnCode  string          `json:"return_code,omitempty"`
+	ReturnNote  string          `json:"return_note,omitempty"`
+	Reversal    int64           `json:"reversal,omitempty"`
+	// Hold is the hold on the money of a debit until the return window passes.
+	Hold      int64     `json:"hold,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ACHFile is a NACHA file generated by ExportNACHA.
+type ACHFile struct {
+	ID        int64     `json:"id"`
+	Entries   int       `json:"entries"`
+	Content   []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ACHReturn is the result of a returned entry. Trace is the trace number of the original entry.
+type ACHReturn struct {
+	Trace       string    `json:"trace"`
+	Reason      string    `json:"reason"`
+	Description string    `json:"description,omitempty"`
+	Entry       int64     `json:"entry,omitempty"`
+	Action      string    `json:"action"`
+	Reversal    *Reversal `json:"reversal,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// ACHReturnReport is the result of a return file.
+type ACHReturnReport struct {
+	Reversed  int          `json:"reversed"`
+	Flagged   int          `json:"flagged"`
+	Unmatched int          `json:"unmatched"`
+	Ignored   int          `json:"ignored"`
+	Returns   []*ACHReturn `json:"returns"`
+}
+
+func achRouting() string {
+	if r := os.Getenv("ACH_ROUTING_NUMBER"); checkRouting(r) == nil {
+		return r
+	}
+	return defaultACHRouting
+}
+
+func achDestination() string {
+	if r := os.Getenv("ACH_DESTINATION"); checkRouting(r) == nil {
+		return r
+	}
+	return defaultACHDestination
+}
+
+func achDebitHoldDays() int {
+	days, err := strconv.Atoi(os.Getenv("ACH_DEBIT_HOLD_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultACHDebitHoldDays
+	}
+	return days
+}
+
+// achHoldExpiry is the start of the business day when the hold on the money of a debit originated at now expires.
+func achHoldExpiry(now time.Time) time.Time {
+	d := now
+	for i := 0; i < achDebitHoldDays(); i++ {
+		d = nextBusinessDay(d)
+	}
+	return d
+}
+
+func achCompanyID() string {
+	if id := os.Getenv("ACH_COMPANY_ID"); id != "" && len(id) <= 10 {
+		return id
+	}
+	return defaultACHCompanyID
+}
+
+// achTrace is the trace number of the entry, which is the routing number of the bank without the check digit and the id.
+func achTrace(id int64) string {
+	return fmt.Sprintf("%v%07d", achRouting()[:8], id%10000000)
+}
+
+// achCents is the amount in cents.
+func achCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// CheckACHBeneficiary checks the beneficiary and returns it normalized. the name is in upper case.
+func CheckACHBeneficiary(b *ACHBeneficiary) (*ACHBeneficiary, error) {
+	err := checkRouting(b.Routing)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidBeneficiary)
+	}
+	if !achAccountPattern.MatchString(b.AccountNumber) {
+		return nil, fmt.Errorf("account number %q must be 1 to 17 letters, digits or hyphens: %w", b.AccountNumber, ErrInvalidBeneficiary)
+	}
+	accountType := b.AccountType
+	if accountType == "" {
+		accountType = ACHChecking
+	}
+	if accountType != ACHChecking && accountType != ACHSavings {
+		return nil, fmt.Errorf("account type %q is not %v or %v: %w", b.AccountType, ACHChecking, ACHSavings, ErrInvalidBeneficiary)
+	}
+	name := nachaText(b.Name)
+	if name == "" || len(name) > achNameLength {
+		return nil, fmt.Errorf("name %q must be 1 to %v characters: %w", b.Name, achNameLength, ErrInvalidBeneficiary)
+	}
+	return &ACHBeneficiary{Routing: b.Routing, AccountNumber: b.AccountNumber, AccountType: accountType, Name: name}, nil
+}
+
+// OriginateACH posts an ACH credit from the account in USD to the beneficiary, or an ACH debit from the beneficiary to the account.
+// a credit is a transfer to ACHClearingAccount with the limits and the fee. a debit is advanced from it with the limits
+// and the fee too, and its money is held until the return window passes. the entry is sent in the next NACHA file.
+func (nb *netBank) OriginateACH(num int, direction string, b *ACHBeneficiary, amount float64) (*ACHEntry, error) {
+	beneficiary, err := CheckACHBeneficiary(b)
+	if err != nil {
+		return nil, err
+	}
+	if direction != ACHCredit && direction != ACHDebit {
+		return nil, fmt.Errorf("direction %q is not %v or %v", direction, ACHCredit, ACHDebit)
+	}
+	if amount <= 0 || amount > maxACHAmount || roundAmount(amount, "USD") != amount {
+		return nil, fmt.Errorf("amount %v must be cents between 0.01 and %.2f", amount, maxACHAmount)
+	}
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	if a.Currency != "USD" {
+		return nil, fmt.Errorf("account(ID: %v) is in %v. ACH is only for accounts in USD", num, a.Currency)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var es []*Event
+	if direction == ACHCredit {
+		id, es, err = nb.transfer(tx, num, ACHClearingAccount, amount, "")
+	} else {
+		id, es, err = nb.advanceDebit(tx, num, amount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	INSERT INTO ach_entry (account_id, transfer_id, direction, routing, account_number, account_type, name, amount, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id, created_at;
+	`
+	e := &ACHEntry{Account: num, Transfer: id, Direction: direction, Beneficiary: beneficiary, Amount: amount, Status: ACHPending}
+	err = tx.QueryRowContext(context.Background(), q, num, id, direction, beneficiary.Routing, beneficiary.AccountNumber,
+		beneficiary.AccountType, beneficiary.Name, amount, ACHPending).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	e.Trace = achTrace(e.ID)
+	if direction == ACHDebit {
+		// the money is not available until a return of insufficient funds can no longer come.
+		h, err := insertHold(tx, num, amount, achHoldExpiry(e.CreatedAt), "ACH "+e.Trace)
+		if err != nil {
+			return nil, err
+		}
+		e.Hold = h.ID
+	}
+	q = `UPDATE ach_entry SET trace=$2, hold_id=NULLIF($3, 0) WHERE id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, e.ID, e.Trace, e.Hold)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return e, nil
+}
+
+// advanceDebit credits the account with the money of a debit from ACHClearingAccount in the transaction.
+// the money is advanced by the bank, so the debit counts against the limits of the account and is charged the transfer fee.
+func (nb *netBank) advanceDebit(tx *sql.Tx, num int, amount float64) (int64, []*Event, error) {
+	id, es, err := nb.moveFunds(tx, ACHClearingAccount, num, amount, false, "")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the account is locked by moveFunds().
+	err = useLimits(tx, num, ACHClearingAccount, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fee, err := quoteFee(tx, num, FeeTransfer, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+	if fee.Fee > 0 {
+		// the fee is paid from the balance before the debit, which is held.
+		balances, err := lockBalances(tx, num)
+		if err != nil {
+			return 0, nil, err
+		}
+		err = checkFunds(tx, num, balances[num]-amount, fee.Fee, "your")
+		if err != nil {
+			return 0, nil, err
+		}
+		_, err = tx.ExecContext(context.Background(), `UPDATE transfer SET fee=$2 WHERE id=$1;`, id, fee.Fee)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	charged, err := nb.chargeFee(tx, fee)
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, append(es, charged...), nil
+}
+
+const achEntryColumns = `id, account_id, transfer_id, direction, routing, account_number, account_type, name, amount, trace, status,
+	COALESCE(file_id, 0), COALESCE(return_code, ''), COALESCE(return_note, ''), COALESCE(reversal_id, 0), COALESCE(hold_id, 0),
+	created_at`
+
+func scanACHEntry(row interface{ Scan(...any) error }) (*ACHEntry, error) {
+	e := &ACHEntry{Beneficiary: &ACHBeneficiary{}}
+	err := row.Scan(&e.ID, &e.Account, &e.Transfer, &e.Direction, &e.Beneficiary.Routing, &e.Beneficiary.AccountNumber,
+		&e.Beneficiary.AccountType, &e.Beneficiary.Name, &e.Amount, &e.Trace, &e.Status, &e.File, &e.ReturnCode, &e.ReturnNote,
+		&e.Reversal, &e.Hold, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetACHEntries returns the entries in the status, or all entries when it is empty, newest first.
+func (nb *netBank) GetACHEntries(status string) ([]*ACHEntry, error) {
+	q := `SELECT ` + achEntryColumns + ` FROM ach_entry WHERE $1='' OR status=$1 ORDER BY id DESC;`
+	rows, err := nb.db.QueryContext(context.Background(), q, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	es := []*ACHEntry{}
+	for rows.Next() {
+		e, err := scanACHEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, rows.Err()
+}
+
+// nextBusinessDay is the day after the date skipping weekends, which is the effective entry date of a file.
+func nextBusinessDay(t time.Time) time.Time {
+	d := truncateDate(t).AddDate(0, 0, 1)
+	for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// newNACHAFile puts the credits and the debits in a batch each. modifier distinguishes the files of a day.
+func newNACHAFile(es []*ACHEntry, now time.Time, modifier string) *NACHAFile {
+	routing := achRouting()
+	f := &NACHAFile{
+		Destination:     achDestination(),
+		Origin:          routing,
+		DestinationName: achDestinationName,
+		OriginName:      achOriginName,
+		CreatedAt:       now.UTC(),
+		IDModifier:      modifier,
+	}
+	for _, d := range []struct {
+		direction    string
+		serviceClass string
+		description  string
+	}{{ACHCredit, NACHACredits, "PAYMENT"}, {ACHDebit, NACHADebits, "COLLECTION"}} {
+		b := &NACHABatch{
+			ServiceClass:     d.serviceClass,
+			CompanyName:      achOriginName,
+			CompanyID:        achCompanyID(),
+			SEC:              achSEC,
+			EntryDescription: d.description,
+			EffectiveDate:    nextBusinessDay(now),
+			ODFI:             routing[:8],
+			Number:           len(f.Batches) + 1,
+		}
+		for _, e := range es {
+			if e.Direction != d.direction {
+				continue
+			}
+			b.Entries = append(b.Entries, &NACHAEntry{
+				TransactionCode: achTransactionCode(e.Direction, e.Beneficiary.AccountType),
+				RDFI:            e.Beneficiary.Routing,
+				Account:         e.Beneficiary.AccountNumber,
+				Amount:          achCents(e.Amount),
+				IndividualID:    strconv.Itoa(e.Account),
+				Name:            e.Beneficiary.Name,
+				Trace:           e.Trace,
+			})
+		}
+		if len(b.Entries) > 0 {
+			f.Batches = append(f.Batches, b)
+		}
+	}
+	return f
+}
+
+// achTransactionCode is 22 and 27 for credits and debits of checking accounts, and 32 and 37 of savings accounts.
+func achTransactionCode(direction string, accountType string) string {
+	code := 22
+	if accountType == ACHSavings {
+		code = 32
+	}
+	if direction == ACHDebit {
+		code += 5
+	}
+	return strconv.Itoa(code)
+}
+
+// ExportNACHA generates a NACHA file of the pending entries, which are marked as sent in it.
+func (nb *netBank) ExportNACHA(now time.Time) (*ACHFile, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := `SELECT ` + achEntryColumns + ` FROM ach_entry WHERE status=$1 ORDER BY id FOR UPDATE;`
+	rows, err := tx.QueryContext(context.Background(), q, ACHPending)
+	if err != nil {
+		return nil, err
+	}
+	es := []*ACHEntry{}
+	for rows.Next() {
+		e, err := scanACHEntry(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(es) == 0 {
+		return nil, ErrNoACHEntries
+	}
+
+	// the file id modifier is A to Z and 0 to 9 by the number of the files of the day.
+	var today int
+	q = `SELECT COUNT(*) FROM ach_file WHERE created_at>=$1;`
+	err = tx.QueryRowContext(context.Background(), q, truncateDate(now)).Scan(&today)
+	if err != nil {
+		return nil, err
+	}
+	modifier := string("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"[today%36])
+
+	content, err := EncodeNACHA(newNACHAFile(es, now, modifier))
+	if err != nil {
+		return nil, err
+	}
+	f := &ACHFile{Entries: len(es), Content: content}
+	q = `INSERT INTO ach_file (content, entries, created_at) VALUES ($1, $2, $3) RETURNING id, created_at;`
+	err = tx.QueryRowContext(context.Background(), q, content, len(es), now).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range es {
+		q := `UPDATE ach_entry SET status=$2, file_id=$3 WHERE id=$1;`
+		_, err = tx.ExecContext(context.Background(), q, e.ID, ACHSent, f.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GetACHFile returns the NACHA file.
+func (nb *netBank) GetACHFile(id int64) (*ACHFile, error) {
+	f := &ACHFile{ID: id}
+	q := `SELECT content, entries, created_at FROM ach_file WHERE id=$1;`
+	err := nb.db.QueryRowContext(context.Background(), q, id).Scan(&f.Content, &f.Entries, &f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ProcessACHReturns reads a return file and reverses the transfers of the returned entries.
+// a return is flagged for staff instead when its reason is not in achReturnReasons, its amount differs from the entry,
+// or the reversal fails, e.g. the account has spent the money of a returned debit. a reversal above the threshold
+// waits for staff approval as ReverseTransfer().
+func (nb *netBank) ProcessACHReturns(data []byte) (*ACHReturnReport, error) {
+	f, err := ParseNACHA(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &ACHReturnReport{Returns: []*ACHReturn{}}
+	published := []*Event{}
+	for _, b := range f.Batches {
+		for _, re := range b.Entries {
+			if re.Return == nil {
+				continue
+			}
+			r, es, err := nb.processACHReturn(tx, re)
+			if err != nil {
+				return nil, err
+			}
+			switch r.Action {
+			case ACHActionReversed:
+				report.Reversed++
+			case ACHActionFlagged:
+				report.Flagged++
+			case ACHActionUnmatched:
+				report.Unmatched++
+			default:
+				report.Ignored++
+			}
+			report.Returns = append(report.Returns, r)
+			published = append(published, es...)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(published...)
+	return report, nil
+}
+
+// reverseACHEntry releases the hold of a debit and reverses the transfer of the entry in the transaction.
+// the hold is released first so that the held money pays the reversal.
+func (nb *netBank) reverseACHEntry(tx *sql.Tx, e *ACHEntry, note string) (*Reversal, []*Event, error) {
+	if e.Hold != 0 {
+		// lock the accounts of the reversal before the hold in the same order as captureHold().
+		_, err := lockBalances(tx, ACHClearingAccount, e.Account)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = releaseHold(tx, e.Account, e.Hold)
+		if err != nil && !errors.Is(err, ErrHoldNotActive) {
+			return nil, nil, err
+		}
+	}
+	return nb.reverseTransfer(tx, e.Transfer, 0, note, true)
+}
+
+// processACHReturn reverses or flags the entry of the return in the transaction.
+func (nb *netBank) processACHReturn(tx *sql.Tx, re *NACHAEntry) (*ACHReturn, []*Event, error) {
+	r := &ACHReturn{Trace: re.Return.OriginalTrace, Reason: re.Return.Reason, Description: achReturnReasons[re.Return.Reason]}
+	q := `SELECT ` + achEntryColumns + ` FROM ach_entry WHERE trace=$1 FOR UPDATE;`
+	e, err := scanACHEntry(tx.QueryRowContext(context.Background(), q, r.Trace))
+	if errors.Is(err, sql.ErrNoRows) {
+		r.Action = ACHActionUnmatched
+		r.Error = fmt.Sprintf("no entry has trace number %v", r.Trace)
+		return r, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	r.Entry = e.ID
+	if e.Status != ACHSent {
+		r.Action = ACHActionIgnored
+		r.Error = fmt.Sprintf("entry(ID: %v) is %v", e.ID, e.Status)
+		return r, nil, nil
+	}
+
+	note := fmt.Sprintf("ACH return %v", r.Reason)
+	if r.Description != "" {
+		note += ": " + r.Description
+	}
+	flag := func(format string, args ...any) (*ACHReturn, []*Event, error) {
+		r.Action = ACHActionFlagged
+		r.Error = fmt.Sprintf(format, args...)
+		q := `UPDATE ach_entry SET status=$2, return_code=$3, return_note=$4 WHERE id=$1;`
+		_, err := tx.ExecContext(context.Background(), q, e.ID, ACHFlagged, r.Reason, r.Error)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, nil, nil
+	}
+
+	if r.Description == "" {
+		return flag("return reason %v is not reversed automatically", r.Reason)
+	}
+	if re.Amount != achCents(e.Amount) {
+		return flag("returned amount is %v cents, but entry(ID: %v) is %v cents", re.Amount, e.ID, achCents(e.Amount))
+	}
+
+	// a failed reversal is rolled back to the savepoint without aborting the other returns.
+	_, err = tx.ExecContext(context.Background(), "SAVEPOINT ach_return;")
+	if err != nil {
+		return nil, nil, err
+	}
+	reversal, es, reverseErr := nb.reverseACHEntry(tx, e, note)
+	if reverseErr != nil {
+		_, err = tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT ach_return;")
+		if err != nil {
+			return nil, nil, err
+		}
+		return flag("failed to reverse transfer(ID: %v): %v", e.Transfer, reverseErr)
+	}
+	_, err = tx.ExecContext(context.Background(), "RELEASE SAVEPOINT ach_return;")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.Action = ACHActionReversed
+	r.Reversal = reversal
+	q = `UPDATE ach_entry SET status=$2, return_code=$3, return_note=$4, reversal_id=$5 WHERE id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, e.ID, ACHReturned, r.Reason, note, reversal.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, es, nil
+}
@@ -3,9 +3,11 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
@@ -20,32 +22,84 @@ type Customer struct {
 // Account ...
 type Account struct {
 	Customer
-	Number  int     `json:"id"`
-	Balance float64 `json:"balance"`
+	Number int `json:"id"`
+	// IBAN is the public identifier of the account by IBAN(), which is accepted in place of the id.
+	IBAN     string  `json:"iban"`
+	Balance  float64 `json:"balance"`
+	Currency string  `json:"currency"`
+	// Fee is the fee charged by the withdrawal or the transfer which returned the account.
+	Fee float64 `json:"fee,omitempty"`
 }
 
 // a field name in a struct must have capital initial when its encoded as json.
 type Trade struct {
-	Class  string  `json:"class"`
-	Amount float64 `json:"amount"`
-	From   int     `json:"from"`
-	To     int     `json:"to"`
+	Class  string     `json:"class"`
+	Amount float64    `json:"amount"`
+	From   AccountRef `json:"from"`
+	To     AccountRef `json:"to"`
+	// Currency is the ISO 4217 code of Amount. it must be the currency of the account, and empty is the same.
+	Currency string `json:"currency,omitempty"`
+	// Quote is the ID of the FX quote which fixes the rate of a transfer to an account in another currency.
+	Quote string `json:"quote,omitempty"`
 }
 
 type netBank struct {
 	db *sql.DB
 }
 
+// ErrInsufficientFunds is matched by errors.Is() when the balance is not enough for a withdrawal or a transfer.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// ErrAccountInUse is matched by errors.Is() when an account cannot be deleted because of its active products.
+var ErrAccountInUse = errors.New("account is in use")
+
+type insufficientFundsError struct {
+	msg string
+}
+
+func (e *insufficientFundsError) Error() string {
+	return e.msg
+}
+
+func (e *insufficientFundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+func insufficientFunds(format string, a ...any) error {
+	return &insufficientFundsError{msg: fmt.Sprintf(format, a...)}
+}
+
+// checkCustomerAccount rejects the internal accounts of the bank, which have ids below 1, as if they didn't exist,
+// so that they are never reached by the operations of customers.
+func checkCustomerAccount(nums ...int) error {
+	for _, num := range nums {
+		if num <= 0 {
+			return fmt.Errorf("account(ID: %v) doesnt exist: %w", num, sql.ErrNoRows)
+		}
+	}
+	return nil
+}
+
 func (a *Account) SetUniqueID(nb *netBank) error {
 	id, err := nb.GetNewId()
 	if err != nil {
 		return err
 	}
 	a.Number = id
+	a.IBAN = IBAN(id)
 	return nil
 }
 
 func NewNetBank() (*netBank, error) {
+	db, err := sql.Open(dataSource())
+	if err != nil {
+		return nil, err
+	}
+	return &netBank{db: db}, nil
+}
+
+// dataSource returns the driver and the source to connect the db depending on the environment.
+func dataSource() (string, string) {
 	env := os.Getenv("Env")
 
 	var (
@@ -64,11 +118,7 @@ func NewNetBank() (*netBank, error) {
 		source = "host=localhost port=5180 user=testUser database=netbank_test password=testPassword sslmode=disable"
 	}
 
-	db, err := sql.Open(driver, source)
-	if err != nil {
-		return nil, err
-	}
-	return &netBank{db: db}, nil
+	return driver, source
 }
 
 func (nb *netBank) Ping() error {
@@ -84,38 +134,59 @@ func (nb *netBank) Begin() (*sql.Tx, error) {
 }
 
 func (nb *netBank) Deposit(num int, money float64) (*Account, error) {
-	// check money is more than 0
-	if money <= 0 {
-		return nil, fmt.Errorf("deposit of account_%v is less than 0. you was going to deposit %v$", num, money)
+	err := checkCustomerAccount(num)
+	if err != nil {
+		return nil, err
 	}
 
-	// extract the account's balance
-	var balance float64
-	q := `
-	SELECT balance 
-	FROM account 
-	WHERE id=$1;
-	`
-	row := nb.db.QueryRowContext(context.Background(), q, num)
-	err := row.Scan(&balance)
+	// start the transaction
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	e, err := nb.deposit(tx, num, money)
 	if err != nil {
 		return nil, err
 	}
 
-	// check balance is more than 0
-	if balance < 0 {
-		return nil, fmt.Errorf("balance of account_%v is less than 0. currenct balance is %v", num, balance)
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
+	publish(e)
 
-	// start the transaction
-	tx, err := nb.db.Begin()
+	account, err := nb.GetAccount(num)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+
+	return account, nil
+}
+
+// deposit posts money to the account in the transaction, and returns the event to publish after commit.
+// loans are disbursed by it as well as deposits.
+func (nb *netBank) deposit(tx *sql.Tx, num int, money float64) (*Event, error) {
+	// check money is more than 0
+	if money <= 0 {
+		return nil, fmt.Errorf("deposit of account_%v is less than 0. you was going to deposit %v$", num, money)
+	}
+
+	// extract the account's balance
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := balances[num]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	// a negative balance is accepted, so that the overdraft can be paid back.
 
 	// update the balance
-	q = `
+	q := `
 	UPDATE account 
 	SET balance=$1 
 	WHERE id=$2;
@@ -123,44 +194,60 @@ func (nb *netBank) Deposit(num int, money float64) (*Account, error) {
 	_, err = tx.ExecContext(context.Background(), q, money+balance, num)
 	if err != nil {
 		return nil, err
-	} else {
-		tx.Commit()
 	}
 
-	account, err := nb.GetAccount(num)
+	e, err := nb.record(tx, BalanceChanged, num, money, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	return account, nil
+	err = nb.enqueue(tx, FundsDeposited, num, &Funds{Account: num, Amount: money, Balance: e.Balance})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
 func (nb *netBank) Withdraw(num int, money float64) (*Account, error) {
 	if money <= 0 {
 		return nil, fmt.Errorf("withdraw is less than zero. id_%v was going to withdraw %v", num, money)
 	}
+	err := checkCustomerAccount(num)
+	if err != nil {
+		return nil, err
+	}
+
+	// start the transaction
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
 
 	// extract the account's balance
-	balance, err := nb.GetBalance(num)
+	balances, err := lockBalances(tx, num)
 	if err != nil {
 		return nil, err
 	}
+	balance, ok := balances[num]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
 
-	// check which balance is more than 0 or not.
-	if balance < 0 {
-		return nil, fmt.Errorf("balance is less than 0. id_%v's currenct balance is %v", num, balance)
+	fee, err := quoteFee(tx, num, FeeWithdraw, money)
+	if err != nil {
+		return nil, err
 	}
 
-	if balance-money < 0 {
-		return nil, fmt.Errorf("amount is grater than the balance. your amount is %v, but the balance is %v", money, balance)
+	err = checkFunds(tx, num, balance, money+fee.Fee, "your")
+	if err != nil {
+		return nil, err
 	}
 
-	// start the transaction
-	tx, err := nb.db.Begin()
+	err = useLimits(tx, num, 0, money)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
 	// update the balance
 	q := `
@@ -171,97 +258,348 @@ func (nb *netBank) Withdraw(num int, money float64) (*Account, error) {
 	_, err = tx.ExecContext(context.Background(), q, balance-money, num)
 	if err != nil {
 		return nil, err
-	} else {
-		tx.Commit()
 	}
 
+	e, err := nb.record(tx, BalanceChanged, num, -money, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, FundsWithdrawn, num, &Funds{Account: num, Amount: money, Balance: e.Balance})
+	if err != nil {
+		return nil, err
+	}
+
+	es, err := nb.chargeFee(tx, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(append([]*Event{e}, es...)...)
+
 	account, err := nb.GetAccount(num)
 	if err != nil {
 		return nil, err
 	}
+	account.Fee = fee.Fee
 
 	return account, nil
 }
 
 func (nb *netBank) Transfer(sender int, reciever int, money float64) ([]*Account, error) {
+	return nb.TransferAtQuote(sender, reciever, money, "")
+}
+
+// TransferAtQuote is Transfer() which converts the money at the rate of the quote. empty quote is the rate of now.
+func (nb *netBank) TransferAtQuote(sender int, reciever int, money float64, quote string) ([]*Account, error) {
 	/*
 			nb.Withdraw() と nb.Deposit() を流用する方法もあるが、
 		    トランザクションの切り替えの間に取引が行われてしまう恐れがないように
 			預金残高の削減と増加を一つのトランザクションにまとめる。
 	*/
+	err := checkCustomerAccount(sender, reciever)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, es, err := nb.transfer(tx, sender, reciever, money, quote)
+	if err != nil {
+		return nil, err
+	}
+
+	var fee float64
+	err = tx.QueryRowContext(context.Background(), "SELECT fee FROM transfer WHERE id=$1;", id).Scan(&fee)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+
+	accounts := make([]*Account, 2)
+	from, err := nb.GetAccount(sender)
+	if err != nil {
+		return nil, err
+	}
+	to, err := nb.GetAccount(reciever)
+	if err != nil {
+		return nil, err
+	}
+	from.Fee = fee
+	accounts[0] = from
+	accounts[1] = to
+	return accounts, nil
+}
+
+// transfer moves money in the transaction, and returns the id of the transfer and the events to publish after commit.
+// the balances are locked until the end of the transaction.
+func (nb *netBank) transfer(tx *sql.Tx, sender int, reciever int, money float64, quote string) (int64, []*Event, error) {
+	return nb.moveFunds(tx, sender, reciever, money, true, quote)
+}
+
+// conversion is the amount credited to the reciever in its currency, and the rate applied to it.
+type conversion struct {
+	credited float64
+	rate     float64
+}
+
+// moveFunds is transfer() which applies the limits and the fee of the sender only when bySender is true.
+func (nb *netBank) moveFunds(tx *sql.Tx, sender int, reciever int, money float64, bySender bool, quote string) (int64, []*Event, error) {
+	return nb.moveFundsAt(tx, sender, reciever, money, bySender, quote, nil)
+}
+
+// moveFundsAt is moveFunds() which credits the reciever in another currency by fixed instead of the rate of now.
+func (nb *netBank) moveFundsAt(tx *sql.Tx, sender int, reciever int, money float64, bySender bool, quote string, fixed *conversion) (int64, []*Event, error) {
 	if money <= 0 {
-		return nil, fmt.Errorf("amount of transfer is less than zero. from id_%v to id_%v was going to withdraw %v", sender, reciever, money)
+		return 0, nil, fmt.Errorf("amount of transfer is less than zero. from id_%v to id_%v was going to withdraw %v", sender, reciever, money)
+	}
+
+	balances, err := lockBalances(tx, sender, reciever)
+	if err != nil {
+		return 0, nil, err
 	}
 
 	/*--- validation of sender ---*/
-	senderBalance, err := nb.GetBalance(sender)
+	senderBalance, ok := balances[sender]
+	if !ok {
+		return 0, nil, fmt.Errorf("sender's account(ID: %v) is not found: %w", sender, sql.ErrNoRows)
+	}
+
+	fee := &FeeQuote{}
+	if bySender {
+		fee, err = quoteFee(tx, sender, FeeTransfer, money)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	err = checkFunds(tx, sender, senderBalance, money+fee.Fee, "sender's")
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("sender's account(ID: %v) is not found: %w", sender, err)
-		} else {
-			return nil, err
+		return 0, nil, err
+	}
+
+	/*--- validation of reciever ---*/
+	recieverBalance, ok := balances[reciever]
+	if !ok {
+		return 0, nil, fmt.Errorf("reciever's account(ID: %v) is not found: %w", reciever, sql.ErrNoRows)
+	}
+
+	if bySender {
+		err = useLimits(tx, sender, reciever, money)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	currencies, err := accountCurrencies(tx, sender, reciever)
+	if err != nil {
+		return 0, nil, err
+	}
+	payload := &FundsTransfer{From: sender, To: reciever, Amount: money, Currency: currencies[sender]}
+	credited, err := nb.convertTransfer(tx, payload, currencies[reciever], quote, fixed)
+	if err != nil {
+		return 0, nil, err
+	}
+	return nb.postTransfer(tx, payload, senderBalance, recieverBalance, credited, fee, quote)
+}
+
+// convertTransfer converts the money of the payload in the currency of the sender into to, the currency of the reciever,
+// and returns the amount credited to the reciever. the payload gets the conversion when the currencies differ.
+func (nb *netBank) convertTransfer(tx *sql.Tx, payload *FundsTransfer, to string, quote string, fixed *conversion) (float64, error) {
+	switch {
+	case fixed != nil && payload.Currency != to:
+		payload.Credited, payload.CreditedCurrency, payload.Rate = fixed.credited, to, fixed.rate
+	case quote != "":
+		if payload.Currency == to {
+			return 0, fmt.Errorf("transfer from id_%v to id_%v is in %v and cannot redeem a quote", payload.From, payload.To, to)
+		}
+		fq, err := redeemQuote(tx, quote, payload.Currency, to, payload.Amount)
+		if err != nil {
+			return 0, err
 		}
+		payload.Credited, payload.CreditedCurrency, payload.Rate = roundAmount(payload.Amount*fq.Rate, to), to, fq.Rate
+	case payload.Currency != to:
+		converted, r, err := nb.convert(payload.Amount, payload.Currency, to)
+		if err != nil {
+			return 0, err
+		}
+		payload.Credited, payload.CreditedCurrency, payload.Rate = converted, to, r
+	default:
+		return payload.Amount, nil
 	}
+	return payload.Credited, nil
+}
+
+// postTransfer writes the transfer of the payload on the locked balances and charges the fee,
+// and returns the id of the transfer and the events to publish after commit.
+func (nb *netBank) postTransfer(tx *sql.Tx, payload *FundsTransfer, senderBalance float64, recieverBalance float64, credited float64, fee *FeeQuote, quote string) (int64, []*Event, error) {
+	sender, reciever, money := payload.From, payload.To, payload.Amount
 
-	if senderBalance < 0 {
-		return nil, fmt.Errorf("balance is less than 0. id_%v's currenct balance is %v", sender, senderBalance)
+	// withdraw from sender's balance and deposit to reciever's balance.
+	withdraw := "UPDATE account SET balance=$1 WHERE id=$2;"
+	_, err := tx.ExecContext(context.Background(), withdraw, senderBalance-money, sender)
+	if err != nil {
+		return 0, nil, err
+	}
+	deposit := "UPDATE account SET balance=$1 WHERE id=$2;"
+	_, err = tx.ExecContext(context.Background(), deposit, recieverBalance+credited, reciever)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	if senderBalance-money < 0 {
-		return nil, fmt.Errorf("amount is grater than the balance. sender's amount is %v, but the balance is %v", money, senderBalance)
+	sent, err := nb.record(tx, BalanceChanged, sender, -money, reciever)
+	if err != nil {
+		return 0, nil, err
+	}
+	recieved, err := nb.record(tx, BalanceChanged, reciever, credited, sender)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	/*--- validation of reciever ---*/
-	recieverBalance, err := nb.GetBalance(reciever)
+	// a transfer in one currency has no conversion.
+	var creditedAmount, creditedCurrency, rate any
+	if payload.CreditedCurrency != "" {
+		creditedAmount, creditedCurrency, rate = payload.Credited, payload.CreditedCurrency, payload.Rate
+	}
+	var id int64
+	q := `
+	INSERT INTO transfer (sender, reciever, amount, fee, currency, credited, credited_currency, rate)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id;
+	`
+	err = tx.QueryRowContext(context.Background(), q, sender, reciever, money, fee.Fee, payload.Currency, creditedAmount, creditedCurrency, rate).Scan(&id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("reciever's account(ID: %v) is not found: %w", reciever, err)
-		} else {
-			return nil, err
+		return 0, nil, err
+	}
+	payload.ID = id
+
+	if quote != "" {
+		_, err = tx.ExecContext(context.Background(), `UPDATE fx_quote SET transfer_id=$2 WHERE id=$1;`, quote, id)
+		if err != nil {
+			return 0, nil, err
 		}
 	}
 
-	if recieverBalance < 0 {
-		return nil, fmt.Errorf("balance of account_%v is less than 0. currenct balance is %v", reciever, recieverBalance)
+	// the transfer is an event of both accounts, so each is written under its own account
+	// and the relay keeps it in order with the other events of the reciever as well.
+	for _, num := range []int{sender, reciever} {
+		err = nb.enqueue(tx, FundsTransferred, num, payload)
+		if err != nil {
+			return 0, nil, err
+		}
 	}
 
-	// start the transaction
-	tx, err := nb.db.Begin()
+	es, err := nb.chargeFee(tx, fee)
 	if err != nil {
-		return nil, err
+		return 0, nil, err
 	}
-	defer tx.Rollback()
 
-	// withdraw from sender's balance and deposit to reciever's balance.
-	withdraw := "UPDATE account SET balance=$1 WHERE id=$2;"
-	_, err = tx.ExecContext(context.Background(), withdraw, senderBalance-money, sender)
+	return id, append([]*Event{sent, recieved}, es...), nil
+}
+
+// accountCurrencies returns the currencies of the accounts.
+func accountCurrencies(q querier, ids ...int) (map[int]string, error) {
+	args := make([]any, len(ids))
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args[i] = id
+		placeholders[i] = fmt.Sprintf("$%v", i+1)
+	}
+
+	query := `SELECT id, currency FROM account WHERE id IN (` + strings.Join(placeholders, ", ") + `);`
+	rows, err := q.QueryContext(context.Background(), query, args...)
 	if err != nil {
 		return nil, err
-	} else {
-		deposit := "UPDATE account SET balance=$1 WHERE id=$2;"
-		_, err = tx.ExecContext(context.Background(), deposit, recieverBalance+money, reciever)
+	}
+	defer rows.Close()
+
+	currencies := map[int]string{}
+	for rows.Next() {
+		var (
+			id       int
+			currency string
+		)
+		err := rows.Scan(&id, &currency)
 		if err != nil {
 			return nil, err
-		} else {
-			tx.Commit()
 		}
+		currencies[id] = currency
 	}
+	return currencies, rows.Err()
+}
 
-	accounts := make([]*Account, 2)
-	from, err := nb.GetAccount(sender)
-	if err != nil {
-		return nil, err
+// lockBalances returns the balances of the accounts locking them in the order of id to avoid deadlocks.
+// an account which doesn't exist is not in the result.
+func lockBalances(tx *sql.Tx, ids ...int) (map[int]float64, error) {
+	args := make([]any, len(ids))
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args[i] = id
+		placeholders[i] = fmt.Sprintf("$%v", i+1)
 	}
-	to, err := nb.GetAccount(reciever)
+
+	q := `
+	SELECT id, balance
+	FROM account
+	WHERE id IN (` + strings.Join(placeholders, ", ") + `)
+	ORDER BY id
+	FOR UPDATE;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, args...)
 	if err != nil {
 		return nil, err
 	}
-	accounts[0] = from
-	accounts[1] = to
-	return accounts, nil
+	defer rows.Close()
+
+	balances := map[int]float64{}
+	for rows.Next() {
+		var (
+			id      int
+			balance float64
+		)
+		err := rows.Scan(&id, &balance)
+		if err != nil {
+			return nil, err
+		}
+		balances[id] = balance
+	}
+	return balances, rows.Err()
 }
 
 func (nb *netBank) CreateAccount(c *Customer) (*Account, error) {
+	return nb.OpenAccount(c, ProductChecking, DefaultCurrency)
+}
+
+// OpenAccount creates a new account as the product in the currency. empty currency is DefaultCurrency.
+func (nb *netBank) OpenAccount(c *Customer, product string, currency string) (*Account, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	err := checkCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = nb.GetProduct(product)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("product(%v) is not found: %w", product, err)
+	} else if err != nil {
+		return nil, err
+	}
+
 	tx, err := nb.db.Begin()
 	if err != nil {
 		return nil, err
@@ -281,17 +619,24 @@ func (nb *netBank) CreateAccount(c *Customer) (*Account, error) {
 	_, err = tx.ExecContext(context.Background(), q, id, c.Name, c.Address, c.Phone)
 	if err != nil {
 		return nil, err
-	} else {
-		q := `
-		INSERT INTO account (id, balance) 
-		VALUES ($1, $2);
-		`
-		_, err = tx.ExecContext(context.Background(), q, id, float64(0))
-		if err != nil {
-			return nil, err
-		} else {
-			tx.Commit()
-		}
+	}
+	q = `
+	INSERT INTO account (id, balance, product, currency) 
+	VALUES ($1, $2, $3, $4);
+	`
+	_, err = tx.ExecContext(context.Background(), q, id, float64(0), product, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, AccountCreated, id, &Account{Customer: *c, Number: id, IBAN: IBAN(id), Balance: 0, Currency: currency})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
 
 	account, err := nb.GetAccount(id)
@@ -302,19 +647,47 @@ func (nb *netBank) CreateAccount(c *Customer) (*Account, error) {
 }
 
 func (nb *netBank) DeleteAccount(num int) error {
+	err := checkCustomerAccount(num)
+	if err != nil {
+		return err
+	}
+
 	tx, err := nb.db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// check the existence of account having num as id.
+	// check the existence of account having num as id, and lock it so that no loan nor deposit starts while deleting it.
 	_, err = nb.GetAccount(num)
 	if err != nil {
 		return err
 	}
+	_, err = lockBalances(tx, num)
+	if err != nil {
+		return err
+	}
+
+	err = deleteLoans(tx, num)
+	if err != nil {
+		return err
+	}
+	err = deleteTermDeposits(tx, num)
+	if err != nil {
+		return err
+	}
+
+	// record the event before the account row disappears.
+	e, err := nb.record(tx, AccountClosed, num, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	err = nb.enqueue(tx, AccountDeleted, num, &Funds{Account: num, Balance: e.Balance})
+	if err != nil {
+		return err
+	}
 
-	// update the balance
 	q := `
 	DELETE FROM account 
 	WHERE id=$1;
@@ -322,36 +695,40 @@ func (nb *netBank) DeleteAccount(num int) error {
 	_, err = tx.ExecContext(context.Background(), q, num)
 	if err != nil {
 		return err
-	} else {
-		q := `
-		DELETE FROM customer 
-		WHERE id=$1;
-		`
-		_, err = tx.ExecContext(context.Background(), q, num)
-		if err != nil {
-			return err
-		} else {
-			tx.Commit()
-		}
+	}
+	q = `
+	DELETE FROM customer 
+	WHERE id=$1;
+	`
+	_, err = tx.ExecContext(context.Background(), q, num)
+	if err != nil {
+		return err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	publish(e)
+
 	return nil
 }
 
 func (nb *netBank) GetAccounts(min float64, max float64) ([]*Account, error) {
 	var (
-		name    string
-		address string
-		phone   string
-		id      int
-		balance float64
+		name     string
+		address  string
+		phone    string
+		id       int
+		balance  float64
+		currency string
 	)
 
-	q := `SELECT username, addr, phone, account.id, balance 
+	q := `SELECT username, addr, phone, account.id, balance, currency 
 	      FROM account 
 		  INNER JOIN customer 
 		  ON account.id=customer.id
-		  WHERE balance>=$1 AND balance<=$2;`
+		  WHERE balance>=$1 AND balance<=$2 AND account.id>0;`
 	rows, err := nb.db.QueryContext(context.Background(), q, min, max)
 	if err != nil {
 		return nil, err
@@ -362,7 +739,7 @@ func (nb *netBank) GetAccounts(min float64, max float64) ([]*Account, error) {
 
 	// Iterate through the result set
 	for rows.Next() {
-		err := rows.Scan(&name, &address, &phone, &id, &balance)
+		err := rows.Scan(&name, &address, &phone, &id, &balance, &currency)
 		if err != nil {
 			return nil, err
 		}
@@ -373,8 +750,10 @@ func (nb *netBank) GetAccounts(min float64, max float64) ([]*Account, error) {
 				Address: address,
 				Phone:   phone,
 			},
-			Number:  id,
-			Balance: balance,
+			Number:   id,
+			IBAN:     IBAN(id),
+			Balance:  balance,
+			Currency: currency,
 		}
 
 		accounts = append(accounts, account)
@@ -385,21 +764,22 @@ func (nb *netBank) GetAccounts(min float64, max float64) ([]*Account, error) {
 
 func (nb *netBank) GetAccount(num int) (*Account, error) {
 	var (
-		name    string
-		address string
-		phone   string
-		id      int
-		balance float64
+		name     string
+		address  string
+		phone    string
+		id       int
+		balance  float64
+		currency string
 	)
 
-	q := `SELECT username, addr, phone, account.id, balance 
+	q := `SELECT username, addr, phone, account.id, balance, currency 
 	      FROM account 
 		  INNER JOIN customer 
 		  ON account.id=customer.id
-		  WHERE account.id=$1;`
+		  WHERE account.id=$1 AND account.id>0;`
 	row := nb.db.QueryRowContext(context.Background(), q, num)
 
-	err := row.Scan(&name, &address, &phone, &id, &balance)
+	err := row.Scan(&name, &address, &phone, &id, &balance, &currency)
 	if err != nil {
 		return nil, err
 	}
@@ -410,20 +790,23 @@ func (nb *netBank) GetAccount(num int) (*Account, error) {
 			Address: address,
 			Phone:   phone,
 		},
-		Number:  id,
-		Balance: balance,
+		Number:   id,
+		IBAN:     IBAN(id),
+		Balance:  balance,
+		Currency: currency,
 	}
 
 	return &account, nil
 }
 
+// GetBalance returns the balance of the account. unlike GetAccount(), it reads the internal accounts of the bank too.
 func (nb *netBank) GetBalance(id int) (float64, error) {
-	account, err := nb.GetAccount(id)
+	var balance float64
+	err := nb.db.QueryRowContext(context.Background(), `SELECT balance FROM account WHERE id=$1;`, id).Scan(&balance)
 	if err != nil {
 		return 0, err
-	} else {
-		return account.Balance, nil
 	}
+	return balance, nil
 }
 
 func (nb *netBank) GetNewId() (int, error) {
@@ -460,6 +843,11 @@ func (nb *netBank) GetNewId() (int, error) {
 }
 
 func (nb *netBank) UpdateAccount(id int, c *Customer) (*Account, error) {
+	err := checkCustomerAccount(id)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := nb.Begin()
 	if err != nil {
 		return nil, err
@@ -474,10 +862,20 @@ func (nb *netBank) UpdateAccount(id int, c *Customer) (*Account, error) {
 	_, err = tx.ExecContext(context.Background(), q, c.Name, c.Address, c.Phone, id)
 	if err != nil {
 		return nil, err
-	} else {
-		tx.Commit()
 	}
 
+	// record() returns sql.ErrNoRows when the account doesn't exist.
+	e, err := nb.record(tx, ProfileUpdated, id, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(e)
+
 	account, err := nb.GetAccount(id)
 	if err != nil {
 		return nil, err
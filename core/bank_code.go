@@ -0,0 +1,353 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+const (
+	// DomesticClearingAccount holds the money of outgoing transfers to other banks until they are settled.
+	DomesticClearingAccount = -4
+
+	// 預金種目 of accounts in other banks.
+	AccountTypeOrdinary = "1"
+	AccountTypeCurrent  = "2"
+	AccountTypeSavings  = "4"
+	AccountTypeOther    = "9"
+
+	bankCodeDigits   = 4
+	branchCodeDigits = 3
+	// the width of 受取人名 in zengin files.
+	maxPayeeNameLength = 30
+)
+
+// ErrInvalidBeneficiary is matched by errors.Is() when an account of another bank is malformed or unknown.
+var ErrInvalidBeneficiary = errors.New("invalid beneficiary")
+
+// FinancialInstitution is a 金融機関 by its 金融機関コード. Kana is in half-width.
+type FinancialInstitution struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Kana string `json:"kana"`
+}
+
+// Branch is a 支店 of a bank by its 支店コード. Kana is in half-width.
+type Branch struct {
+	Bank string `json:"bank"`
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Kana string `json:"kana"`
+}
+
+// BankCodeLoad is the result of loading the codes from a CSV.
+type BankCodeLoad struct {
+	Banks    int `json:"banks"`
+	Branches int `json:"branches"`
+}
+
+// KanaName is an account holder name in katakana. Half is the form of zengin files and Full is for display.
+type KanaName struct {
+	Half string `json:"half"`
+	Full string `json:"full"`
+}
+
+// Beneficiary is an account in another bank. Name is the account holder name in katakana.
+type Beneficiary struct {
+	Bank          string `json:"bank"`
+	BankName      string `json:"bank_name,omitempty"`
+	Branch        string `json:"branch"`
+	BranchName    string `json:"branch_name,omitempty"`
+	AccountType   string `json:"account_type"`
+	AccountNumber string `json:"account_number"`
+	Name          string `json:"name"`
+}
+
+// OutgoingTransfer is a transfer to an account in another bank. the money is in DomesticClearingAccount until it is settled.
+type OutgoingTransfer struct {
+	ID          int64        `json:"id"`
+	Account     int          `json:"account"`
+	Transfer    int64        `json:"transfer"`
+	Beneficiary *Beneficiary `json:"beneficiary"`
+	Amount      float64      `json:"amount"`
+	Fee         float64      `json:"fee,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// NormalizeKanaName converts a name in half-width or full-width katakana, hiragana or latin letters
+// into both widths. spaces are squeezed, and characters which cannot be in zengin files are an error.
+func NormalizeKanaName(s string) (*KanaName, error) {
+	half, err := ZenginKana(strings.Join(strings.Fields(strings.ReplaceAll(s, "　", " ")), " "))
+	if err != nil {
+		return nil, err
+	}
+	if half == "" {
+		return nil, fmt.Errorf("name is empty")
+	}
+
+	// the voiced sound marks are made combining, so that NFC puts them into the kana.
+	// ZenginKana() wrote the long vowel mark as a hyphen, and it is back in full-width.
+	full := width.Widen.String(half)
+	full = strings.NewReplacer("゛", "\u3099", "゜", "\u309a", "－", "ー").Replace(full)
+	return &KanaName{Half: half, Full: norm.NFC.String(full)}, nil
+}
+
+func checkDigits(s string, n int, what string) error {
+	if len(s) != n || strings.Trim(s, "0123456789") != "" {
+		return fmt.Errorf("%v must be %v digits. your input is %v: %w", what, n, s, ErrInvalidBeneficiary)
+	}
+	return nil
+}
+
+// checkAccountType checks 預金種目. 1 is 普通, 2 is 当座, 4 is 貯蓄 and 9 is その他.
+func checkAccountType(t string) error {
+	switch t {
+	case AccountTypeOrdinary, AccountTypeCurrent, AccountTypeSavings, AccountTypeOther:
+		return nil
+	}
+	return fmt.Errorf("account type must be %v, %v, %v or %v. your input is %v: %w",
+		AccountTypeOrdinary, AccountTypeCurrent, AccountTypeSavings, AccountTypeOther, t, ErrInvalidBeneficiary)
+}
+
+// normalizeAccountNumber pads 口座番号 with zeros to 7 digits.
+func normalizeAccountNumber(s string) (string, error) {
+	if s == "" || len(s) > zenginAccountDigits || strings.Trim(s, "0123456789") != "" {
+		return "", fmt.Errorf("account number must be up to %v digits. your input is %v: %w", zenginAccountDigits, s, ErrInvalidBeneficiary)
+	}
+	return strings.Repeat("0", zenginAccountDigits-len(s)) + s, nil
+}
+
+// LoadBankCodes replaces the banks and the branches with the CSV of
+// bank_code,bank_name,bank_kana,branch_code,branch_name,branch_kana. the header line is optional.
+// kana may be in half-width or full-width, and are stored in half-width.
+func (nb *netBank) LoadBankCodes(r io.Reader) (*BankCodeLoad, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 6
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	banks := map[string]*FinancialInstitution{}
+	branches := []*Branch{}
+	for i, record := range records {
+		if i == 0 && record[0] == "bank_code" {
+			continue
+		}
+		bank := &FinancialInstitution{Code: record[0], Name: record[1]}
+		branch := &Branch{Bank: record[0], Code: record[3], Name: record[4]}
+		if err := checkDigits(bank.Code, bankCodeDigits, "bank code"); err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
+		}
+		if err := checkDigits(branch.Code, branchCodeDigits, "branch code"); err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
+		}
+		bank.Kana, err = ZenginKana(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
+		}
+		branch.Kana, err = ZenginKana(record[5])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
+		}
+		if _, ok := banks[bank.Code]; !ok {
+			banks[bank.Code] = bank
+		}
+		branches = append(branches, branch)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(context.Background(), `DELETE FROM bank_branch; DELETE FROM financial_institution;`)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range banks {
+		q := `INSERT INTO financial_institution (code, name, kana) VALUES ($1, $2, $3);`
+		_, err = tx.ExecContext(context.Background(), q, b.Code, b.Name, b.Kana)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range branches {
+		q := `
+		INSERT INTO bank_branch (bank_code, code, name, kana) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (bank_code, code) DO UPDATE SET name=EXCLUDED.name, kana=EXCLUDED.kana;
+		`
+		_, err = tx.ExecContext(context.Background(), q, b.Bank, b.Code, b.Name, b.Kana)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &BankCodeLoad{Banks: len(banks), Branches: len(branches)}, nil
+}
+
+// GetFinancialInstitution returns the bank of the code without the branches.
+func (nb *netBank) GetFinancialInstitution(code string) (*FinancialInstitution, error) {
+	b := &FinancialInstitution{}
+	q := `SELECT code, name, kana FROM financial_institution WHERE code=$1;`
+	err := nb.db.QueryRowContext(context.Background(), q, code).Scan(&b.Code, &b.Name, &b.Kana)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetBranches returns the branches of the bank in the order of the code.
+func (nb *netBank) GetBranches(bank string) ([]*Branch, error) {
+	_, err := nb.GetFinancialInstitution(bank)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `SELECT bank_code, code, name, kana FROM bank_branch WHERE bank_code=$1 ORDER BY code;`
+	rows, err := nb.db.QueryContext(context.Background(), q, bank)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bs := []*Branch{}
+	for rows.Next() {
+		b := &Branch{}
+		err := rows.Scan(&b.Bank, &b.Code, &b.Name, &b.Kana)
+		if err != nil {
+			return nil, err
+		}
+		bs = append(bs, b)
+	}
+	return bs, rows.Err()
+}
+
+// GetBranch returns the branch of the bank.
+func (nb *netBank) GetBranch(bank string, code string) (*Branch, error) {
+	b := &Branch{}
+	q := `SELECT bank_code, code, name, kana FROM bank_branch WHERE bank_code=$1 AND code=$2;`
+	err := nb.db.QueryRowContext(context.Background(), q, bank, code).Scan(&b.Bank, &b.Code, &b.Name, &b.Kana)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CheckBeneficiary checks the formats of the account in another bank and looks up the bank and the branch.
+// the returned beneficiary has the names of them, the account number in 7 digits and the name in half-width katakana.
+func (nb *netBank) CheckBeneficiary(b *Beneficiary) (*Beneficiary, error) {
+	err := checkDigits(b.Bank, bankCodeDigits, "bank code")
+	if err != nil {
+		return nil, err
+	}
+	if b.Bank == zenginBankCode() {
+		return nil, fmt.Errorf("bank %v is this bank. transfer to the account directly: %w", b.Bank, ErrInvalidBeneficiary)
+	}
+	err = checkDigits(b.Branch, branchCodeDigits, "branch code")
+	if err != nil {
+		return nil, err
+	}
+	err = checkAccountType(b.AccountType)
+	if err != nil {
+		return nil, err
+	}
+	number, err := normalizeAccountNumber(b.AccountNumber)
+	if err != nil {
+		return nil, err
+	}
+	name, err := NormalizeKanaName(b.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidBeneficiary)
+	}
+	if len([]rune(name.Half)) > maxPayeeNameLength {
+		return nil, fmt.Errorf("name %v is longer than %v characters: %w", name.Half, maxPayeeNameLength, ErrInvalidBeneficiary)
+	}
+
+	bank, err := nb.GetFinancialInstitution(b.Bank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("bank %v doesnt exist: %w", b.Bank, ErrInvalidBeneficiary)
+	} else if err != nil {
+		return nil, err
+	}
+	branch, err := nb.GetBranch(b.Bank, b.Branch)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("branch %v of bank %v doesnt exist: %w", b.Branch, b.Bank, ErrInvalidBeneficiary)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &Beneficiary{
+		Bank:          bank.Code,
+		BankName:      bank.Name,
+		Branch:        branch.Code,
+		BranchName:    branch.Name,
+		AccountType:   b.AccountType,
+		AccountNumber: number,
+		Name:          name.Half,
+	}, nil
+}
+
+// SendDomesticTransfer sends the money from the account in JPY to the account in another bank.
+// the beneficiary is checked before anything is posted, and the limits and the fee of transfers apply.
+func (nb *netBank) SendDomesticTransfer(num int, b *Beneficiary, amount float64) (*OutgoingTransfer, error) {
+	beneficiary, err := nb.CheckBeneficiary(b)
+	if err != nil {
+		return nil, err
+	}
+	_, err = nb.checkZenginAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	if amount != float64(int64(amount)) {
+		return nil, fmt.Errorf("amount %v is not in yen", amount)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, es, err := nb.transfer(tx, num, DomesticClearingAccount, amount, "")
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	INSERT INTO outgoing_transfer (account_id, transfer_id, bank_code, branch_code, account_type, account_number, name, amount)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at;
+	`
+	o := &OutgoingTransfer{Account: num, Transfer: id, Beneficiary: beneficiary, Amount: amount}
+	err = tx.QueryRowContext(context.Background(), q, num, id, beneficiary.Bank, beneficiary.Branch, beneficiary.AccountType,
+		beneficiary.AccountNumber, beneficiary.Name, amount).Scan(&o.ID, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.QueryRowContext(context.Background(), `SELECT fee FROM transfer WHERE id=$1;`, id).Scan(&o.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return o, nil
+}
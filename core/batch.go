@@ -0,0 +1,254 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+const (
+	// BatchAtomic commits all lines or none of them.
+	BatchAtomic = "atomic"
+	// BatchBestEffort commits the lines that succeed and reports the others.
+	BatchBestEffort = "best-effort"
+
+	LineSucceeded  = "succeeded"
+	LineFailed     = "failed"
+	LineRolledBack = "rolled-back"
+	LineSkipped    = "skipped"
+
+	maxBatchLines = 1000
+)
+
+// BatchLine is the result of a trade in a batch.
+type BatchLine struct {
+	Line     int     `json:"line"`
+	To       int     `json:"to"`
+	Amount   float64 `json:"amount"`
+	Status   string  `json:"status"`
+	Transfer int64   `json:"transfer,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	Code     string  `json:"code,omitempty"`
+	// err is the error of a failed line, which callers map to codes of their own.
+	err error
+}
+
+type BatchResult struct {
+	Mode      string       `json:"mode"`
+	Committed bool         `json:"committed"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Lines     []*BatchLine `json:"lines"`
+}
+
+// BatchTransfer sends the trades from the sender in one transaction.
+// the sender and the recievers are locked once at the beginning, and the balances, the limits and the fee of the sender
+// are kept in memory across the lines, so the batch costs one commit and one read of them instead of one per trade.
+// in atomic mode the first failure rolls back the whole batch, and in best-effort mode it rolls back only the line.
+func (nb *netBank) BatchTransfer(sender int, ts []*Trade, mode string) (*BatchResult, error) {
+	if mode == "" {
+		mode = BatchAtomic
+	}
+	if mode != BatchAtomic && mode != BatchBestEffort {
+		return nil, fmt.Errorf("mode of batch must be %v or %v. your input is %v", BatchAtomic, BatchBestEffort, mode)
+	}
+	if len(ts) == 0 || len(ts) > maxBatchLines {
+		return nil, fmt.Errorf("number of trades must be between 1 and %v. your input is %v", maxBatchLines, len(ts))
+	}
+	err := checkCustomerAccount(sender)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// every account is locked at once in the order of id as transfer() does, which prevents deadlocks with other transfers.
+	ids := []int{sender}
+	seen := map[int]bool{sender: true}
+	for _, t := range ts {
+		// an internal account fails its line without being locked.
+		if !seen[int(t.To)] && t.To > 0 {
+			seen[int(t.To)] = true
+			ids = append(ids, int(t.To))
+		}
+	}
+	state, err := loadBatchState(tx, sender, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Mode: mode, Lines: make([]*BatchLine, len(ts))}
+	published := []*Event{}
+	for i, t := range ts {
+		line := &BatchLine{Line: i + 1, To: int(t.To), Amount: t.Amount}
+		result.Lines[i] = line
+
+		// after a failure of atomic mode, the rest is not tried.
+		if mode == BatchAtomic && result.Failed > 0 {
+			line.Status = LineSkipped
+			continue
+		}
+
+		if mode == BatchBestEffort {
+			_, err := tx.ExecContext(context.Background(), "SAVEPOINT batch_line;")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		id, es, transferErr := nb.batchLine(tx, state, t)
+		if mode == BatchBestEffort {
+			if transferErr != nil {
+				_, err = tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT batch_line;")
+			} else {
+				_, err = tx.ExecContext(context.Background(), "RELEASE SAVEPOINT batch_line;")
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if transferErr != nil {
+			line.Status = LineFailed
+			line.Error = transferErr.Error()
+			line.err = transferErr
+			var le *LimitError
+			if errors.As(transferErr, &le) {
+				line.Code = le.Code()
+			}
+			result.Failed++
+			continue
+		}
+		line.Status = LineSucceeded
+		line.Transfer = id
+		result.Succeeded++
+		published = append(published, es...)
+	}
+
+	if mode == BatchAtomic && result.Failed > 0 {
+		for _, line := range result.Lines {
+			if line.Status == LineSucceeded {
+				line.Status = LineRolledBack
+				line.Transfer = 0
+			}
+		}
+		result.Succeeded = 0
+		return result, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	result.Committed = true
+	publish(published...)
+	return result, nil
+}
+
+// batchState is what the lines of a batch read, loaded once after the accounts are locked.
+// it is updated only after a line succeeds, so that a line rolled back in best-effort mode leaves it as it was.
+type batchState struct {
+	sender     int
+	balances   map[int]float64
+	currencies map[int]string
+	held       float64
+	overdraft  float64
+	limits     *limitUsage
+	fees       *feeUsage
+}
+
+func loadBatchState(tx *sql.Tx, sender int, ids []int) (*batchState, error) {
+	balances, err := lockBalances(tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := balances[sender]; !ok {
+		return nil, fmt.Errorf("sender's account(ID: %v) is not found: %w", sender, sql.ErrNoRows)
+	}
+	s := &batchState{sender: sender, balances: balances}
+
+	s.currencies, err = accountCurrencies(tx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	s.held, err = heldAmount(tx, sender)
+	if err != nil {
+		return nil, err
+	}
+	s.overdraft, err = overdraftLimit(tx, sender)
+	if err != nil {
+		return nil, err
+	}
+	s.limits, err = loadLimitUsage(tx, sender)
+	if err != nil {
+		return nil, err
+	}
+	s.fees, err = loadFeeUsage(tx, sender, FeeTransfer)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// batchLine is transfer() on the state of the batch, which reads only the rate of a conversion from the database.
+func (nb *netBank) batchLine(tx *sql.Tx, s *batchState, t *Trade) (int64, []*Event, error) {
+	sender, reciever, money := s.sender, int(t.To), t.Amount
+	if t.Class != "" && t.Class != "transfer" {
+		return 0, nil, fmt.Errorf("class of trade in batch must be transfer. your input is %v", t.Class)
+	}
+	if t.From != 0 && int(t.From) != sender {
+		return 0, nil, fmt.Errorf("trade from id_%v cannot be in the batch of id_%v", t.From, sender)
+	}
+	if reciever == sender {
+		return 0, nil, fmt.Errorf("trade to id_%v cannot be in the batch of id_%v", reciever, sender)
+	}
+	err := checkCustomerAccount(reciever)
+	if err != nil {
+		return 0, nil, err
+	}
+	if money <= 0 {
+		return 0, nil, fmt.Errorf("amount of transfer is less than zero. from id_%v to id_%v was going to withdraw %v", sender, reciever, money)
+	}
+	err = nb.CheckTrade(sender, t)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fee := s.fees.quote(sender, FeeTransfer, money)
+	err = fundsError(s.balances[sender], s.held, s.overdraft, money+fee.Fee, "sender's")
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, ok := s.balances[reciever]; !ok {
+		return 0, nil, fmt.Errorf("reciever's account(ID: %v) is not found: %w", reciever, sql.ErrNoRows)
+	}
+	err = s.limits.check(reciever, money)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload := &FundsTransfer{From: sender, To: reciever, Amount: money, Currency: s.currencies[sender]}
+	credited, err := nb.convertTransfer(tx, payload, s.currencies[reciever], t.Quote, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = recordLimitUsage(tx, sender, reciever, money)
+	if err != nil {
+		return 0, nil, err
+	}
+	id, es, err := nb.postTransfer(tx, payload, s.balances[sender], s.balances[reciever], credited, fee, t.Quote)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.balances[sender] -= money + fee.Fee
+	s.balances[reciever] += credited
+	s.limits.use(reciever, money)
+	s.fees.use()
+	return id, es, nil
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// EventBus delivers events published by any netBank to the subscribers of the account.
+type EventBus interface {
+	Publish(es ...*Event) error
+	Subscribe(account int) (<-chan *Event, func())
+	Close() error
+}
+
+var (
+	busMu sync.RWMutex
+	bus   EventBus = NewInProcessBus()
+)
+
+// SetEventBus replaces the event bus which account mutations publish to.
+func SetEventBus(b EventBus) {
+	busMu.Lock()
+	defer busMu.Unlock()
+	bus = b
+}
+
+func eventBus() EventBus {
+	busMu.RLock()
+	defer busMu.RUnlock()
+	return bus
+}
+
+// Subscribe returns a channel which receives events of the account, and a function to unsubscribe.
+// the channel is closed when the subscriber may have missed events,
+// so the subscriber should resume from the journal with EventsSince().
+func Subscribe(account int) (<-chan *Event, func()) {
+	return eventBus().Subscribe(account)
+}
+
+// publish is called after the transaction is committed.
+// the events are already in the journal, so a failure here is only logged.
+func publish(es ...*Event) {
+	err := eventBus().Publish(es...)
+	if err != nil {
+		log.Printf("failed to publish events: %v", err)
+	}
+}
+
+// InProcessBus fans out events to the subscribers in this process.
+type InProcessBus struct {
+	mu   sync.Mutex
+	subs map[int]map[chan *Event]struct{}
+}
+
+func NewInProcessBus() *InProcessBus {
+	return &InProcessBus{subs: map[int]map[chan *Event]struct{}{}}
+}
+
+func (b *InProcessBus) Publish(es ...*Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range es {
+		for ch := range b.subs[e.Account] {
+			select {
+			case ch <- e:
+			default:
+				// don't block the bank for a slow subscriber.
+				delete(b.subs[e.Account], ch)
+				close(ch)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *InProcessBus) Subscribe(account int) (<-chan *Event, func()) {
+	ch := make(chan *Event, 16)
+
+	b.mu.Lock()
+	if b.subs[account] == nil {
+		b.subs[account] = map[chan *Event]struct{}{}
+	}
+	b.subs[account][ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[account][ch]; ok {
+			delete(b.subs[account], ch)
+			close(ch)
+		}
+		if len(b.subs[account]) == 0 {
+			delete(b.subs, account)
+		}
+	}
+	return ch, cancel
+}
+
+// Close closes all subscriptions.
+func (b *InProcessBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for account, chs := range b.subs {
+		for ch := range chs {
+			close(ch)
+		}
+		delete(b.subs, account)
+	}
+	return nil
+}
+
+const eventChannel = "netbank_events"
+
+// PostgresBus delivers events to every instance connected to the same db with LISTEN/NOTIFY.
+// an event published by this instance also comes back through the notification,
+// so the local subscribers receive events in the order of the db.
+type PostgresBus struct {
+	db     *sql.DB
+	local  *InProcessBus
+	source string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPostgresBus connects the db of the environment and starts listening.
+func NewPostgresBus() (*PostgresBus, error) {
+	driver, source := dataSource()
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &PostgresBus{
+		db:     db,
+		local:  NewInProcessBus(),
+		source: source,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// the first connection is made synchronously to report a wrong configuration.
+	conn, err := b.listen(ctx)
+	if err != nil {
+		cancel()
+		db.Close()
+		return nil, err
+	}
+	go b.run(ctx, conn)
+	return b, nil
+}
+
+func (b *PostgresBus) Publish(es ...*Event) error {
+	for _, e := range es {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = b.db.ExecContext(context.Background(), "SELECT pg_notify($1, $2);", eventChannel, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBus) Subscribe(account int) (<-chan *Event, func()) {
+	return b.local.Subscribe(account)
+}
+
+func (b *PostgresBus) Close() error {
+	b.cancel()
+	<-b.done
+	b.local.Close()
+	return b.db.Close()
+}
+
+func (b *PostgresBus) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, b.source)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Exec(ctx, "LISTEN "+eventChannel+";")
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run receives notifications and reconnects when the connection is lost.
+func (b *PostgresBus) run(ctx context.Context, conn *pgx.Conn) {
+	defer close(b.done)
+
+	backoff := time.Second
+	for {
+		if conn != nil {
+			err := b.receive(ctx, conn)
+			conn.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("lost the connection of %v: %v", eventChannel, err)
+
+			// notifications sent while disconnected are lost.
+			// closing the subscriptions makes the subscribers resume from the journal.
+			b.local.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		var err error
+		conn, err = b.listen(ctx)
+		if err != nil {
+			log.Printf("failed to listen %v: %v", eventChannel, err)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		// a subscriber which came while disconnected read the journal before missing the notifications,
+		// so the subscriptions are closed again once listening, and the subscribers resume after it.
+		b.local.Close()
+	}
+}
+
+func (b *PostgresBus) receive(ctx context.Context, conn *pgx.Conn) error {
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var e Event
+		err = json.Unmarshal([]byte(n.Payload), &e)
+		if err != nil {
+			log.Printf("got invalid event on %v: %v", eventChannel, err)
+			continue
+		}
+		b.local.Publish(&e)
+	}
+}
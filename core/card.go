@@ -0,0 +1,541 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	CardActive    = "active"
+	CardFrozen    = "frozen"
+	CardCancelled = "cancelled"
+
+	AuthorizationApproved = "approved"
+	AuthorizationDeclined = "declined"
+	AuthorizationCleared  = "cleared"
+	AuthorizationVoided   = "voided"
+
+	CardIssued        = "CardIssued"
+	CardAuthorized    = "CardAuthorized"
+	CardPaymentClosed = "CardPaymentClosed"
+
+	// the first digits of the card numbers unless CARD_BIN is set.
+	defaultCardBIN = "400000"
+	cardPANLength  = 16
+	// a card is valid until the end of the month this many years later.
+	cardValidYears = 3
+	expiryLayout   = "01/06"
+	// a card is frozen when the cvv is wrong this many times in a row.
+	maxCVVAttempts = 3
+)
+
+var (
+	// ErrCardCancelled is matched by errors.Is() when the status of a cancelled card is changed.
+	ErrCardCancelled = errors.New("card is cancelled")
+	// ErrAuthorizationNotOpen is matched by errors.Is() when an authorization is declined, cleared or voided.
+	ErrAuthorizationNotOpen = errors.New("authorization is not open")
+	// ErrNoCardSecret is matched by errors.Is() when CARD_SECRET is not set.
+	ErrNoCardSecret = errors.New("card secret is not set")
+)
+
+// Card is a virtual debit card of an account. PAN and CVV are only returned by IssueCard(),
+// because only their hashes and the last digits of PAN are stored.
+type Card struct {
+	ID        int64     `json:"id"`
+	Account   int       `json:"account"`
+	PAN       string    `json:"pan"`
+	Expiry    string    `json:"expiry"`
+	CVV       string    `json:"cvv,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuthorizationRequest is sent by a merchant to authorize a card payment.
+type AuthorizationRequest struct {
+	PAN      string  `json:"pan"`
+	Expiry   string  `json:"expiry"`
+	CVV      string  `json:"cvv"`
+	Amount   float64 `json:"amount"`
+	Merchant string  `json:"merchant"`
+}
+
+// CardAuthorization is the result of an AuthorizationRequest. an approved authorization holds the amount
+// until it is cleared into a withdrawal or voided. Reason tells why it is declined, e.g. insufficient_funds.
+type CardAuthorization struct {
+	ID        int64     `json:"id"`
+	Card      int64     `json:"card"`
+	Account   int       `json:"account"`
+	Amount    float64   `json:"amount"`
+	Cleared   float64   `json:"cleared"`
+	Merchant  string    `json:"merchant"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Hold      int64     `json:"hold,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// luhnValid tells whether the last digit of the number is its Luhn check digit.
+func luhnValid(pan string) bool {
+	if len(pan) < 12 || len(pan) > 19 {
+		return false
+	}
+	var sum int
+	double := false
+	for i := len(pan) - 1; i >= 0; i-- {
+		d := int(pan[i] - '0')
+		if d < 0 || d > 9 {
+			return false
+		}
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// luhnDigit returns the check digit to append to the payload.
+func luhnDigit(payload string) byte {
+	var sum int
+	double := true
+	for i := len(payload) - 1; i >= 0; i-- {
+		d := int(payload[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func randomDigits(n int) (string, error) {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		d, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(d.String())
+	}
+	return b.String(), nil
+}
+
+// cardSecret reads CARD_SECRET, which keys the hashes of the card numbers and the cvvs.
+// a plain hash of them is reversed by trying every number, so it is not enough without the key.
+func cardSecret() ([]byte, error) {
+	env := os.Getenv("CARD_SECRET")
+	if len(env) < 32 {
+		return nil, fmt.Errorf("CARD_SECRET must be at least 32 characters: %w", ErrNoCardSecret)
+	}
+	return []byte(env), nil
+}
+
+func hmacHex(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashPAN is the key to find the card of a number.
+func hashPAN(key []byte, pan string) string {
+	return hmacHex(key, "pan:"+pan)
+}
+
+func hashCVV(key []byte, pan string, cvv string) string {
+	return hmacHex(key, "cvv:"+pan+":"+cvv)
+}
+
+func maskPAN(pan string) string {
+	if len(pan) <= 4 {
+		return pan
+	}
+	return strings.Repeat("*", len(pan)-4) + pan[len(pan)-4:]
+}
+
+const cardColumns = `id, account_id, pan_last4, expires_on, status, created_at`
+
+func scanCard(row interface{ Scan(...any) error }) (*Card, error) {
+	c := &Card{}
+	var (
+		last4     string
+		expiresOn time.Time
+	)
+	err := row.Scan(&c.ID, &c.Account, &last4, &expiresOn, &c.Status, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.PAN = maskPAN(strings.Repeat("0", cardPANLength-len(last4)) + last4)
+	c.Expiry = expiresOn.Format(expiryLayout)
+	return c, nil
+}
+
+// IssueCard issues a new virtual debit card of the account.
+func (nb *netBank) IssueCard(num int) (*Card, error) {
+	bin := os.Getenv("CARD_BIN")
+	if bin == "" {
+		bin = defaultCardBIN
+	}
+	key, err := cardSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := balances[num]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	var pan string
+	for {
+		digits, err := randomDigits(cardPANLength - len(bin) - 1)
+		if err != nil {
+			return nil, err
+		}
+		pan = bin + digits
+		pan += string(luhnDigit(pan))
+
+		var exists bool
+		err = tx.QueryRowContext(context.Background(), `SELECT EXISTS (SELECT 1 FROM card WHERE pan_hash=$1);`, hashPAN(key, pan)).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			break
+		}
+	}
+
+	cvv, err := randomDigits(3)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresOn := monthDay(now.Year()+cardValidYears, now.Month(), 31)
+	q := `
+	INSERT INTO card (account_id, pan_hash, pan_last4, expires_on, cvv_hash)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING ` + cardColumns + `;`
+	c, err := scanCard(tx.QueryRowContext(context.Background(), q, num, hashPAN(key, pan), pan[len(pan)-4:], expiresOn.Format(dateLayout), hashCVV(key, pan, cvv)))
+	if err != nil {
+		return nil, err
+	}
+
+	// the outbox is delivered to webhooks, so it only gets the masked card.
+	err = nb.enqueue(tx, CardIssued, num, c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	c.PAN = pan
+	c.CVV = cvv
+	return c, nil
+}
+
+func (nb *netBank) GetCards(num int) ([]*Card, error) {
+	q := `SELECT ` + cardColumns + ` FROM card WHERE account_id=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cs := []*Card{}
+	for rows.Next() {
+		c, err := scanCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return cs, rows.Err()
+}
+
+// SetCardStatus freezes, unfreezes or cancels the card. a cancelled card cannot be changed anymore.
+// unfreezing the card clears the count of the wrong cvvs.
+func (nb *netBank) SetCardStatus(num int, id int64, status string) (*Card, error) {
+	if status != CardActive && status != CardFrozen && status != CardCancelled {
+		return nil, fmt.Errorf("status of card must be %v, %v or %v. your input is %v", CardActive, CardFrozen, CardCancelled, status)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	q := `SELECT status FROM card WHERE id=$1 AND account_id=$2 FOR UPDATE;`
+	err = tx.QueryRowContext(context.Background(), q, id, num).Scan(&current)
+	if err != nil {
+		return nil, err
+	}
+	if current == CardCancelled {
+		return nil, fmt.Errorf("card(ID: %v) cannot be %v: %w", id, status, ErrCardCancelled)
+	}
+
+	q = `
+	UPDATE card
+	SET status=$2, failed_cvv=CASE WHEN $2=$3 THEN 0 ELSE failed_cvv END, updated_at=now()
+	WHERE id=$1
+	RETURNING ` + cardColumns + `;`
+	c, err := scanCard(tx.QueryRowContext(context.Background(), q, id, status, CardActive))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+const authorizationColumns = `id, card_id, account_id, amount, cleared, merchant, status, reason, COALESCE(hold_id, 0), created_at`
+
+func scanAuthorization(row interface{ Scan(...any) error }) (*CardAuthorization, error) {
+	a := &CardAuthorization{}
+	err := row.Scan(&a.ID, &a.Card, &a.Account, &a.Amount, &a.Cleared, &a.Merchant, &a.Status, &a.Reason, &a.Hold, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authorize checks the card and the available balance of its account, and holds the amount when it is approved.
+// a declined authorization is recorded and returned without error. an unknown card returns sql.ErrNoRows.
+// the card is frozen after maxCVVAttempts wrong cvvs in a row, so the cvv cannot be guessed by trying them all.
+func (nb *netBank) Authorize(r *AuthorizationRequest) (*CardAuthorization, error) {
+	if r.Amount <= 0 {
+		return nil, fmt.Errorf("amount of authorization is less than zero. your input is %v", r.Amount)
+	}
+	if !luhnValid(r.PAN) {
+		return nil, fmt.Errorf("got %v as invalid card number", maskPAN(r.PAN))
+	}
+	key, err := cardSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id        int64
+		num       int
+		expiresOn time.Time
+		cvvHash   string
+		status    string
+		failed    int
+	)
+	// the card is locked so that the wrong cvvs sent at the same time are all counted.
+	q := `SELECT id, account_id, expires_on, cvv_hash, status, failed_cvv FROM card WHERE pan_hash=$1 FOR UPDATE;`
+	err = tx.QueryRowContext(context.Background(), q, hashPAN(key, r.PAN)).Scan(&id, &num, &expiresOn, &cvvHash, &status, &failed)
+	if err != nil {
+		return nil, err
+	}
+
+	cvvValid := subtle.ConstantTimeCompare([]byte(hashCVV(key, r.PAN, r.CVV)), []byte(cvvHash)) == 1
+	if status == CardActive && (!cvvValid || failed > 0) {
+		if cvvValid {
+			failed = 0
+		} else {
+			failed++
+		}
+		if failed >= maxCVVAttempts {
+			status = CardFrozen
+		}
+		q = `UPDATE card SET failed_cvv=$2, status=$3, updated_at=now() WHERE id=$1;`
+		_, err = tx.ExecContext(context.Background(), q, id, failed, status)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// a frozen card doesn't tell whether the cvv is right, so it cannot be guessed after the card is frozen.
+	var reason string
+	switch {
+	case status == CardFrozen:
+		reason = "card_frozen"
+	case status == CardCancelled:
+		reason = "card_cancelled"
+	case !cvvValid:
+		reason = "invalid_cvv"
+	case r.Expiry != expiresOn.Format(expiryLayout):
+		reason = "invalid_expiry"
+	case expiresOn.Before(truncateDate(time.Now())):
+		reason = "card_expired"
+	}
+
+	var hold any
+	if reason == "" {
+		h, err := placeHold(tx, num, r.Amount, time.Now().Add(defaultHoldExpiry), fmt.Sprintf("card %v at %v", maskPAN(r.PAN), r.Merchant))
+		if errors.Is(err, ErrInsufficientFunds) {
+			reason = "insufficient_funds"
+		} else if err != nil {
+			return nil, err
+		} else {
+			hold = h.ID
+		}
+	}
+
+	authorization := AuthorizationApproved
+	if reason != "" {
+		authorization = AuthorizationDeclined
+	}
+	q = `
+	INSERT INTO card_authorization (card_id, account_id, amount, merchant, status, reason, hold_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING ` + authorizationColumns + `;`
+	a, err := scanAuthorization(tx.QueryRowContext(context.Background(), q, id, num, r.Amount, r.Merchant, authorization, reason, hold))
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status == AuthorizationApproved {
+		err = nb.enqueue(tx, CardAuthorized, num, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (nb *netBank) GetAuthorization(id int64) (*CardAuthorization, error) {
+	q := `SELECT ` + authorizationColumns + ` FROM card_authorization WHERE id=$1;`
+	return scanAuthorization(nb.db.QueryRowContext(context.Background(), q, id))
+}
+
+// lockAuthorization locks an approved authorization in the transaction.
+func lockAuthorization(tx *sql.Tx, id int64) (*CardAuthorization, error) {
+	q := `SELECT ` + authorizationColumns + ` FROM card_authorization WHERE id=$1 FOR UPDATE;`
+	a, err := scanAuthorization(tx.QueryRowContext(context.Background(), q, id))
+	if err != nil {
+		return nil, err
+	}
+	if a.Status != AuthorizationApproved {
+		return nil, fmt.Errorf("authorization(ID: %v) is already %v: %w", id, a.Status, ErrAuthorizationNotOpen)
+	}
+	return a, nil
+}
+
+// ClearAuthorization withdraws the amount of the authorization from the account by capturing its hold.
+// zero amount clears the whole authorization. the limits and the fee of withdrawals are applied as CaptureHold().
+func (nb *netBank) ClearAuthorization(id int64, amount float64) (*CardAuthorization, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a, err := lockAuthorization(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	h, es, err := nb.captureHold(tx, a.Account, a.Hold, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	UPDATE card_authorization
+	SET status=$2, cleared=$3, updated_at=now()
+	WHERE id=$1
+	RETURNING ` + authorizationColumns + `;`
+	a, err = scanAuthorization(tx.QueryRowContext(context.Background(), q, id, AuthorizationCleared, h.Captured))
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, CardPaymentClosed, a.Account, a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return a, nil
+}
+
+// VoidAuthorization releases the hold of the authorization without withdrawing it.
+func (nb *netBank) VoidAuthorization(id int64) (*CardAuthorization, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	a, err := lockAuthorization(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = releaseHold(tx, a.Account, a.Hold)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	UPDATE card_authorization
+	SET status=$2, updated_at=now()
+	WHERE id=$1
+	RETURNING ` + authorizationColumns + `;`
+	a, err = scanAuthorization(tx.QueryRowContext(context.Background(), q, id, AuthorizationVoided))
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, CardPaymentClosed, a.Account, a)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
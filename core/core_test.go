@@ -2,16 +2,30 @@ package core
 
 // without import bank.go, you can use objects ans functions because core_test.go and bank.go are in the same module.
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"gotest.tools/v3/assert"
+
+	"github.com/hiroyuki-takayama-RAIX/core/iso20022"
+	"github.com/hiroyuki-takayama-RAIX/core/rates"
 )
 
 func TestMain(m *testing.M) {
@@ -68,8 +82,10 @@ func TestBegin(t *testing.T) {
 			Address: "Los Angeles, California",
 			Phone:   "(213) 444 0147",
 		},
-		Number:  1001,
-		Balance: 200,
+		Number:   1001,
+		IBAN:     IBAN(1001),
+		Balance:  200,
+		Currency: DefaultCurrency,
 	}
 
 	assert.DeepEqual(t, want, got)
@@ -117,8 +133,10 @@ func TestGetAccounts(t *testing.T) {
 			Address: "Los Angeles, California",
 			Phone:   "(213) 444 0147",
 		},
-		Number:  1001,
-		Balance: 100,
+		Number:   1001,
+		IBAN:     IBAN(1001),
+		Balance:  100,
+		Currency: DefaultCurrency,
 	}
 	expected[1] = &Account{
 		Customer: Customer{
@@ -126,8 +144,10 @@ func TestGetAccounts(t *testing.T) {
 			Address: "Ta No Tsu",
 			Phone:   "(0120) 117 117",
 		},
-		Number:  3003,
-		Balance: 100,
+		Number:   3003,
+		IBAN:     IBAN(3003),
+		Balance:  100,
+		Currency: DefaultCurrency,
 	}
 
 	if len(got) != len(expected) {
@@ -159,8 +179,10 @@ func TestGetAccount(t *testing.T) {
 			Address: "Los Angeles, California",
 			Phone:   "(213) 444 0147",
 		},
-		Number:  1001,
-		Balance: 100,
+		Number:   1001,
+		IBAN:     IBAN(1001),
+		Balance:  100,
+		Currency: DefaultCurrency,
 	}
 
 	if !reflect.DeepEqual(got, expected) {
@@ -193,7 +215,9 @@ func TestCreateAccount(t *testing.T) {
 	expected := &Account{
 		Customer: *c,
 		Number:   got.Number,
+		IBAN:     IBAN(got.Number),
 		Balance:  0,
+		Currency: DefaultCurrency,
 	}
 
 	if !reflect.DeepEqual(*got, *expected) {
@@ -228,6 +252,37 @@ func TestDeleteAccount(t *testing.T) {
 	}
 }
 
+func TestInternalAccounts(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insertTestData(): %v", err)
+	}
+	defer DeleteTestData()
+
+	// the internal accounts of the bank are not reached by the operations of customers.
+	_, err = tnb.GetAccount(FeeIncomeAccount)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.Withdraw(FeeIncomeAccount, 1)
+	assert.Error(t, err, "account(ID: -1) doesnt exist: sql: no rows in result set")
+	_, err = tnb.Deposit(FeeIncomeAccount, 1)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.Transfer(ACHClearingAccount, 1001, 1)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.Transfer(1001, FeeIncomeAccount, 1)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.UpdateAccount(FeeIncomeAccount, &Customer{Name: "a", Address: "b", Phone: "c"})
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	err = tnb.DeleteAccount(FeeIncomeAccount)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	// the balances are still read by the bank.
+	balance, err := tnb.GetBalance(FeeIncomeAccount)
+	assert.NilError(t, err)
+	assert.Equal(t, float64(0), balance)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(100), balance)
+}
+
 func TestUpdateAccount(t *testing.T) {
 	err := InsertTestData()
 	if err != nil {
@@ -251,7 +306,9 @@ func TestUpdateAccount(t *testing.T) {
 	expected := &Account{
 		Customer: *c,
 		Number:   id,
+		IBAN:     IBAN(id),
 		Balance:  100,
+		Currency: DefaultCurrency,
 	}
 
 	if !reflect.DeepEqual(*got, *expected) {
@@ -280,8 +337,10 @@ func TestDeposit(t *testing.T) {
 			Address: "Los Angeles, California",
 			Phone:   "(213) 444 0147",
 		},
-		Number:  1001,
-		Balance: 200,
+		Number:   1001,
+		IBAN:     IBAN(1001),
+		Balance:  200,
+		Currency: DefaultCurrency,
 	}
 	assert.DeepEqual(t, expected, got)
 }
@@ -309,8 +368,10 @@ func TestWithdraw(t *testing.T) {
 				Address: "Los Angeles, California",
 				Phone:   "(213) 444 0147",
 			},
-			Number:  1001,
-			Balance: 0,
+			Number:   1001,
+			IBAN:     IBAN(1001),
+			Balance:  0,
+			Currency: DefaultCurrency,
 		},
 		err: nil,
 	}
@@ -367,8 +428,10 @@ func TestTransfer(t *testing.T) {
 					Address: "Los Angeles, California",
 					Phone:   "(213) 444 0147",
 				},
-				Number:  1001,
-				Balance: 80,
+				Number:   1001,
+				IBAN:     IBAN(1001),
+				Balance:  80,
+				Currency: DefaultCurrency,
 			},
 			{
 				Customer: Customer{
@@ -376,8 +439,10 @@ func TestTransfer(t *testing.T) {
 					Address: "Ta No Tsu",
 					Phone:   "(0120) 117 117",
 				},
-				Number:  3003,
-				Balance: 120,
+				Number:   3003,
+				IBAN:     IBAN(3003),
+				Balance:  120,
+				Currency: DefaultCurrency,
 			},
 		},
 		err: nil,
@@ -479,3 +544,2755 @@ func TestGetBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestEventsSince(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	ch, cancel := Subscribe(1001)
+	defer cancel()
+
+	_, err = tnb.Deposit(1001, 50)
+	if err != nil {
+		t.Errorf("failed to deposit on account_%v: %v", 1001, err)
+	}
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Errorf("failed to transfer from account_%v: %v", 1001, err)
+	}
+
+	got, err := tnb.EventsSince(1001, 0)
+	if err != nil {
+		t.Errorf("failed to get events of account_%v: %v", 1001, err)
+	}
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, BalanceChanged, got[0].Type)
+	assert.Equal(t, float64(50), got[0].Amount)
+	assert.Equal(t, float64(150), got[0].Balance)
+	assert.Equal(t, float64(-30), got[1].Amount)
+	assert.Equal(t, float64(120), got[1].Balance)
+	assert.Equal(t, 3003, got[1].Counterparty)
+
+	// events published to the subscriber are the same as the journal.
+	for _, want := range got {
+		e := <-ch
+		assert.Equal(t, want.ID, e.ID)
+	}
+
+	// resume after the first event.
+	got, err = tnb.EventsSince(1001, got[0].ID)
+	if err != nil {
+		t.Errorf("failed to get events of account_%v: %v", 1001, err)
+	}
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, float64(-30), got[0].Amount)
+}
+
+func TestEventsSince_AccountClosed(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.UpdateAccount(3003, &Customer{Name: "Ide", Address: "Ta No Tsu", Phone: "(0120) 117 117"})
+	if err != nil {
+		t.Errorf("failed to update account_%v: %v", 3003, err)
+	}
+	err = tnb.DeleteAccount(3003)
+	if err != nil {
+		t.Errorf("failed to delete account_%v: %v", 3003, err)
+	}
+
+	got, err := tnb.EventsSince(3003, 0)
+	if err != nil {
+		t.Errorf("failed to get events of account_%v: %v", 3003, err)
+	}
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, ProfileUpdated, got[0].Type)
+	assert.Equal(t, AccountClosed, got[1].Type)
+	assert.Equal(t, float64(100), got[1].Balance)
+}
+
+func TestInProcessBus(t *testing.T) {
+	b := NewInProcessBus()
+	defer b.Close()
+
+	ch, cancel := b.Subscribe(1001)
+	other, cancelOther := b.Subscribe(3003)
+	defer cancelOther()
+
+	err := b.Publish(&Event{ID: 1, Type: BalanceChanged, Account: 1001}, &Event{ID: 2, Type: BalanceChanged, Account: 3003})
+	if err != nil {
+		t.Errorf("failed to publish events: %v", err)
+	}
+	assert.Equal(t, int64(1), (<-ch).ID)
+	assert.Equal(t, int64(2), (<-other).ID)
+
+	// a slow subscriber is dropped instead of blocking the publisher.
+	for i := 0; i < 17; i++ {
+		b.Publish(&Event{ID: int64(i), Type: BalanceChanged, Account: 1001})
+	}
+	for range ch {
+	}
+
+	// cancel() after the subscription is dropped doesn't panic.
+	cancel()
+}
+
+func TestPostgresBus(t *testing.T) {
+	publisher, err := NewPostgresBus()
+	if err != nil {
+		t.Fatalf("failed to start the event bus: %v", err)
+	}
+	defer publisher.Close()
+
+	subscriber, err := NewPostgresBus()
+	if err != nil {
+		t.Fatalf("failed to start the event bus: %v", err)
+	}
+	defer subscriber.Close()
+
+	ch, cancel := subscriber.Subscribe(1001)
+	defer cancel()
+
+	want := &Event{ID: 1, Type: BalanceChanged, Account: 1001, Amount: 20, Balance: 120}
+	err = publisher.Publish(want)
+	if err != nil {
+		t.Errorf("failed to publish an event: %v", err)
+	}
+
+	select {
+	case got := <-ch:
+		assert.DeepEqual(t, want, got)
+	case <-time.After(5 * time.Second):
+		t.Errorf("event is not delivered to another bus")
+	}
+}
+
+func TestPostgresBus_Reconnect(t *testing.T) {
+	subscriber, err := NewPostgresBus()
+	if err != nil {
+		t.Fatalf("failed to start the event bus: %v", err)
+	}
+	defer subscriber.Close()
+
+	closed := func(ch <-chan *Event) bool {
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return true
+				}
+			case <-time.After(5 * time.Second):
+				return false
+			}
+		}
+	}
+
+	before, cancel := subscriber.Subscribe(1001)
+	defer cancel()
+	_, err = tnb.db.Exec("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE query=$1;", "LISTEN "+eventChannel+";")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Assert(t, closed(before), "subscription is not closed after the connection is lost")
+
+	// a subscriber coming while disconnected is closed again when listening is restored.
+	during, cancel := subscriber.Subscribe(1001)
+	defer cancel()
+	assert.Assert(t, closed(during), "subscription made while disconnected is not closed after reconnecting")
+
+	after, cancel := subscriber.Subscribe(1001)
+	defer cancel()
+	want := &Event{ID: 1, Type: BalanceChanged, Account: 1001, Amount: 20, Balance: 120}
+	err = subscriber.Publish(want)
+	if err != nil {
+		t.Errorf("failed to publish an event: %v", err)
+	}
+	select {
+	case got := <-after:
+		assert.DeepEqual(t, want, got)
+	case <-time.After(5 * time.Second):
+		t.Errorf("event is not delivered after reconnecting")
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.Deposit(1001, 50)
+	if err != nil {
+		t.Errorf("failed to deposit on account_%v: %v", 1001, err)
+	}
+	_, err = tnb.Transfer(3003, 1001, 30)
+	if err != nil {
+		t.Errorf("failed to transfer from account_%v: %v", 3003, err)
+	}
+	_, err = tnb.Withdraw(1001, 10)
+	if err != nil {
+		t.Errorf("failed to withdraw from account_%v: %v", 1001, err)
+	}
+
+	// deliveries to account_1001 fail, so its events, including the transfer it recieved,
+	// are held while account_3003's are delivered.
+	got := []string{}
+	n, err := tnb.RelayOutbox(func(e *DomainEvent) error {
+		if e.Account == 1001 {
+			return errors.New("receiver is down")
+		}
+		got = append(got, e.Type)
+		return nil
+	}, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	assert.DeepEqual(t, []string{FundsTransferred}, got)
+
+	// held events are delivered in order when the receiver comes back.
+	got = []string{}
+	payloads := []string{}
+	n, err = tnb.RelayOutbox(func(e *DomainEvent) error {
+		got = append(got, e.Type)
+		payloads = append(payloads, string(e.Payload))
+		return nil
+	}, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+	assert.Equal(t, 3, n)
+	assert.DeepEqual(t, []string{FundsDeposited, FundsTransferred, FundsWithdrawn}, got)
+	var funds Funds
+	err = json.Unmarshal([]byte(payloads[0]), &funds)
+	if err != nil {
+		t.Errorf("failed to parse the payload: %v", err)
+	}
+	assert.DeepEqual(t, Funds{Account: 1001, Amount: 50, Balance: 150}, funds)
+
+	// nothing is left.
+	n, err = tnb.RelayOutbox(func(e *DomainEvent) error { return nil }, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+	assert.Equal(t, 0, n)
+}
+
+func TestSignWebhook(t *testing.T) {
+	got := SignWebhook("secret", 1696118400, []byte(`{"id":1}`))
+	assert.Equal(t, "t=1696118400,v1=52977ed6659a5f52fd6f46dc257229bb234c9f919b955bde6a60c3b1b61ff406", got)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	// the receiver fails for the first request, and checks the signature of the others.
+	var (
+		received []string
+		failures = 1
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var ts int64
+		fmt.Sscanf(r.Header.Get("X-NetBank-Signature"), "t=%d,", &ts)
+		if r.Header.Get("X-NetBank-Signature") != SignWebhook("secret", ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e DomainEvent
+		json.Unmarshal(body, &e)
+		received = append(received, e.Type)
+	}))
+	defer receiver.Close()
+
+	hook, err := tnb.CreateWebhook(&Webhook{URL: receiver.URL, Event: FundsDeposited, Secret: "secret"})
+	if err != nil {
+		t.Fatalf("failed to create a webhook: %v", err)
+	}
+
+	_, err = tnb.Deposit(1001, 50)
+	if err != nil {
+		t.Errorf("failed to deposit on account_%v: %v", 1001, err)
+	}
+	_, err = tnb.Withdraw(1001, 10)
+	if err != nil {
+		t.Errorf("failed to withdraw from account_%v: %v", 1001, err)
+	}
+	_, err = tnb.RelayOutbox(tnb.EnqueueWebhooks, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+
+	// the first attempt fails and is retried after the backoff.
+	now := time.Now()
+	n, err := tnb.DispatchWebhooks(http.DefaultClient, now, 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	ds, err := tnb.GetWebhookDeliveries(hook.ID)
+	if err != nil {
+		t.Errorf("failed to get deliveries: %v", err)
+	}
+	assert.Equal(t, 1, len(ds))
+	assert.Equal(t, DeliveryPending, ds[0].Status)
+	assert.Equal(t, 1, ds[0].Attempts)
+	assert.Equal(t, "webhook responded 503 Service Unavailable", ds[0].LastError)
+
+	n, err = tnb.DispatchWebhooks(http.DefaultClient, now, 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	n, err = tnb.DispatchWebhooks(http.DefaultClient, now.Add(webhookBackoff(1)), 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	assert.DeepEqual(t, []string{FundsDeposited}, received)
+
+	// a delivered event can be delivered again by hand.
+	d, err := tnb.RedeliverWebhook(ds[0].ID)
+	if err != nil {
+		t.Errorf("failed to redeliver: %v", err)
+	}
+	assert.Equal(t, DeliveryPending, d.Status)
+	n, err = tnb.DispatchWebhooks(http.DefaultClient, time.Now(), 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	assert.DeepEqual(t, []string{FundsDeposited, FundsDeposited}, received)
+}
+
+func TestWebhookDelivery_Dead(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	hook, err := tnb.CreateWebhook(&Webhook{URL: receiver.URL, Event: AnyEvent})
+	if err != nil {
+		t.Fatalf("failed to create a webhook: %v", err)
+	}
+	assert.Equal(t, 64, len(hook.Secret))
+
+	_, err = tnb.Deposit(1001, 50)
+	if err != nil {
+		t.Errorf("failed to deposit on account_%v: %v", 1001, err)
+	}
+	_, err = tnb.RelayOutbox(tnb.EnqueueWebhooks, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+
+	now := time.Now()
+	for i := 1; i <= webhookMaxAttempts; i++ {
+		_, err = tnb.DispatchWebhooks(http.DefaultClient, now, 10)
+		if err != nil {
+			t.Errorf("failed to dispatch webhooks: %v", err)
+		}
+		now = now.Add(webhookBackoff(i))
+	}
+
+	ds, err := tnb.GetWebhookDeliveries(hook.ID)
+	if err != nil {
+		t.Errorf("failed to get deliveries: %v", err)
+	}
+	assert.Equal(t, DeliveryDead, ds[0].Status)
+	assert.Equal(t, webhookMaxAttempts, ds[0].Attempts)
+}
+
+func TestWebhookDelivery_Lease(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.CreateWebhook(&Webhook{URL: "https://accounting.example.com/hooks", Event: "FundDeposited"})
+	msg := compareErrors(errors.New("got FundDeposited as unknown webhook event"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	hook, err := tnb.CreateWebhook(&Webhook{URL: receiver.URL, Event: FundsDeposited})
+	if err != nil {
+		t.Fatalf("failed to create a webhook: %v", err)
+	}
+	_, err = tnb.Deposit(1001, 50)
+	if err != nil {
+		t.Errorf("failed to deposit on account_%v: %v", 1001, err)
+	}
+	_, err = tnb.RelayOutbox(tnb.EnqueueWebhooks, 100)
+	if err != nil {
+		t.Errorf("failed to relay the outbox: %v", err)
+	}
+
+	// a dispatcher which stopped after the claim keeps the delivery from the others until the lease expires.
+	now := time.Now()
+	ds, err := tnb.claimDeliveries(now, 10)
+	if err != nil {
+		t.Fatalf("failed to claim deliveries: %v", err)
+	}
+	assert.Equal(t, 1, len(ds))
+	n, err := tnb.DispatchWebhooks(http.DefaultClient, now, 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	n, err = tnb.DispatchWebhooks(http.DefaultClient, now.Add(webhookLease), 10)
+	if err != nil {
+		t.Errorf("failed to dispatch webhooks: %v", err)
+	}
+	assert.Equal(t, 1, n)
+
+	delivered, err := tnb.GetWebhookDeliveries(hook.ID)
+	if err != nil {
+		t.Errorf("failed to get deliveries: %v", err)
+	}
+	assert.Equal(t, DeliveryDelivered, delivered[0].Status)
+	assert.Equal(t, 2, delivered[0].Attempts)
+}
+
+func TestSchedule(t *testing.T) {
+	type fixture struct {
+		name     string
+		rule     string
+		date     string
+		expected string
+		err      error
+	}
+
+	fs := make([]*fixture, 7)
+	fs[0] = &fixture{name: "Daily", rule: "daily", date: "2023-10-25", expected: "2023-10-25"}
+	fs[1] = &fixture{name: "Weekly on the same weekday", rule: "weekly:3", date: "2023-10-25", expected: "2023-10-25"}
+	fs[2] = &fixture{name: "Weekly on next Monday", rule: "weekly:1", date: "2023-10-25", expected: "2023-10-30"}
+	fs[3] = &fixture{name: "Monthly in this month", rule: "monthly:25", date: "2023-10-20", expected: "2023-10-25"}
+	fs[4] = &fixture{name: "Monthly in next month", rule: "monthly:25", date: "2023-10-26", expected: "2023-11-25"}
+	fs[5] = &fixture{name: "Monthly on the last day of a short month", rule: "monthly:31", date: "2024-02-01", expected: "2024-02-29"}
+	fs[6] = &fixture{
+		name: "Invalid rule",
+		rule: "monthly:32",
+		err:  errors.New("got monthly:32 as invalid schedule. use daily, weekly:<0-6> or monthly:<1-31>"),
+	}
+
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			s, err := ParseSchedule(f.rule)
+			msg := compareErrors(f.err, err)
+			if msg != "" {
+				t.Errorf(msg)
+			}
+			if err != nil {
+				return
+			}
+
+			date, _ := time.Parse(dateLayout, f.date)
+			assert.Equal(t, f.expected, s.Next(date).Format(dateLayout))
+		})
+	}
+}
+
+func TestRunStandingOrders(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	// the order starts next month, since a start in the past is rejected.
+	today := truncateDate(time.Now())
+	first := time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	due := first.AddDate(0, 0, 24)
+
+	_, err = tnb.CreateStandingOrder(&StandingOrder{From: 1001, To: 3003, Amount: 60, Schedule: "daily", Start: today.AddDate(0, 0, -1).Format(dateLayout)})
+	assert.ErrorContains(t, err, "start date of standing order is before today")
+
+	o, err := tnb.CreateStandingOrder(&StandingOrder{
+		From:       1001,
+		To:         3003,
+		Amount:     60,
+		Schedule:   "monthly:25",
+		Start:      first.Format(dateLayout),
+		End:        first.AddDate(0, 2, -1).Format(dateLayout),
+		Retries:    1,
+		RetryHours: 24,
+	})
+	if err != nil {
+		t.Fatalf("failed to create a standing order: %v", err)
+	}
+	assert.Equal(t, due.Format(dateLayout), o.NextRun)
+	assert.Equal(t, OrderActive, o.Status)
+
+	// nothing is due before the date.
+	n, err := tnb.RunStandingOrders(due.Add(-15 * time.Hour))
+	if err != nil {
+		t.Errorf("failed to run standing orders: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	// it is already the 25th in Tokyo, but not in UTC.
+	n, err = tnb.RunStandingOrders(due.Add(-time.Hour).In(time.FixedZone("JST", 9*60*60)))
+	if err != nil {
+		t.Errorf("failed to run standing orders: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	n, err = tnb.RunStandingOrders(due.Add(9 * time.Hour))
+	if err != nil {
+		t.Errorf("failed to run standing orders: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(40), balance)
+
+	// the second payment fails by insufficient funds, is retried once a day later and gives up.
+	next := due.AddDate(0, 1, 0).Add(9 * time.Hour)
+	for _, now := range []time.Time{next, next.Add(time.Hour), next.Add(24 * time.Hour)} {
+		_, err = tnb.RunStandingOrders(now)
+		if err != nil {
+			t.Errorf("failed to run standing orders: %v", err)
+		}
+	}
+
+	runs, err := tnb.GetStandingOrderRuns(o.ID)
+	if err != nil {
+		t.Errorf("failed to get runs: %v", err)
+	}
+	got := []string{}
+	for _, r := range runs {
+		got = append(got, fmt.Sprintf("%v#%v:%v", r.DueDate, r.Attempt, r.Status))
+	}
+	second := due.AddDate(0, 1, 0).Format(dateLayout)
+	assert.DeepEqual(t, []string{due.Format(dateLayout) + "#1:succeeded", second + "#1:retrying", second + "#2:failed"}, got)
+	assert.Equal(t, "amount is grater than the balance. sender's amount is 60, but the balance is 40", runs[2].Error)
+
+	// the order is finished because the next due date is after the end.
+	o, err = tnb.GetStandingOrder(o.ID)
+	if err != nil {
+		t.Errorf("failed to get the standing order: %v", err)
+	}
+	assert.Equal(t, OrderFinished, o.Status)
+	assert.Equal(t, due.AddDate(0, 2, 0).Format(dateLayout), o.NextRun)
+}
+
+func TestHolds(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	h, err := tnb.PlaceHold(1001, 70, time.Time{}, "merchant-1")
+	if err != nil {
+		t.Fatalf("failed to place a hold: %v", err)
+	}
+	assert.Equal(t, HoldActive, h.Status)
+
+	available, err := tnb.GetAvailableBalance(1001)
+	if err != nil {
+		t.Errorf("failed to get the available balance: %v", err)
+	}
+	assert.Equal(t, float64(30), available)
+
+	// the held amount can be neither withdrawn nor transferred.
+	_, err = tnb.Withdraw(1001, 40)
+	msg := compareErrors(errors.New("amount is grater than the available balance. your amount is 40, but the available balance is 30"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+	_, err = tnb.Transfer(1001, 3003, 40)
+	msg = compareErrors(errors.New("amount is grater than the available balance. sender's amount is 40, but the available balance is 30"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+	_, err = tnb.PlaceHold(1001, 40, time.Time{}, "")
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+
+	// the capture is a withdrawal, so it is limited and charged the fee.
+	limit := func(v float64) *float64 { return &v }
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{PerTransaction: limit(45)})
+	if err != nil {
+		t.Fatalf("failed to set the limit: %v", err)
+	}
+	_, err = tnb.CaptureHold(1001, h.ID, 50)
+	assert.Assert(t, errors.Is(err, ErrLimitExceeded))
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{PerTransaction: limit(100)})
+	if err != nil {
+		t.Fatalf("failed to set the limit: %v", err)
+	}
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeWithdraw, Kind: FeeFlat, Flat: 2})
+	if err != nil {
+		t.Fatalf("failed to set the fee schedule: %v", err)
+	}
+
+	// a partial capture withdraws the amount and releases the rest.
+	h, err = tnb.CaptureHold(1001, h.ID, 50)
+	if err != nil {
+		t.Errorf("failed to capture the hold: %v", err)
+	}
+	assert.Equal(t, HoldCaptured, h.Status)
+	assert.Equal(t, float64(50), h.Captured)
+
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(48), balance)
+	available, _ = tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(48), available)
+	fees, _ := tnb.GetBalance(FeeIncomeAccount)
+	assert.Equal(t, float64(2), fees)
+
+	_, err = tnb.ReleaseHold(1001, h.ID)
+	assert.Assert(t, errors.Is(err, ErrHoldNotActive))
+
+	// a hold of another account is not found.
+	_, err = tnb.CaptureHold(3003, h.ID, 0)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestHolds_Expired(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	h, err := tnb.PlaceHold(1001, 70, time.Now().Add(time.Hour), "")
+	if err != nil {
+		t.Fatalf("failed to place a hold: %v", err)
+	}
+	_, err = tnb.db.Exec("UPDATE hold SET expires_at=now()-interval '1 second' WHERE id=$1;", h.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an expired hold doesn't reserve the balance even before it is marked.
+	available, _ := tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(100), available)
+	h, _ = tnb.GetHold(1001, h.ID)
+	assert.Equal(t, HoldExpired, h.Status)
+
+	_, err = tnb.CaptureHold(1001, h.ID, 0)
+	assert.Assert(t, errors.Is(err, ErrHoldNotActive))
+
+	n, err := tnb.ExpireHolds(time.Now())
+	if err != nil {
+		t.Errorf("failed to expire holds: %v", err)
+	}
+	assert.Equal(t, int64(1), n)
+}
+
+func TestReverseTransfer(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.Transfer(1001, 3003, 60)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	ts, err := tnb.GetTransfers(1001)
+	if err != nil || len(ts) != 1 {
+		t.Fatalf("failed to get transfers: %v", err)
+	}
+	id := ts[0].ID
+
+	// a partial refund.
+	r, err := tnb.ReverseTransfer(id, 20, "wrong amount")
+	if err != nil {
+		t.Fatalf("failed to reverse the transfer: %v", err)
+	}
+	assert.Equal(t, ReversalCompleted, r.Status)
+	assert.Equal(t, float64(20), r.Amount)
+
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(60), balance)
+	balance, _ = tnb.GetBalance(3003)
+	assert.Equal(t, float64(140), balance)
+
+	// the original and the refund refer to each other.
+	orig, err := tnb.GetTransfer(id)
+	if err != nil {
+		t.Fatalf("failed to get the transfer: %v", err)
+	}
+	assert.Equal(t, float64(20), orig.Refunded)
+	assert.Equal(t, 1, len(orig.Reversals))
+	refund, err := tnb.GetTransfer(orig.Reversals[0].Refund)
+	if err != nil {
+		t.Fatalf("failed to get the refund: %v", err)
+	}
+	assert.Equal(t, id, refund.ReversalOf)
+	assert.Equal(t, 3003, refund.From)
+	assert.Equal(t, 1001, refund.To)
+
+	_, err = tnb.ReverseTransfer(refund.ID, 0, "")
+	msg := compareErrors(fmt.Errorf("transfer(ID: %v) is a reversal of transfer(ID: %v) and cannot be reversed", refund.ID, id), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+
+	// zero amount reverses the rest.
+	r, err = tnb.ReverseTransfer(id, 0, "")
+	if err != nil {
+		t.Fatalf("failed to reverse the transfer: %v", err)
+	}
+	assert.Equal(t, float64(40), r.Amount)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(100), balance)
+
+	_, err = tnb.ReverseTransfer(id, 0, "")
+	msg = compareErrors(fmt.Errorf("transfer(ID: %v) is already reversed", id), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+
+	_, err = tnb.ReverseTransfer(404, 0, "")
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestReverseTransfer_Approval(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	os.Setenv("REVERSAL_APPROVAL_THRESHOLD", "10")
+	defer os.Unsetenv("REVERSAL_APPROVAL_THRESHOLD")
+
+	_, err = tnb.Transfer(1001, 3003, 60)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	ts, _ := tnb.GetTransfers(1001)
+	id := ts[0].ID
+
+	r, err := tnb.ReverseTransfer(id, 50, "")
+	if err != nil {
+		t.Fatalf("failed to reverse the transfer: %v", err)
+	}
+	assert.Equal(t, ReversalPending, r.Status)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(40), balance)
+
+	// the pending amount cannot be reversed twice.
+	_, err = tnb.ReverseTransfer(id, 20, "")
+	msg := compareErrors(errors.New("amount of reversal must be between 0 and 10. your input is 20"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+
+	rs, err := tnb.GetPendingReversals()
+	if err != nil {
+		t.Errorf("failed to get pending reversals: %v", err)
+	}
+	assert.Equal(t, 1, len(rs))
+
+	r, err = tnb.ApproveReversal(r.ID)
+	if err != nil {
+		t.Fatalf("failed to approve the reversal: %v", err)
+	}
+	assert.Equal(t, ReversalCompleted, r.Status)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(90), balance)
+
+	_, err = tnb.RejectReversal(r.ID)
+	assert.Assert(t, errors.Is(err, ErrReversalNotPending))
+
+	// a rejected reversal frees the amount again.
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	ts, _ = tnb.GetTransfers(1001)
+	r, err = tnb.ReverseTransfer(ts[0].ID, 0, "")
+	if err != nil {
+		t.Fatalf("failed to reverse the transfer: %v", err)
+	}
+	r, err = tnb.RejectReversal(r.ID)
+	if err != nil {
+		t.Fatalf("failed to reject the reversal: %v", err)
+	}
+	assert.Equal(t, ReversalRejected, r.Status)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(60), balance)
+}
+
+func TestBatchTransfer(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	ts := []*Trade{
+		{To: 3003, Amount: 30},
+		{Class: "withdraw", To: 3003, Amount: 10},
+		{To: 3003, Amount: 20},
+	}
+	result, err := tnb.BatchTransfer(1001, ts, BatchAtomic)
+	if err != nil {
+		t.Fatalf("failed to send the batch: %v", err)
+	}
+	assert.Equal(t, false, result.Committed)
+	assert.Equal(t, LineRolledBack, result.Lines[0].Status)
+	assert.Equal(t, "class of trade in batch must be transfer. your input is withdraw", result.Lines[1].Error)
+	assert.Equal(t, LineSkipped, result.Lines[2].Status)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(100), balance)
+
+	result, err = tnb.BatchTransfer(1001, ts, BatchBestEffort)
+	if err != nil {
+		t.Fatalf("failed to send the batch: %v", err)
+	}
+	assert.Equal(t, true, result.Committed)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(50), balance)
+	balance, _ = tnb.GetBalance(3003)
+	assert.Equal(t, float64(150), balance)
+
+	// the internal accounts of the bank are neither senders nor recievers.
+	result, err = tnb.BatchTransfer(1001, []*Trade{{To: FeeIncomeAccount, Amount: 1}}, BatchBestEffort)
+	if err != nil {
+		t.Fatalf("failed to send the batch: %v", err)
+	}
+	assert.Equal(t, 1, result.Failed)
+	assert.Assert(t, errors.Is(result.Lines[0].err, sql.ErrNoRows))
+	_, err = tnb.BatchTransfer(FeeIncomeAccount, []*Trade{{To: 3003, Amount: 1}}, BatchAtomic)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	// each line is checked against the currency of the sender like a single transfer.
+	result, err = tnb.BatchTransfer(1001, []*Trade{{To: 3003, Amount: 1, Currency: "JPY"}, {To: 3003, Amount: 0.001}}, BatchBestEffort)
+	if err != nil {
+		t.Fatalf("failed to send the batch: %v", err)
+	}
+	assert.Equal(t, 2, result.Failed)
+	assert.Assert(t, errors.Is(result.Lines[0].err, ErrCurrencyMismatch))
+	assert.Equal(t, "amount 0.001 has more decimals than USD allows", result.Lines[1].Error)
+
+	_, err = tnb.BatchTransfer(1001, ts, "partial")
+	msg := compareErrors(errors.New("mode of batch must be atomic or best-effort. your input is partial"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+}
+
+// BenchmarkBatchTransfer compares a batch with sending the same lines by transfer() in one transaction,
+// which locks and reads the sender again for every line.
+func BenchmarkBatchTransfer(b *testing.B) {
+	err := InsertTestData()
+	if err != nil {
+		b.Fatalf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	// the limits make both of them read the usage of the sender.
+	limit := func(v float64) *float64 { return &v }
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{Daily: limit(1e9), PerCounterparty: limit(1e9)})
+	if err != nil {
+		b.Fatalf("failed to set the limits: %v", err)
+	}
+
+	ts := make([]*Trade, 100)
+	for i := range ts {
+		ts[i] = &Trade{To: 3003, Amount: 0.01}
+	}
+	reset := func(b *testing.B) {
+		b.StopTimer()
+		defer b.StartTimer()
+		_, err := tnb.db.Exec("UPDATE account SET balance=100 WHERE id=1001;")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reset(b)
+			result, err := tnb.BatchTransfer(1001, ts, BatchAtomic)
+			if err != nil || !result.Committed {
+				b.Fatalf("failed to send the batch: %v", err)
+			}
+		}
+	})
+
+	b.Run("transfer per line", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			reset(b)
+			tx, err := tnb.db.Begin()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, t := range ts {
+				_, _, err := tnb.transfer(tx, 1001, int(t.To), t.Amount, "")
+				if err != nil {
+					tx.Rollback()
+					b.Fatalf("failed to transfer: %v", err)
+				}
+			}
+			err = tx.Commit()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestOverdraft(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	o, err := tnb.SetOverdraft(1001, 50, 0.365)
+	if err != nil {
+		t.Fatalf("failed to set the overdraft: %v", err)
+	}
+	assert.Equal(t, float64(50), o.Limit)
+
+	// the balance can go negative up to the limit.
+	_, err = tnb.Withdraw(1001, 130)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	available, _ := tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(20), available)
+
+	_, err = tnb.Transfer(1001, 3003, 30)
+	msg := compareErrors(errors.New("amount is grater than the available balance. sender's amount is 30, but the available balance is 20"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+
+	// the interest of 10 days on 30 at 36.5% is 0.3.
+	_, err = tnb.db.Exec("UPDATE overdraft SET accrued_on=CURRENT_DATE-10 WHERE account_id=$1;", 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := tnb.ChargeOverdraftInterest(time.Now())
+	if err != nil {
+		t.Errorf("failed to charge the interest: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, -30.3, balance)
+
+	// the interest is charged once a day.
+	n, _ = tnb.ChargeOverdraftInterest(time.Now())
+	assert.Equal(t, 0, n)
+
+	// a deposit is accepted on a negative balance.
+	_, err = tnb.Deposit(1001, 30.3)
+	if err != nil {
+		t.Errorf("failed to deposit: %v", err)
+	}
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(0), balance)
+
+	_, err = tnb.SetOverdraft(404, 50, 0)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.SetOverdraft(1001, -1, 0)
+	msg = compareErrors(errors.New("overdraft limit is less than zero. your input is -1"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	limit := func(v float64) *float64 { return &v }
+
+	_, err = tnb.SetLimitRule(LimitDefault, "", &LimitRule{PerTransaction: limit(50), Daily: limit(60)})
+	if err != nil {
+		t.Fatalf("failed to set the default limits: %v", err)
+	}
+	_, err = tnb.SetLimitRule(LimitTier, "gold", &LimitRule{Daily: limit(80), PerCounterparty: limit(30)})
+	if err != nil {
+		t.Fatalf("failed to set the limits of the tier: %v", err)
+	}
+	err = tnb.SetCustomerTier(1001, "gold")
+	if err != nil {
+		t.Fatalf("failed to set the tier: %v", err)
+	}
+
+	_, err = tnb.Withdraw(1001, 51)
+	msg := compareErrors(errors.New("per_transaction limit is exceeded. the limit is 50 and 50 remains, but the amount is 51"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+	assert.Assert(t, errors.Is(err, ErrLimitExceeded))
+
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	_, err = tnb.Transfer(1001, 3003, 10)
+	var le *LimitError
+	assert.Assert(t, errors.As(err, &le))
+	assert.Equal(t, "per_counterparty_limit_exceeded", le.Code())
+
+	// the daily limit of the tier overrides the default.
+	_, err = tnb.Withdraw(1001, 40)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	_, err = tnb.Withdraw(1001, 20)
+	msg = compareErrors(errors.New("daily limit is exceeded. the limit is 80 and 10 remains, but the amount is 20"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+
+	ls, err := tnb.GetLimits(1001)
+	if err != nil {
+		t.Fatalf("failed to get the limits: %v", err)
+	}
+	got := map[string]*Limit{}
+	for _, l := range ls {
+		got[l.Kind] = l
+	}
+	assert.Equal(t, LimitDefault, got[PerTransaction].Source)
+	assert.Equal(t, LimitTier, got[Daily].Source)
+	assert.Equal(t, float64(10), got[Daily].Remaining)
+	assert.Equal(t, float64(0), got[PerCounterparty].Counterparties[0].Remaining)
+
+	// a limit of the account overrides the tier.
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{Daily: limit(100)})
+	if err != nil {
+		t.Fatalf("failed to set the limits of the account: %v", err)
+	}
+	_, err = tnb.Withdraw(1001, 20)
+	if err != nil {
+		t.Errorf("failed to withdraw: %v", err)
+	}
+
+	_, err = tnb.SetLimitRule(LimitAccount, "404", &LimitRule{})
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{Currency: "JPY"})
+	assert.Assert(t, errors.Is(err, ErrCurrencyMismatch))
+
+	// the limits in dollars don't apply to an account in yen, which has its own.
+	yen, err := tnb.OpenAccount(&Customer{Name: "Yen", Address: "Tokyo", Phone: "000"}, ProductChecking, "JPY")
+	if err != nil {
+		t.Fatalf("failed to open the account: %v", err)
+	}
+	_, err = tnb.Deposit(yen.Number, 10000)
+	if err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+	_, err = tnb.Withdraw(yen.Number, 1000)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	_, err = tnb.SetLimitRule(LimitDefault, "", &LimitRule{Currency: "JPY", PerTransaction: limit(5000)})
+	if err != nil {
+		t.Fatalf("failed to set the default limits in yen: %v", err)
+	}
+	_, err = tnb.Withdraw(yen.Number, 6000)
+	assert.Assert(t, errors.Is(err, ErrLimitExceeded))
+	ls, _ = tnb.GetLimits(yen.Number)
+	assert.Equal(t, 1, len(ls))
+	assert.Equal(t, "JPY", ls[0].Currency)
+	assert.Equal(t, float64(5000), ls[0].Limit)
+}
+
+func TestFeeSchedule(t *testing.T) {
+	type feeFixture struct {
+		name     string
+		schedule *FeeSchedule
+		amount   float64
+		fee      float64
+	}
+
+	tiered := &FeeSchedule{Currency: "USD", Kind: FeeTiered, Tiers: []*FeeTier{{UpTo: 100, Fee: 1}, {UpTo: 1000, Fee: 5}, {Fee: 10}}}
+
+	fs := make([]*feeFixture, 6)
+	fs[0] = &feeFixture{"flat", &FeeSchedule{Currency: "USD", Kind: FeeFlat, Flat: 2}, 500, 2}
+	fs[1] = &feeFixture{"percentage is rounded to cents", &FeeSchedule{Currency: "USD", Kind: FeePercentage, Rate: 0.015}, 33.33, 0.5}
+	fs[2] = &feeFixture{"first tier", tiered, 100, 1}
+	fs[3] = &feeFixture{"second tier", tiered, 100.01, 5}
+	fs[4] = &feeFixture{"last tier", tiered, 5000, 10}
+	fs[5] = &feeFixture{"percentage is rounded to yen", &FeeSchedule{Currency: "JPY", Kind: FeePercentage, Rate: 0.015}, 1010, 15}
+
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			assert.Equal(t, f.fee, f.schedule.fee(f.amount))
+		})
+	}
+}
+
+func TestFees(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeWithdraw, Kind: FeeFlat, Flat: 2, FreePerMonth: 1})
+	if err != nil {
+		t.Fatalf("failed to set the fee: %v", err)
+	}
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeTransfer, Kind: FeePercentage, Rate: 0.1})
+	if err != nil {
+		t.Fatalf("failed to set the fee: %v", err)
+	}
+
+	// the first withdrawal of the month is free.
+	quote, err := tnb.QuoteFee(1001, FeeWithdraw, 10)
+	if err != nil {
+		t.Fatalf("failed to quote the fee: %v", err)
+	}
+	assert.Equal(t, float64(0), quote.Fee)
+	assert.Equal(t, 1, quote.FreeRemaining)
+
+	account, err := tnb.Withdraw(1001, 10)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	assert.Equal(t, float64(0), account.Fee)
+	assert.Equal(t, float64(90), account.Balance)
+
+	account, err = tnb.Withdraw(1001, 10)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	assert.Equal(t, float64(2), account.Fee)
+	assert.Equal(t, float64(78), account.Balance)
+
+	accounts, err := tnb.Transfer(1001, 3003, 50)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	assert.Equal(t, float64(5), accounts[0].Fee)
+	assert.Equal(t, float64(23), accounts[0].Balance)
+	assert.Equal(t, float64(150), accounts[1].Balance)
+
+	// the amount and the fee must be in the balance.
+	_, err = tnb.Transfer(1001, 3003, 21)
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+
+	income, _ := tnb.GetBalance(FeeIncomeAccount)
+	assert.Equal(t, float64(7), income)
+
+	es, err := tnb.EventsSince(FeeIncomeAccount, 0)
+	if err != nil {
+		t.Errorf("failed to get events: %v", err)
+	}
+	assert.Equal(t, 2, len(es))
+	assert.Equal(t, FeePosted, es[0].Type)
+	assert.Equal(t, 1001, es[0].Counterparty)
+
+	// the fees in yen are set in yen, and booked by the fee income in yen, not added to the dollars.
+	yen, err := tnb.OpenAccount(&Customer{Name: "Yen", Address: "Tokyo", Phone: "000"}, ProductChecking, "JPY")
+	if err != nil {
+		t.Fatalf("failed to open the account: %v", err)
+	}
+	_, err = tnb.Deposit(yen.Number, 1000)
+	if err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+	account, err = tnb.Withdraw(yen.Number, 100)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	assert.Equal(t, float64(0), account.Fee)
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeWithdraw, Currency: "JPY", Kind: FeeFlat, Flat: 2.5})
+	assert.Error(t, err, "fee 2.5 has more decimals than JPY allows")
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeWithdraw, Currency: "JPY", Kind: FeeFlat, Flat: 200})
+	if err != nil {
+		t.Fatalf("failed to set the fee schedule: %v", err)
+	}
+	account, err = tnb.Withdraw(yen.Number, 100)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	assert.Equal(t, float64(200), account.Fee)
+	assert.Equal(t, float64(600), account.Balance)
+	var yenIncome int
+	err = tnb.db.QueryRow(`SELECT account_id FROM internal_account WHERE role=$1 AND currency='JPY';`, FeeIncomeAccount).Scan(&yenIncome)
+	if err != nil {
+		t.Fatalf("failed to get the fee income in yen: %v", err)
+	}
+	assert.Assert(t, yenIncome < 0)
+	income, _ = tnb.GetBalance(yenIncome)
+	assert.Equal(t, float64(200), income)
+	income, _ = tnb.GetBalance(FeeIncomeAccount)
+	assert.Equal(t, float64(7), income)
+
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "gold", Operation: FeeWithdraw, Kind: FeeFlat})
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.SetFeeSchedule(&FeeSchedule{Product: "checking", Operation: FeeWithdraw, Kind: FeeTiered, Tiers: []*FeeTier{{Fee: 1}, {UpTo: 100, Fee: 2}}})
+	msg := compareErrors(errors.New("only the last tier can be without upper bound"), err)
+	if msg != "" {
+		t.Errorf(msg)
+	}
+}
+
+func TestProductRate(t *testing.T) {
+	p := &Product{InterestRate: 0.001, RateTiers: []*RateTier{{From: 1000, Rate: 0.002}, {From: 10000, Rate: 0.005}}}
+	assert.Equal(t, 0.001, p.rate(999))
+	assert.Equal(t, 0.002, p.rate(1000))
+	assert.Equal(t, 0.005, p.rate(20000))
+}
+
+func TestInterest(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.SetProduct(&Product{Code: "test-savings", Name: "Savings for test", InterestRate: 0.365})
+	if err != nil {
+		t.Fatalf("failed to set the product: %v", err)
+	}
+	defer tnb.db.Exec("DELETE FROM product WHERE code='test-savings';")
+
+	account, err := tnb.OpenAccount(&Customer{Name: "Saver", Address: "Tokyo", Phone: "000"}, "test-savings", DefaultCurrency)
+	if err != nil {
+		t.Fatalf("failed to open the account: %v", err)
+	}
+	_, err = tnb.Deposit(account.Number, 1000)
+	if err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+
+	// the interest of a day on 1000 at 36.5% is 1.
+	// the account is opened today, so the accrual of tomorrow is the first one.
+	now := time.Now().AddDate(0, 0, 2)
+	n, err := tnb.AccrueInterest(now)
+	if err != nil {
+		t.Fatalf("failed to accrue interest: %v", err)
+	}
+	assert.Equal(t, int64(1), n)
+
+	// accruing again never pays twice.
+	n, _ = tnb.AccrueInterest(now)
+	assert.Equal(t, int64(0), n)
+
+	s, err := tnb.GetInterest(account.Number)
+	if err != nil {
+		t.Fatalf("failed to get the interest: %v", err)
+	}
+	assert.Equal(t, float64(1), s.Accrued)
+	assert.Equal(t, "test-savings", s.Product)
+
+	// the interest is posted after the month ends.
+	posted, err := tnb.PostInterest(now.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to post interest: %v", err)
+	}
+	assert.Equal(t, 1, posted)
+	balance, _ := tnb.GetBalance(account.Number)
+	assert.Equal(t, float64(1001), balance)
+	expense, _ := tnb.GetBalance(InterestExpenseAccount)
+	assert.Equal(t, float64(-1), expense)
+
+	posted, _ = tnb.PostInterest(now.AddDate(0, 1, 0))
+	assert.Equal(t, 0, posted)
+
+	_, err = tnb.OpenAccount(&Customer{Name: "Saver", Address: "Tokyo", Phone: "000"}, "gold", DefaultCurrency)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestTermDeposit(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.SetTermRate(&TermRate{TermMonths: 24, Rate: 0.1, PenaltyRate: 0.05})
+	if err != nil {
+		t.Fatalf("failed to set the term rate: %v", err)
+	}
+	defer tnb.db.Exec("DELETE FROM term_rate WHERE term_months=24;")
+
+	payout, err := tnb.OpenTermDeposit(1001, 60, 24, "")
+	if err != nil {
+		t.Fatalf("failed to open the term deposit: %v", err)
+	}
+	assert.Equal(t, MaturityPayout, payout.Instruction)
+	assert.Equal(t, 0.1, payout.Rate)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(40), balance)
+
+	_, err = tnb.OpenTermDeposit(1001, 50, 24, MaturityPayout)
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+
+	// deleting the account doesn't lose the principal.
+	err = tnb.DeleteAccount(1001)
+	assert.Error(t, err, "account(ID: 1001) has 1 active term deposits. break them before deleting it: account is in use")
+	_, err = tnb.OpenTermDeposit(1001, 10, 5, MaturityPayout)
+	msg := compareErrors(fmt.Errorf("term of 5 months is not offered"), err)
+	if msg != "" {
+		t.Error(msg)
+	}
+
+	rollover, err := tnb.OpenTermDeposit(3003, 50, 24, MaturityRollover)
+	if err != nil {
+		t.Fatalf("failed to open the term deposit: %v", err)
+	}
+
+	// the interest of 2 years at 10% is 12 on 60 and 10 on 50.
+	n, err := tnb.MatureTermDeposits(time.Now().AddDate(0, 24, 0))
+	if err != nil {
+		t.Fatalf("failed to mature term deposits: %v", err)
+	}
+	assert.Equal(t, 2, n)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(112), balance)
+	balance, _ = tnb.GetBalance(3003)
+	assert.Equal(t, float64(50), balance)
+	expense, _ := tnb.GetBalance(InterestExpenseAccount)
+	assert.Equal(t, float64(-22), expense)
+
+	p, err := tnb.GetPortfolio(3003)
+	if err != nil {
+		t.Fatalf("failed to get the portfolio: %v", err)
+	}
+	assert.Equal(t, 2, len(p.TermDeposits))
+	assert.Equal(t, DepositRolledOver, p.TermDeposits[0].Status)
+	renewed := p.TermDeposits[1]
+	assert.Equal(t, DepositActive, renewed.Status)
+	assert.Equal(t, float64(60), renewed.Principal)
+	assert.Equal(t, rollover.ID, renewed.RolledFrom)
+	assert.Equal(t, rollover.Maturity, renewed.StartDate)
+	assert.Equal(t, float64(110), p.Total)
+
+	// breaking the deposit charges 5% of the principal.
+	broken, err := tnb.BreakTermDeposit(3003, renewed.ID)
+	if err != nil {
+		t.Fatalf("failed to break the term deposit: %v", err)
+	}
+	assert.Equal(t, DepositBroken, broken.Status)
+	assert.Equal(t, float64(3), broken.Penalty)
+	balance, _ = tnb.GetBalance(3003)
+	assert.Equal(t, float64(107), balance)
+	income, _ := tnb.GetBalance(FeeIncomeAccount)
+	assert.Equal(t, float64(3), income)
+
+	_, err = tnb.BreakTermDeposit(3003, renewed.ID)
+	assert.Assert(t, errors.Is(err, ErrDepositNotActive))
+	_, err = tnb.BreakTermDeposit(1001, renewed.ID)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	// a deposit due today is matured with the interest before the maturity job runs.
+	due, err := tnb.OpenTermDeposit(1001, 100, 24, MaturityPayout)
+	if err != nil {
+		t.Fatalf("failed to open the term deposit: %v", err)
+	}
+	_, err = tnb.db.Exec("UPDATE term_deposit SET maturity=$2 WHERE id=$1;", due.ID, time.Now().UTC().Format(dateLayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matured, err := tnb.BreakTermDeposit(1001, due.ID)
+	if err != nil {
+		t.Fatalf("failed to break the term deposit: %v", err)
+	}
+	assert.Equal(t, DepositMatured, matured.Status)
+	assert.Equal(t, float64(20), matured.Interest)
+	assert.Equal(t, float64(0), matured.Penalty)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(132), balance)
+}
+
+func TestAmortize(t *testing.T) {
+	type amortizeFixture struct {
+		name      string
+		principal float64
+		method    string
+		currency  string
+		first     *Installment
+		last      *Installment
+		interests float64
+	}
+
+	start := time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	fs := make([]*amortizeFixture, 3)
+	fs[0] = &amortizeFixture{
+		name:      "annuity pays the same amount",
+		principal: 1200,
+		method:    LoanAnnuity,
+		currency:  "USD",
+		first:     &Installment{Seq: 1, DueDate: "2023-02-28", Principal: 94.62, Interest: 12, Amount: 106.62, Status: InstallmentDue},
+		last:      &Installment{Seq: 12, DueDate: "2024-01-31", Principal: 105.54, Interest: 1.06, Amount: 106.6, Status: InstallmentDue},
+		interests: 79.42,
+	}
+	fs[1] = &amortizeFixture{
+		name:      "equal principal pays decreasing interest",
+		principal: 1200,
+		method:    LoanEqualPrincipal,
+		currency:  "USD",
+		first:     &Installment{Seq: 1, DueDate: "2023-02-28", Principal: 100, Interest: 12, Amount: 112, Status: InstallmentDue},
+		last:      &Installment{Seq: 12, DueDate: "2024-01-31", Principal: 100, Interest: 1, Amount: 101, Status: InstallmentDue},
+		interests: 78,
+	}
+	fs[2] = &amortizeFixture{
+		name:      "yen has no minor unit",
+		principal: 120000,
+		method:    LoanAnnuity,
+		currency:  "JPY",
+		first:     &Installment{Seq: 1, DueDate: "2023-02-28", Principal: 9462, Interest: 1200, Amount: 10662, Status: InstallmentDue},
+		last:      &Installment{Seq: 12, DueDate: "2024-01-31", Principal: 10554, Interest: 106, Amount: 10660, Status: InstallmentDue},
+		interests: 7942,
+	}
+
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			is := amortize(f.principal, 0.12, 12, f.method, start, f.currency)
+			assert.Equal(t, 12, len(is))
+			assert.DeepEqual(t, f.first, is[0])
+			assert.DeepEqual(t, f.last, is[11])
+
+			var principal, interests float64
+			for _, i := range is {
+				principal += i.Principal
+				interests += i.Interest
+			}
+			assert.Equal(t, f.principal, math.Round(principal*100)/100)
+			assert.Equal(t, f.interests, math.Round(interests*100)/100)
+		})
+	}
+}
+
+func TestLoan(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	l, err := tnb.DisburseLoan(1001, 1200, 0.12, 12, LoanEqualPrincipal)
+	if err != nil {
+		t.Fatalf("failed to disburse the loan: %v", err)
+	}
+	assert.Equal(t, float64(1200), l.Outstanding)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(1300), balance)
+
+	_, err = tnb.DisburseLoan(1001, 1200, 0.12, 12, "bullet")
+	msg := compareErrors(fmt.Errorf("method of loan must be annuity or equal-principal. your input is bullet"), err)
+	if msg != "" {
+		t.Error(msg)
+	}
+
+	// deleting the account doesn't forgive the loan.
+	err = tnb.DeleteAccount(1001)
+	assert.Assert(t, errors.Is(err, ErrAccountInUse))
+	assert.Error(t, err, "account(ID: 1001) has 1 active loans. pay them off before deleting it: account is in use")
+	_, err = tnb.GetLoan(l.ID)
+	assert.NilError(t, err)
+
+	// the first installment is 100 of principal and 12 of interest.
+	n, err := tnb.CollectRepayments(time.Now().AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatalf("failed to collect repayments: %v", err)
+	}
+	assert.Equal(t, 1, n)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(1188), balance)
+	income, _ := tnb.GetBalance(LoanInterestIncomeAccount)
+	assert.Equal(t, float64(12), income)
+
+	// the second installment cannot be collected from the empty account, and it is overdue on the next day.
+	_, err = tnb.Withdraw(1001, 1188)
+	if err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+	n, err = tnb.CollectRepayments(time.Now().AddDate(0, 2, 1))
+	if err != nil {
+		t.Fatalf("failed to collect repayments: %v", err)
+	}
+	assert.Equal(t, 0, n)
+
+	s, err := tnb.GetLoanStatement(l.ID)
+	if err != nil {
+		t.Fatalf("failed to get the statement: %v", err)
+	}
+	assert.Equal(t, float64(1100), s.Loan.Outstanding)
+	assert.Equal(t, 1, len(s.Payments))
+	assert.Equal(t, float64(12), s.PaidInterest)
+	assert.Equal(t, 1, s.OverdueCount)
+	assert.Equal(t, float64(121), s.Arrears)
+	assert.Equal(t, 3, s.NextInstallment.Seq)
+
+	// paying off today owes the overdue interest and late fee, but no interest accrued since the disbursement.
+	q, err := tnb.QuotePayoff(l.ID, time.Now())
+	if err != nil {
+		t.Fatalf("failed to quote the payoff: %v", err)
+	}
+	assert.DeepEqual(t, &PayoffQuote{Loan: l.ID, Date: l.DisbursedOn, Principal: 1100, Interest: 11, LateFees: 10, Total: 1121}, q)
+
+	_, err = tnb.PayOffLoan(l.ID)
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+
+	_, err = tnb.Deposit(1001, 2000)
+	if err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+	p, err := tnb.PayOffLoan(l.ID)
+	if err != nil {
+		t.Fatalf("failed to pay off the loan: %v", err)
+	}
+	assert.Equal(t, float64(1121), p.Amount)
+	assert.Equal(t, float64(879), p.Balance)
+
+	l, err = tnb.GetLoan(l.ID)
+	if err != nil {
+		t.Fatalf("failed to get the loan: %v", err)
+	}
+	assert.Equal(t, LoanPaidOff, l.Status)
+	assert.Equal(t, float64(0), l.Outstanding)
+	income, _ = tnb.GetBalance(LoanInterestIncomeAccount)
+	assert.Equal(t, float64(23), income)
+	income, _ = tnb.GetBalance(FeeIncomeAccount)
+	assert.Equal(t, float64(10), income)
+
+	_, err = tnb.PayOffLoan(l.ID)
+	assert.Assert(t, errors.Is(err, ErrLoanNotActive))
+	_, err = tnb.GetLoan(0)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestLuhn(t *testing.T) {
+	type luhnFixture struct {
+		pan   string
+		valid bool
+	}
+
+	fs := make([]*luhnFixture, 6)
+	fs[0] = &luhnFixture{"4111111111111111", true}
+	fs[1] = &luhnFixture{"5555555555554444", true}
+	fs[2] = &luhnFixture{"378282246310005", true}
+	fs[3] = &luhnFixture{"4111111111111112", false}
+	fs[4] = &luhnFixture{"411111111111111a", false}
+	fs[5] = &luhnFixture{"41111", false}
+
+	for _, f := range fs {
+		t.Run(f.pan, func(t *testing.T) {
+			assert.Equal(t, f.valid, luhnValid(f.pan))
+		})
+	}
+
+	assert.Equal(t, byte('1'), luhnDigit("411111111111111"))
+	assert.Equal(t, byte('5'), luhnDigit("37828224631000"))
+}
+
+func TestCard(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	t.Setenv("CARD_SECRET", "")
+	_, err = tnb.IssueCard(1001)
+	assert.Assert(t, errors.Is(err, ErrNoCardSecret))
+	t.Setenv("CARD_SECRET", "0123456789abcdef0123456789abcdef")
+
+	c, err := tnb.IssueCard(1001)
+	if err != nil {
+		t.Fatalf("failed to issue the card: %v", err)
+	}
+	assert.Equal(t, 16, len(c.PAN))
+	assert.Assert(t, luhnValid(c.PAN))
+	assert.Equal(t, defaultCardBIN, c.PAN[:6])
+	assert.Equal(t, 3, len(c.CVV))
+
+	cs, err := tnb.GetCards(1001)
+	if err != nil {
+		t.Fatalf("failed to get the cards: %v", err)
+	}
+	assert.Equal(t, "************"+c.PAN[12:], cs[0].PAN)
+	assert.Equal(t, "", cs[0].CVV)
+
+	_, err = tnb.IssueCard(9999)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	r := &AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: c.CVV, Amount: 60, Merchant: "coffee shop"}
+	approved, err := tnb.Authorize(r)
+	if err != nil {
+		t.Fatalf("failed to authorize: %v", err)
+	}
+	assert.Equal(t, AuthorizationApproved, approved.Status)
+	available, _ := tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(40), available)
+
+	wrong := "000"
+	if c.CVV == wrong {
+		wrong = "111"
+	}
+	type declineFixture struct {
+		name    string
+		request *AuthorizationRequest
+		reason  string
+	}
+	fs := make([]*declineFixture, 3)
+	fs[0] = &declineFixture{"insufficient funds", &AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: c.CVV, Amount: 50}, "insufficient_funds"}
+	fs[1] = &declineFixture{"invalid cvv", &AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: wrong, Amount: 10}, "invalid_cvv"}
+	fs[2] = &declineFixture{"invalid expiry", &AuthorizationRequest{PAN: c.PAN, Expiry: "01/20", CVV: c.CVV, Amount: 10}, "invalid_expiry"}
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			a, err := tnb.Authorize(f.request)
+			if err != nil {
+				t.Fatalf("failed to authorize: %v", err)
+			}
+			assert.Equal(t, AuthorizationDeclined, a.Status)
+			assert.Equal(t, f.reason, a.Reason)
+		})
+	}
+
+	// the card is frozen by the wrong cvvs in a row, and then even the right cvv is declined.
+	for i := 0; i < maxCVVAttempts; i++ {
+		a, _ := tnb.Authorize(&AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: wrong, Amount: 10})
+		assert.Equal(t, "invalid_cvv", a.Reason)
+	}
+	cs, _ = tnb.GetCards(1001)
+	assert.Equal(t, CardFrozen, cs[0].Status)
+	a, _ := tnb.Authorize(&AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: c.CVV, Amount: 10})
+	assert.Equal(t, "card_frozen", a.Reason)
+	_, err = tnb.SetCardStatus(1001, c.ID, CardActive)
+	if err != nil {
+		t.Fatalf("failed to unfreeze the card: %v", err)
+	}
+
+	_, err = tnb.SetCardStatus(1001, c.ID, CardFrozen)
+	if err != nil {
+		t.Fatalf("failed to freeze the card: %v", err)
+	}
+	a, _ = tnb.Authorize(&AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: c.CVV, Amount: 10})
+	assert.Equal(t, "card_frozen", a.Reason)
+	_, err = tnb.SetCardStatus(1001, c.ID, CardActive)
+	if err != nil {
+		t.Fatalf("failed to unfreeze the card: %v", err)
+	}
+
+	// clearing less than the authorization releases the rest.
+	cleared, err := tnb.ClearAuthorization(approved.ID, 50)
+	if err != nil {
+		t.Fatalf("failed to clear the authorization: %v", err)
+	}
+	assert.Equal(t, AuthorizationCleared, cleared.Status)
+	assert.Equal(t, float64(50), cleared.Cleared)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(50), balance)
+	available, _ = tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(50), available)
+
+	_, err = tnb.ClearAuthorization(approved.ID, 0)
+	assert.Assert(t, errors.Is(err, ErrAuthorizationNotOpen))
+
+	a, _ = tnb.Authorize(&AuthorizationRequest{PAN: c.PAN, Expiry: c.Expiry, CVV: c.CVV, Amount: 30})
+	voided, err := tnb.VoidAuthorization(a.ID)
+	if err != nil {
+		t.Fatalf("failed to void the authorization: %v", err)
+	}
+	assert.Equal(t, AuthorizationVoided, voided.Status)
+	available, _ = tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(50), available)
+
+	_, err = tnb.SetCardStatus(1001, c.ID, CardCancelled)
+	if err != nil {
+		t.Fatalf("failed to cancel the card: %v", err)
+	}
+	_, err = tnb.SetCardStatus(1001, c.ID, CardActive)
+	assert.Assert(t, errors.Is(err, ErrCardCancelled))
+
+	_, err = tnb.Authorize(&AuthorizationRequest{PAN: "4111111111111111", Expiry: c.Expiry, CVV: c.CVV, Amount: 10})
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestCurrency(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.OpenAccount(&Customer{Name: "Yen", Address: "Tokyo", Phone: "000"}, ProductChecking, "XXX")
+	assert.Assert(t, errors.Is(err, ErrUnknownCurrency))
+
+	yen, err := tnb.OpenAccount(&Customer{Name: "Yen", Address: "Tokyo", Phone: "000"}, ProductChecking, "JPY")
+	if err != nil {
+		t.Fatalf("failed to open the account: %v", err)
+	}
+	assert.Equal(t, "JPY", yen.Currency)
+
+	err = tnb.CheckTrade(yen.Number, &Trade{Amount: 10, Currency: "USD"})
+	assert.Assert(t, errors.Is(err, ErrCurrencyMismatch))
+	err = tnb.CheckTrade(yen.Number, &Trade{Amount: 1.5})
+	assert.Error(t, err, "amount 1.5 has more decimals than JPY allows")
+	err = tnb.CheckTrade(1001, &Trade{Amount: 1.5, Currency: "USD"})
+	assert.NilError(t, err)
+
+	// no rate is set yet.
+	_, err = tnb.Transfer(1001, yen.Number, 10)
+	assert.Error(t, err, "no exchange rate from USD to JPY")
+
+	_, err = tnb.SetFXRate(&FXRate{Base: "USD", Quote: "JPY", Rate: 150})
+	if err != nil {
+		t.Fatalf("failed to set the rate: %v", err)
+	}
+
+	as, err := tnb.Transfer(1001, yen.Number, 10)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	assert.Equal(t, float64(90), as[0].Balance)
+	assert.Equal(t, float64(1485), as[1].Balance)
+
+	ts, err := tnb.GetTransfers(yen.Number)
+	if err != nil {
+		t.Fatalf("failed to get the transfers: %v", err)
+	}
+	assert.Equal(t, "USD", ts[0].Currency)
+	assert.Equal(t, float64(1485), ts[0].Credited)
+	assert.Equal(t, "JPY", ts[0].CreditedCurrency)
+	assert.Assert(t, math.Abs(ts[0].Rate-150*(1-defaultFXSpread)) < 1e-9)
+
+	// a reversal in dollars takes back the same part of the yen at the rate of the transfer, whatever the rate of now.
+	_, err = tnb.SetFXRate(&FXRate{Base: "USD", Quote: "JPY", Rate: 100})
+	if err != nil {
+		t.Fatalf("failed to set the rate: %v", err)
+	}
+	r, err := tnb.ReverseTransfer(ts[0].ID, 4, "")
+	if err != nil {
+		t.Fatalf("failed to reverse the transfer: %v", err)
+	}
+	assert.Equal(t, ReversalCompleted, r.Status)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(94), balance)
+	balance, _ = tnb.GetBalance(yen.Number)
+	assert.Equal(t, float64(891), balance)
+	refund, err := tnb.GetTransfer(r.Refund)
+	if err != nil {
+		t.Fatalf("failed to get the refund: %v", err)
+	}
+	assert.Equal(t, float64(594), refund.Amount)
+	assert.Equal(t, "JPY", refund.Currency)
+	assert.Equal(t, float64(4), refund.Credited)
+	assert.Equal(t, "USD", refund.CreditedCurrency)
+
+	// the inverse of USD/JPY converts yen into dollars.
+	as, err = tnb.Transfer(yen.Number, 1001, 891)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	assert.Equal(t, float64(0), as[0].Balance)
+	assert.Equal(t, 102.82, as[1].Balance)
+}
+
+func TestFXQuote(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	yen, err := tnb.OpenAccount(&Customer{Name: "Yen", Address: "Tokyo", Phone: "000"}, ProductChecking, "JPY")
+	if err != nil {
+		t.Fatalf("failed to open the account: %v", err)
+	}
+
+	_, err = tnb.QuoteFX("USD", "JPY", 10)
+	assert.Assert(t, errors.Is(err, rates.ErrNoRate))
+
+	_, err = tnb.SetFXRate(&FXRate{Base: "USD", Quote: "JPY", Rate: 150})
+	if err != nil {
+		t.Fatalf("failed to set the rate: %v", err)
+	}
+	// a rate effective tomorrow is kept in the history, but not used yet.
+	_, err = tnb.SetFXRate(&FXRate{Base: "USD", Quote: "JPY", Rate: 100, EffectiveAt: time.Now().AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to set the rate: %v", err)
+	}
+	current, err := tnb.GetFXRates()
+	if err != nil {
+		t.Fatalf("failed to get the rates: %v", err)
+	}
+	assert.Equal(t, 1, len(current))
+	assert.Equal(t, float64(150), current[0].Rate)
+	history, err := tnb.GetFXRateHistory("USD", "JPY")
+	if err != nil {
+		t.Fatalf("failed to get the history: %v", err)
+	}
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, float64(100), history[0].Rate)
+
+	fq, err := tnb.QuoteFX("USD", "JPY", 10)
+	if err != nil {
+		t.Fatalf("failed to quote: %v", err)
+	}
+	assert.Equal(t, float64(150), fq.Mid)
+	assert.Equal(t, float64(1485), fq.Converted)
+
+	// the rate of the quote is used even if the rate changes before the transfer.
+	_, err = tnb.SetFXRate(&FXRate{Base: "USD", Quote: "JPY", Rate: 120})
+	if err != nil {
+		t.Fatalf("failed to set the rate: %v", err)
+	}
+
+	_, err = tnb.TransferAtQuote(1001, yen.Number, 5, fq.ID)
+	assert.Error(t, err, fmt.Sprintf("quote(ID: %v) is for 10, but transfer is of 5", fq.ID))
+	_, err = tnb.TransferAtQuote(1001, 3003, 10, fq.ID)
+	assert.Error(t, err, "transfer from id_1001 to id_3003 is in USD and cannot redeem a quote")
+
+	as, err := tnb.TransferAtQuote(1001, yen.Number, 10, fq.ID)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	assert.Equal(t, float64(1485), as[1].Balance)
+
+	_, err = tnb.TransferAtQuote(1001, yen.Number, 10, fq.ID)
+	assert.Assert(t, errors.Is(err, ErrQuoteRedeemed))
+
+	expired, err := tnb.QuoteFX("USD", "JPY", 0)
+	if err != nil {
+		t.Fatalf("failed to quote: %v", err)
+	}
+	_, err = tnb.db.Exec(`UPDATE fx_quote SET expires_at=now() - interval '1 second' WHERE id=$1;`, expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tnb.TransferAtQuote(1001, yen.Number, 10, expired.ID)
+	assert.Assert(t, errors.Is(err, ErrQuoteExpired))
+
+	_, err = tnb.TransferAtQuote(1001, yen.Number, 10, "unknown")
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestIBAN(t *testing.T) {
+	assert.Equal(t, "JP72NETB0000001001", IBAN(1001))
+	assert.Equal(t, "", IBAN(FeeIncomeAccount))
+
+	type fixture struct {
+		name    string
+		input   string
+		num     int
+		wantErr string
+	}
+	fs := make([]*fixture, 13)
+	fs[0] = &fixture{"identifier", "JP72NETB0000001001", 1001, ""}
+	fs[1] = &fixture{"lower case with spaces", "jp72 netb 0000 0010 01", 1001, ""}
+	fs[2] = &fixture{"internal id", "3003", 3003, ""}
+	fs[3] = &fixture{"transposed digits", "JP72NETB0000001010", 0, "check digits of JP72NETB0000001010 are wrong: invalid account identifier"}
+	fs[4] = &fixture{"wrong check digits", "JP27NETB0000001001", 0, "check digits of JP27NETB0000001001 are wrong: invalid account identifier"}
+	fs[5] = &fixture{"too short", "JP72NETB1001", 0, "JP72NETB1001 has 12 characters. it must be like JP72NETB0000001001: invalid account identifier"}
+	fs[6] = &fixture{"other country", "GB82WEST12345698765432", 0, "GB82WEST12345698765432 has 22 characters. it must be like JP72NETB0000001001: invalid account identifier"}
+	fs[7] = &fixture{"not an id", "千百一", 0, "got 千百一 as invalied id"}
+	fs[8] = &fixture{"internal account", "-1", 0, "got -1 as invalied id"}
+	fs[9] = &fixture{"identifier of account 0", IBAN(0), 0, fmt.Sprintf("got %v as invalied id", IBAN(0))}
+	fs[10] = &fixture{"largest account", IBAN(math.MaxInt32), math.MaxInt32, ""}
+	fs[11] = &fixture{"identifier beyond the largest account", IBAN(math.MaxInt32 + 1), 0,
+		fmt.Sprintf("account number of %v is more than 2147483647: invalid account identifier", IBAN(math.MaxInt32+1))}
+	fs[12] = &fixture{"id beyond the largest account", "2147483648", 0, "got 2147483648 as invalied id"}
+
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			num, err := ParseAccountID(f.input)
+			if f.wantErr != "" {
+				assert.Error(t, err, f.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, f.num, num)
+		})
+	}
+
+	// an identifier of another bank has the right check digits, but is not ours.
+	t.Setenv("BANK_CODE", "ABCD")
+	other := IBAN(1001)
+	t.Setenv("BANK_CODE", "")
+	_, err := ParseIBAN(other)
+	assert.Error(t, err, fmt.Sprintf("%v is an account of bank ABCD, not NETB: invalid account identifier", other))
+
+	var trade Trade
+	err = json.Unmarshal([]byte(`{"class":"transfer","amount":10,"to":"JP47NETB0000003003"}`), &trade)
+	assert.NilError(t, err)
+	assert.Equal(t, AccountRef(3003), trade.To)
+	err = json.Unmarshal([]byte(`{"class":"transfer","amount":10,"to":3003}`), &trade)
+	assert.NilError(t, err)
+	assert.Equal(t, AccountRef(3003), trade.To)
+	err = json.Unmarshal([]byte(`{"class":"transfer","amount":10,"to":"JP47NETB0000003030"}`), &trade)
+	assert.Assert(t, errors.Is(err, ErrInvalidIBAN))
+	err = json.Unmarshal([]byte(`{"class":"transfer","amount":10,"to":-5}`), &trade)
+	assert.Error(t, err, "got -5 as invalied id")
+	err = json.Unmarshal([]byte(`{"class":"transfer","amount":10,"to":2147483648}`), &trade)
+	assert.Error(t, err, "got 2147483648 as invalied id")
+}
+
+func TestZenginKana(t *testing.T) {
+	type fixture struct {
+		input    string
+		expected string
+		wantErr  string
+	}
+	fs := make([]*fixture, 6)
+	fs[0] = &fixture{"John", "JOHN", ""}
+	fs[1] = &fixture{"ヤマダ　タロウ", "ﾔﾏﾀﾞ ﾀﾛｳ", ""}
+	fs[2] = &fixture{"がっこう", "ｶﾞﾂｺｳ", ""}
+	fs[3] = &fixture{"ＡＢＣ（カ）", "ABC(ｶ)", ""}
+	fs[4] = &fixture{"パーク", "ﾊﾟ-ｸ", ""}
+	fs[5] = &fixture{"山田", "", "'山' in 山田 cannot be written in zengin"}
+	for _, f := range fs {
+		t.Run(f.input, func(t *testing.T) {
+			got, err := ZenginKana(f.input)
+			if f.wantErr != "" {
+				assert.Error(t, err, f.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, f.expected, got)
+		})
+	}
+}
+
+func TestZenginFile(t *testing.T) {
+	f := &ZenginFile{
+		Header: &ZenginHeader{Kind: ZenginTotalTransfer, RequesterCode: "0000001001", RequesterName: "ﾔﾏﾀﾞ ﾀﾛｳ", Date: "1031", Bank: "9999",
+			BankName: "ﾈﾂﾄﾊﾞﾝｸ", Branch: "001", BranchName: "ﾎﾝﾃﾝ", DepositType: "1", Account: "0001001"},
+		Records: []*ZenginRecord{
+			{Bank: "9999", BankName: "ﾈﾂﾄﾊﾞﾝｸ", Branch: "001", BranchName: "ﾎﾝﾃﾝ", DepositType: "1", Account: "0003003", Name: "IDE NON NO", Amount: 1500, CustomerCode1: "1"},
+			{Bank: "9999", BankName: "ﾈﾂﾄﾊﾞﾝｸ", Branch: "001", BranchName: "ﾎﾝﾃﾝ", DepositType: "1", Account: "0001002", Name: "ｽｽﾞｷ ﾊﾅｺ", Amount: 20000},
+		},
+	}
+	bs, err := EncodeZengin(f)
+	assert.NilError(t, err)
+
+	golden, err := os.ReadFile("testdata/zengin.txt")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, golden, bs)
+
+	records := bytes.Split(bytes.TrimSuffix(bs, []byte("\r\n")), []byte("\r\n"))
+	assert.Equal(t, 5, len(records))
+	for _, r := range records {
+		assert.Equal(t, zenginRecordLength, len(r))
+	}
+	assert.Equal(t, "8000002000000021500", string(records[3][:19]))
+
+	parsed, issues := ParseZengin(bs)
+	assert.Equal(t, 0, len(issues))
+	assert.DeepEqual(t, f.Header, parsed.Header)
+	assert.Equal(t, 2, parsed.Count)
+	assert.Equal(t, int64(21500), parsed.Amount)
+	assert.Equal(t, "ｽｽﾞｷ ﾊﾅｺ", parsed.Records[1].Name)
+	assert.Equal(t, 3, parsed.Records[1].Line)
+
+	// records without separators are read as well.
+	_, issues = ParseZengin(bytes.ReplaceAll(bs, []byte("\r\n"), nil))
+	assert.Equal(t, 0, len(issues))
+
+	broken := bytes.Replace(bs, []byte("8000002000000021500"), []byte("8000002000000021000"), 1)
+	broken = broken[:len(broken)-zenginRecordLength-2]
+	_, issues = ParseZengin(broken)
+	assert.Equal(t, 2, len(issues))
+	assert.Equal(t, "trailer has 21000 in total, but the records are 21500", issues[0].Error)
+	assert.Equal(t, "file has no end record", issues[1].Error)
+
+	f.Records[0].Name = "山田"
+	_, err = EncodeZengin(f)
+	assert.ErrorContains(t, err, "bytes in Shift_JIS")
+}
+
+func TestZenginExportImport(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.ExportZengin(1001, time.Now(), time.Now())
+	assert.Assert(t, errors.Is(err, ErrCurrencyMismatch))
+
+	_, err = tnb.db.Exec(`UPDATE account SET currency='JPY', balance=10000 WHERE id IN (1001, 3003);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tnb.Transfer(1001, 3003, 1500)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	bs, err := tnb.ExportZengin(1001, time.Now(), time.Now())
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	f, issues := ParseZengin(bs)
+	assert.Equal(t, 0, len(issues))
+	assert.Equal(t, "JOHN", f.Header.RequesterName)
+	assert.Equal(t, 1, len(f.Records))
+	assert.Equal(t, "0003003", f.Records[0].Account)
+	assert.Equal(t, "IDE NON NO", f.Records[0].Name)
+	assert.Equal(t, int64(1500), f.Records[0].Amount)
+
+	report, err := tnb.ImportZengin(1001, bs, "", true)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	assert.Assert(t, report.Valid)
+	assert.Equal(t, 1, len(report.Trades))
+	assert.Assert(t, report.Result == nil)
+
+	report, err = tnb.ImportZengin(1001, bs, "", false)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	assert.Assert(t, report.Result.Committed)
+	balance, _ := tnb.GetBalance(3003)
+	assert.Equal(t, float64(13000), balance)
+
+	f.Records[0].Name = "SOMEONE ELSE"
+	f.Records[0].Bank = "0001"
+	wrong, err := EncodeZengin(f)
+	assert.NilError(t, err)
+	report, err = tnb.ImportZengin(3003, wrong, "", false)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	assert.Assert(t, !report.Valid)
+	assert.Equal(t, 2, len(report.Issues))
+	assert.Equal(t, "file is from account 0001001, not 3003", report.Issues[0].Error)
+	assert.Equal(t, "transfer to bank 0001 is not supported", report.Issues[1].Error)
+}
+
+func TestNormalizeKanaName(t *testing.T) {
+	type fixture struct {
+		input   string
+		half    string
+		full    string
+		wantErr string
+	}
+	fs := make([]*fixture, 6)
+	fs[0] = &fixture{"ﾔﾏﾀﾞ ﾀﾛｳ", "ﾔﾏﾀﾞ ﾀﾛｳ", "ヤマダ　タロウ", ""}
+	fs[1] = &fixture{"ヤマダ　　タロウ", "ﾔﾏﾀﾞ ﾀﾛｳ", "ヤマダ　タロウ", ""}
+	fs[2] = &fixture{"ぱーく", "ﾊﾟ-ｸ", "パーク", ""}
+	fs[3] = &fixture{"ｶ)ﾈﾂﾄ", "ｶ)ﾈﾂﾄ", "カ）ネツト", ""}
+	fs[4] = &fixture{"　", "", "", "name is empty"}
+	fs[5] = &fixture{"山田", "", "", "'山' in 山田 cannot be written in zengin"}
+	for _, f := range fs {
+		t.Run(f.input, func(t *testing.T) {
+			got, err := NormalizeKanaName(f.input)
+			if f.wantErr != "" {
+				assert.Error(t, err, f.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, f.half, got.Half)
+			assert.Equal(t, f.full, got.Full)
+		})
+	}
+}
+
+func TestBeneficiaryFormat(t *testing.T) {
+	assert.NilError(t, checkDigits("0001", bankCodeDigits, "bank code"))
+	assert.Assert(t, errors.Is(checkDigits("001", bankCodeDigits, "bank code"), ErrInvalidBeneficiary))
+	assert.Assert(t, errors.Is(checkDigits("00a", branchCodeDigits, "branch code"), ErrInvalidBeneficiary))
+
+	for _, at := range []string{"1", "2", "4", "9"} {
+		assert.NilError(t, checkAccountType(at))
+	}
+	assert.Assert(t, errors.Is(checkAccountType("3"), ErrInvalidBeneficiary))
+
+	number, err := normalizeAccountNumber("1234")
+	assert.NilError(t, err)
+	assert.Equal(t, "0001234", number)
+	_, err = normalizeAccountNumber("12345678")
+	assert.Error(t, err, "account number must be up to 7 digits. your input is 12345678: invalid beneficiary")
+	_, err = normalizeAccountNumber("12-34")
+	assert.Assert(t, errors.Is(err, ErrInvalidBeneficiary))
+}
+
+func TestDomesticTransfer(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	csv := "bank_code,bank_name,bank_kana,branch_code,branch_name,branch_kana\n" +
+		"0001,みずほ銀行,ミズホ,001,東京営業部,トウキヨウ\n" +
+		"0001,みずほ銀行,ミズホ,110,新宿支店,シンジユク\n" +
+		"0005,三菱ＵＦＪ銀行,ミツビシユ-エフジエイ,001,本店,ホンテン\n"
+	loaded, err := tnb.LoadBankCodes(strings.NewReader(csv))
+	assert.NilError(t, err)
+	assert.Equal(t, 2, loaded.Banks)
+	assert.Equal(t, 3, loaded.Branches)
+
+	branches, err := tnb.GetBranches("0001")
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(branches))
+	assert.Equal(t, "ｼﾝｼﾞﾕｸ", branches[1].Kana)
+	_, err = tnb.GetBranches("0002")
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	b := &Beneficiary{Bank: "0001", Branch: "110", AccountType: AccountTypeOrdinary, AccountNumber: "1234", Name: "やまだ たろう"}
+	checked, err := tnb.CheckBeneficiary(b)
+	assert.NilError(t, err)
+	assert.Equal(t, "新宿支店", checked.BranchName)
+	assert.Equal(t, "0001234", checked.AccountNumber)
+	assert.Equal(t, "ﾔﾏﾀﾞ ﾀﾛｳ", checked.Name)
+
+	_, err = tnb.CheckBeneficiary(&Beneficiary{Bank: "0001", Branch: "999", AccountType: "1", AccountNumber: "1", Name: "ﾔﾏﾀﾞ"})
+	assert.Error(t, err, "branch 999 of bank 0001 doesnt exist: invalid beneficiary")
+	_, err = tnb.CheckBeneficiary(&Beneficiary{Bank: "9999", Branch: "001", AccountType: "1", AccountNumber: "1", Name: "ﾔﾏﾀﾞ"})
+	assert.Error(t, err, "bank 9999 is this bank. transfer to the account directly: invalid beneficiary")
+
+	_, err = tnb.SendDomesticTransfer(1001, b, 1000)
+	assert.Assert(t, errors.Is(err, ErrCurrencyMismatch))
+
+	_, err = tnb.db.Exec(`UPDATE account SET currency='JPY', balance=10000 WHERE id=1001;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := tnb.SendDomesticTransfer(1001, b, 1000)
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	assert.Equal(t, "ﾔﾏﾀﾞ ﾀﾛｳ", o.Beneficiary.Name)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(9000), balance)
+	clearing, _ := tnb.GetBalance(DomesticClearingAccount)
+	assert.Equal(t, float64(1000), clearing)
+
+	// the money in the clearing account is paid to the other bank, so the sender cannot take it back.
+	_, err = tnb.ReverseTransfer(o.Transfer, 0, "")
+	assert.Error(t, err, fmt.Sprintf("transfer(ID: %v) is with another bank and is reversed only by its return", o.Transfer))
+
+	bs, err := tnb.ExportZengin(1001, time.Now(), time.Now())
+	assert.NilError(t, err)
+	f, issues := ParseZengin(bs)
+	assert.Equal(t, 0, len(issues))
+	assert.Equal(t, 1, len(f.Records))
+	assert.Equal(t, "0001", f.Records[0].Bank)
+	assert.Equal(t, "ｼﾝｼﾞﾕｸ", f.Records[0].BranchName)
+	assert.Equal(t, "0001234", f.Records[0].Account)
+}
+
+func TestCamt053(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	a := &Account{Customer: Customer{Name: "John"}, Number: 1001, Currency: "USD"}
+	es := []*Event{
+		{ID: 7, Type: BalanceChanged, Account: 1001, Amount: 50, At: time.Date(2023, 10, 31, 9, 0, 0, 0, jst)},
+		{ID: 9, Type: BalanceChanged, Account: 1001, Amount: -30.5, Counterparty: 3003, At: time.Date(2023, 10, 31, 10, 0, 0, 0, jst)},
+		{ID: 10, Type: FeePosted, Account: 1001, Amount: -1, Counterparty: FeeIncomeAccount, At: time.Date(2023, 10, 31, 10, 0, 0, 0, jst)},
+	}
+	date := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	s := newCamt053(a, es, 118.5, date, time.Date(2023, 11, 1, 0, 5, 0, 0, time.UTC))
+
+	assert.Equal(t, "100.00", s.Statement.Balances[0].Amount.Value)
+	assert.Equal(t, "18.50", s.Statement.Summary.NetAmount)
+	bs, err := s.Encode()
+	assert.NilError(t, err)
+	golden, err := os.ReadFile("testdata/camt053.xml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(golden), string(bs))
+
+	// an overdrawn account has the balances as debits.
+	s = newCamt053(a, es[1:], -20, date, time.Now())
+	assert.Equal(t, iso20022.Credit, s.Statement.Balances[0].Indicator)
+	assert.Equal(t, "11.50", s.Statement.Balances[0].Amount.Value)
+	assert.Equal(t, iso20022.Debit, s.Statement.Balances[1].Indicator)
+	assert.Equal(t, "20.00", s.Statement.Balances[1].Amount.Value)
+}
+
+func TestISO20022(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	data, err := os.ReadFile("iso20022/testdata/pain001.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := tnb.ImportPain001(1001, data, "", true)
+	assert.NilError(t, err)
+	assert.Equal(t, iso20022.StatusAcceptedTechnicalValidation, report.Group.Status)
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(100), balance)
+
+	// the second transaction is to an account which doesnt exist, and atomic mode sends nothing.
+	wrong := bytes.Replace(data, []byte("<Id>3003</Id>"), []byte("<Id>404</Id>"), 1)
+	report, err = tnb.ImportPain001(1001, wrong, "", false)
+	assert.NilError(t, err)
+	assert.Equal(t, iso20022.StatusRejected, report.Group.Status)
+	txs := report.PaymentInfos[0].Transactions
+	assert.Equal(t, iso20022.ReasonNarrative, txs[0].Reasons[0].Code)
+	assert.Equal(t, iso20022.ReasonIncorrectAccount, txs[1].Reasons[0].Code)
+
+	report, err = tnb.ImportPain001(1001, wrong, BatchBestEffort, false)
+	assert.NilError(t, err)
+	assert.Equal(t, iso20022.StatusPartiallyAccepted, report.Group.Status)
+	assert.Equal(t, iso20022.StatusAcceptedSettlementCompleted, report.PaymentInfos[0].Transactions[0].Status)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(70), balance)
+
+	report, err = tnb.ImportPain001(3003, data, "", false)
+	assert.NilError(t, err)
+	assert.Equal(t, iso20022.StatusRejected, report.Group.Status)
+	assert.Equal(t, "debtor account JP72NETB0000001001 is not account(ID: 3003)", report.PaymentInfos[0].Transactions[0].Reasons[0].Information[0])
+
+	report, err = tnb.ImportPain001(1001, []byte("<Document/>"), "", false)
+	assert.NilError(t, err)
+	assert.Equal(t, iso20022.ReasonInvalidFileFormat, report.Group.Reasons[0].Code)
+
+	bs, err := tnb.StatementCamt053(1001, time.Now())
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Contains(bs, []byte("<Amt Ccy=\"USD\">30.00</Amt>")))
+	assert.Assert(t, bytes.Contains(bs, []byte("<Amt Ccy=\"USD\">100.00</Amt>")))
+	assert.Assert(t, bytes.Contains(bs, []byte("<Amt Ccy=\"USD\">70.00</Amt>")))
+
+	_, err = tnb.StatementCamt053(404, time.Now())
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestWrapMT940(t *testing.T) {
+	assert.DeepEqual(t, []string{"ABCDE", "FGH"}, wrapMT940("ABCDEFGH", 5, 6))
+	assert.DeepEqual(t, []string{"AB", " :", "CD"}, wrapMT940("AB:CD", 2, 6))
+	assert.DeepEqual(t, []string{"ABCD", " -EF", "GH"}, wrapMT940("ABCD-EFGH", 4, 6))
+	assert.DeepEqual(t, []string{"ABC", "DEF"}, wrapMT940("ABCDEFGHI", 3, 2))
+	assert.DeepEqual(t, []string{"Muller .. S.A."}, wrapMT940("Müller 山田 S.A.", 65, 6))
+	assert.DeepEqual(t, []string{}, wrapMT940("", 65, 6))
+}
+
+func TestMT940(t *testing.T) {
+	a := &Account{Customer: Customer{Name: "John"}, Number: 1001, Currency: "USD"}
+	es := []*Event{
+		{ID: 7, Type: BalanceChanged, Account: 1001, Amount: 50, At: time.Date(2023, 10, 30, 9, 0, 0, 0, time.UTC)},
+		{ID: 9, Type: BalanceChanged, Account: 1001, Amount: -30.5, Counterparty: 3003, At: time.Date(2023, 10, 31, 10, 0, 0, 0, time.UTC)},
+		{ID: 10, Type: FeePosted, Account: 1001, Amount: -1, Counterparty: FeeIncomeAccount, At: time.Date(2023, 10, 31, 10, 0, 0, 0, time.UTC)},
+	}
+	s := newMT940(a, es, 118.5, time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, "2310311001", s.Reference)
+	assert.Equal(t, "23304/1", s.Number)
+	assert.DeepEqual(t, &MT940Balance{Mark: "C", Date: time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), Amount: 100}, s.Opening)
+	assert.Equal(t, "TRF", s.Lines[1].Type)
+	assert.Equal(t, "BALANCE-CHANGED TO JP47NETB0000003003", s.Lines[1].Information)
+	assert.Equal(t, "CHG", s.Lines[2].Type)
+
+	// the information of a line is wrapped by 65 characters.
+	s.Lines[0].Information = "CASH DEPOSIT AT THE COUNTER OF THE HEAD OFFICE BY THE OWNER OF THE ACCOUNT: JOHN -- LOS ANGELES"
+	bs, err := EncodeMT940(s)
+	assert.NilError(t, err)
+	golden, err := os.ReadFile("testdata/mt940.txt")
+	assert.NilError(t, err)
+	assert.Equal(t, string(golden), string(bs))
+	for _, l := range strings.Split(string(bs), "\r\n") {
+		assert.Assert(t, len(l) <= 4+mt940LineLength, l)
+	}
+
+	a.Currency = "JPY"
+	s = newMT940(a, es[:1], -1500, time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC))
+	bs, err = EncodeMT940(s)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(bs), ":60F:D231030JPY1550,\r\n"))
+	assert.Assert(t, strings.Contains(string(bs), ":62F:D231030JPY1500,\r\n"))
+}
+
+func TestMT940Export(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	bs, err := tnb.ExportMT940(1001, time.Now(), time.Now())
+	assert.NilError(t, err)
+	s := string(bs)
+	assert.Assert(t, strings.Contains(s, ":25:JP72NETB0000001001\r\n"))
+	assert.Assert(t, strings.Contains(s, "USD100,00\r\n"))
+	assert.Assert(t, strings.Contains(s, "D30,00NTRFNONREF//"))
+	assert.Assert(t, strings.Contains(s, ":86:BALANCE-CHANGED TO JP47NETB0000003003\r\n"))
+	assert.Assert(t, strings.Contains(s, "USD70,00\r\n-\r\n"))
+
+	_, err = tnb.ExportMT940(1001, time.Now(), time.Now().AddDate(0, 0, -1))
+	assert.ErrorContains(t, err, "is after to")
+	_, err = tnb.ExportMT940(404, time.Now(), time.Now())
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestPersonalStatement(t *testing.T) {
+	a := &Account{Customer: Customer{Name: "John"}, Number: 1001, Currency: "USD"}
+	es := []*Event{
+		{ID: 7, Type: BalanceChanged, Account: 1001, Amount: 50, At: time.Date(2023, 10, 30, 9, 0, 0, 0, time.UTC)},
+		{ID: 9, Type: BalanceChanged, Account: 1001, Amount: -30.5, Counterparty: 3003, At: time.Date(2023, 10, 31, 10, 0, 0, 0, time.UTC)},
+		{ID: 10, Type: FeePosted, Account: 1001, Amount: -1, Counterparty: FeeIncomeAccount, At: time.Date(2023, 10, 31, 10, 0, 0, 0, time.UTC)},
+	}
+	now := time.Date(2023, 11, 1, 8, 0, 0, 0, time.UTC)
+	s := newPersonalStatement(a, es, 118.5, time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC), now)
+	assert.Equal(t, 100.0, s.Opening)
+	assert.Equal(t, 150.0, s.Entries[0].Balance)
+	assert.Equal(t, 119.5, s.Entries[1].Balance)
+	assert.Equal(t, 118.5, s.Entries[2].Balance)
+	// the events are not changed by the running balances.
+	assert.Equal(t, 0.0, es[0].Balance)
+
+	ofx, err := EncodeOFX(s)
+	assert.NilError(t, err)
+	csv, err := EncodeCSV(s)
+	assert.NilError(t, err)
+	for _, f := range []struct {
+		name string
+		got  []byte
+	}{{"testdata/statement.ofx", ofx}, {"testdata/statement.qif", EncodeQIF(s)}, {"testdata/statement.csv", csv}} {
+		golden, err := os.ReadFile(f.name)
+		assert.NilError(t, err)
+		assert.Equal(t, string(golden), string(f.got), f.name)
+	}
+
+	a.Currency = "JPY"
+	s = newPersonalStatement(a, es[:1], 1550, time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), now)
+	assert.Assert(t, strings.Contains(string(EncodeQIF(s)), "T50\nN7\nPDeposit\nMBalance 1550\n^\n"))
+}
+
+func TestStatementDownload(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	token, err := tnb.IssueDownloadToken(1001)
+	assert.NilError(t, err)
+	assert.Equal(t, 1001, token.Account)
+	assert.Assert(t, token.ExpiresAt.After(time.Now()))
+
+	bs, err := tnb.ExportStatement(1001, token.Token, StatementCSV, time.Now(), time.Now())
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(bs)), "\r\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Assert(t, strings.HasSuffix(lines[1], ",balance-changed,Transfer to JP47NETB0000003003,JP47NETB0000003003,-30.00,USD,70.00"))
+
+	// the id of a transaction is the same on every download.
+	again, err := tnb.ExportStatement(1001, token.Token, StatementCSV, time.Now(), time.Now())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, bs, again)
+
+	bs, err = tnb.ExportStatement(1001, token.Token, StatementOFX, time.Now(), time.Now())
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(bs), "<TRNAMT>-30.00</TRNAMT>"))
+	assert.Assert(t, strings.Contains(string(bs), "<BALAMT>70.00</BALAMT>"))
+
+	// the token is only for the account.
+	_, err = tnb.ExportStatement(3003, token.Token, StatementQIF, time.Now(), time.Now())
+	assert.Assert(t, errors.Is(err, ErrInvalidDownloadToken))
+	_, err = tnb.ExportStatement(1001, "wrong", StatementQIF, time.Now(), time.Now())
+	assert.Assert(t, errors.Is(err, ErrInvalidDownloadToken))
+	_, err = tnb.db.Exec(`UPDATE download_token SET expires_at=now() - interval '1 second';`)
+	assert.NilError(t, err)
+	_, err = tnb.ExportStatement(1001, token.Token, StatementQIF, time.Now(), time.Now())
+	assert.Assert(t, errors.Is(err, ErrInvalidDownloadToken))
+
+	_, err = tnb.ExportStatement(1001, token.Token, "pdf", time.Now(), time.Now())
+	assert.Error(t, err, "format pdf is not one of ofx, qif and csv")
+	_, err = tnb.IssueDownloadToken(404)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestAccountCredential(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	c, err := tnb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatalf("failed to issue the credential: %v", err)
+	}
+	assert.NilError(t, tnb.CheckAccountCredential(1001, c.Token))
+	assert.Assert(t, errors.Is(tnb.CheckAccountCredential(3003, c.Token), ErrInvalidCredential))
+	assert.Assert(t, errors.Is(tnb.CheckAccountCredential(1001, ""), ErrInvalidCredential))
+
+	// a new credential revokes the old one.
+	renewed, err := tnb.IssueAccountCredential(1001)
+	if err != nil {
+		t.Fatalf("failed to issue the credential: %v", err)
+	}
+	assert.Assert(t, errors.Is(tnb.CheckAccountCredential(1001, c.Token), ErrInvalidCredential))
+	assert.NilError(t, tnb.CheckAccountCredential(1001, renewed.Token))
+
+	_, err = tnb.IssueAccountCredential(404)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+}
+
+func TestMonthlyStatementDocument(t *testing.T) {
+	key := ed25519.NewKeyFromSeed([]byte("0123456789abcdef0123456789abcdef"))
+	a := &Account{Customer: Customer{Name: "John <Doe>"}, Number: 1001, Currency: "USD"}
+	es := []*Event{
+		{ID: 7, Type: BalanceChanged, Account: 1001, Amount: 50, At: time.Date(2023, 10, 2, 9, 0, 0, 0, time.UTC)},
+		{ID: 9, Type: BalanceChanged, Account: 1001, Amount: -30.5, Counterparty: 3003, At: time.Date(2023, 10, 12, 10, 0, 0, 0, time.UTC)},
+		{ID: 10, Type: FeePosted, Account: 1001, Amount: -1, Counterparty: FeeIncomeAccount, At: time.Date(2023, 10, 12, 10, 0, 0, 0, time.UTC)},
+		{ID: 12, Type: InterestCredited, Account: 1001, Amount: 0.25, Counterparty: InterestExpenseAccount, At: time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	now := time.Date(2023, 11, 1, 8, 0, 0, 0, time.UTC)
+	ms, err := newMonthlyStatement(a, es, 118.75, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), now, key)
+	assert.NilError(t, err)
+	assert.Equal(t, "2023-10", ms.Month)
+	assert.Equal(t, 100.0, ms.Opening)
+	assert.Equal(t, 1.0, ms.Fees)
+	assert.Equal(t, 0.25, ms.Interest)
+	assert.Equal(t, 118.75, ms.Closing)
+	assert.Equal(t, 4, ms.Transactions)
+
+	golden, err := os.ReadFile("testdata/statement.html")
+	assert.NilError(t, err)
+	assert.Equal(t, string(golden), string(ms.Content))
+	assert.Equal(t, hashContent(golden), ms.ContentHash)
+	signature, err := base64.StdEncoding.DecodeString(ms.Signature)
+	assert.NilError(t, err)
+	assert.Assert(t, ed25519.Verify(key.Public().(ed25519.PublicKey), golden, signature))
+	assert.Assert(t, !ed25519.Verify(key.Public().(ed25519.PublicKey), bytes.Replace(golden, []byte("118.75"), []byte("1118.75"), 1), signature))
+}
+
+func TestMonthlyStatements(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	_, err = tnb.GenerateMonthlyStatements(time.Now())
+	assert.Assert(t, errors.Is(err, ErrNoSigningKey))
+	os.Setenv("STATEMENT_SIGNING_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	defer os.Unsetenv("STATEMENT_SIGNING_KEY")
+
+	_, err = tnb.Transfer(1001, 3003, 30)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	// the statements of this month are generated in the next month.
+	now := time.Now().UTC()
+	next := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	n, err := tnb.GenerateMonthlyStatements(next)
+	assert.NilError(t, err)
+	assert.Assert(t, n > 0)
+	n, err = tnb.GenerateMonthlyStatements(next)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, n)
+
+	mss, err := tnb.GetMonthlyStatements(1001)
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(mss))
+	assert.Equal(t, now.Format("2006-01"), mss[0].Month)
+	assert.Equal(t, 100.0, mss[0].Opening)
+	assert.Equal(t, 70.0, mss[0].Closing)
+	assert.Equal(t, 1, mss[0].Transactions)
+	assert.Assert(t, mss[0].Content == nil)
+
+	ms, err := tnb.GetMonthlyStatement(1001, mss[0].ID)
+	assert.NilError(t, err)
+	assert.Equal(t, hashContent(ms.Content), ms.ContentHash)
+	_, err = tnb.GetMonthlyStatement(3003, mss[0].ID)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	v, err := tnb.VerifyStatement(ms.Content)
+	assert.NilError(t, err)
+	assert.Assert(t, v.Valid)
+	assert.Equal(t, mss[0].ID, v.Statement.ID)
+
+	altered := bytes.Replace(ms.Content, []byte("70.00"), []byte("7000.00"), -1)
+	v, err = tnb.VerifyStatement(altered)
+	assert.NilError(t, err)
+	assert.Assert(t, !v.Valid)
+	assert.Assert(t, v.Statement == nil)
+
+	// the archive can not be changed.
+	_, err = tnb.db.Exec(`UPDATE monthly_statement SET content=$1, content_hash=$2 WHERE id=$3;`, altered, hashContent(altered), ms.ID)
+	assert.ErrorContains(t, err, "monthly statements are immutable")
+	_, err = tnb.db.Exec(`DELETE FROM monthly_statement WHERE id=$1;`, ms.ID)
+	assert.ErrorContains(t, err, "monthly statements are immutable")
+
+	// a statement signed by another key is not valid.
+	os.Setenv("STATEMENT_SIGNING_KEY", base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210")))
+	v, err = tnb.VerifyStatement(ms.Content)
+	assert.NilError(t, err)
+	assert.Assert(t, !v.Valid)
+	assert.Equal(t, "the signature of the statement does not match the key of the bank", v.Reason)
+}
+
+// nachaReturnFile returns the debit of the golden file for insufficient funds and the first credit for no account.
+func nachaReturnFile() *NACHAFile {
+	return &NACHAFile{
+		Destination:     "091000019",
+		Origin:          "011000015",
+		DestinationName: "NETBANK",
+		OriginName:      "FEDERAL RESERVE BANK",
+		CreatedAt:       time.Date(2023, 10, 31, 9, 30, 0, 0, time.UTC),
+		IDModifier:      "A",
+		Batches: []*NACHABatch{{
+			ServiceClass:     NACHAMixed,
+			CompanyName:      "NETBANK",
+			CompanyID:        "1000000001",
+			SEC:              "PPD",
+			EntryDescription: "RETURN",
+			EffectiveDate:    time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+			ODFI:             "01100001",
+			Number:           1,
+			Entries: []*NACHAEntry{
+				{TransactionCode: "36", RDFI: "091000019", Account: "SAV-0042", Amount: 120000, IndividualID: "1001", Name: "JOHN", Trace: "011000010000001",
+					Return: &NACHAReturn{Reason: "R01", OriginalTrace: "091000010000002", OriginalRDFI: "01100001"}},
+				{TransactionCode: "21", RDFI: "091000019", Account: "123456789", Amount: 3050, IndividualID: "1001", Name: "JANE ROE", Trace: "021000020000007",
+					Return: &NACHAReturn{Reason: "R03", OriginalTrace: "091000010000001", OriginalRDFI: "02100002", Information: "NO ACCOUNT"}},
+			},
+		}},
+	}
+}
+
+func TestNACHA(t *testing.T) {
+	es := []*ACHEntry{
+		{ID: 1, Account: 1001, Direction: ACHCredit, Beneficiary: &ACHBeneficiary{Routing: "021000021", AccountNumber: "123456789", AccountType: ACHChecking, Name: "JANE ROE"}, Amount: 30.5, Trace: "091000010000001"},
+		{ID: 2, Account: 1001, Direction: ACHDebit, Beneficiary: &ACHBeneficiary{Routing: "011000015", AccountNumber: "SAV-0042", AccountType: ACHSavings, Name: "JOHN"}, Amount: 1200, Trace: "091000010000002"},
+		{ID: 3, Account: 3003, Direction: ACHCredit, Beneficiary: &ACHBeneficiary{Routing: "122000247", AccountNumber: "987654321", AccountType: ACHSavings, Name: "RENEE CAFE"}, Amount: 0.99, Trace: "091000010000003"},
+	}
+	// the file of friday is effective on monday.
+	f := newNACHAFile(es, time.Date(2023, 10, 27, 15, 4, 0, 0, time.UTC), "A")
+	assert.Equal(t, 2, len(f.Batches))
+	assert.Equal(t, NACHACredits, f.Batches[0].ServiceClass)
+	assert.Equal(t, "37", f.Batches[1].Entries[0].TransactionCode)
+	assert.Equal(t, time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC), f.Batches[0].EffectiveDate)
+
+	for _, g := range []struct {
+		name string
+		file *NACHAFile
+	}{{"testdata/nacha.txt", f}, {"testdata/nacha_return.txt", nachaReturnFile()}} {
+		bs, err := EncodeNACHA(g.file)
+		assert.NilError(t, err)
+		golden, err := os.ReadFile(g.name)
+		assert.NilError(t, err)
+		assert.Equal(t, string(golden), string(bs), g.name)
+		lines := strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n")
+		assert.Equal(t, 0, len(lines)%10)
+		for _, l := range lines {
+			assert.Equal(t, 94, len(l), l)
+		}
+
+		parsed, err := ParseNACHA(bs)
+		assert.NilError(t, err)
+		assert.Equal(t, len(g.file.Batches), len(parsed.Batches))
+		assert.DeepEqual(t, g.file.Batches[0].Entries, parsed.Batches[0].Entries)
+	}
+
+	bs, err := os.ReadFile("testdata/nacha.txt")
+	assert.NilError(t, err)
+	// the control records must have the totals of the entries.
+	altered := strings.Replace(string(bs), "0000003050", "0000003060", 1)
+	_, err = ParseNACHA([]byte(altered))
+	assert.ErrorContains(t, err, "total credit of batch 1 control is 000000003149, but the entries make 3159")
+	_, err = ParseNACHA(bs[:len(bs)-95*5])
+	assert.Error(t, err, "file control record is missing")
+	_, err = ParseNACHA([]byte("1" + strings.Repeat(" ", 92) + "\n"))
+	assert.Error(t, err, "record 1 is 93 characters, not 94")
+
+	assert.NilError(t, checkRouting("091000019"))
+	assert.Error(t, checkRouting("091000018"), "check digit of routing number 091000018 is wrong")
+	b, err := CheckACHBeneficiary(&ACHBeneficiary{Routing: "021000021", AccountNumber: "123", Name: "Renée Café"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &ACHBeneficiary{Routing: "021000021", AccountNumber: "123", AccountType: ACHChecking, Name: "RENEE CAFE"}, b)
+	_, err = CheckACHBeneficiary(&ACHBeneficiary{Routing: "021000021", AccountNumber: "123", Name: "A NAME LONGER THAN 22 CHARACTERS"})
+	assert.Assert(t, errors.Is(err, ErrInvalidBeneficiary))
+}
+
+func TestACH(t *testing.T) {
+	err := InsertTestData()
+	if err != nil {
+		t.Errorf("failed to insert test data: %v", err)
+	}
+	defer DeleteTestData()
+
+	b := &ACHBeneficiary{Routing: "021000021", AccountNumber: "123456789", Name: "Jane Roe"}
+	credit, err := tnb.OriginateACH(1001, ACHCredit, b, 30)
+	if err != nil {
+		t.Fatalf("failed to originate a credit: %v", err)
+	}
+	assert.Equal(t, ACHPending, credit.Status)
+	assert.Equal(t, achTrace(credit.ID), credit.Trace)
+	// the money of a debit is advanced by the bank, so it counts against the limits.
+	limit := func(v float64) *float64 { return &v }
+	john := &ACHBeneficiary{Routing: "011000015", AccountNumber: "SAV-0042", AccountType: ACHSavings, Name: "John"}
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{PerTransaction: limit(45)})
+	assert.NilError(t, err)
+	_, err = tnb.OriginateACH(1001, ACHDebit, john, 50)
+	assert.Assert(t, errors.Is(err, ErrLimitExceeded))
+	_, err = tnb.SetLimitRule(LimitAccount, "1001", &LimitRule{PerTransaction: limit(100)})
+	assert.NilError(t, err)
+	debit, err := tnb.OriginateACH(1001, ACHDebit, john, 50)
+	if err != nil {
+		t.Fatalf("failed to originate a debit: %v", err)
+	}
+	another, err := tnb.OriginateACH(1001, ACHCredit, b, 5)
+	if err != nil {
+		t.Fatalf("failed to originate a credit: %v", err)
+	}
+	balance, _ := tnb.GetBalance(1001)
+	assert.Equal(t, float64(115), balance)
+	clearing, _ := tnb.GetBalance(ACHClearingAccount)
+	assert.Equal(t, float64(-15), clearing)
+
+	// the money of the debit is held until the return window passes.
+	h, err := tnb.GetHold(1001, debit.Hold)
+	assert.NilError(t, err)
+	assert.Equal(t, float64(50), h.Amount)
+	assert.Equal(t, "ACH "+debit.Trace, h.Reference)
+	assert.Equal(t, achHoldExpiry(debit.CreatedAt), h.ExpiresAt.UTC())
+	available, _ := tnb.GetAvailableBalance(1001)
+	assert.Equal(t, float64(65), available)
+
+	_, err = tnb.OriginateACH(1001, ACHCredit, b, 10.005)
+	assert.Error(t, err, "amount 10.005 must be cents between 0.01 and 99999999.99")
+	_, err = tnb.OriginateACH(1001, ACHCredit, &ACHBeneficiary{Routing: "021000022", AccountNumber: "1", Name: "A"}, 10)
+	assert.Assert(t, errors.Is(err, ErrInvalidBeneficiary))
+	_, err = tnb.db.Exec(`UPDATE account SET currency='JPY' WHERE id=3003;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tnb.OriginateACH(3003, ACHCredit, b, 10)
+	assert.Error(t, err, "account(ID: 3003) is in JPY. ACH is only for accounts in USD")
+	// the overdraft of the clearing account is never paid out to customers.
+	_, err = tnb.OriginateACH(ACHClearingAccount, ACHCredit, b, 10)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+	_, err = tnb.Transfer(ACHClearingAccount, 1001, 10)
+	assert.Assert(t, errors.Is(err, sql.ErrNoRows))
+
+	f, err := tnb.ExportNACHA(time.Now())
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	assert.Equal(t, 3, f.Entries)
+	parsed, err := ParseNACHA(f.Content)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(parsed.Batches))
+	saved, err := tnb.GetACHFile(f.ID)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, f.Content, saved.Content)
+	_, err = tnb.ExportNACHA(time.Now())
+	assert.Assert(t, errors.Is(err, ErrNoACHEntries))
+	sent, err := tnb.GetACHEntries(ACHSent)
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(sent))
+
+	// only the returns reverse the entries.
+	_, err = tnb.ReverseTransfer(credit.Transfer, 0, "")
+	assert.Error(t, err, fmt.Sprintf("transfer(ID: %v) is with another bank and is reversed only by its return", credit.Transfer))
+	_, err = tnb.ReverseTransfer(debit.Transfer, 0, "")
+	assert.Error(t, err, fmt.Sprintf("transfer(ID: %v) is with another bank and is reversed only by its return", debit.Transfer))
+
+	// the held money of the debit cannot be spent before it is returned.
+	_, err = tnb.db.Exec(`UPDATE account SET currency='USD' WHERE id=3003;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tnb.Transfer(1001, 3003, 110)
+	assert.Assert(t, errors.Is(err, ErrInsufficientFunds))
+	_, err = tnb.Transfer(1001, 3003, 60)
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	rf := nachaReturnFile()
+	es := rf.Batches[0].Entries
+	es[0].Amount, es[0].Return.OriginalTrace = 5000, debit.Trace
+	es[1].Amount, es[1].Return.OriginalTrace = 3000, credit.Trace
+	es = append(es,
+		&NACHAEntry{TransactionCode: "21", RDFI: "091000019", Account: "123456789", Amount: 500, Name: "JANE ROE", Trace: "021000020000008",
+			Return: &NACHAReturn{Reason: "R99", OriginalTrace: another.Trace, OriginalRDFI: "02100002"}},
+		&NACHAEntry{TransactionCode: "21", RDFI: "091000019", Account: "1", Amount: 100, Name: "UNKNOWN", Trace: "021000020000009",
+			Return: &NACHAReturn{Reason: "R02", OriginalTrace: "091000019999999", OriginalRDFI: "02100002"}})
+	rf.Batches[0].Entries = es
+	bs, err := EncodeNACHA(rf)
+	assert.NilError(t, err)
+
+	report, err := tnb.ProcessACHReturns(bs)
+	if err != nil {
+		t.Fatalf("failed to process returns: %v", err)
+	}
+	assert.Equal(t, 2, report.Reversed)
+	assert.Equal(t, 1, report.Flagged)
+	assert.Equal(t, 1, report.Unmatched)
+	assert.Equal(t, ACHActionReversed, report.Returns[0].Action)
+	assert.Equal(t, ACHActionReversed, report.Returns[1].Action)
+	assert.Equal(t, ReversalCompleted, report.Returns[1].Reversal.Status)
+	assert.Equal(t, ACHActionFlagged, report.Returns[2].Action)
+
+	// the hold of the returned debit is released, and its money goes back to the clearing account.
+	h, err = tnb.GetHold(1001, debit.Hold)
+	assert.NilError(t, err)
+	assert.Equal(t, HoldReleased, h.Status)
+	balance, _ = tnb.GetBalance(1001)
+	assert.Equal(t, float64(35), balance)
+	clearing, _ = tnb.GetBalance(ACHClearingAccount)
+	assert.Equal(t, float64(5), clearing)
+	returned, err := tnb.GetACHEntries(ACHReturned)
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(returned))
+	assert.Equal(t, "R03", returned[0].ReturnCode)
+	assert.Equal(t, report.Returns[1].Reversal.ID, returned[0].Reversal)
+	flagged, err := tnb.GetACHEntries(ACHFlagged)
+	assert.NilError(t, err)
+	assert.Equal(t, another.ID, flagged[0].ID)
+
+	// the same file twice reverses nothing.
+	report, err = tnb.ProcessACHReturns(bs)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, report.Reversed)
+	assert.Equal(t, 3, report.Ignored)
+
+	_, err = tnb.ProcessACHReturns([]byte("not a nacha file"))
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCredential is matched by errors.Is() when a request is made without the credential of the account.
+var ErrInvalidCredential = errors.New("invalid credential")
+
+// AccountCredential proves that a request is made by the holder of the account.
+// only the hash of Token is stored, so it is shown once when it is issued.
+type AccountCredential struct {
+	Account   int       `json:"account"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func hashCredential(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueAccountCredential issues the credential of the account holder by staff. it replaces the credential issued before,
+// so a leaked one is revoked by issuing a new one.
+func (nb *netBank) IssueAccountCredential(num int) (*AccountCredential, error) {
+	_, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &AccountCredential{Account: num, Token: token}
+	q := `
+	INSERT INTO account_credential (account_id, token_hash)
+	VALUES ($1, $2)
+	ON CONFLICT (account_id) DO UPDATE SET token_hash=EXCLUDED.token_hash, created_at=now()
+	RETURNING created_at;
+	`
+	err = nb.db.QueryRowContext(context.Background(), q, num, hashCredential(token)).Scan(&c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// CheckAccountCredential returns ErrInvalidCredential unless the token is the credential of the account.
+func (nb *netBank) CheckAccountCredential(num int, token string) error {
+	var account int
+	q := `SELECT account_id FROM account_credential WHERE token_hash=$1;`
+	err := nb.db.QueryRowContext(context.Background(), q, hashCredential(token)).Scan(&account)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && account != num) {
+		return fmt.Errorf("the token is not the credential of account(ID: %v): %w", num, ErrInvalidCredential)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
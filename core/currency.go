@@ -0,0 +1,55 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultCurrency is the currency of an account opened without one.
+const DefaultCurrency = "USD"
+
+var (
+	// ErrCurrencyMismatch is matched by errors.Is() when the currency of a trade is not the currency of the account.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrUnknownCurrency is matched by errors.Is() when a code is not one of the currencies accounts can hold.
+	ErrUnknownCurrency = errors.New("unknown currency")
+)
+
+// currencies are the ISO 4217 codes which accounts can hold, with the digits of their minor unit.
+var currencies = map[string]int{
+	"AUD": 2, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "ISK": 0, "JPY": 0,
+	"KRW": 0, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "PHP": 2, "PLN": 2, "SEK": 2,
+	"SGD": 2, "THB": 2, "TRY": 2, "TWD": 2, "USD": 2, "VND": 0, "ZAR": 2,
+}
+
+func checkCurrency(code string) error {
+	if _, ok := currencies[code]; !ok {
+		return fmt.Errorf("got %v as currency. use an ISO 4217 code such as %v: %w", code, DefaultCurrency, ErrUnknownCurrency)
+	}
+	return nil
+}
+
+// roundAmount rounds the amount to the minor unit of the currency, e.g. cents of USD and yen of JPY.
+func roundAmount(amount float64, currency string) float64 {
+	unit := math.Pow10(currencies[currency])
+	return math.Round(amount*unit) / unit
+}
+
+// CheckTrade checks that the trade is in the currency of the account and the amount fits its minor unit.
+// an empty currency of the trade is the currency of the account.
+func (nb *netBank) CheckTrade(num int, t *Trade) error {
+	currency, err := accountCurrency(nb.db, num)
+	if err != nil {
+		return err
+	}
+
+	if t.Currency != "" && t.Currency != currency {
+		return fmt.Errorf("currency of trade is %v, but account(ID: %v) is in %v: %w", t.Currency, num, currency, ErrCurrencyMismatch)
+	}
+	if roundAmount(t.Amount, currency) != t.Amount {
+		return fmt.Errorf("amount %v has more decimals than %v allows", t.Amount, currency)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	BalanceChanged   = "balance-changed"
+	ProfileUpdated   = "profile-updated"
+	AccountClosed    = "account-closed"
+	FeePosted        = "fee-posted"
+	InterestCredited = "interest-credited"
+	LoanRepayment    = "loan-repayment"
+)
+
+// Event is a change on an account. every event is recorded in the journal table,
+// so ID increases monotonically and can be used to resume a stream.
+type Event struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	Account      int       `json:"account"`
+	Amount       float64   `json:"amount"`
+	Balance      float64   `json:"balance"`
+	Counterparty int       `json:"counterparty,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// record inserts an event into the journal in the transaction.
+// the balance is read from the account table, so call it after updating the balance.
+func (nb *netBank) record(tx *sql.Tx, class string, num int, amount float64, counterparty int) (*Event, error) {
+	q := `
+	INSERT INTO journal (account_id, event, amount, balance, counterparty)
+	SELECT id, $2, $3, balance, $4
+	FROM account
+	WHERE id=$1
+	RETURNING id, balance, created_at;
+	`
+	e := &Event{
+		Type:         class,
+		Account:      num,
+		Amount:       amount,
+		Counterparty: counterparty,
+	}
+	row := tx.QueryRowContext(context.Background(), q, num, class, amount, counterparty)
+	err := row.Scan(&e.ID, &e.Balance, &e.At)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// EventsSince returns events of the account recorded after the event having id as ID.
+func (nb *netBank) EventsSince(num int, id int64) ([]*Event, error) {
+	q := `
+	SELECT id, event, account_id, amount, balance, counterparty, created_at
+	FROM journal
+	WHERE account_id=$1 AND id>$2
+	ORDER BY id;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, num, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	es := []*Event{}
+	for rows.Next() {
+		e := &Event{}
+		err := rows.Scan(&e.ID, &e.Type, &e.Account, &e.Amount, &e.Balance, &e.Counterparty, &e.At)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, rows.Err()
+}
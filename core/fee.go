@@ -0,0 +1,343 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	FeeFlat       = "flat"
+	FeePercentage = "percentage"
+	FeeTiered     = "tiered"
+
+	FeeWithdraw = "withdraw"
+	FeeTransfer = "transfer"
+
+	FeeCharged = "FeeCharged"
+
+	// internal accounts of the bank have negative ids, and are not shown in GetAccounts().
+	// this is the one in USD, and the fees in the other currencies are booked by internalAccount().
+	FeeIncomeAccount = -1
+)
+
+// FeeSchedule is the fee of an operation on the accounts of a product in a currency.
+// Flat is used by FeeFlat, Rate by FeePercentage (e.g. 0.01 for 1%) and Tiers by FeeTiered.
+// the amounts are in Currency, which is DefaultCurrency when empty, and an account in another currency is not charged.
+// the first FreePerMonth operations of every month are free.
+type FeeSchedule struct {
+	Product      string     `json:"product"`
+	Operation    string     `json:"operation"`
+	Currency     string     `json:"currency"`
+	Kind         string     `json:"kind"`
+	Flat         float64    `json:"flat,omitempty"`
+	Rate         float64    `json:"rate,omitempty"`
+	Tiers        []*FeeTier `json:"tiers,omitempty"`
+	FreePerMonth int        `json:"free_per_month,omitempty"`
+}
+
+// FeeTier is the fee of amounts up to UpTo. zero UpTo is the last tier without upper bound.
+type FeeTier struct {
+	UpTo float64 `json:"up_to"`
+	Fee  float64 `json:"fee"`
+}
+
+// FeeQuote is the fee which an operation would be charged.
+type FeeQuote struct {
+	Account   int     `json:"account"`
+	Operation string  `json:"operation"`
+	Amount    float64 `json:"amount"`
+	Fee       float64 `json:"fee"`
+	// FreeRemaining is the number of free operations left in this month.
+	FreeRemaining int `json:"free_remaining"`
+
+	scheduled bool
+}
+
+// FeeCharge is the payload of FeeCharged.
+type FeeCharge struct {
+	Account   int     `json:"account"`
+	Operation string  `json:"operation"`
+	Amount    float64 `json:"amount"`
+	Fee       float64 `json:"fee"`
+	Balance   float64 `json:"balance"`
+}
+
+func (s *FeeSchedule) validate() error {
+	if s.Operation != FeeWithdraw && s.Operation != FeeTransfer {
+		return fmt.Errorf("operation of fee must be %v or %v. your input is %v", FeeWithdraw, FeeTransfer, s.Operation)
+	}
+	if s.FreePerMonth < 0 {
+		return fmt.Errorf("free operations per month is less than zero. your input is %v", s.FreePerMonth)
+	}
+	if s.Currency == "" {
+		s.Currency = DefaultCurrency
+	}
+	err := checkCurrency(s.Currency)
+	if err != nil {
+		return err
+	}
+	fees := []float64{s.Flat}
+	for _, t := range s.Tiers {
+		fees = append(fees, t.Fee)
+	}
+	for _, fee := range fees {
+		if roundAmount(fee, s.Currency) != fee {
+			return fmt.Errorf("fee %v has more decimals than %v allows", fee, s.Currency)
+		}
+	}
+
+	switch s.Kind {
+	case FeeFlat:
+		if s.Flat < 0 {
+			return fmt.Errorf("flat fee is less than zero. your input is %v", s.Flat)
+		}
+	case FeePercentage:
+		if s.Rate < 0 || s.Rate > 1 {
+			return fmt.Errorf("rate of fee must be between 0 and 1. your input is %v", s.Rate)
+		}
+	case FeeTiered:
+		if len(s.Tiers) == 0 {
+			return fmt.Errorf("tiered fee has no tier")
+		}
+		for i, t := range s.Tiers {
+			if t.Fee < 0 {
+				return fmt.Errorf("fee of tier is less than zero. your input is %v", t.Fee)
+			}
+			if t.UpTo == 0 && i != len(s.Tiers)-1 {
+				return fmt.Errorf("only the last tier can be without upper bound")
+			}
+			if i > 0 && t.UpTo != 0 && t.UpTo <= s.Tiers[i-1].UpTo {
+				return fmt.Errorf("tiers must be in ascending order of up_to")
+			}
+		}
+	default:
+		return fmt.Errorf("kind of fee must be %v, %v or %v. your input is %v", FeeFlat, FeePercentage, FeeTiered, s.Kind)
+	}
+	return nil
+}
+
+// fee returns the fee of amount by the schedule, rounded to the minor unit of the currency.
+func (s *FeeSchedule) fee(amount float64) float64 {
+	var fee float64
+	switch s.Kind {
+	case FeeFlat:
+		fee = s.Flat
+	case FeePercentage:
+		fee = amount * s.Rate
+	case FeeTiered:
+		// an amount above every tier pays the last one.
+		fee = s.Tiers[len(s.Tiers)-1].Fee
+		for _, t := range s.Tiers {
+			if t.UpTo == 0 || amount <= t.UpTo {
+				fee = t.Fee
+				break
+			}
+		}
+	}
+	return roundAmount(fee, s.Currency)
+}
+
+// quoteFee returns the fee of the operation on the account.
+// an account whose product has no schedule in the currency of the account is not charged.
+func quoteFee(q querier, num int, operation string, amount float64) (*FeeQuote, error) {
+	u, err := loadFeeUsage(q, num, operation)
+	if err != nil {
+		return nil, err
+	}
+	return u.quote(num, operation, amount), nil
+}
+
+// feeUsage is the schedule of the operation on an account and how many times it is used this month,
+// which lets a batch quote its lines without reading them again. schedule is nil when the account is not charged.
+type feeUsage struct {
+	schedule *FeeSchedule
+	used     int
+}
+
+func loadFeeUsage(q querier, num int, operation string) (*feeUsage, error) {
+	query := `
+	SELECT f.product, f.currency, f.kind, f.flat, f.rate, f.tiers, f.free_per_month
+	FROM fee_schedule f
+	JOIN account a ON a.product=f.product AND a.currency=f.currency
+	WHERE a.id=$1 AND f.operation=$2;
+	`
+	s := &FeeSchedule{Operation: operation}
+	var tiers []byte
+	err := q.QueryRowContext(context.Background(), query, num, operation).Scan(&s.Product, &s.Currency, &s.Kind, &s.Flat, &s.Rate, &tiers, &s.FreePerMonth)
+	if err == sql.ErrNoRows {
+		return &feeUsage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(tiers, &s.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &feeUsage{schedule: s}
+	query = `
+	SELECT COUNT(*)
+	FROM fee_charge
+	WHERE account_id=$1 AND operation=$2 AND created_at>=date_trunc('month', now());
+	`
+	err = q.QueryRowContext(context.Background(), query, num, operation).Scan(&u.used)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *feeUsage) quote(num int, operation string, amount float64) *FeeQuote {
+	quote := &FeeQuote{Account: num, Operation: operation, Amount: amount}
+	if u.schedule == nil {
+		return quote
+	}
+	quote.scheduled = true
+	if u.used < u.schedule.FreePerMonth {
+		quote.FreeRemaining = u.schedule.FreePerMonth - u.used
+		return quote
+	}
+	quote.Fee = u.schedule.fee(amount)
+	return quote
+}
+
+// use counts a quote after it is charged.
+func (u *feeUsage) use() {
+	if u.schedule != nil {
+		u.used++
+	}
+}
+
+// chargeFee posts the quoted fee from the account to FeeIncomeAccount of its currency in the transaction,
+// and returns the events to publish after commit. the operation is counted against the free quota even when it is free.
+func (nb *netBank) chargeFee(tx *sql.Tx, quote *FeeQuote) ([]*Event, error) {
+	if !quote.scheduled {
+		return nil, nil
+	}
+
+	q := `INSERT INTO fee_charge (account_id, operation, amount, fee) VALUES ($1, $2, $3, $4);`
+	_, err := tx.ExecContext(context.Background(), q, quote.Account, quote.Operation, quote.Amount, quote.Fee)
+	if err != nil {
+		return nil, err
+	}
+	if quote.Fee == 0 {
+		return nil, nil
+	}
+
+	currency, err := accountCurrency(tx, quote.Account)
+	if err != nil {
+		return nil, err
+	}
+	income, err := internalAccount(tx, FeeIncomeAccount, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	q = `UPDATE account SET balance=balance+$1 WHERE id=$2;`
+	_, err = tx.ExecContext(context.Background(), q, -quote.Fee, quote.Account)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(context.Background(), q, quote.Fee, income)
+	if err != nil {
+		return nil, err
+	}
+
+	paid, err := nb.record(tx, FeePosted, quote.Account, -quote.Fee, income)
+	if err != nil {
+		return nil, err
+	}
+	earned, err := nb.record(tx, FeePosted, income, quote.Fee, quote.Account)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &FeeCharge{Account: quote.Account, Operation: quote.Operation, Amount: quote.Amount, Fee: quote.Fee, Balance: paid.Balance}
+	err = nb.enqueue(tx, FeeCharged, quote.Account, c)
+	if err != nil {
+		return nil, err
+	}
+	return []*Event{paid, earned}, nil
+}
+
+// QuoteFee previews the fee of the operation without charging it.
+func (nb *netBank) QuoteFee(num int, operation string, amount float64) (*FeeQuote, error) {
+	if operation != FeeWithdraw && operation != FeeTransfer {
+		return nil, fmt.Errorf("operation of fee must be %v or %v. your input is %v", FeeWithdraw, FeeTransfer, operation)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount is less than zero. your input is %v", amount)
+	}
+	_, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	return quoteFee(nb.db, num, operation, amount)
+}
+
+// SetFeeSchedule sets the fee of the operation on the product by staff.
+func (nb *netBank) SetFeeSchedule(s *FeeSchedule) (*FeeSchedule, error) {
+	err := s.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = nb.GetProduct(s.Product)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("product(%v) is not found: %w", s.Product, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	tiers, err := json.Marshal(s.Tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	INSERT INTO fee_schedule (product, operation, currency, kind, flat, rate, tiers, free_per_month)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (product, operation, currency) DO UPDATE
+	SET kind=EXCLUDED.kind, flat=EXCLUDED.flat, rate=EXCLUDED.rate,
+		tiers=EXCLUDED.tiers, free_per_month=EXCLUDED.free_per_month;
+	`
+	_, err = nb.db.ExecContext(context.Background(), q, s.Product, s.Operation, s.Currency, s.Kind, s.Flat, s.Rate, string(tiers), s.FreePerMonth)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetFeeSchedules returns the fees of the product in every currency.
+func (nb *netBank) GetFeeSchedules(product string) ([]*FeeSchedule, error) {
+	q := `
+	SELECT product, operation, currency, kind, flat, rate, tiers, free_per_month
+	FROM fee_schedule
+	WHERE product=$1
+	ORDER BY operation, currency;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, product)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ss := []*FeeSchedule{}
+	for rows.Next() {
+		s := &FeeSchedule{}
+		var tiers []byte
+		err := rows.Scan(&s.Product, &s.Operation, &s.Currency, &s.Kind, &s.Flat, &s.Rate, &tiers, &s.FreePerMonth)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(tiers, &s.Tiers)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, rows.Err()
+}
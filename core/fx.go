@@ -0,0 +1,206 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hiroyuki-takayama-RAIX/core/rates"
+)
+
+const (
+	// the part of the mid rate kept by the bank on a conversion unless FX_SPREAD is set.
+	defaultFXSpread = 0.01
+	// how long a quote can be redeemed unless FX_QUOTE_TTL is set in seconds.
+	defaultFXQuoteTTL = 30 * time.Second
+)
+
+var (
+	// ErrQuoteExpired is matched by errors.Is() when a quote is redeemed after it expired.
+	ErrQuoteExpired = errors.New("quote expired")
+	// ErrQuoteRedeemed is matched by errors.Is() when a quote is redeemed twice.
+	ErrQuoteRedeemed = errors.New("quote already redeemed")
+)
+
+// FXRate is a mid rate effective from EffectiveAt. one Base is Rate of Quote.
+type FXRate = rates.Rate
+
+// FXQuote fixes the rate of a conversion for a while. it is redeemed once by a transfer with its ID.
+// Amount and Converted are set when the quote is for an amount, and then the transfer must be of the amount.
+type FXQuote struct {
+	ID         string     `json:"id"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Rate       float64    `json:"rate"`
+	Mid        float64    `json:"mid"`
+	Amount     float64    `json:"amount,omitempty"`
+	Converted  float64    `json:"converted,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	Transfer   int64      `json:"transfer,omitempty"`
+}
+
+// rates returns the provider of the exchange rates. the file of FX_RATES_FILE is used when it is set,
+// and the rates set by staff otherwise.
+func (nb *netBank) rates() rates.Provider {
+	if path := os.Getenv("FX_RATES_FILE"); path != "" {
+		return &rates.File{Path: path}
+	}
+	return &rates.Table{DB: nb.db}
+}
+
+func fxSpread() float64 {
+	spread, err := strconv.ParseFloat(os.Getenv("FX_SPREAD"), 64)
+	if err != nil || spread < 0 || spread >= 1 {
+		return defaultFXSpread
+	}
+	return spread
+}
+
+func fxQuoteTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("FX_QUOTE_TTL"))
+	if err != nil || seconds <= 0 {
+		return defaultFXQuoteTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// rate returns the mid rate of now and the rate applied to it after the spread.
+func (nb *netBank) rate(from string, to string) (float64, float64, error) {
+	mid, err := nb.rates().Rate(from, to, time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	return mid.Rate, mid.Rate * (1 - fxSpread()), nil
+}
+
+// convert returns the amount in to, and the rate applied to it after the spread.
+func (nb *netBank) convert(amount float64, from string, to string) (float64, float64, error) {
+	_, rate, err := nb.rate(from, to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return roundAmount(amount*rate, to), rate, nil
+}
+
+// SetFXRate adds the mid rate of the pair to the history by staff. zero EffectiveAt is now.
+func (nb *netBank) SetFXRate(r *FXRate) (*FXRate, error) {
+	for _, c := range []string{r.Base, r.Quote} {
+		err := checkCurrency(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return (&rates.Table{DB: nb.db}).Set(r)
+}
+
+// GetFXRates returns the rates set by staff which are effective now.
+func (nb *netBank) GetFXRates() ([]*FXRate, error) {
+	return (&rates.Table{DB: nb.db}).Current(time.Now())
+}
+
+// GetFXRateHistory returns the rates of the pair set by staff from the newest.
+func (nb *netBank) GetFXRateHistory(base string, quote string) ([]*FXRate, error) {
+	return (&rates.Table{DB: nb.db}).History(base, quote)
+}
+
+const fxQuoteColumns = `id, base, quote, rate, mid, COALESCE(amount, 0), COALESCE(converted, 0), expires_at, redeemed_at, COALESCE(transfer_id, 0)`
+
+func scanFXQuote(row interface{ Scan(...any) error }) (*FXQuote, error) {
+	fq := &FXQuote{}
+	var redeemedAt sql.NullTime
+	err := row.Scan(&fq.ID, &fq.From, &fq.To, &fq.Rate, &fq.Mid, &fq.Amount, &fq.Converted, &fq.ExpiresAt, &redeemedAt, &fq.Transfer)
+	if err != nil {
+		return nil, err
+	}
+	if redeemedAt.Valid {
+		fq.RedeemedAt = &redeemedAt.Time
+	}
+	return fq, nil
+}
+
+// newRandomID returns 32 hex characters, which fit the identifiers of quotes and ISO 20022 messages.
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// QuoteFX fixes the rate from one currency to another until the quote expires. zero amount quotes only the rate.
+func (nb *netBank) QuoteFX(from string, to string, amount float64) (*FXQuote, error) {
+	for _, c := range []string{from, to} {
+		err := checkCurrency(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if from == to {
+		return nil, fmt.Errorf("currencies of quote are the same %v", from)
+	}
+	if amount < 0 {
+		return nil, fmt.Errorf("amount is less than zero. your input is %v", amount)
+	}
+	if roundAmount(amount, from) != amount {
+		return nil, fmt.Errorf("amount %v has more decimals than %v allows", amount, from)
+	}
+
+	mid, rate, err := nb.rate(from, to)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	var converted any
+	var quoted any
+	if amount > 0 {
+		quoted, converted = amount, roundAmount(amount*rate, to)
+	}
+
+	q := `
+	INSERT INTO fx_quote (id, base, quote, rate, mid, amount, converted, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING ` + fxQuoteColumns + `;`
+	return scanFXQuote(nb.db.QueryRowContext(context.Background(), q, id, from, to, rate, mid, quoted, converted, time.Now().Add(fxQuoteTTL())))
+}
+
+// redeemQuote locks the quote for the conversion of the amount and marks it redeemed.
+func redeemQuote(tx *sql.Tx, id string, from string, to string, amount float64) (*FXQuote, error) {
+	q := `SELECT ` + fxQuoteColumns + ` FROM fx_quote WHERE id=$1 FOR UPDATE;`
+	fq, err := scanFXQuote(tx.QueryRowContext(context.Background(), q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("quote(ID: %v) is not found: %w", id, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if fq.RedeemedAt != nil {
+		return nil, fmt.Errorf("quote(ID: %v) was redeemed by transfer(ID: %v): %w", id, fq.Transfer, ErrQuoteRedeemed)
+	}
+	if !time.Now().Before(fq.ExpiresAt) {
+		return nil, fmt.Errorf("quote(ID: %v) expired at %v: %w", id, fq.ExpiresAt.Format(time.RFC3339), ErrQuoteExpired)
+	}
+	if fq.From != from || fq.To != to {
+		return nil, fmt.Errorf("quote(ID: %v) is from %v to %v, but transfer is from %v to %v", id, fq.From, fq.To, from, to)
+	}
+	if fq.Amount != 0 && fq.Amount != amount {
+		return nil, fmt.Errorf("quote(ID: %v) is for %v, but transfer is of %v", id, fq.Amount, amount)
+	}
+
+	q = `UPDATE fx_quote SET redeemed_at=now() WHERE id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, id)
+	if err != nil {
+		return nil, err
+	}
+	return fq, nil
+}
@@ -0,0 +1,381 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+	HoldExpired  = "expired"
+
+	// a hold expires after this when the expiry is not given.
+	defaultHoldExpiry = 7 * 24 * time.Hour
+)
+
+// ErrHoldNotActive is matched by errors.Is() when a hold is already captured, released or expired.
+var ErrHoldNotActive = errors.New("hold is not active")
+
+// Hold reserves the amount of the balance until it is captured, released or expired.
+// the reserved amount cannot be withdrawn nor transferred.
+type Hold struct {
+	ID        int64     `json:"id"`
+	Account   int       `json:"account"`
+	Amount    float64   `json:"amount"`
+	Captured  float64   `json:"captured"`
+	Status    string    `json:"status"`
+	Reference string    `json:"reference,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// an active hold past its expiry is shown as expired even before ExpireHolds() marks it.
+const holdColumns = `id, account_id, amount, captured,
+	CASE WHEN status='active' AND expires_at<=now() THEN 'expired' ELSE status END,
+	reference, expires_at, created_at`
+
+func scanHold(row interface{ Scan(...any) error }) (*Hold, error) {
+	h := &Hold{}
+	err := row.Scan(&h.ID, &h.Account, &h.Amount, &h.Captured, &h.Status, &h.Reference, &h.ExpiresAt, &h.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// heldAmount returns the sum of the active holds of the account.
+func heldAmount(tx *sql.Tx, num int) (float64, error) {
+	q := `
+	SELECT COALESCE(SUM(amount), 0)
+	FROM hold
+	WHERE account_id=$1 AND status=$2 AND expires_at>now();
+	`
+	var held float64
+	row := tx.QueryRowContext(context.Background(), q, num, HoldActive)
+	err := row.Scan(&held)
+	if err != nil {
+		return 0, err
+	}
+	return held, nil
+}
+
+// checkFunds returns an error matching ErrInsufficientFunds when money is more than the available balance.
+// the available balance includes the overdraft limit. whose is the owner of the amount in the message.
+func checkFunds(tx *sql.Tx, num int, balance float64, money float64, whose string) error {
+	held, err := heldAmount(tx, num)
+	if err != nil {
+		return err
+	}
+	limit, err := overdraftLimit(tx, num)
+	if err != nil {
+		return err
+	}
+	return fundsError(balance, held, limit, money, whose)
+}
+
+// fundsError is checkFunds() with the held amount and the overdraft limit read beforehand.
+func fundsError(balance float64, held float64, limit float64, money float64, whose string) error {
+	available := balance - held + limit
+	if available-money >= 0 {
+		return nil
+	}
+	if held == 0 && limit == 0 {
+		return insufficientFunds("amount is grater than the balance. %v amount is %v, but the balance is %v", whose, money, balance)
+	}
+	return insufficientFunds("amount is grater than the available balance. %v amount is %v, but the available balance is %v", whose, money, available)
+}
+
+// GetAvailableBalance returns the balance without the active holds, plus the overdraft limit.
+func (nb *netBank) GetAvailableBalance(num int) (float64, error) {
+	q := `
+	SELECT balance - COALESCE((
+		SELECT SUM(amount)
+		FROM hold
+		WHERE account_id=$1 AND status=$2 AND expires_at>now()
+	), 0) + COALESCE((
+		SELECT limit_amount
+		FROM overdraft
+		WHERE account_id=$1
+	), 0)
+	FROM account
+	WHERE id=$1;
+	`
+	var available float64
+	row := nb.db.QueryRowContext(context.Background(), q, num, HoldActive)
+	err := row.Scan(&available)
+	if err != nil {
+		return 0, err
+	}
+	return available, nil
+}
+
+// PlaceHold reserves the amount of the available balance until expiresAt.
+// a zero expiresAt means a week later.
+func (nb *netBank) PlaceHold(num int, amount float64, expiresAt time.Time, reference string) (*Hold, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount of hold is less than zero. your input is %v", amount)
+	}
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(defaultHoldExpiry)
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("hold is already expired at %v", expiresAt.Format(time.RFC3339))
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h, err := placeHold(tx, num, amount, expiresAt, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// placeHold reserves the amount of the available balance in the transaction.
+func placeHold(tx *sql.Tx, num int, amount float64, expiresAt time.Time, reference string) (*Hold, error) {
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := balances[num]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	err = checkFunds(tx, num, balance, amount, "your")
+	if err != nil {
+		return nil, err
+	}
+	return insertHold(tx, num, amount, expiresAt, reference)
+}
+
+// insertHold reserves the amount without checking the available balance, e.g. money credited in the same transaction.
+// the account must be locked.
+func insertHold(tx *sql.Tx, num int, amount float64, expiresAt time.Time, reference string) (*Hold, error) {
+	q := `
+	INSERT INTO hold (account_id, amount, reference, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + holdColumns + `;`
+	return scanHold(tx.QueryRowContext(context.Background(), q, num, amount, reference, expiresAt))
+}
+
+func (nb *netBank) GetHold(num int, id int64) (*Hold, error) {
+	q := `SELECT ` + holdColumns + ` FROM hold WHERE id=$1 AND account_id=$2;`
+	return scanHold(nb.db.QueryRowContext(context.Background(), q, id, num))
+}
+
+func (nb *netBank) GetHolds(num int) ([]*Hold, error) {
+	q := `SELECT ` + holdColumns + ` FROM hold WHERE account_id=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hs := []*Hold{}
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		hs = append(hs, h)
+	}
+	return hs, rows.Err()
+}
+
+// lockHold locks an active hold of the account in the transaction.
+func lockHold(tx *sql.Tx, num int, id int64) (*Hold, error) {
+	q := `SELECT ` + holdColumns + ` FROM hold WHERE id=$1 AND account_id=$2 FOR UPDATE;`
+	h, err := scanHold(tx.QueryRowContext(context.Background(), q, id, num))
+	if err != nil {
+		return nil, err
+	}
+	if h.Status != HoldActive {
+		return nil, fmt.Errorf("hold(ID: %v) is already %v: %w", id, h.Status, ErrHoldNotActive)
+	}
+	return h, nil
+}
+
+// CaptureHold withdraws the amount of the hold from the balance and releases the rest.
+// zero amount captures the whole hold. the capture is a withdrawal, so it uses the limits and is charged its fee.
+func (nb *netBank) CaptureHold(num int, id int64, amount float64) (*Hold, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h, es, err := nb.captureHold(tx, num, id, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return h, nil
+}
+
+// captureHold is CaptureHold() in the transaction, and returns the events to publish after commit.
+func (nb *netBank) captureHold(tx *sql.Tx, num int, id int64, amount float64) (*Hold, []*Event, error) {
+	// lock the account before the hold in the same order as PlaceHold().
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, nil, err
+	}
+	h, err := lockHold(tx, num, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if amount == 0 {
+		amount = h.Amount
+	}
+	if amount < 0 || amount > h.Amount {
+		return nil, nil, fmt.Errorf("amount of capture must be between 0 and %v. your input is %v", h.Amount, amount)
+	}
+
+	err = useLimits(tx, num, 0, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the fee is not reserved by the hold, so it is paid from the balance available after the capture.
+	fee, err := quoteFee(tx, num, FeeWithdraw, amount)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkFunds(tx, num, balances[num]-amount+h.Amount, fee.Fee, "fee")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the captured amount was reserved, so it is withdrawn without checking the available balance.
+	q := `
+	UPDATE account
+	SET balance=balance-$1
+	WHERE id=$2;
+	`
+	_, err = tx.ExecContext(context.Background(), q, amount, num)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e, err := nb.record(tx, BalanceChanged, num, -amount, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = nb.enqueue(tx, FundsWithdrawn, num, &Funds{Account: num, Amount: amount, Balance: e.Balance})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q = `
+	UPDATE hold
+	SET status=$2, captured=$3, updated_at=now()
+	WHERE id=$1
+	RETURNING ` + holdColumns + `;`
+	h, err = scanHold(tx.QueryRowContext(context.Background(), q, id, HoldCaptured, amount))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	es, err := nb.chargeFee(tx, fee)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, append([]*Event{e}, es...), nil
+}
+
+// ReleaseHold makes the amount of the hold available again.
+func (nb *netBank) ReleaseHold(num int, id int64) (*Hold, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h, err := releaseHold(tx, num, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func releaseHold(tx *sql.Tx, num int, id int64) (*Hold, error) {
+	_, err := lockHold(tx, num, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	UPDATE hold
+	SET status=$2, updated_at=now()
+	WHERE id=$1
+	RETURNING ` + holdColumns + `;`
+	return scanHold(tx.QueryRowContext(context.Background(), q, id, HoldReleased))
+}
+
+// ExpireHolds marks the active holds past their expiry at now as expired.
+// expired holds are already excluded from the available balance, so this only tidies their status.
+func (nb *netBank) ExpireHolds(now time.Time) (int64, error) {
+	q := `
+	UPDATE hold
+	SET status=$1, updated_at=now()
+	WHERE status=$2 AND expires_at<=$3;
+	`
+	res, err := nb.db.ExecContext(context.Background(), q, HoldExpired, HoldActive, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunHoldExpiry expires holds every interval until ctx is done.
+func RunHoldExpiry(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the hold expiry: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.ExpireHolds(time.Now())
+		if err != nil {
+			log.Printf("failed to expire holds: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
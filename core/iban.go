@@ -0,0 +1,155 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ibanCountry is the country code of the identifiers. the bank is not in the IBAN registry, so they are only IBAN-style.
+	ibanCountry = "JP"
+	// the bank code in the identifiers unless BANK_CODE is set.
+	defaultBankCode = "NETB"
+	// the digits of the account number in the identifiers. GetNewId() returns up to 2147483647.
+	ibanAccountDigits = 10
+)
+
+// ErrInvalidIBAN is matched by errors.Is() when an account identifier is malformed or its check digits are wrong.
+var ErrInvalidIBAN = errors.New("invalid account identifier")
+
+func bankCode() string {
+	code := strings.ToUpper(os.Getenv("BANK_CODE"))
+	if len(code) != 4 {
+		return defaultBankCode
+	}
+	for _, r := range code {
+		if !isUpperAlnum(r) {
+			return defaultBankCode
+		}
+	}
+	return code
+}
+
+func isUpperAlnum(r rune) bool {
+	return ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
+
+// mod97 returns the remainder of the number which the letters of s are replaced with 10 to 35 by ISO 7064 MOD 97-10.
+// s must consist of upper letters and digits.
+func mod97(s string) int {
+	remainder := 0
+	for _, r := range s {
+		if r >= 'A' {
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		} else {
+			remainder = (remainder*10 + int(r-'0')) % 97
+		}
+	}
+	return remainder
+}
+
+// IBAN returns the public identifier of the account, which is the country code, the check digits,
+// the bank code and the account number, e.g. JP72NETB0000001001. internal accounts of the bank have none.
+func IBAN(num int) string {
+	if num < 0 {
+		return ""
+	}
+	bban := fmt.Sprintf("%v%0*d", bankCode(), ibanAccountDigits, num)
+	check := 98 - mod97(bban+ibanCountry+"00")
+	return fmt.Sprintf("%v%02d%v", ibanCountry, check, bban)
+}
+
+// ParseIBAN returns the account number in the identifier. spaces are ignored and letters are case-insensitive.
+// it only checks the identifier, so the account may not exist.
+func ParseIBAN(s string) (int, error) {
+	iban := strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	bank := bankCode()
+	if len(iban) != len(ibanCountry)+2+len(bank)+ibanAccountDigits {
+		return 0, fmt.Errorf("%v has %v characters. it must be like %v: %w", s, len(iban), IBAN(1001), ErrInvalidIBAN)
+	}
+	for _, r := range iban {
+		if !isUpperAlnum(r) {
+			return 0, fmt.Errorf("%v has %q. it must be like %v: %w", s, r, IBAN(1001), ErrInvalidIBAN)
+		}
+	}
+	if !strings.HasPrefix(iban, ibanCountry) {
+		return 0, fmt.Errorf("country of %v is not %v: %w", s, ibanCountry, ErrInvalidIBAN)
+	}
+	// the check digits are moved to the end with the country code, and the whole is 1 by mod 97.
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return 0, fmt.Errorf("check digits of %v are wrong: %w", s, ErrInvalidIBAN)
+	}
+	if iban[4:8] != bank {
+		return 0, fmt.Errorf("%v is an account of bank %v, not %v: %w", s, iban[4:8], bank, ErrInvalidIBAN)
+	}
+
+	num, err := strconv.Atoi(iban[8:])
+	if err != nil {
+		return 0, fmt.Errorf("account number of %v is not digits: %w", s, ErrInvalidIBAN)
+	}
+	// the id of the account is INT in the db, so a larger number can not be an account.
+	if num > math.MaxInt32 {
+		return 0, fmt.Errorf("account number of %v is more than %v: %w", s, math.MaxInt32, ErrInvalidIBAN)
+	}
+	return num, nil
+}
+
+// ParseAccountID returns the account number of either the internal id or the identifier by IBAN().
+// the internal accounts of the bank, which have ids below 1, are rejected.
+func ParseAccountID(s string) (int, error) {
+	num, err := strconv.Atoi(s)
+	if err != nil {
+		// anything starting with a country code is taken as an identifier, so that a mistyped one is told so.
+		if len(s) < 2 || !isLetter(s[0]) || !isLetter(s[1]) {
+			return 0, fmt.Errorf("got %v as invalied id", s)
+		}
+		num, err = ParseIBAN(s)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if num <= 0 || num > math.MaxInt32 {
+		return 0, fmt.Errorf("got %v as invalied id", s)
+	}
+	return num, nil
+}
+
+func isLetter(b byte) bool {
+	return ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z')
+}
+
+// AccountRef is an account in a request body. it is either the internal id or the identifier by IBAN() in JSON,
+// and the identifier is checked when the body is decoded.
+type AccountRef int
+
+func (a *AccountRef) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		err := json.Unmarshal(b, &s)
+		if err != nil {
+			return err
+		}
+		num, err := ParseAccountID(s)
+		if err != nil {
+			return err
+		}
+		*a = AccountRef(num)
+		return nil
+	}
+
+	var num int
+	err := json.Unmarshal(b, &num)
+	if err != nil {
+		return err
+	}
+	if num <= 0 || num > math.MaxInt32 {
+		return fmt.Errorf("got %v as invalied id", num)
+	}
+	*a = AccountRef(num)
+	return nil
+}
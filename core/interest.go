@@ -0,0 +1,321 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+const (
+	InterestPosted = "InterestPosted"
+
+	// interest is paid from this internal account, so its balance goes negative.
+	// this is the one in USD, and the interest in the other currencies is booked by internalAccount().
+	InterestExpenseAccount = -2
+
+	interestLock = 20231004
+
+	// days in the past which AccrueInterest() catches up when the job was stopped.
+	maxAccrualCatchUp = 31
+)
+
+// InterestSummary is the interest of an account accrued but not posted yet.
+type InterestSummary struct {
+	Account int     `json:"account"`
+	Product string  `json:"product"`
+	Rate    float64 `json:"rate"`
+	Accrued float64 `json:"accrued"`
+	Since   string  `json:"since,omitempty"`
+}
+
+// accrue records the interest of the end-of-day balance of every account earning interest on day.
+// an account accrued on the day is skipped, so running it twice never pays twice.
+func (nb *netBank) accrue(tx *sql.Tx, day time.Time) (int64, error) {
+	ps, err := nb.GetProducts()
+	if err != nil {
+		return 0, err
+	}
+
+	end := day.AddDate(0, 0, 1)
+	var accrued int64
+	for _, p := range ps {
+		if p.InterestRate == 0 && len(p.RateTiers) == 0 {
+			continue
+		}
+
+		// the end-of-day balance is the last one in the journal before the end of the day.
+		// an account without entries before it has the balance before its first entry, or the current one.
+		q := `
+		SELECT a.id, COALESCE(
+			(SELECT balance FROM journal WHERE account_id=a.id AND created_at<$2 ORDER BY id DESC LIMIT 1),
+			(SELECT balance-amount FROM journal WHERE account_id=a.id AND created_at>=$2 ORDER BY id LIMIT 1),
+			a.balance
+		)
+		FROM account a
+		WHERE a.product=$1 AND a.id>0
+		ORDER BY a.id;
+		`
+		rows, err := tx.QueryContext(context.Background(), q, p.Code, end)
+		if err != nil {
+			return 0, err
+		}
+		type balance struct {
+			num     int
+			balance float64
+		}
+		bs := []*balance{}
+		for rows.Next() {
+			b := &balance{}
+			err := rows.Scan(&b.num, &b.balance)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			bs = append(bs, b)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for _, b := range bs {
+			if b.balance <= 0 {
+				continue
+			}
+			rate := p.rate(b.balance)
+			q := `
+			INSERT INTO interest_accrual (account_id, day, balance, rate, amount)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (account_id, day) DO NOTHING;
+			`
+			res, err := tx.ExecContext(context.Background(), q, b.num, day.Format(dateLayout), b.balance, rate, b.balance*rate/365)
+			if err != nil {
+				return 0, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return 0, err
+			}
+			accrued += n
+		}
+	}
+	return accrued, nil
+}
+
+// AccrueInterest accrues the interest of the days after the last accrual until the day before now,
+// and returns the number of accruals.
+func (nb *netBank) AccrueInterest(now time.Time) (int64, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", interestLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	yesterday := truncateDate(now).AddDate(0, 0, -1)
+	day := yesterday
+	var last sql.NullTime
+	err = tx.QueryRowContext(context.Background(), "SELECT MAX(day) FROM interest_accrual;").Scan(&last)
+	if err != nil {
+		return 0, err
+	}
+	if last.Valid {
+		day = truncateDate(last.Time).AddDate(0, 0, 1)
+	}
+	if earliest := yesterday.AddDate(0, 0, 1-maxAccrualCatchUp); day.Before(earliest) {
+		day = earliest
+	}
+
+	var accrued int64
+	for ; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		n, err := nb.accrue(tx, day)
+		if err != nil {
+			return 0, err
+		}
+		accrued += n
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return accrued, nil
+}
+
+// PostInterest credits the interest accrued before the month of now to the accounts, and returns the number of credited accounts.
+// the accruals are marked as posted in the same transaction, so a posted month is never paid again.
+func (nb *netBank) PostInterest(now time.Time) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", interestLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	q := `
+	SELECT i.account_id, a.currency, SUM(i.amount)
+	FROM interest_accrual i
+	JOIN account a ON a.id=i.account_id
+	WHERE i.posted_at IS NULL AND i.day<$1
+	GROUP BY i.account_id, a.currency
+	ORDER BY i.account_id;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, month.Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+	type posting struct {
+		num      int
+		currency string
+		amount   float64
+	}
+	ps := []*posting{}
+	for rows.Next() {
+		p := &posting{}
+		err := rows.Scan(&p.num, &p.currency, &p.amount)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ps = append(ps, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := []*Event{}
+	for _, p := range ps {
+		q := `UPDATE interest_accrual SET posted_at=now() WHERE account_id=$1 AND posted_at IS NULL AND day<$2;`
+		_, err := tx.ExecContext(context.Background(), q, p.num, month.Format(dateLayout))
+		if err != nil {
+			return 0, err
+		}
+
+		amount := roundAmount(p.amount, p.currency)
+		if amount <= 0 {
+			continue
+		}
+		expense, err := internalAccount(tx, InterestExpenseAccount, p.currency)
+		if err != nil {
+			return 0, err
+		}
+
+		q = `UPDATE account SET balance=balance+$1 WHERE id=$2;`
+		_, err = tx.ExecContext(context.Background(), q, amount, p.num)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(context.Background(), q, -amount, expense)
+		if err != nil {
+			return 0, err
+		}
+
+		credited, err := nb.record(tx, InterestCredited, p.num, amount, expense)
+		if err != nil {
+			return 0, err
+		}
+		paid, err := nb.record(tx, InterestCredited, expense, -amount, p.num)
+		if err != nil {
+			return 0, err
+		}
+
+		err = nb.enqueue(tx, InterestPosted, p.num, &Funds{Account: p.num, Amount: amount, Balance: credited.Balance})
+		if err != nil {
+			return 0, err
+		}
+		published = append(published, credited, paid)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	publish(published...)
+	return len(published) / 2, nil
+}
+
+// GetInterest returns the interest of the account accrued but not posted yet.
+func (nb *netBank) GetInterest(num int) (*InterestSummary, error) {
+	q := `
+	SELECT a.id, a.product, a.balance, a.currency, COALESCE(SUM(i.amount), 0), MIN(i.day)
+	FROM account a
+	LEFT JOIN interest_accrual i ON i.account_id=a.id AND i.posted_at IS NULL
+	WHERE a.id=$1
+	GROUP BY a.id;
+	`
+	s := &InterestSummary{}
+	var (
+		balance  float64
+		currency string
+		since    sql.NullTime
+	)
+	err := nb.db.QueryRowContext(context.Background(), q, num).Scan(&s.Account, &s.Product, &balance, &currency, &s.Accrued, &since)
+	if err != nil {
+		return nil, err
+	}
+	if since.Valid {
+		s.Since = since.Time.Format(dateLayout)
+	}
+
+	p, err := nb.GetProduct(s.Product)
+	if err != nil {
+		return nil, err
+	}
+	s.Rate = p.rate(balance)
+	s.Accrued = roundAmount(s.Accrued, currency)
+	return s, nil
+}
+
+// RunInterestJobs accrues the interest of the past days and posts the interest of the past months every interval until ctx is done.
+func RunInterestJobs(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the interest jobs: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		_, err := nb.AccrueInterest(now)
+		if err != nil {
+			log.Printf("failed to accrue interest: %v", err)
+		} else {
+			// posting waits for the accruals of the last day of the month.
+			_, err = nb.PostInterest(now)
+			if err != nil {
+				log.Printf("failed to post interest: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// internalAccountLock is the key of the advisory lock which lets only one transaction open an internal account at a time.
+const internalAccountLock = 20231008
+
+// internalAccount returns the internal account of the role in the currency, e.g. the fee income in JPY.
+// the role is the id of the internal account in USD, such as FeeIncomeAccount. the accounts of the other
+// currencies are opened when they are used first, so that money in different currencies is never added up.
+func internalAccount(tx *sql.Tx, role int, currency string) (int, error) {
+	num, err := findInternalAccount(tx, role, currency)
+	if err != sql.ErrNoRows {
+		return num, err
+	}
+
+	// the account is looked up again after the lock, because another transaction may have opened it meanwhile.
+	_, err = tx.ExecContext(context.Background(), "SELECT pg_advisory_xact_lock($1);", internalAccountLock)
+	if err != nil {
+		return 0, err
+	}
+	num, err = findInternalAccount(tx, role, currency)
+	if err != sql.ErrNoRows {
+		return num, err
+	}
+
+	var name string
+	err = tx.QueryRowContext(context.Background(), `SELECT username FROM customer WHERE id=$1;`, role).Scan(&name)
+	if err != nil {
+		return 0, fmt.Errorf("internal account(ID: %v) doesnt exist: %w", role, err)
+	}
+
+	err = tx.QueryRowContext(context.Background(), `SELECT nextval('internal_account_id');`).Scan(&num)
+	if err != nil {
+		return 0, err
+	}
+	q := `INSERT INTO customer (id, username, addr, phone) VALUES ($1, $2, '', '');`
+	_, err = tx.ExecContext(context.Background(), q, num, name+" "+currency)
+	if err != nil {
+		return 0, err
+	}
+	q = `INSERT INTO account (id, balance, currency) VALUES ($1, 0, $2);`
+	_, err = tx.ExecContext(context.Background(), q, num, currency)
+	if err != nil {
+		return 0, err
+	}
+	q = `INSERT INTO internal_account (role, currency, account_id) VALUES ($1, $2, $3);`
+	_, err = tx.ExecContext(context.Background(), q, role, currency, num)
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+func findInternalAccount(tx *sql.Tx, role int, currency string) (int, error) {
+	var num int
+	q := `SELECT account_id FROM internal_account WHERE role=$1 AND currency=$2;`
+	err := tx.QueryRowContext(context.Background(), q, role, currency).Scan(&num)
+	return num, err
+}
+
+// accountCurrency returns the currency of the account.
+func accountCurrency(q querier, num int) (string, error) {
+	var currency string
+	err := q.QueryRowContext(context.Background(), `SELECT currency FROM account WHERE id=$1;`, num).Scan(&currency)
+	return currency, err
+}
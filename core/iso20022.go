@@ -0,0 +1,304 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hiroyuki-takayama-RAIX/core/iso20022"
+)
+
+// ImportPain001 sends the credit transfers of a pain.001 message from the account as a batch transfer,
+// and reports the status of every transaction as pain.002.
+// a message which breaks the schema is rejected as a whole, and a transaction which is not to an account
+// of the bank or not in the currency of the account is rejected alone. in atomic mode nothing is sent
+// when any transaction is rejected. nothing is sent and the valid transactions are ACTC when dryRun is true.
+func (nb *netBank) ImportPain001(num int, data []byte, mode string, dryRun bool) (*iso20022.Pain002, error) {
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	doc, issues := iso20022.ParsePain001(data)
+	report := iso20022.NewPain002(doc, id, time.Now())
+	if len(issues) > 0 {
+		report.Reject(issues)
+		return report, nil
+	}
+
+	reject := func(ts *iso20022.TransactionStatus, code string, format string, args ...any) {
+		ts.Status = iso20022.StatusRejected
+		ts.Reasons = append(ts.Reasons, iso20022.NewStatusReason(code, fmt.Sprintf(format, args...)))
+	}
+	trades := []*Trade{}
+	accepted := []*iso20022.TransactionStatus{}
+	rejected := false
+	for i, p := range doc.PaymentInfos {
+		ps := report.PaymentInfos[i]
+		debtor, err := ParseAccountID(p.DebtorAccount.ID())
+		if err != nil || debtor != num {
+			for _, ts := range ps.Transactions {
+				reject(ts, iso20022.ReasonIncorrectAccount, "debtor account %v is not account(ID: %v)", p.DebtorAccount.ID(), num)
+			}
+			rejected = true
+			continue
+		}
+
+		for j, t := range p.Transfers {
+			ts := ps.Transactions[j]
+			trade, code, err := nb.pain001Trade(a, t)
+			if err != nil {
+				reject(ts, code, "%v", err)
+				rejected = true
+				continue
+			}
+			trades = append(trades, trade)
+			accepted = append(accepted, ts)
+		}
+	}
+
+	if dryRun || len(trades) == 0 {
+		for _, ts := range accepted {
+			ts.Status = iso20022.StatusAcceptedTechnicalValidation
+		}
+		report.Summarize()
+		return report, nil
+	}
+	if (mode == "" || mode == BatchAtomic) && rejected {
+		for _, ts := range accepted {
+			reject(ts, iso20022.ReasonNarrative, "not sent because another transaction of the atomic batch was rejected")
+		}
+		report.Summarize()
+		return report, nil
+	}
+
+	result, err := nb.BatchTransfer(num, trades, mode)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range result.Lines {
+		ts := accepted[i]
+		switch line.Status {
+		case LineSucceeded:
+			ts.Status = iso20022.StatusAcceptedSettlementCompleted
+			ts.Reference = strconv.FormatInt(line.Transfer, 10)
+		case LineFailed:
+			ts.Status = iso20022.StatusRejected
+			ts.Reasons = append(ts.Reasons, iso20022.NewStatusReason(pain002Reason(line.err), line.Error))
+		default:
+			reject(ts, iso20022.ReasonNarrative, "not sent because the atomic batch was rolled back")
+		}
+	}
+	report.Summarize()
+	return report, nil
+}
+
+// pain001Trade is the trade of the transaction from the account. the error has the status reason of the rejection.
+func (nb *netBank) pain001Trade(a *Account, t *iso20022.CreditTransfer) (*Trade, string, error) {
+	if t.CreditorAccount == nil {
+		return nil, iso20022.ReasonIncorrectAccount, fmt.Errorf("creditor account is missing")
+	}
+	to, err := ParseAccountID(t.CreditorAccount.ID())
+	if err != nil {
+		return nil, iso20022.ReasonIncorrectAccount, err
+	}
+	if t.Amount.Currency != a.Currency {
+		return nil, iso20022.ReasonNotAllowedCurrency, fmt.Errorf("amount is in %v, but account(ID: %v) is in %v", t.Amount.Currency, a.Number, a.Currency)
+	}
+	amount, err := strconv.ParseFloat(t.Amount.Value, 64)
+	if err != nil || amount <= 0 || roundAmount(amount, a.Currency) != amount {
+		return nil, iso20022.ReasonNotAllowedAmount, fmt.Errorf("amount %v is not a positive amount of %v", t.Amount.Value, a.Currency)
+	}
+	_, err = nb.GetAccount(to)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, iso20022.ReasonIncorrectAccount, fmt.Errorf("account(ID: %v) doesnt exist", to)
+	} else if err != nil {
+		return nil, iso20022.ReasonNarrative, err
+	}
+	return &Trade{Class: "transfer", Amount: amount, To: AccountRef(to), Currency: a.Currency}, "", nil
+}
+
+// pain002Reason is the status reason of a transfer which failed.
+func pain002Reason(err error) string {
+	var le *LimitError
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		return iso20022.ReasonInsufficientFunds
+	case errors.As(err, &le):
+		return iso20022.ReasonNotAllowedAmount
+	case errors.Is(err, ErrCurrencyMismatch):
+		return iso20022.ReasonNotAllowedCurrency
+	case errors.Is(err, sql.ErrNoRows):
+		return iso20022.ReasonIncorrectAccount
+	}
+	return iso20022.ReasonNarrative
+}
+
+// StatementCamt053 renders the entries of the journal of the account on the date as a camt.053 statement.
+func (nb *netBank) StatementCamt053(num int, date time.Time) ([]byte, error) {
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	from := truncateDate(date)
+	es, closing, err := journalBetween(nb.db, a, from, from)
+	if err != nil {
+		return nil, err
+	}
+	return newCamt053(a, es, closing, from, time.Now()).Encode()
+}
+
+// journalBetween returns the entries of the journal of the account between the dates, and the balance at the end of the last date.
+// the balance is the one after the last entry before the end, or the balance before the first entry when there is none.
+func journalBetween(q querier, a *Account, from time.Time, to time.Time) ([]*Event, float64, error) {
+	end := truncateDate(to).AddDate(0, 0, 1)
+	query := `
+	SELECT id, event, account_id, amount, balance, counterparty, created_at
+	FROM journal
+	WHERE account_id=$1 AND created_at>=$2 AND created_at<$3 AND amount<>0
+	ORDER BY id;
+	`
+	rows, err := q.QueryContext(context.Background(), query, a.Number, truncateDate(from), end)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	es := []*Event{}
+	for rows.Next() {
+		e := &Event{}
+		err := rows.Scan(&e.ID, &e.Type, &e.Account, &e.Amount, &e.Balance, &e.Counterparty, &e.At)
+		if err != nil {
+			return nil, 0, err
+		}
+		es = append(es, e)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var closing float64
+	query = `
+	SELECT COALESCE(
+		(SELECT balance FROM journal WHERE account_id=$1 AND created_at<$2 ORDER BY id DESC LIMIT 1),
+		(SELECT a.balance-COALESCE(SUM(j.amount), 0) FROM account a LEFT JOIN journal j ON j.account_id=a.id WHERE a.id=$1 GROUP BY a.id),
+		0
+	);
+	`
+	err = q.QueryRowContext(context.Background(), query, a.Number, end).Scan(&closing)
+	if err != nil {
+		return nil, 0, err
+	}
+	return es, roundAmount(closing, a.Currency), nil
+}
+
+// newCamt053 is the statement of the entries on the day from the date. the opening balance is the closing one without the entries.
+func newCamt053(a *Account, es []*Event, closing float64, date time.Time, now time.Time) *iso20022.Camt053 {
+	digits := currencies[a.Currency]
+	amount := func(v float64) *iso20022.Amount {
+		return &iso20022.Amount{Currency: a.Currency, Value: iso20022.FormatAmount(math.Abs(v), digits)}
+	}
+	indicator := func(v float64) string {
+		if v < 0 {
+			return iso20022.Debit
+		}
+		return iso20022.Credit
+	}
+
+	id := fmt.Sprintf("%v-%v", a.Number, date.Format("20060102"))
+	s := &iso20022.Statement{
+		ID:        id,
+		CreatedAt: iso20022.FormatDateTime(now),
+		From:      iso20022.FormatDateTime(date),
+		To:        iso20022.FormatDateTime(date.AddDate(0, 0, 1).Add(-time.Second)),
+		Account: &iso20022.CashAccount{
+			IBAN:     IBAN(a.Number),
+			Currency: a.Currency,
+			Owner:    &iso20022.Party{Name: a.Name},
+		},
+		Entries: []*iso20022.Entry{},
+	}
+
+	credits, debits := 0, 0
+	var creditSum, debitSum float64
+	for _, e := range es {
+		entry := &iso20022.Entry{
+			Reference:   strconv.FormatInt(e.ID, 10),
+			Amount:      amount(e.Amount),
+			Indicator:   indicator(e.Amount),
+			Status:      iso20022.Booked,
+			BookedAt:    iso20022.FormatDateTime(e.At),
+			ValueDate:   iso20022.FormatDate(e.At),
+			Domain:      bankTransactionDomain(e),
+			Proprietary: e.Type,
+		}
+		if e.Counterparty > 0 {
+			counterparty := &iso20022.CashAccount{IBAN: IBAN(e.Counterparty)}
+			if e.Amount > 0 {
+				entry.Parties = &iso20022.RelatedParties{DebtorAccount: counterparty}
+			} else {
+				entry.Parties = &iso20022.RelatedParties{CreditorAccount: counterparty}
+			}
+		}
+		s.Entries = append(s.Entries, entry)
+
+		if e.Amount > 0 {
+			credits++
+			creditSum += e.Amount
+		} else {
+			debits++
+			debitSum -= e.Amount
+		}
+	}
+
+	net := roundAmount(creditSum-debitSum, a.Currency)
+	opening := roundAmount(closing-net, a.Currency)
+	s.Balances = []*iso20022.Balance{
+		{Type: iso20022.OpeningBooked, Amount: amount(opening), Indicator: indicator(opening), Date: iso20022.FormatDate(date)},
+		{Type: iso20022.ClosingBooked, Amount: amount(closing), Indicator: indicator(closing), Date: iso20022.FormatDate(date)},
+	}
+	s.Summary = &iso20022.TransactionsSummary{
+		Entries:      fmt.Sprint(len(es)),
+		Sum:          iso20022.FormatAmount(creditSum+debitSum, digits),
+		NetAmount:    iso20022.FormatAmount(math.Abs(net), digits),
+		NetIndicator: indicator(net),
+		Credits:      fmt.Sprint(credits),
+		CreditSum:    iso20022.FormatAmount(creditSum, digits),
+		Debits:       fmt.Sprint(debits),
+		DebitSum:     iso20022.FormatAmount(debitSum, digits),
+	}
+
+	return &iso20022.Camt053{
+		MessageID: "STMT-" + id,
+		CreatedAt: iso20022.FormatDateTime(now),
+		Statement: s,
+	}
+}
+
+// bankTransactionDomain is the bank transaction code of ISO 20022 for the event. other events have the proprietary code only.
+func bankTransactionDomain(e *Event) *iso20022.BankTransactionDomain {
+	switch {
+	case e.Type == BalanceChanged && e.Counterparty != 0 && e.Amount > 0:
+		return &iso20022.BankTransactionDomain{Code: "PMNT", Family: "RCDT", SubFamily: "BOOK"}
+	case e.Type == BalanceChanged && e.Counterparty != 0:
+		return &iso20022.BankTransactionDomain{Code: "PMNT", Family: "ICDT", SubFamily: "BOOK"}
+	case e.Type == BalanceChanged && e.Amount > 0:
+		return &iso20022.BankTransactionDomain{Code: "PMNT", Family: "CNTR", SubFamily: "CDPT"}
+	case e.Type == BalanceChanged:
+		return &iso20022.BankTransactionDomain{Code: "PMNT", Family: "CNTR", SubFamily: "CWDL"}
+	case e.Type == FeePosted:
+		return &iso20022.BankTransactionDomain{Code: "ACMT", Family: "MDOP", SubFamily: "CHRG"}
+	case e.Type == InterestCredited:
+		return &iso20022.BankTransactionDomain{Code: "ACMT", Family: "MDOP", SubFamily: "INTR"}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package iso20022
+
+import "encoding/xml"
+
+// BalanceType3Code of the balances of a statement.
+const (
+	OpeningBooked = "OPBD"
+	ClosingBooked = "CLBD"
+
+	// Booked is the status of entries which are posted on the account.
+	Booked = "BOOK"
+)
+
+// Camt053 is BankToCustomerStatementV08 with one statement.
+type Camt053 struct {
+	XMLName   xml.Name   `xml:"urn:iso:std:iso:20022:tech:xsd:camt.053.001.08 Document"`
+	MessageID string     `xml:"BkToCstmrStmt>GrpHdr>MsgId"`
+	CreatedAt string     `xml:"BkToCstmrStmt>GrpHdr>CreDtTm"`
+	Statement *Statement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// Statement is AccountStatement8.
+type Statement struct {
+	ID        string               `xml:"Id"`
+	CreatedAt string               `xml:"CreDtTm"`
+	From      string               `xml:"FrToDt>FrDtTm"`
+	To        string               `xml:"FrToDt>ToDtTm"`
+	Account   *CashAccount         `xml:"Acct"`
+	Balances  []*Balance           `xml:"Bal"`
+	Summary   *TransactionsSummary `xml:"TxsSummry,omitempty"`
+	Entries   []*Entry             `xml:"Ntry"`
+}
+
+// Balance is CashBalance8.
+type Balance struct {
+	Type      string  `xml:"Tp>CdOrPrtry>Cd"`
+	Amount    *Amount `xml:"Amt"`
+	Indicator string  `xml:"CdtDbtInd"`
+	Date      string  `xml:"Dt>Dt"`
+}
+
+// TransactionsSummary is TotalTransactions6 with the sums of the entries.
+type TransactionsSummary struct {
+	Entries      string `xml:"TtlNtries>NbOfNtries"`
+	Sum          string `xml:"TtlNtries>Sum"`
+	NetAmount    string `xml:"TtlNtries>TtlNetNtry>Amt"`
+	NetIndicator string `xml:"TtlNtries>TtlNetNtry>CdtDbtInd"`
+	Credits      string `xml:"TtlCdtNtries>NbOfNtries"`
+	CreditSum    string `xml:"TtlCdtNtries>Sum"`
+	Debits       string `xml:"TtlDbtNtries>NbOfNtries"`
+	DebitSum     string `xml:"TtlDbtNtries>Sum"`
+}
+
+// Entry is ReportEntry10.
+type Entry struct {
+	Reference         string                 `xml:"NtryRef,omitempty"`
+	Amount            *Amount                `xml:"Amt"`
+	Indicator         string                 `xml:"CdtDbtInd"`
+	Status            string                 `xml:"Sts>Cd"`
+	BookedAt          string                 `xml:"BookgDt>DtTm"`
+	ValueDate         string                 `xml:"ValDt>Dt"`
+	ServicerReference string                 `xml:"AcctSvcrRef,omitempty"`
+	Domain            *BankTransactionDomain `xml:"BkTxCd>Domn,omitempty"`
+	Proprietary       string                 `xml:"BkTxCd>Prtry>Cd"`
+	Parties           *RelatedParties        `xml:"NtryDtls>TxDtls>RltdPties,omitempty"`
+	Information       string                 `xml:"AddtlNtryInf,omitempty"`
+}
+
+// BankTransactionDomain is the domain, the family and the sub-family of the bank transaction code.
+type BankTransactionDomain struct {
+	Code      string `xml:"Cd"`
+	Family    string `xml:"Fmly>Cd"`
+	SubFamily string `xml:"Fmly>SubFmlyCd"`
+}
+
+// RelatedParties has the account of the counterparty, which is the debtor of a credit and the creditor of a debit.
+type RelatedParties struct {
+	DebtorAccount   *CashAccount `xml:"DbtrAcct,omitempty"`
+	CreditorAccount *CashAccount `xml:"CdtrAcct,omitempty"`
+}
+
+// Encode writes the statement as XML.
+func (s *Camt053) Encode() ([]byte, error) {
+	return encode(s)
+}
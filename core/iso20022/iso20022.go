@@ -0,0 +1,247 @@
+// Package iso20022 reads and writes the ISO 20022 messages exchanged with corporate clients:
+// pain.001 (payment initiation), pain.002 (payment status report) and camt.053 (account statement).
+//
+// the rules of the schemas which matter to the bank are checked in Go: required elements, text lengths, codes,
+// patterns of identifiers, dates and amounts. elements the bank does not read are not checked.
+// the XSDs in schemas/ declare the elements the bank reads and writes, and the tests validate the messages against them.
+package iso20022
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	Pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.09"
+	Pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.10"
+	Camt053Namespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"
+
+	// Credit and Debit are CreditDebitCode.
+	Credit = "CRDT"
+	Debit  = "DBIT"
+)
+
+var (
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[a-zA-Z0-9]{1,30}$`)
+	bicPattern      = regexp.MustCompile(`^[A-Z0-9]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	numericPattern  = regexp.MustCompile(`^[0-9]{1,15}$`)
+	decimalPattern  = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+)
+
+// Issue is a violation of the schema or the rules of the message. Path is the path of the element from the message root,
+// and Reason is the status reason of the rejection, which is FF01 for the schema.
+type Issue struct {
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+func (i *Issue) String() string {
+	return fmt.Sprintf("%v: %v", i.Path, i.Error)
+}
+
+// Amount is ActiveOrHistoricCurrencyAndAmount.
+type Amount struct {
+	Currency string `xml:"Ccy,attr" json:"currency"`
+	Value    string `xml:",chardata" json:"value"`
+}
+
+// Party is PartyIdentification with the name only.
+type Party struct {
+	Name string `xml:"Nm,omitempty" json:"name,omitempty"`
+}
+
+// CashAccount is identified by either IBAN or another identifier.
+type CashAccount struct {
+	IBAN     string          `xml:"Id>IBAN,omitempty" json:"iban,omitempty"`
+	Other    *GenericAccount `xml:"Id>Othr,omitempty" json:"other,omitempty"`
+	Currency string          `xml:"Ccy,omitempty" json:"currency,omitempty"`
+	Owner    *Party          `xml:"Ownr,omitempty" json:"owner,omitempty"`
+}
+
+// GenericAccount is GenericAccountIdentification, which is the number of the account in the bank.
+type GenericAccount struct {
+	ID string `xml:"Id" json:"id"`
+}
+
+// ID returns the identifier of the account.
+func (a *CashAccount) ID() string {
+	if a.IBAN != "" || a.Other == nil {
+		return a.IBAN
+	}
+	return a.Other.ID
+}
+
+// Agent is BranchAndFinancialInstitutionIdentification with BIC only.
+type Agent struct {
+	BIC string `xml:"FinInstnId>BICFI,omitempty" json:"bic,omitempty"`
+}
+
+// FormatAmount writes the amount with the digits of the minor unit of the currency.
+func FormatAmount(amount float64, digits int) string {
+	return strconv.FormatFloat(amount, 'f', digits, 64)
+}
+
+// FormatDateTime writes ISODateTime with the offset.
+func FormatDateTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// FormatDate writes ISODate.
+func FormatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func encode(v any) ([]byte, error) {
+	bs, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(bs, '\n')...), nil
+}
+
+// checker collects the issues of a message.
+type checker struct {
+	issues []*Issue
+}
+
+func (c *checker) add(path string, format string, a ...any) {
+	c.issues = append(c.issues, &Issue{Path: path, Error: fmt.Sprintf(format, a...), Reason: ReasonInvalidFileFormat})
+}
+
+func (c *checker) required(path string, s string) bool {
+	if strings.TrimSpace(s) == "" {
+		c.add(path, "is missing")
+		return false
+	}
+	return true
+}
+
+// text checks MaxNText. an empty optional text is not checked.
+func (c *checker) text(path string, s string, max int, required bool) {
+	if s == "" && !required {
+		return
+	}
+	if !c.required(path, s) {
+		return
+	}
+	if n := utf8.RuneCountInString(s); n > max {
+		c.add(path, "has %v characters, more than %v", n, max)
+	}
+}
+
+func (c *checker) numeric(path string, s string, required bool) {
+	if s == "" && !required {
+		return
+	}
+	if c.required(path, s) && !numericPattern.MatchString(s) {
+		c.add(path, "%v is not up to 15 digits", s)
+	}
+}
+
+// decimal checks DecimalNumber and the value of amounts, which are up to 18 digits and 5 decimals for amounts.
+func (c *checker) decimal(path string, s string, fractions int, required bool) {
+	if s == "" && !required {
+		return
+	}
+	if !c.required(path, s) {
+		return
+	}
+	if !decimalPattern.MatchString(s) {
+		c.add(path, "%v is not a decimal number", s)
+		return
+	}
+	integer, fraction, _ := strings.Cut(s, ".")
+	if len(strings.TrimLeft(integer, "0"))+len(fraction) > 18 {
+		c.add(path, "%v has more than 18 digits", s)
+	}
+	if len(fraction) > fractions {
+		c.add(path, "%v has more than %v decimals", s, fractions)
+	}
+}
+
+func (c *checker) amount(path string, a *Amount) {
+	if a == nil {
+		c.add(path, "is missing")
+		return
+	}
+	c.decimal(path, a.Value, 5, true)
+	if !currencyPattern.MatchString(a.Currency) {
+		c.add(path+"/@Ccy", "%q is not a currency code", a.Currency)
+	}
+}
+
+func (c *checker) dateTime(path string, s string) {
+	if !c.required(path, s) {
+		return
+	}
+	if _, err := ParseDateTime(s); err != nil {
+		c.add(path, "%v is not ISODateTime", s)
+	}
+}
+
+func (c *checker) date(path string, s string) {
+	if !c.required(path, s) {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		c.add(path, "%v is not ISODate", s)
+	}
+}
+
+func (c *checker) code(path string, s string, codes ...string) {
+	if !c.required(path, s) {
+		return
+	}
+	for _, code := range codes {
+		if s == code {
+			return
+		}
+	}
+	c.add(path, "%v is not one of %v", s, strings.Join(codes, ", "))
+}
+
+func (c *checker) account(path string, a *CashAccount) {
+	if a == nil {
+		c.add(path, "is missing")
+		return
+	}
+	switch {
+	case a.IBAN != "":
+		if !ibanPattern.MatchString(a.IBAN) {
+			c.add(path+"/Id/IBAN", "%v is not an IBAN", a.IBAN)
+		}
+	case a.Other != nil:
+		c.text(path+"/Id/Othr/Id", a.Other.ID, 34, true)
+	default:
+		c.add(path+"/Id", "has neither IBAN nor Othr")
+	}
+	if a.Currency != "" && !currencyPattern.MatchString(a.Currency) {
+		c.add(path+"/Ccy", "%q is not a currency code", a.Currency)
+	}
+}
+
+func (c *checker) agent(path string, a *Agent) {
+	if a == nil {
+		c.add(path, "is missing")
+		return
+	}
+	if a.BIC != "" && !bicPattern.MatchString(a.BIC) {
+		c.add(path+"/FinInstnId/BICFI", "%v is not a BIC", a.BIC)
+	}
+}
+
+// ParseDateTime reads ISODateTime, which may be without the offset. it is then in the local time.
+func ParseDateTime(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", s)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05.999999999", s, time.Local)
+}
@@ -0,0 +1,138 @@
+package iso20022
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParsePain001(t *testing.T) {
+	data, err := os.ReadFile("testdata/pain001.xml")
+	assert.NilError(t, err)
+
+	doc, issues := ParsePain001(data)
+	assert.Equal(t, 0, len(issues))
+	assert.Equal(t, "MSG-20231031-001", doc.GroupHeader.MessageID)
+	assert.Equal(t, 1, len(doc.PaymentInfos))
+	p := doc.PaymentInfos[0]
+	assert.Equal(t, "JP72NETB0000001001", p.DebtorAccount.ID())
+	assert.Equal(t, 2, len(p.Transfers))
+	assert.DeepEqual(t, &Amount{Currency: "USD", Value: "30"}, p.Transfers[0].Amount)
+	assert.Equal(t, "3003", p.Transfers[1].CreditorAccount.ID())
+
+	type fixture struct {
+		name   string
+		old    string
+		new    string
+		issues []string
+	}
+	fs := make([]*fixture, 6)
+	fs[0] = &fixture{"namespace", "pain.001.001.09", "pain.001.001.03",
+		[]string{`Document: namespace "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03" is not urn:iso:std:iso:20022:tech:xsd:pain.001.001.09`}}
+	fs[1] = &fixture{"not xml", "</Document>", "", []string{"Document: is not XML of pain.001: XML syntax error on line 71: unexpected EOF"}}
+	fs[2] = &fixture{"message id", "MSG-20231031-001", strings.Repeat("M", 36), []string{"GrpHdr/MsgId: has 36 characters, more than 35"}}
+	fs[3] = &fixture{"totals", "<CtrlSum>40.5</CtrlSum>", "<CtrlSum>40</CtrlSum>",
+		[]string{"GrpHdr/CtrlSum: is 40, but the sum of the transactions is 40.5"}}
+	fs[4] = &fixture{"amount", `Ccy="USD">10.50<`, `Ccy="usd">10.505<`,
+		[]string{`PmtInf[1]/CdtTrfTxInf[2]/Amt/InstdAmt/@Ccy: "usd" is not a currency code`,
+			"GrpHdr/CtrlSum: is 40.5, but the sum of the transactions is 40.505"}}
+	fs[5] = &fixture{"method and date", "<PmtMtd>TRF</PmtMtd>", "<PmtMtd>DD</PmtMtd>",
+		[]string{"PmtInf[1]/PmtMtd: DD is not one of CHK, TRF, TRA"}}
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			_, issues := ParsePain001([]byte(strings.Replace(string(data), f.old, f.new, 1)))
+			got := []string{}
+			for _, i := range issues {
+				got = append(got, i.String())
+			}
+			assert.DeepEqual(t, f.issues, got)
+		})
+	}
+
+	_, issues = ParsePain001([]byte(strings.Replace(string(data), "<NbOfTxs>2</NbOfTxs>", "<NbOfTxs>3</NbOfTxs>", 1)))
+	assert.Equal(t, 1, len(issues))
+	assert.Equal(t, ReasonInvalidNumberOfTxs, issues[0].Reason)
+}
+
+func TestPain002(t *testing.T) {
+	data, err := os.ReadFile("testdata/pain001.xml")
+	assert.NilError(t, err)
+	doc, _ := ParsePain001(data)
+
+	now := time.Date(2023, 10, 31, 10, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	r := NewPain002(doc, "4f2a9c", now)
+	txs := r.PaymentInfos[0].Transactions
+	txs[0].Status = StatusAcceptedSettlementCompleted
+	txs[0].Reference = "12"
+	txs[1].Status = StatusRejected
+	txs[1].Reasons = []*StatusReason{NewStatusReason(ReasonInsufficientFunds, strings.Repeat("x", 110))}
+	r.Summarize()
+	assert.Equal(t, StatusPartiallyAccepted, r.Group.Status)
+	assert.Equal(t, StatusPartiallyAccepted, r.PaymentInfos[0].Status)
+	assert.DeepEqual(t, []string{strings.Repeat("x", 105), "xxxxx"}, txs[1].Reasons[0].Information)
+
+	bs, err := r.Encode()
+	assert.NilError(t, err)
+	golden, err := os.ReadFile("testdata/pain002.xml")
+	assert.NilError(t, err)
+	assert.Equal(t, string(golden), string(bs))
+
+	_, issues := ParsePain001([]byte(strings.Replace(string(data), "<NbOfTxs>2</NbOfTxs>", "<NbOfTxs>3</NbOfTxs>", 1)))
+	r = NewPain002(doc, "4f2a9c", now)
+	r.Reject(issues)
+	assert.Equal(t, StatusRejected, r.Group.Status)
+	assert.Equal(t, 0, len(r.PaymentInfos))
+	assert.DeepEqual(t, &StatusReason{Code: ReasonInvalidNumberOfTxs, Information: []string{"GrpHdr/NbOfTxs: is 3, but there are 2 transactions"}}, r.Group.Reasons[0])
+}
+
+// validate checks the message against the bundled XSD with xmllint, which is skipped when it is not installed.
+func validate(t *testing.T, schema string, data []byte) error {
+	t.Helper()
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+	path := filepath.Join(t.TempDir(), "message.xml")
+	err = os.WriteFile(path, data, 0o600)
+	assert.NilError(t, err)
+	out, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("schemas", schema+".xsd"), path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+func TestSchemas(t *testing.T) {
+	data, err := os.ReadFile("testdata/pain001.xml")
+	assert.NilError(t, err)
+	assert.NilError(t, validate(t, "pain.001.001.09", data))
+
+	// the reports and the statements written by the bank are valid.
+	report, err := os.ReadFile("testdata/pain002.xml")
+	assert.NilError(t, err)
+	assert.NilError(t, validate(t, "pain.002.001.10", report))
+
+	doc, _ := ParsePain001(data)
+	_, issues := ParsePain001([]byte(strings.Replace(string(data), "<NbOfTxs>2</NbOfTxs>", "<NbOfTxs>3</NbOfTxs>", 1)))
+	r := NewPain002(doc, "4f2a9c", time.Date(2023, 10, 31, 10, 0, 0, 0, time.UTC))
+	r.Reject(issues)
+	bs, err := r.Encode()
+	assert.NilError(t, err)
+	assert.NilError(t, validate(t, "pain.002.001.10", bs))
+
+	// the statement is generated by the core package from the journal.
+	statement, err := os.ReadFile("../testdata/camt053.xml")
+	assert.NilError(t, err)
+	assert.NilError(t, validate(t, "camt.053.001.08", statement))
+
+	err = validate(t, "pain.002.001.10", []byte(strings.Replace(string(report), "<TxSts>RJCT</TxSts>", "<TxSts>REJECTED</TxSts>", 1)))
+	assert.ErrorContains(t, err, "TxSts")
+	err = validate(t, "camt.053.001.08", []byte(strings.Replace(string(statement), "<CdtDbtInd>CRDT</CdtDbtInd>", "<CdtDbtInd>CR</CdtDbtInd>", 1)))
+	assert.ErrorContains(t, err, "CdtDbtInd")
+}
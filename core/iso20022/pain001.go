@@ -0,0 +1,149 @@
+package iso20022
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Pain001 is CustomerCreditTransferInitiationV09.
+type Pain001 struct {
+	XMLName      xml.Name              `xml:"Document"`
+	GroupHeader  *Pain001GroupHeader   `xml:"CstmrCdtTrfInitn>GrpHdr"`
+	PaymentInfos []*PaymentInformation `xml:"CstmrCdtTrfInitn>PmtInf"`
+}
+
+type Pain001GroupHeader struct {
+	MessageID       string `xml:"MsgId"`
+	CreatedAt       string `xml:"CreDtTm"`
+	NumberOfTxs     string `xml:"NbOfTxs"`
+	ControlSum      string `xml:"CtrlSum"`
+	InitiatingParty *Party `xml:"InitgPty"`
+}
+
+// PaymentInformation is a set of credit transfers from a debtor account.
+type PaymentInformation struct {
+	ID                string            `xml:"PmtInfId"`
+	Method            string            `xml:"PmtMtd"`
+	NumberOfTxs       string            `xml:"NbOfTxs"`
+	ControlSum        string            `xml:"CtrlSum"`
+	ExecutionDate     string            `xml:"ReqdExctnDt>Dt"`
+	ExecutionDateTime string            `xml:"ReqdExctnDt>DtTm"`
+	Debtor            *Party            `xml:"Dbtr"`
+	DebtorAccount     *CashAccount      `xml:"DbtrAcct"`
+	DebtorAgent       *Agent            `xml:"DbtrAgt"`
+	Transfers         []*CreditTransfer `xml:"CdtTrfTxInf"`
+}
+
+// CreditTransfer is CreditTransferTransaction.
+type CreditTransfer struct {
+	InstructionID   string       `xml:"PmtId>InstrId"`
+	EndToEndID      string       `xml:"PmtId>EndToEndId"`
+	Amount          *Amount      `xml:"Amt>InstdAmt"`
+	Creditor        *Party       `xml:"Cdtr"`
+	CreditorAccount *CashAccount `xml:"CdtrAcct"`
+	Remittance      string       `xml:"RmtInf>Ustrd"`
+}
+
+// ParsePain001 reads the message and checks it by the rules of the schema,
+// and that the numbers of transactions and the control sums are the totals of the transactions.
+// the message is nil when it is not XML of pain.001.
+func ParsePain001(data []byte) (*Pain001, []*Issue) {
+	doc := &Pain001{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	err := d.Decode(doc)
+	if err != nil {
+		return nil, []*Issue{{Path: "Document", Error: fmt.Sprintf("is not XML of pain.001: %v", err), Reason: ReasonInvalidFileFormat}}
+	}
+	if doc.XMLName.Space != Pain001Namespace {
+		msg := fmt.Sprintf("namespace %q is not %v", doc.XMLName.Space, Pain001Namespace)
+		return nil, []*Issue{{Path: "Document", Error: msg, Reason: ReasonInvalidFileFormat}}
+	}
+
+	c := &checker{}
+	h := doc.GroupHeader
+	if h == nil {
+		c.add("CstmrCdtTrfInitn/GrpHdr", "is missing")
+		return doc, c.issues
+	}
+	c.text("GrpHdr/MsgId", h.MessageID, 35, true)
+	c.dateTime("GrpHdr/CreDtTm", h.CreatedAt)
+	c.numeric("GrpHdr/NbOfTxs", h.NumberOfTxs, true)
+	c.decimal("GrpHdr/CtrlSum", h.ControlSum, 17, false)
+	if h.InitiatingParty == nil {
+		c.add("GrpHdr/InitgPty", "is missing")
+	} else {
+		c.text("GrpHdr/InitgPty/Nm", h.InitiatingParty.Name, 140, false)
+	}
+	if len(doc.PaymentInfos) == 0 {
+		c.add("PmtInf", "is missing")
+	}
+
+	count, sum := 0, new(big.Rat)
+	for i, p := range doc.PaymentInfos {
+		path := fmt.Sprintf("PmtInf[%v]", i+1)
+		c.text(path+"/PmtInfId", p.ID, 35, true)
+		c.code(path+"/PmtMtd", p.Method, "CHK", "TRF", "TRA")
+		c.numeric(path+"/NbOfTxs", p.NumberOfTxs, false)
+		c.decimal(path+"/CtrlSum", p.ControlSum, 17, false)
+		if p.ExecutionDateTime != "" {
+			c.dateTime(path+"/ReqdExctnDt/DtTm", p.ExecutionDateTime)
+		} else {
+			c.date(path+"/ReqdExctnDt/Dt", p.ExecutionDate)
+		}
+		if p.Debtor == nil {
+			c.add(path+"/Dbtr", "is missing")
+		} else {
+			c.text(path+"/Dbtr/Nm", p.Debtor.Name, 140, false)
+		}
+		c.account(path+"/DbtrAcct", p.DebtorAccount)
+		c.agent(path+"/DbtrAgt", p.DebtorAgent)
+		if len(p.Transfers) == 0 {
+			c.add(path+"/CdtTrfTxInf", "is missing")
+		}
+
+		subtotal := new(big.Rat)
+		for j, t := range p.Transfers {
+			tpath := fmt.Sprintf("%v/CdtTrfTxInf[%v]", path, j+1)
+			c.text(tpath+"/PmtId/InstrId", t.InstructionID, 35, false)
+			c.text(tpath+"/PmtId/EndToEndId", t.EndToEndID, 35, true)
+			c.amount(tpath+"/Amt/InstdAmt", t.Amount)
+			if t.Creditor != nil {
+				c.text(tpath+"/Cdtr/Nm", t.Creditor.Name, 140, false)
+			}
+			if t.CreditorAccount != nil {
+				c.account(tpath+"/CdtrAcct", t.CreditorAccount)
+			}
+			c.text(tpath+"/RmtInf/Ustrd", t.Remittance, 140, false)
+			if t.Amount != nil {
+				if v, ok := new(big.Rat).SetString(t.Amount.Value); ok {
+					subtotal.Add(subtotal, v)
+				}
+			}
+		}
+		checkTotals(c, path, p.NumberOfTxs, p.ControlSum, len(p.Transfers), subtotal)
+		count += len(p.Transfers)
+		sum.Add(sum, subtotal)
+	}
+	checkTotals(c, "GrpHdr", h.NumberOfTxs, h.ControlSum, count, sum)
+
+	return doc, c.issues
+}
+
+// checkTotals compares the number of transactions and the control sum with the transactions. both are optional in PmtInf.
+func checkTotals(c *checker, path string, number string, controlSum string, count int, sum *big.Rat) {
+	if numericPattern.MatchString(number) && number != fmt.Sprint(count) {
+		c.add(path+"/NbOfTxs", "is %v, but there are %v transactions", number, count)
+		c.issues[len(c.issues)-1].Reason = ReasonInvalidNumberOfTxs
+	}
+	if !decimalPattern.MatchString(controlSum) {
+		return
+	}
+	if v, _ := new(big.Rat).SetString(controlSum); v.Cmp(sum) != 0 {
+		total := strings.TrimRight(strings.TrimRight(sum.FloatString(5), "0"), ".")
+		c.add(path+"/CtrlSum", "is %v, but the sum of the transactions is %v", controlSum, total)
+		c.issues[len(c.issues)-1].Reason = ReasonInvalidControlSum
+	}
+}
@@ -0,0 +1,168 @@
+package iso20022
+
+import (
+	"encoding/xml"
+	"time"
+	"unicode/utf8"
+)
+
+// ExternalPaymentTransactionStatus1Code
+const (
+	StatusAcceptedTechnicalValidation = "ACTC"
+	StatusAcceptedSettlementCompleted = "ACSC"
+	StatusPartiallyAccepted           = "PART"
+	StatusRejected                    = "RJCT"
+)
+
+// ExternalStatusReason1Code
+const (
+	ReasonInvalidFileFormat  = "FF01"
+	ReasonIncorrectAccount   = "AC01"
+	ReasonNotAllowedAmount   = "AM02"
+	ReasonNotAllowedCurrency = "AM03"
+	ReasonInsufficientFunds  = "AM04"
+	ReasonInvalidControlSum  = "AM10"
+	ReasonInvalidNumberOfTxs = "AM18"
+	ReasonNarrative          = "NARR"
+	maxAdditionalInformation = 105
+	pain001MessageName       = "pain.001.001.09"
+	missingOriginalMessageID = "NOTPROVIDED"
+)
+
+// Pain002 is CustomerPaymentStatusReportV10.
+type Pain002 struct {
+	XMLName      xml.Name                     `xml:"urn:iso:std:iso:20022:tech:xsd:pain.002.001.10 Document" json:"-"`
+	MessageID    string                       `xml:"CstmrPmtStsRpt>GrpHdr>MsgId" json:"message_id"`
+	CreatedAt    string                       `xml:"CstmrPmtStsRpt>GrpHdr>CreDtTm" json:"created_at"`
+	Group        *OriginalGroupStatus         `xml:"CstmrPmtStsRpt>OrgnlGrpInfAndSts" json:"group"`
+	PaymentInfos []*OriginalPaymentInfoStatus `xml:"CstmrPmtStsRpt>OrgnlPmtInfAndSts" json:"payment_infos,omitempty"`
+}
+
+type OriginalGroupStatus struct {
+	MessageID   string          `xml:"OrgnlMsgId" json:"message_id"`
+	MessageName string          `xml:"OrgnlMsgNmId" json:"message_name"`
+	NumberOfTxs string          `xml:"OrgnlNbOfTxs,omitempty" json:"number_of_txs,omitempty"`
+	ControlSum  string          `xml:"OrgnlCtrlSum,omitempty" json:"control_sum,omitempty"`
+	Status      string          `xml:"GrpSts,omitempty" json:"status,omitempty"`
+	Reasons     []*StatusReason `xml:"StsRsnInf" json:"reasons,omitempty"`
+}
+
+type OriginalPaymentInfoStatus struct {
+	ID           string               `xml:"OrgnlPmtInfId" json:"id"`
+	Status       string               `xml:"PmtInfSts,omitempty" json:"status,omitempty"`
+	Reasons      []*StatusReason      `xml:"StsRsnInf" json:"reasons,omitempty"`
+	Transactions []*TransactionStatus `xml:"TxInfAndSts" json:"transactions"`
+}
+
+type TransactionStatus struct {
+	InstructionID string          `xml:"OrgnlInstrId,omitempty" json:"instruction_id,omitempty"`
+	EndToEndID    string          `xml:"OrgnlEndToEndId,omitempty" json:"end_to_end_id,omitempty"`
+	Status        string          `xml:"TxSts,omitempty" json:"status"`
+	Reasons       []*StatusReason `xml:"StsRsnInf" json:"reasons,omitempty"`
+	// Reference is the id of the transfer.
+	Reference string `xml:"AcctSvcrRef,omitempty" json:"reference,omitempty"`
+}
+
+type StatusReason struct {
+	Code        string   `xml:"Rsn>Cd" json:"code"`
+	Information []string `xml:"AddtlInf,omitempty" json:"information,omitempty"`
+}
+
+// NewStatusReason is the reason with the texts cut into Max105Text.
+func NewStatusReason(code string, texts ...string) *StatusReason {
+	r := &StatusReason{Code: code}
+	for _, text := range texts {
+		for text != "" {
+			n, i := 0, 0
+			for i < len(text) && n < maxAdditionalInformation {
+				_, size := utf8.DecodeRuneInString(text[i:])
+				i += size
+				n++
+			}
+			r.Information = append(r.Information, text[:i])
+			text = text[i:]
+		}
+	}
+	return r
+}
+
+// NewPain002 is the report on the message without statuses. the message may be nil when it could not be read.
+func NewPain002(doc *Pain001, id string, now time.Time) *Pain002 {
+	r := &Pain002{
+		MessageID: id,
+		CreatedAt: FormatDateTime(now),
+		Group:     &OriginalGroupStatus{MessageID: missingOriginalMessageID, MessageName: pain001MessageName},
+	}
+	if doc == nil || doc.GroupHeader == nil {
+		return r
+	}
+	if doc.GroupHeader.MessageID != "" {
+		r.Group.MessageID = doc.GroupHeader.MessageID
+	}
+	if numericPattern.MatchString(doc.GroupHeader.NumberOfTxs) {
+		r.Group.NumberOfTxs = doc.GroupHeader.NumberOfTxs
+	}
+	if decimalPattern.MatchString(doc.GroupHeader.ControlSum) {
+		r.Group.ControlSum = doc.GroupHeader.ControlSum
+	}
+	for _, p := range doc.PaymentInfos {
+		ps := &OriginalPaymentInfoStatus{ID: p.ID, Transactions: make([]*TransactionStatus, len(p.Transfers))}
+		for i, t := range p.Transfers {
+			ps.Transactions[i] = &TransactionStatus{InstructionID: t.InstructionID, EndToEndID: t.EndToEndID}
+		}
+		r.PaymentInfos = append(r.PaymentInfos, ps)
+	}
+	return r
+}
+
+// Reject rejects the whole message for the issues, which are reported by their reasons.
+// the transactions are not reported.
+func (r *Pain002) Reject(issues []*Issue) {
+	r.Group.Status = StatusRejected
+	r.PaymentInfos = nil
+	reasons := map[string]*StatusReason{}
+	for _, i := range issues {
+		reason, ok := reasons[i.Reason]
+		if !ok {
+			reason = &StatusReason{Code: i.Reason}
+			reasons[i.Reason] = reason
+			r.Group.Reasons = append(r.Group.Reasons, reason)
+		}
+		reason.Information = append(reason.Information, NewStatusReason(i.Reason, i.String()).Information...)
+	}
+}
+
+// Summarize sets the statuses of the payment informations and the group by their transactions.
+// all transactions in a status make the status, and some accepted ones make PART.
+func (r *Pain002) Summarize() {
+	if r.Group.Status == StatusRejected {
+		return
+	}
+	all := []string{}
+	for _, p := range r.PaymentInfos {
+		ss := []string{}
+		for _, t := range p.Transactions {
+			ss = append(ss, t.Status)
+		}
+		p.Status = summarize(ss)
+		all = append(all, ss...)
+	}
+	r.Group.Status = summarize(all)
+}
+
+func summarize(ss []string) string {
+	if len(ss) == 0 {
+		return ""
+	}
+	for _, s := range ss[1:] {
+		if s != ss[0] {
+			return StatusPartiallyAccepted
+		}
+	}
+	return ss[0]
+}
+
+// Encode writes the report as XML.
+func (r *Pain002) Encode() ([]byte, error) {
+	return encode(r)
+}
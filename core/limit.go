@@ -0,0 +1,400 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	PerTransaction  = "per_transaction"
+	Daily           = "daily"
+	Monthly         = "monthly"
+	PerCounterparty = "per_counterparty"
+
+	// a limit of an account overrides the tier of the customer, and the tier overrides the default of the bank.
+	LimitAccount = "account"
+	LimitTier    = "tier"
+	LimitDefault = "default"
+)
+
+// ErrLimitExceeded is matched by errors.Is() when a withdrawal or a transfer is over one of the limits.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError tells which limit is exceeded. errors.As() gets it from the error of a withdrawal or a transfer.
+type LimitError struct {
+	Kind      string
+	Limit     float64
+	Remaining float64
+	Amount    float64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v limit is exceeded. the limit is %v and %v remains, but the amount is %v", e.Kind, e.Limit, e.Remaining, e.Amount)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Code is the error code of the limit for clients, e.g. daily_limit_exceeded.
+func (e *LimitError) Code() string {
+	return e.Kind + "_limit_exceeded"
+}
+
+// LimitRule is a set of limits on the money going out of an account by withdrawals and transfers.
+// nil is not limited at the level, and the next level is applied.
+// PerCounterparty is the daily limit for each reciever.
+// the limits are in Currency and applied to the accounts in it. empty Currency is DefaultCurrency,
+// or the currency of the account for LimitAccount.
+type LimitRule struct {
+	Currency        string   `json:"currency,omitempty"`
+	PerTransaction  *float64 `json:"per_transaction,omitempty"`
+	Daily           *float64 `json:"daily,omitempty"`
+	Monthly         *float64 `json:"monthly,omitempty"`
+	PerCounterparty *float64 `json:"per_counterparty,omitempty"`
+}
+
+// Limit is a limit applied to an account and how much of it remains.
+type Limit struct {
+	Kind      string  `json:"kind"`
+	Currency  string  `json:"currency"`
+	Limit     float64 `json:"limit"`
+	Source    string  `json:"source"`
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+	// Counterparties is the usage of PerCounterparty today by reciever.
+	Counterparties []*CounterpartyLimit `json:"counterparties,omitempty"`
+}
+
+type CounterpartyLimit struct {
+	Account   int     `json:"account"`
+	Used      float64 `json:"used"`
+	Remaining float64 `json:"remaining"`
+}
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type appliedLimit struct {
+	limit  float64
+	source string
+}
+
+// resolveLimits returns the limits of the account in its currency by kind. a kind without any limit is not in the result.
+func resolveLimits(q querier, num int) (map[string]*appliedLimit, error) {
+	var tier, currency string
+	row := q.QueryRowContext(context.Background(), `
+	SELECT COALESCE((SELECT tier FROM customer_tier WHERE customer_id=$1), ''),
+		COALESCE((SELECT currency FROM account WHERE id=$1), '');
+	`, num)
+	err := row.Scan(&tier, &currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows are read from the lowest level, so that a higher level overwrites them.
+	rows, err := q.QueryContext(context.Background(), `
+	SELECT scope, per_transaction, daily, monthly, per_counterparty
+	FROM limit_rule
+	WHERE ((scope=$1 AND key='') OR (scope=$2 AND key=$3) OR (scope=$4 AND key=$5)) AND currency=$6
+	ORDER BY CASE scope WHEN $1 THEN 0 WHEN $2 THEN 1 ELSE 2 END;
+	`, LimitDefault, LimitTier, tier, LimitAccount, strconv.Itoa(num), currency)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := map[string]*appliedLimit{}
+	for rows.Next() {
+		var (
+			scope string
+			vs    [4]sql.NullFloat64
+		)
+		err := rows.Scan(&scope, &vs[0], &vs[1], &vs[2], &vs[3])
+		if err != nil {
+			return nil, err
+		}
+		for i, kind := range []string{PerTransaction, Daily, Monthly, PerCounterparty} {
+			if vs[i].Valid {
+				limits[kind] = &appliedLimit{limit: vs[i].Float64, source: scope}
+			}
+		}
+	}
+	return limits, rows.Err()
+}
+
+const usedToday = `SELECT COALESCE(SUM(amount), 0) FROM limit_usage WHERE account_id=$1 AND created_at>=date_trunc('day', now())`
+
+const usedThisMonth = `SELECT COALESCE(SUM(amount), 0) FROM limit_usage WHERE account_id=$1 AND created_at>=date_trunc('month', now())`
+
+func usedAmount(q querier, query string, args ...any) (float64, error) {
+	var used float64
+	err := q.QueryRowContext(context.Background(), query, args...).Scan(&used)
+	if err != nil {
+		return 0, err
+	}
+	return used, nil
+}
+
+// useLimits checks the limits of the account for money going to counterparty, and records it as used.
+// counterparty is zero for a withdrawal. the account must be locked so that concurrent usage is counted.
+func useLimits(tx *sql.Tx, num int, counterparty int, money float64) error {
+	u, err := loadLimitUsage(tx, num)
+	if err != nil {
+		return err
+	}
+	err = u.check(counterparty, money)
+	if err != nil {
+		return err
+	}
+	return recordLimitUsage(tx, num, counterparty, money)
+}
+
+// limitUsage is the limits of an account and how much of them is used, which lets a batch check its lines
+// without reading them again. the account must be locked while it is used.
+type limitUsage struct {
+	limits         map[string]*appliedLimit
+	daily          float64
+	monthly        float64
+	counterparties map[int]float64
+}
+
+func loadLimitUsage(tx *sql.Tx, num int) (*limitUsage, error) {
+	limits, err := resolveLimits(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	u := &limitUsage{limits: limits, counterparties: map[int]float64{}}
+
+	// only the usage of the kinds having a limit is read.
+	if _, ok := limits[Daily]; ok {
+		u.daily, err = usedAmount(tx, usedToday, num)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := limits[Monthly]; ok {
+		u.monthly, err = usedAmount(tx, usedThisMonth, num)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := limits[PerCounterparty]; ok {
+		q := `
+		SELECT counterparty, SUM(amount)
+		FROM limit_usage
+		WHERE account_id=$1 AND counterparty<>0 AND created_at>=date_trunc('day', now())
+		GROUP BY counterparty;
+		`
+		rows, err := tx.QueryContext(context.Background(), q, num)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				counterparty int
+				used         float64
+			)
+			err := rows.Scan(&counterparty, &used)
+			if err != nil {
+				return nil, err
+			}
+			u.counterparties[counterparty] = used
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+// check returns a LimitError when money going to counterparty exceeds any limit.
+func (u *limitUsage) check(counterparty int, money float64) error {
+	if l, ok := u.limits[PerTransaction]; ok && money > l.limit {
+		return &LimitError{Kind: PerTransaction, Limit: l.limit, Remaining: l.limit, Amount: money}
+	}
+
+	type check struct {
+		kind string
+		used float64
+	}
+	checks := []check{{Daily, u.daily}, {Monthly, u.monthly}}
+	if counterparty != 0 {
+		checks = append(checks, check{PerCounterparty, u.counterparties[counterparty]})
+	}
+	for _, c := range checks {
+		l, ok := u.limits[c.kind]
+		if !ok {
+			continue
+		}
+		if c.used+money > l.limit {
+			return &LimitError{Kind: c.kind, Limit: l.limit, Remaining: remaining(l.limit, c.used), Amount: money}
+		}
+	}
+	return nil
+}
+
+// use counts money going to counterparty after it is recorded.
+func (u *limitUsage) use(counterparty int, money float64) {
+	u.daily += money
+	u.monthly += money
+	if counterparty != 0 {
+		u.counterparties[counterparty] += money
+	}
+}
+
+func recordLimitUsage(tx *sql.Tx, num int, counterparty int, money float64) error {
+	q := `INSERT INTO limit_usage (account_id, counterparty, amount) VALUES ($1, $2, $3);`
+	_, err := tx.ExecContext(context.Background(), q, num, counterparty, money)
+	return err
+}
+
+// GetLimits returns the limits applied to the account and how much of them remains.
+func (nb *netBank) GetLimits(num int) ([]*Limit, error) {
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := resolveLimits(nb.db, num)
+	if err != nil {
+		return nil, err
+	}
+
+	ls := []*Limit{}
+	if l, ok := limits[PerTransaction]; ok {
+		ls = append(ls, &Limit{Kind: PerTransaction, Currency: a.Currency, Limit: l.limit, Source: l.source, Remaining: l.limit})
+	}
+	for _, c := range []struct{ kind, query string }{{Daily, usedToday}, {Monthly, usedThisMonth}} {
+		l, ok := limits[c.kind]
+		if !ok {
+			continue
+		}
+		used, err := usedAmount(nb.db, c.query, num)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, &Limit{Kind: c.kind, Currency: a.Currency, Limit: l.limit, Source: l.source, Used: used, Remaining: remaining(l.limit, used)})
+	}
+
+	if l, ok := limits[PerCounterparty]; ok {
+		q := `
+		SELECT counterparty, SUM(amount)
+		FROM limit_usage
+		WHERE account_id=$1 AND counterparty<>0 AND created_at>=date_trunc('day', now())
+		GROUP BY counterparty
+		ORDER BY counterparty;
+		`
+		rows, err := nb.db.QueryContext(context.Background(), q, num)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		limit := &Limit{Kind: PerCounterparty, Currency: a.Currency, Limit: l.limit, Source: l.source, Remaining: l.limit}
+		for rows.Next() {
+			c := &CounterpartyLimit{}
+			err := rows.Scan(&c.Account, &c.Used)
+			if err != nil {
+				return nil, err
+			}
+			c.Remaining = remaining(l.limit, c.Used)
+			limit.Counterparties = append(limit.Counterparties, c)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		ls = append(ls, limit)
+	}
+	return ls, nil
+}
+
+func remaining(limit float64, used float64) float64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// SetLimitRule sets the limits of the scope by staff. key is the account id for LimitAccount,
+// the name of the tier for LimitTier and empty for LimitDefault.
+func (nb *netBank) SetLimitRule(scope string, key string, r *LimitRule) (*LimitRule, error) {
+	switch scope {
+	case LimitAccount:
+		num, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("got %v as invalied id", key)
+		}
+		a, err := nb.GetAccount(num)
+		if err != nil {
+			return nil, err
+		}
+		if r.Currency == "" {
+			r.Currency = a.Currency
+		}
+		if r.Currency != a.Currency {
+			return nil, fmt.Errorf("currency of limits is %v, but account(ID: %v) is in %v: %w", r.Currency, num, a.Currency, ErrCurrencyMismatch)
+		}
+	case LimitTier:
+		if key == "" {
+			return nil, fmt.Errorf("name of tier is empty")
+		}
+	case LimitDefault:
+		key = ""
+	default:
+		return nil, fmt.Errorf("scope of limits must be %v, %v or %v. your input is %v", LimitAccount, LimitTier, LimitDefault, scope)
+	}
+
+	if r.Currency == "" {
+		r.Currency = DefaultCurrency
+	}
+	err := checkCurrency(r.Currency)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range []*float64{r.PerTransaction, r.Daily, r.Monthly, r.PerCounterparty} {
+		if v != nil && *v < 0 {
+			return nil, fmt.Errorf("limit is less than zero. your input is %v", *v)
+		}
+	}
+
+	q := `
+	INSERT INTO limit_rule (scope, key, currency, per_transaction, daily, monthly, per_counterparty)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (scope, key, currency) DO UPDATE
+	SET per_transaction=EXCLUDED.per_transaction, daily=EXCLUDED.daily,
+		monthly=EXCLUDED.monthly, per_counterparty=EXCLUDED.per_counterparty;
+	`
+	_, err = nb.db.ExecContext(context.Background(), q, scope, key, r.Currency, r.PerTransaction, r.Daily, r.Monthly, r.PerCounterparty)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetCustomerTier puts the customer in the tier. an empty tier removes the customer from its tier.
+func (nb *netBank) SetCustomerTier(num int, tier string) error {
+	_, err := nb.GetAccount(num)
+	if err != nil {
+		return err
+	}
+
+	if tier == "" {
+		_, err = nb.db.ExecContext(context.Background(), `DELETE FROM customer_tier WHERE customer_id=$1;`, num)
+		return err
+	}
+
+	q := `
+	INSERT INTO customer_tier (customer_id, tier)
+	VALUES ($1, $2)
+	ON CONFLICT (customer_id) DO UPDATE SET tier=EXCLUDED.tier;
+	`
+	_, err = nb.db.ExecContext(context.Background(), q, num, tier)
+	return err
+}
@@ -0,0 +1,788 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// LoanAnnuity pays the same amount every month, and LoanEqualPrincipal pays the same principal with decreasing interest.
+	LoanAnnuity        = "annuity"
+	LoanEqualPrincipal = "equal-principal"
+
+	LoanActive  = "active"
+	LoanPaidOff = "paid-off"
+
+	InstallmentDue     = "due"
+	InstallmentOverdue = "overdue"
+	InstallmentPaid    = "paid"
+	// an installment closed by the early payoff of the loan.
+	InstallmentSettled = "settled"
+
+	LoanDisbursed          = "LoanDisbursed"
+	LoanRepaid             = "LoanRepaid"
+	LoanInstallmentOverdue = "LoanInstallmentOverdue"
+	LoanClosed             = "LoanClosed"
+
+	// interest of loans is earned by this internal account.
+	// this is the one in USD, and the interest in the other currencies is booked by internalAccount().
+	LoanInterestIncomeAccount = -3
+
+	loanLock = 20231006
+
+	// the late fee of an overdue installment unless LOAN_LATE_FEE is set.
+	defaultLoanLateFee = 10
+
+	maxLoanTerm = 360
+)
+
+// ErrLoanNotActive is matched by errors.Is() when a loan is already paid off.
+var ErrLoanNotActive = errors.New("loan is not active")
+
+// Loan is money lent to an account. Rate is the annual interest rate, and Outstanding is the principal not repaid yet.
+// LateFee is charged once on every installment which is not collected by the day after its due date.
+type Loan struct {
+	ID          int64      `json:"id"`
+	Account     int        `json:"account"`
+	Principal   float64    `json:"principal"`
+	Rate        float64    `json:"rate"`
+	TermMonths  int        `json:"term_months"`
+	Method      string     `json:"method"`
+	LateFee     float64    `json:"late_fee"`
+	Outstanding float64    `json:"outstanding"`
+	Status      string     `json:"status"`
+	DisbursedOn string     `json:"disbursed_on"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+
+	// currency is the currency of the account, which the amounts of the loan are rounded to.
+	currency string
+}
+
+// Installment is a monthly repayment of a loan. Amount is the principal, the interest and the late fee.
+type Installment struct {
+	Loan      int64      `json:"loan"`
+	Seq       int        `json:"seq"`
+	DueDate   string     `json:"due_date"`
+	Principal float64    `json:"principal"`
+	Interest  float64    `json:"interest"`
+	LateFee   float64    `json:"late_fee,omitempty"`
+	Amount    float64    `json:"amount"`
+	Status    string     `json:"status"`
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+}
+
+// LoanPayment is money collected for a loan. Seq is zero for the early payoff.
+type LoanPayment struct {
+	ID        int64     `json:"id"`
+	Loan      int64     `json:"loan"`
+	Account   int       `json:"account"`
+	Seq       int       `json:"seq,omitempty"`
+	Principal float64   `json:"principal"`
+	Interest  float64   `json:"interest"`
+	LateFee   float64   `json:"late_fee,omitempty"`
+	Amount    float64   `json:"amount"`
+	Balance   float64   `json:"balance"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoanStatement is the payments of a loan and its arrears.
+type LoanStatement struct {
+	Loan          *Loan          `json:"loan"`
+	Payments      []*LoanPayment `json:"payments"`
+	PaidPrincipal float64        `json:"paid_principal"`
+	PaidInterest  float64        `json:"paid_interest"`
+	PaidLateFees  float64        `json:"paid_late_fees"`
+	// Arrears is the amount of the overdue installments including their late fees.
+	Arrears         float64      `json:"arrears"`
+	OverdueCount    int          `json:"overdue_count"`
+	NextInstallment *Installment `json:"next_installment,omitempty"`
+}
+
+// PayoffQuote is the amount which pays off a loan on Date.
+// Interest is the interest of the overdue installments and the interest accrued since the last due date.
+type PayoffQuote struct {
+	Loan      int64   `json:"loan"`
+	Date      string  `json:"date"`
+	Principal float64 `json:"principal"`
+	Interest  float64 `json:"interest"`
+	LateFees  float64 `json:"late_fees"`
+	Total     float64 `json:"total"`
+}
+
+func loanLateFee() float64 {
+	fee, err := strconv.ParseFloat(os.Getenv("LOAN_LATE_FEE"), 64)
+	if err != nil || fee < 0 {
+		return defaultLoanLateFee
+	}
+	return fee
+}
+
+// amortize returns the monthly installments of the loan disbursed on start, rounded to the minor unit of the currency.
+// the last installment pays the rest of the principal, so the rounding never leaves a balance.
+func amortize(principal float64, rate float64, months int, method string, start time.Time, currency string) []*Installment {
+	r := rate / 12
+
+	var payment float64
+	if method == LoanAnnuity {
+		if r == 0 {
+			payment = principal / float64(months)
+		} else {
+			payment = principal * r / (1 - math.Pow(1+r, -float64(months)))
+		}
+		payment = roundAmount(payment, currency)
+	}
+
+	is := make([]*Installment, months)
+	balance := principal
+	for i := 1; i <= months; i++ {
+		interest := roundAmount(balance*r, currency)
+
+		var p float64
+		switch {
+		case i == months:
+			p = balance
+		case method == LoanAnnuity:
+			p = roundAmount(payment-interest, currency)
+		default:
+			p = roundAmount(principal/float64(months), currency)
+		}
+		balance = roundAmount(balance-p, currency)
+
+		is[i-1] = &Installment{
+			Seq:       i,
+			DueDate:   monthDay(start.Year(), start.Month()+time.Month(i), start.Day()).Format(dateLayout),
+			Principal: p,
+			Interest:  interest,
+			Amount:    roundAmount(p+interest, currency),
+			Status:    InstallmentDue,
+		}
+	}
+	return is
+}
+
+const loanColumns = `id, account_id, principal, rate, term_months, method, late_fee, outstanding, status, disbursed_on, closed_at,
+	(SELECT currency FROM account WHERE id=account_id)`
+
+func scanLoan(row interface{ Scan(...any) error }) (*Loan, error) {
+	l := &Loan{}
+	var (
+		disbursedOn time.Time
+		closedAt    sql.NullTime
+	)
+	err := row.Scan(&l.ID, &l.Account, &l.Principal, &l.Rate, &l.TermMonths, &l.Method, &l.LateFee, &l.Outstanding,
+		&l.Status, &disbursedOn, &closedAt, &l.currency)
+	if err != nil {
+		return nil, err
+	}
+	l.DisbursedOn = disbursedOn.Format(dateLayout)
+	if closedAt.Valid {
+		l.ClosedAt = &closedAt.Time
+	}
+	return l, nil
+}
+
+const installmentColumns = `loan_id, seq, due_date, principal, interest, late_fee, status, paid_at`
+
+func scanInstallment(row interface{ Scan(...any) error }, currency string) (*Installment, error) {
+	i := &Installment{}
+	var (
+		dueDate time.Time
+		paidAt  sql.NullTime
+	)
+	err := row.Scan(&i.Loan, &i.Seq, &dueDate, &i.Principal, &i.Interest, &i.LateFee, &i.Status, &paidAt)
+	if err != nil {
+		return nil, err
+	}
+	i.DueDate = dueDate.Format(dateLayout)
+	i.Amount = roundAmount(i.Principal+i.Interest+i.LateFee, currency)
+	if paidAt.Valid {
+		i.PaidAt = &paidAt.Time
+	}
+	return i, nil
+}
+
+// DisburseLoan lends the principal to the account by staff. the money is posted as a deposit,
+// and the installments are scheduled monthly from today.
+func (nb *netBank) DisburseLoan(num int, principal float64, rate float64, months int, method string) (*Loan, error) {
+	if principal <= 0 {
+		return nil, fmt.Errorf("principal of loan is less than zero. your input is %v", principal)
+	}
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("interest rate must be between 0 and 1. your input is %v", rate)
+	}
+	if months <= 0 || months > maxLoanTerm {
+		return nil, fmt.Errorf("term of loan must be between 1 and %v months. your input is %v", maxLoanTerm, months)
+	}
+	if method == "" {
+		method = LoanAnnuity
+	}
+	if method != LoanAnnuity && method != LoanEqualPrincipal {
+		return nil, fmt.Errorf("method of loan must be %v or %v. your input is %v", LoanAnnuity, LoanEqualPrincipal, method)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	e, err := nb.deposit(tx, num, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	today := truncateDate(time.Now())
+	q := `
+	INSERT INTO loan (account_id, principal, rate, term_months, method, late_fee, outstanding, disbursed_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $2, $7)
+	RETURNING ` + loanColumns + `;`
+	l, err := scanLoan(tx.QueryRowContext(context.Background(), q, num, principal, rate, months, method, loanLateFee(), today.Format(dateLayout)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range amortize(principal, rate, months, method, today, l.currency) {
+		q := `
+		INSERT INTO loan_installment (loan_id, seq, due_date, principal, interest)
+		VALUES ($1, $2, $3, $4, $5);
+		`
+		_, err := tx.ExecContext(context.Background(), q, l.ID, i.Seq, i.DueDate, i.Principal, i.Interest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = nb.enqueue(tx, LoanDisbursed, num, l)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(e)
+	return l, nil
+}
+
+func (nb *netBank) GetLoan(id int64) (*Loan, error) {
+	q := `SELECT ` + loanColumns + ` FROM loan WHERE id=$1;`
+	return scanLoan(nb.db.QueryRowContext(context.Background(), q, id))
+}
+
+func (nb *netBank) GetLoans(num int) ([]*Loan, error) {
+	q := `SELECT ` + loanColumns + ` FROM loan WHERE account_id=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ls := []*Loan{}
+	for rows.Next() {
+		l, err := scanLoan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, rows.Err()
+}
+
+func getInstallments(q querier, l *Loan) ([]*Installment, error) {
+	query := `SELECT ` + installmentColumns + ` FROM loan_installment WHERE loan_id=$1 ORDER BY seq;`
+	rows, err := q.QueryContext(context.Background(), query, l.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	is := []*Installment{}
+	for rows.Next() {
+		i, err := scanInstallment(rows, l.currency)
+		if err != nil {
+			return nil, err
+		}
+		is = append(is, i)
+	}
+	return is, rows.Err()
+}
+
+// GetLoanSchedule returns the installments of the loan.
+func (nb *netBank) GetLoanSchedule(id int64) ([]*Installment, error) {
+	l, err := nb.GetLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	return getInstallments(nb.db, l)
+}
+
+// GetLoanStatement returns the payments of the loan and its arrears.
+func (nb *netBank) GetLoanStatement(id int64) (*LoanStatement, error) {
+	l, err := nb.GetLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	s := &LoanStatement{Loan: l, Payments: []*LoanPayment{}}
+
+	q := `
+	SELECT id, loan_id, account_id, COALESCE(seq, 0), principal, interest, late_fee, amount, balance, created_at
+	FROM loan_payment
+	WHERE loan_id=$1
+	ORDER BY id;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &LoanPayment{}
+		err := rows.Scan(&p.ID, &p.Loan, &p.Account, &p.Seq, &p.Principal, &p.Interest, &p.LateFee, &p.Amount, &p.Balance, &p.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		s.PaidPrincipal += p.Principal
+		s.PaidInterest += p.Interest
+		s.PaidLateFees += p.LateFee
+		s.Payments = append(s.Payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	is, err := getInstallments(nb.db, l)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range is {
+		switch i.Status {
+		case InstallmentOverdue:
+			s.Arrears += i.Amount
+			s.OverdueCount++
+		case InstallmentDue:
+			if s.NextInstallment == nil {
+				s.NextInstallment = i
+			}
+		}
+	}
+
+	s.PaidPrincipal = roundAmount(s.PaidPrincipal, l.currency)
+	s.PaidInterest = roundAmount(s.PaidInterest, l.currency)
+	s.PaidLateFees = roundAmount(s.PaidLateFees, l.currency)
+	s.Arrears = roundAmount(s.Arrears, l.currency)
+	return s, nil
+}
+
+// quotePayoff returns the amount which pays off the loan on the day of now.
+func quotePayoff(q querier, l *Loan, now time.Time) (*PayoffQuote, error) {
+	today := truncateDate(now)
+	quote := &PayoffQuote{Loan: l.ID, Date: today.Format(dateLayout), Principal: l.Outstanding}
+
+	is, err := getInstallments(q, l)
+	if err != nil {
+		return nil, err
+	}
+
+	// the interest of the current period accrues daily on the outstanding principal since the last due date.
+	since, err := time.Parse(dateLayout, l.DisbursedOn)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range is {
+		due, err := time.Parse(dateLayout, i.DueDate)
+		if err != nil {
+			return nil, err
+		}
+		if !due.After(today) {
+			since = due
+		}
+		// the interest of an unpaid installment is owed in full once it is due.
+		if i.Status == InstallmentOverdue || (i.Status == InstallmentDue && !due.After(today)) {
+			quote.Interest += i.Interest
+			quote.LateFees += i.LateFee
+		}
+	}
+	days := math.Round(today.Sub(since).Hours() / 24)
+	quote.Interest += l.Outstanding * l.Rate * days / 365
+
+	quote.Interest = roundAmount(quote.Interest, l.currency)
+	quote.LateFees = roundAmount(quote.LateFees, l.currency)
+	quote.Total = roundAmount(quote.Principal+quote.Interest+quote.LateFees, l.currency)
+	return quote, nil
+}
+
+// QuotePayoff returns the amount which pays off the loan on the day of now without collecting it.
+func (nb *netBank) QuotePayoff(id int64, now time.Time) (*PayoffQuote, error) {
+	l, err := nb.GetLoan(id)
+	if err != nil {
+		return nil, err
+	}
+	if l.Status != LoanActive {
+		return nil, fmt.Errorf("loan(ID: %v) is already %v: %w", id, l.Status, ErrLoanNotActive)
+	}
+	return quotePayoff(nb.db, l, now)
+}
+
+// lockLoan locks the account of the loan and then the loan, in the same order as the other postings.
+func lockLoan(tx *sql.Tx, id int64) (*Loan, float64, error) {
+	var num int
+	err := tx.QueryRowContext(context.Background(), `SELECT account_id FROM loan WHERE id=$1;`, id).Scan(&num)
+	if err != nil {
+		return nil, 0, err
+	}
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, 0, err
+	}
+	balance, ok := balances[num]
+	if !ok {
+		return nil, 0, sql.ErrNoRows
+	}
+
+	q := `SELECT ` + loanColumns + ` FROM loan WHERE id=$1 FOR UPDATE;`
+	l, err := scanLoan(tx.QueryRowContext(context.Background(), q, id))
+	if err != nil {
+		return nil, 0, err
+	}
+	return l, balance, nil
+}
+
+// collect debits the payment from the account of the loan. the interest is earned by LoanInterestIncomeAccount
+// and the late fee by FeeIncomeAccount of the currency of the account. the account must be locked.
+func (nb *netBank) collect(tx *sql.Tx, l *Loan, balance float64, p *LoanPayment) ([]*Event, error) {
+	p.Loan = l.ID
+	p.Account = l.Account
+	p.Amount = roundAmount(p.Principal+p.Interest+p.LateFee, l.currency)
+
+	err := checkFunds(tx, l.Account, balance, p.Amount, "borrower's")
+	if err != nil {
+		return nil, err
+	}
+
+	q := `UPDATE account SET balance=balance+$1 WHERE id=$2;`
+	_, err = tx.ExecContext(context.Background(), q, -p.Amount, l.Account)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := nb.record(tx, LoanRepayment, l.Account, -p.Amount, 0)
+	if err != nil {
+		return nil, err
+	}
+	p.Balance = paid.Balance
+	es := []*Event{paid}
+
+	currency, err := accountCurrency(tx, l.Account)
+	if err != nil {
+		return nil, err
+	}
+	if p.Interest > 0 {
+		income, err := internalAccount(tx, LoanInterestIncomeAccount, currency)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(context.Background(), q, p.Interest, income)
+		if err != nil {
+			return nil, err
+		}
+		e, err := nb.record(tx, LoanRepayment, income, p.Interest, l.Account)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	if p.LateFee > 0 {
+		income, err := internalAccount(tx, FeeIncomeAccount, currency)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(context.Background(), q, p.LateFee, income)
+		if err != nil {
+			return nil, err
+		}
+		e, err := nb.record(tx, FeePosted, income, p.LateFee, l.Account)
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+
+	var seq any
+	if p.Seq != 0 {
+		seq = p.Seq
+	}
+	q = `
+	INSERT INTO loan_payment (loan_id, account_id, seq, principal, interest, late_fee, amount, balance)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at;
+	`
+	err = tx.QueryRowContext(context.Background(), q, p.Loan, p.Account, seq, p.Principal, p.Interest, p.LateFee, p.Amount, p.Balance).Scan(&p.ID, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	q = `
+	UPDATE loan
+	SET outstanding=ROUND((outstanding-$2)::numeric, 2)
+	WHERE id=$1
+	RETURNING outstanding;
+	`
+	err = tx.QueryRowContext(context.Background(), q, l.ID, p.Principal).Scan(&l.Outstanding)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, LoanRepaid, l.Account, p)
+	if err != nil {
+		return nil, err
+	}
+	return es, nil
+}
+
+// closeLoan marks the loan as paid off when no installment is left.
+func (nb *netBank) closeLoan(tx *sql.Tx, l *Loan) error {
+	var left int
+	q := `SELECT COUNT(*) FROM loan_installment WHERE loan_id=$1 AND status IN ($2, $3);`
+	err := tx.QueryRowContext(context.Background(), q, l.ID, InstallmentDue, InstallmentOverdue).Scan(&left)
+	if err != nil {
+		return err
+	}
+	if left > 0 {
+		return nil
+	}
+
+	q = `
+	UPDATE loan
+	SET status=$2, outstanding=0, closed_at=now()
+	WHERE id=$1
+	RETURNING ` + loanColumns + `;`
+	closed, err := scanLoan(tx.QueryRowContext(context.Background(), q, l.ID, LoanPaidOff))
+	if err != nil {
+		return err
+	}
+	*l = *closed
+	return nb.enqueue(tx, LoanClosed, l.Account, l)
+}
+
+// deleteLoans deletes the loans paid off by the account which is being deleted in the transaction.
+// an account with an active loan cannot be deleted, because the debt would be forgiven.
+func deleteLoans(tx *sql.Tx, num int) error {
+	var active int
+	q := `SELECT COUNT(*) FROM loan WHERE account_id=$1 AND status=$2;`
+	err := tx.QueryRowContext(context.Background(), q, num, LoanActive).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return fmt.Errorf("account(ID: %v) has %v active loans. pay them off before deleting it: %w", num, active, ErrAccountInUse)
+	}
+
+	_, err = tx.ExecContext(context.Background(), `DELETE FROM loan WHERE account_id=$1;`, num)
+	return err
+}
+
+// PayOffLoan collects the payoff quote of today from the account and closes the loan.
+func (nb *netBank) PayOffLoan(id int64) (*LoanPayment, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	l, balance, err := lockLoan(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if l.Status != LoanActive {
+		return nil, fmt.Errorf("loan(ID: %v) is already %v: %w", id, l.Status, ErrLoanNotActive)
+	}
+
+	quote, err := quotePayoff(tx, l, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	p := &LoanPayment{Principal: quote.Principal, Interest: quote.Interest, LateFee: quote.LateFees}
+	es, err := nb.collect(tx, l, balance, p)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `UPDATE loan_installment SET status=$2, paid_at=now() WHERE loan_id=$1 AND status IN ($3, $4);`
+	_, err = tx.ExecContext(context.Background(), q, id, InstallmentSettled, InstallmentDue, InstallmentOverdue)
+	if err != nil {
+		return nil, err
+	}
+	err = nb.closeLoan(tx, l)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return p, nil
+}
+
+// CollectRepayments collects the installments due by the day of now from the accounts, and returns the number of collected installments.
+// an installment which cannot be collected by the day after its due date is overdue and charged the late fee of the loan.
+// it is retried with the late fee on the next runs, and the later installments of the loan wait for it.
+func (nb *netBank) CollectRepayments(now time.Time) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", loanLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	today := truncateDate(now)
+	q := `
+	SELECT DISTINCT l.id
+	FROM loan l
+	JOIN loan_installment i ON i.loan_id=l.id
+	WHERE l.status=$1 AND i.status IN ($2, $3) AND i.due_date<=$4
+	ORDER BY l.id;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, LoanActive, InstallmentDue, InstallmentOverdue, today.Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var collected int
+	published := []*Event{}
+	for _, id := range ids {
+		l, balance, err := lockLoan(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		// a loan paid off after it was read is skipped.
+		if l.Status != LoanActive {
+			continue
+		}
+
+		is, err := getInstallments(tx, l)
+		if err != nil {
+			return 0, err
+		}
+
+		failed := false
+		for _, i := range is {
+			if i.Status != InstallmentDue && i.Status != InstallmentOverdue {
+				continue
+			}
+			due, err := time.Parse(dateLayout, i.DueDate)
+			if err != nil {
+				return 0, err
+			}
+			if due.After(today) {
+				break
+			}
+
+			if !failed {
+				p := &LoanPayment{Seq: i.Seq, Principal: i.Principal, Interest: i.Interest, LateFee: i.LateFee}
+				es, err := nb.collect(tx, l, balance, p)
+				if err == nil {
+					q := `UPDATE loan_installment SET status=$3, paid_at=now() WHERE loan_id=$1 AND seq=$2;`
+					_, err = tx.ExecContext(context.Background(), q, id, i.Seq, InstallmentPaid)
+					if err != nil {
+						return 0, err
+					}
+					balance = p.Balance
+					collected++
+					published = append(published, es...)
+					continue
+				}
+				if !errors.Is(err, ErrInsufficientFunds) {
+					return 0, err
+				}
+				failed = true
+			}
+
+			// the installment is in arrears from the day after its due date.
+			if i.Status == InstallmentDue && due.Before(today) {
+				q := `UPDATE loan_installment SET status=$3, late_fee=$4 WHERE loan_id=$1 AND seq=$2;`
+				_, err := tx.ExecContext(context.Background(), q, id, i.Seq, InstallmentOverdue, l.LateFee)
+				if err != nil {
+					return 0, err
+				}
+				i.Status = InstallmentOverdue
+				i.LateFee = l.LateFee
+				i.Amount = roundAmount(i.Principal+i.Interest+i.LateFee, l.currency)
+				err = nb.enqueue(tx, LoanInstallmentOverdue, l.Account, i)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+
+		err = nb.closeLoan(tx, l)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	publish(published...)
+	return collected, nil
+}
+
+// RunLoanRepayments collects the loan repayments every interval until ctx is done.
+func RunLoanRepayments(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the loan repayments: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.CollectRepayments(time.Now())
+		if err != nil {
+			log.Printf("failed to collect loan repayments: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
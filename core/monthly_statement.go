@@ -0,0 +1,379 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	statementLock = 20231007
+	// the month of a statement is YYYY-MM.
+	monthLayout = "2006-01"
+	// StatementContentType is the media type of the documents of monthly statements.
+	StatementContentType = "text/html; charset=utf-8"
+)
+
+// ErrNoSigningKey is matched by errors.Is() when STATEMENT_SIGNING_KEY is not set or not a key.
+var ErrNoSigningKey = errors.New("no statement signing key")
+
+// MonthlyStatement is the archived statement of an account for a month. Content is the document, which is never changed.
+// ContentHash is the hex SHA-256 of Content and Signature is the base64 ed25519 signature of Content by the key of the bank.
+// Fees is the sum of the fees charged and Interest is the sum of the interest credited in the month.
+type MonthlyStatement struct {
+	ID           int64     `json:"id"`
+	Account      int       `json:"account"`
+	Month        string    `json:"month"`
+	Currency     string    `json:"currency"`
+	Opening      float64   `json:"opening"`
+	Fees         float64   `json:"fees"`
+	Interest     float64   `json:"interest"`
+	Closing      float64   `json:"closing"`
+	Transactions int       `json:"transactions"`
+	ContentHash  string    `json:"content_hash"`
+	Signature    string    `json:"signature"`
+	CreatedAt    time.Time `json:"created_at"`
+	Content      []byte    `json:"-"`
+}
+
+// StatementVerification is the result of verifying a document. Statement is the archived one having the same content.
+type StatementVerification struct {
+	Valid       bool              `json:"valid"`
+	Reason      string            `json:"reason,omitempty"`
+	ContentHash string            `json:"content_hash"`
+	Statement   *MonthlyStatement `json:"statement,omitempty"`
+}
+
+var statementTemplate = template.Must(template.New("statement").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Statement {{.Month}} {{.IBAN}}</title>
+</head>
+<body>
+<h1>Monthly statement {{.Month}}</h1>
+<dl>
+<dt>Account</dt><dd>{{.IBAN}}</dd>
+<dt>Name</dt><dd>{{.Name}}</dd>
+<dt>Currency</dt><dd>{{.Currency}}</dd>
+<dt>Period</dt><dd>{{.From}} to {{.To}}</dd>
+</dl>
+<table>
+<thead><tr><th>Date</th><th>ID</th><th>Description</th><th>Amount</th><th>Balance</th></tr></thead>
+<tbody>
+<tr><td>{{.From}}</td><td></td><td>Opening balance</td><td></td><td>{{.Opening}}</td></tr>
+{{range .Lines}}<tr><td>{{.Date}}</td><td>{{.ID}}</td><td>{{.Description}}</td><td>{{.Amount}}</td><td>{{.Balance}}</td></tr>
+{{end}}<tr><td>{{.To}}</td><td></td><td>Closing balance</td><td></td><td>{{.Closing}}</td></tr>
+</tbody>
+</table>
+<dl>
+<dt>Opening balance</dt><dd>{{.Opening}}</dd>
+<dt>Fees</dt><dd>{{.Fees}}</dd>
+<dt>Interest</dt><dd>{{.Interest}}</dd>
+<dt>Closing balance</dt><dd>{{.Closing}}</dd>
+</dl>
+<p>Generated at {{.CreatedAt}}</p>
+</body>
+</html>
+`))
+
+// statementSigningKey reads STATEMENT_SIGNING_KEY, which is the base64 of an ed25519 seed of 32 bytes.
+func statementSigningKey() (ed25519.PrivateKey, error) {
+	env := os.Getenv("STATEMENT_SIGNING_KEY")
+	if env == "" {
+		return nil, fmt.Errorf("STATEMENT_SIGNING_KEY is not set: %w", ErrNoSigningKey)
+	}
+	seed, err := base64.StdEncoding.DecodeString(env)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("STATEMENT_SIGNING_KEY must be the base64 of %v bytes: %w", ed25519.SeedSize, ErrNoSigningKey)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// StatementPublicKey returns the public key which verifies the signatures of statements.
+func StatementPublicKey() (ed25519.PublicKey, error) {
+	key, err := statementSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// newMonthlyStatement renders the entries of the month from the first day of the month and signs the document with the key.
+func newMonthlyStatement(a *Account, es []*Event, closing float64, month time.Time, now time.Time, key ed25519.PrivateKey) (*MonthlyStatement, error) {
+	to := month.AddDate(0, 1, -1)
+	s := newPersonalStatement(a, es, closing, month, to, now)
+	ms := &MonthlyStatement{
+		Account:      a.Number,
+		Month:        month.Format(monthLayout),
+		Currency:     a.Currency,
+		Opening:      s.Opening,
+		Closing:      s.Closing,
+		Transactions: len(s.Entries),
+		CreatedAt:    now,
+	}
+
+	type line struct {
+		Date        string
+		ID          int64
+		Description string
+		Amount      string
+		Balance     string
+	}
+	lines := []*line{}
+	for _, e := range s.Entries {
+		switch e.Type {
+		case FeePosted:
+			ms.Fees -= e.Amount
+		case InterestCredited:
+			ms.Interest += e.Amount
+		}
+		lines = append(lines, &line{
+			Date:        e.At.UTC().Format(dateLayout),
+			ID:          e.ID,
+			Description: describeEvent(e),
+			Amount:      formatStatementAmount(e.Amount, a.Currency),
+			Balance:     formatStatementAmount(e.Balance, a.Currency),
+		})
+	}
+	ms.Fees = roundAmount(ms.Fees, a.Currency)
+	ms.Interest = roundAmount(ms.Interest, a.Currency)
+
+	var b bytes.Buffer
+	err := statementTemplate.Execute(&b, map[string]any{
+		"Month":     ms.Month,
+		"IBAN":      IBAN(a.Number),
+		"Name":      a.Name,
+		"Currency":  a.Currency,
+		"From":      month.Format(dateLayout),
+		"To":        to.Format(dateLayout),
+		"Opening":   formatStatementAmount(ms.Opening, a.Currency),
+		"Lines":     lines,
+		"Fees":      formatStatementAmount(ms.Fees, a.Currency),
+		"Interest":  formatStatementAmount(ms.Interest, a.Currency),
+		"Closing":   formatStatementAmount(ms.Closing, a.Currency),
+		"CreatedAt": now.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ms.Content = b.Bytes()
+	ms.ContentHash = hashContent(ms.Content)
+	ms.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, ms.Content))
+	return ms, nil
+}
+
+// GenerateMonthlyStatements archives the statements of the month before now for the accounts which do not have one,
+// and returns the number of generated statements. an account without entries until the end of the month and
+// without balance is skipped, because it was opened after the month.
+func (nb *netBank) GenerateMonthlyStatements(now time.Time) (int, error) {
+	key, err := statementSigningKey()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", statementLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+	end := month.AddDate(0, 1, 0)
+	q := `
+	SELECT a.id
+	FROM account a
+	WHERE a.id>0 AND NOT EXISTS (SELECT 1 FROM monthly_statement s WHERE s.account_id=a.id AND s.month=$1)
+	ORDER BY a.id;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, month.Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+	nums := []int{}
+	for rows.Next() {
+		var num int
+		err := rows.Scan(&num)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		nums = append(nums, num)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	generated := 0
+	for _, num := range nums {
+		a, err := nb.GetAccount(num)
+		if err != nil {
+			return 0, err
+		}
+		es, closing, err := journalBetween(tx, a, month, end.AddDate(0, 0, -1))
+		if err != nil {
+			return 0, err
+		}
+		var before bool
+		q := `SELECT EXISTS (SELECT 1 FROM journal WHERE account_id=$1 AND created_at<$2);`
+		err = tx.QueryRowContext(context.Background(), q, num, end).Scan(&before)
+		if err != nil {
+			return 0, err
+		}
+		if !before && closing == 0 {
+			continue
+		}
+
+		ms, err := newMonthlyStatement(a, es, closing, month, now, key)
+		if err != nil {
+			return 0, err
+		}
+		q = `
+		INSERT INTO monthly_statement (account_id, month, currency, opening, fees, interest, closing, transactions, content, content_hash, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (account_id, month) DO NOTHING;
+		`
+		res, err := tx.ExecContext(context.Background(), q, ms.Account, month.Format(dateLayout), ms.Currency, ms.Opening, ms.Fees, ms.Interest,
+			ms.Closing, ms.Transactions, ms.Content, ms.ContentHash, ms.Signature, ms.CreatedAt)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		generated += int(n)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return generated, nil
+}
+
+const monthlyStatementColumns = `id, account_id, month, currency, opening, fees, interest, closing, transactions, content_hash, signature, created_at`
+
+func scanMonthlyStatement(row interface{ Scan(...any) error }, content bool) (*MonthlyStatement, error) {
+	ms := &MonthlyStatement{}
+	var month time.Time
+	dest := []any{&ms.ID, &ms.Account, &month, &ms.Currency, &ms.Opening, &ms.Fees, &ms.Interest, &ms.Closing,
+		&ms.Transactions, &ms.ContentHash, &ms.Signature, &ms.CreatedAt}
+	if content {
+		dest = append(dest, &ms.Content)
+	}
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+	ms.Month = month.Format(monthLayout)
+	return ms, nil
+}
+
+// GetMonthlyStatements returns the statements of the account from the newest month without their documents.
+func (nb *netBank) GetMonthlyStatements(num int) ([]*MonthlyStatement, error) {
+	_, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	q := `SELECT ` + monthlyStatementColumns + ` FROM monthly_statement WHERE account_id=$1 ORDER BY month DESC;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mss := []*MonthlyStatement{}
+	for rows.Next() {
+		ms, err := scanMonthlyStatement(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		mss = append(mss, ms)
+	}
+	return mss, rows.Err()
+}
+
+// GetMonthlyStatement returns the statement of the account with its document.
+func (nb *netBank) GetMonthlyStatement(num int, id int64) (*MonthlyStatement, error) {
+	q := `SELECT ` + monthlyStatementColumns + `, content FROM monthly_statement WHERE account_id=$1 AND id=$2;`
+	return scanMonthlyStatement(nb.db.QueryRowContext(context.Background(), q, num, id), true)
+}
+
+// VerifyStatement confirms that the document is a statement archived by the bank and not altered.
+// the archived statement is found by the hash of the document, and its signature is checked by the current key.
+func (nb *netBank) VerifyStatement(content []byte) (*StatementVerification, error) {
+	public, err := StatementPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	v := &StatementVerification{ContentHash: hashContent(content)}
+	q := `SELECT ` + monthlyStatementColumns + ` FROM monthly_statement WHERE content_hash=$1;`
+	ms, err := scanMonthlyStatement(nb.db.QueryRowContext(context.Background(), q, v.ContentHash), false)
+	if errors.Is(err, sql.ErrNoRows) {
+		v.Reason = "no statement has the content. it was altered or is not issued by the bank"
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+	v.Statement = ms
+
+	signature, err := base64.StdEncoding.DecodeString(ms.Signature)
+	if err != nil || !ed25519.Verify(public, content, signature) {
+		v.Reason = "the signature of the statement does not match the key of the bank"
+		return v, nil
+	}
+	v.Valid = true
+	return v, nil
+}
+
+// RunMonthlyStatements generates the statements of the past month every interval until ctx is done.
+func RunMonthlyStatements(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the monthly statements: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.GenerateMonthlyStatements(time.Now())
+		if err != nil {
+			log.Printf("failed to generate monthly statements: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
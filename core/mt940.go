@@ -0,0 +1,253 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// the lines of SWIFT messages are up to 65 characters.
+	mt940LineLength = 65
+	// :86: is up to 6 lines.
+	mt940InformationLines = 6
+	mt940NoReference      = "NONREF"
+)
+
+// MT940Statement is a customer statement message. Number is :28C: and the amounts are in Currency.
+type MT940Statement struct {
+	Reference string
+	Account   string
+	Number    string
+	Currency  string
+	Opening   *MT940Balance
+	Lines     []*MT940Line
+	Closing   *MT940Balance
+}
+
+// MT940Balance is :60F: and :62F:. Mark is C for credit and D for debit.
+type MT940Balance struct {
+	Mark   string
+	Date   time.Time
+	Amount float64
+}
+
+// MT940Line is :61: and its :86:. Type is the transaction type identification code, e.g. TRF.
+type MT940Line struct {
+	ValueDate         time.Time
+	EntryDate         time.Time
+	Mark              string
+	Amount            float64
+	Type              string
+	CustomerReference string
+	BankReference     string
+	Supplementary     string
+	Information       string
+}
+
+// mt940Text replaces characters which are not in the SWIFT X character set. accents are dropped.
+func mt940Text(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', strings.ContainsRune("/-?:().,'+ ", r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('.')
+		}
+	}
+	return b.String()
+}
+
+// wrapMT940 cuts the text into lines of the width. a line must not begin with ':' or '-', which would be
+// read as a tag or the end of the message, so such a line begins with a space. the lines after max are dropped.
+func wrapMT940(text string, width int, max int) []string {
+	rest := mt940Text(text)
+	lines := []string{}
+	for rest != "" && len(lines) < max {
+		prefix := ""
+		if rest[0] == ':' || rest[0] == '-' {
+			prefix = " "
+		}
+		n := width - len(prefix)
+		if n > len(rest) {
+			n = len(rest)
+		}
+		lines = append(lines, prefix+rest[:n])
+		rest = rest[n:]
+	}
+	return lines
+}
+
+// mt940Amount writes the amount with a decimal comma, e.g. 1500,00. the comma remains without decimals.
+func mt940Amount(amount float64, currency string) (string, error) {
+	digits := currencies[currency]
+	s := strings.Replace(strconv.FormatFloat(amount, 'f', digits, 64), ".", ",", 1)
+	if digits == 0 {
+		s += ","
+	}
+	if len(s) > 15 {
+		return "", fmt.Errorf("amount %v is longer than 15 characters of MT940", s)
+	}
+	return s, nil
+}
+
+func checkMT940Length(field string, s string, n int) error {
+	if s == "" || len(s) > n {
+		return fmt.Errorf("%v of MT940 must be 1 to %v characters. got %q", field, n, s)
+	}
+	return nil
+}
+
+// EncodeMT940 renders the statement as the text block of MT940. the lines are separated by CRLF and the block ends with '-'.
+func EncodeMT940(s *MT940Statement) ([]byte, error) {
+	for _, f := range []struct {
+		name  string
+		value string
+		n     int
+	}{{":20:", s.Reference, 16}, {":25:", s.Account, 35}, {":28C:", s.Number, 11}} {
+		if err := checkMT940Length(f.name, f.value, f.n); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	line := func(format string, a ...any) {
+		fmt.Fprintf(&b, format, a...)
+		b.WriteString("\r\n")
+	}
+	balance := func(tag string, bl *MT940Balance) error {
+		amount, err := mt940Amount(bl.Amount, s.Currency)
+		if err != nil {
+			return err
+		}
+		line("%v%v%v%v%v", tag, bl.Mark, bl.Date.Format("060102"), s.Currency, amount)
+		return nil
+	}
+
+	line(":20:%v", mt940Text(s.Reference))
+	line(":25:%v", mt940Text(s.Account))
+	line(":28C:%v", s.Number)
+	err := balance(":60F:", s.Opening)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range s.Lines {
+		amount, err := mt940Amount(l.Amount, s.Currency)
+		if err != nil {
+			return nil, err
+		}
+		customer := l.CustomerReference
+		if customer == "" {
+			customer = mt940NoReference
+		}
+		if err := checkMT940Length("customer reference", customer, 16); err != nil {
+			return nil, err
+		}
+		if len(l.BankReference) > 16 {
+			return nil, fmt.Errorf("bank reference of MT940 must be up to 16 characters. got %q", l.BankReference)
+		}
+		bank := ""
+		if l.BankReference != "" {
+			bank = "//" + mt940Text(l.BankReference)
+		}
+		line(":61:%v%v%v%vN%v%v%v", l.ValueDate.Format("060102"), l.EntryDate.Format("0102"), l.Mark, amount, l.Type, mt940Text(customer), bank)
+		if supplementary := wrapMT940(l.Supplementary, 34, 1); len(supplementary) > 0 {
+			line("%v", supplementary[0])
+		}
+		if information := wrapMT940(l.Information, mt940LineLength, mt940InformationLines); len(information) > 0 {
+			line(":86:%v", information[0])
+			for _, i := range information[1:] {
+				line("%v", i)
+			}
+		}
+	}
+	err = balance(":62F:", s.Closing)
+	if err != nil {
+		return nil, err
+	}
+	line("-")
+	return b.Bytes(), nil
+}
+
+// ExportMT940 renders the journal of the account between the dates as an MT940 statement.
+func (nb *netBank) ExportMT940(num int, from time.Time, to time.Time) ([]byte, error) {
+	if truncateDate(from).After(truncateDate(to)) {
+		return nil, fmt.Errorf("from %v is after to %v", from.Format(dateLayout), to.Format(dateLayout))
+	}
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	es, closing, err := journalBetween(nb.db, a, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeMT940(newMT940(a, es, closing, truncateDate(from), truncateDate(to)))
+}
+
+// newMT940 is the statement of the entries between the dates. the opening balance is the closing one without the entries.
+// :28C: is the year and the day of the year of the last date.
+func newMT940(a *Account, es []*Event, closing float64, from time.Time, to time.Time) *MT940Statement {
+	mark := func(v float64) string {
+		if v < 0 {
+			return "D"
+		}
+		return "C"
+	}
+
+	s := &MT940Statement{
+		Reference: fmt.Sprintf("%v%v", to.Format("060102"), a.Number),
+		Account:   IBAN(a.Number),
+		Number:    fmt.Sprintf("%v%03d/1", to.Format("06"), to.YearDay()),
+		Currency:  a.Currency,
+		Lines:     []*MT940Line{},
+	}
+	opening := closing
+	for _, e := range es {
+		opening -= e.Amount
+		at := e.At.UTC()
+		l := &MT940Line{
+			ValueDate:     at,
+			EntryDate:     at,
+			Mark:          mark(e.Amount),
+			Amount:        roundAmount(math.Abs(e.Amount), a.Currency),
+			Type:          mt940Type(e),
+			BankReference: strconv.FormatInt(e.ID, 10),
+			Information:   strings.ToUpper(e.Type),
+		}
+		if e.Counterparty > 0 {
+			l.Supplementary = IBAN(e.Counterparty)
+			if e.Amount > 0 {
+				l.Information += " FROM " + IBAN(e.Counterparty)
+			} else {
+				l.Information += " TO " + IBAN(e.Counterparty)
+			}
+		}
+		s.Lines = append(s.Lines, l)
+	}
+	opening = roundAmount(opening, a.Currency)
+	s.Opening = &MT940Balance{Mark: mark(opening), Date: from, Amount: math.Abs(opening)}
+	s.Closing = &MT940Balance{Mark: mark(closing), Date: to, Amount: math.Abs(closing)}
+	return s
+}
+
+// mt940Type is the transaction type identification code of the event.
+func mt940Type(e *Event) string {
+	switch {
+	case e.Type == BalanceChanged && e.Counterparty != 0:
+		return "TRF"
+	case e.Type == FeePosted:
+		return "CHG"
+	case e.Type == InterestCredited:
+		return "INT"
+	}
+	return "MSC"
+}
@@ -0,0 +1,356 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the records of NACHA files are 94 characters, in blocks of 10 records.
+	nachaRecordLength   = 94
+	nachaBlockingFactor = 10
+
+	// the service class codes of batches.
+	NACHAMixed   = "200"
+	NACHACredits = "220"
+	NACHADebits  = "225"
+
+	// nachaReturnAddenda is the addenda type code of returns.
+	nachaReturnAddenda = "99"
+)
+
+// NACHAFile is an ACH file. Destination and Origin are the routing numbers of the receiving point and the bank.
+type NACHAFile struct {
+	Destination     string
+	Origin          string
+	DestinationName string
+	OriginName      string
+	CreatedAt       time.Time
+	IDModifier      string
+	Batches         []*NACHABatch
+}
+
+// NACHABatch is a batch of entries of a company. ODFI is the first 8 digits of the routing number of the bank.
+type NACHABatch struct {
+	ServiceClass     string
+	CompanyName      string
+	CompanyID        string
+	SEC              string
+	EntryDescription string
+	EffectiveDate    time.Time
+	ODFI             string
+	Number           int
+	Entries          []*NACHAEntry
+}
+
+// NACHAEntry is an entry detail record. RDFI is the routing number of the receiving bank with the check digit,
+// and Amount is in cents. Return is the addenda of a returned entry.
+type NACHAEntry struct {
+	TransactionCode string
+	RDFI            string
+	Account         string
+	Amount          int64
+	IndividualID    string
+	Name            string
+	Trace           string
+	Return          *NACHAReturn
+}
+
+// NACHAReturn is the addenda record of a return. OriginalTrace is the trace number of the returned entry.
+type NACHAReturn struct {
+	Reason        string
+	OriginalTrace string
+	OriginalRDFI  string
+	Information   string
+}
+
+// nachaText is the text in upper case. accents are dropped and other characters are replaced as in MT940.
+func nachaText(s string) string {
+	return strings.ToUpper(mt940Text(s))
+}
+
+// nachaAlpha left-justifies the text in n characters.
+func nachaAlpha(s string, n int) string {
+	s = nachaText(s)
+	if len(s) > n {
+		return s[:n]
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// nachaNumeric right-justifies the number with zeros in n digits.
+func nachaNumeric(v int64, n int) (string, error) {
+	s := strconv.FormatInt(v, 10)
+	if v < 0 || len(s) > n {
+		return "", fmt.Errorf("%v does not fit %v digits of NACHA", v, n)
+	}
+	return strings.Repeat("0", n-len(s)) + s, nil
+}
+
+// nachaEntryHash is the sum of the 8 digit routing numbers of the receiving banks, which is cut to the last 10 digits.
+func nachaEntryHash(es []*NACHAEntry) int64 {
+	var sum int64
+	for _, e := range es {
+		rdfi, _ := strconv.ParseInt(e.RDFI[:8], 10, 64)
+		sum += rdfi
+	}
+	return sum % 10000000000
+}
+
+// nachaTotals returns the sums of the debits and the credits of the entries in cents.
+// the second digit of a transaction code is 5 to 9 for debits and 0 to 4 for credits.
+func nachaTotals(es []*NACHAEntry) (int64, int64) {
+	var debit, credit int64
+	for _, e := range es {
+		if e.TransactionCode[1] >= '5' {
+			debit += e.Amount
+		} else {
+			credit += e.Amount
+		}
+	}
+	return debit, credit
+}
+
+// EncodeNACHA renders the file with the batch and file control records. the file is padded with records of 9 to a block.
+func EncodeNACHA(f *NACHAFile) ([]byte, error) {
+	records := []string{}
+	var err error
+	field := func(v int64, n int) string {
+		s, e := nachaNumeric(v, n)
+		if e != nil && err == nil {
+			err = e
+		}
+		return s
+	}
+	for _, r := range []string{f.Destination, f.Origin} {
+		if err := checkRouting(r); err != nil {
+			return nil, err
+		}
+	}
+
+	records = append(records, "101 "+f.Destination+" "+f.Origin+f.CreatedAt.Format("0601021504")+nachaAlpha(f.IDModifier, 1)+"094101"+
+		nachaAlpha(f.DestinationName, 23)+nachaAlpha(f.OriginName, 23)+nachaAlpha("", 8))
+
+	count := 0
+	all := []*NACHAEntry{}
+	for _, b := range f.Batches {
+		records = append(records, "5"+b.ServiceClass+nachaAlpha(b.CompanyName, 16)+nachaAlpha("", 20)+nachaAlpha(b.CompanyID, 10)+nachaAlpha(b.SEC, 3)+
+			nachaAlpha(b.EntryDescription, 10)+b.EffectiveDate.Format("060102")+b.EffectiveDate.Format("060102")+"   1"+b.ODFI+field(int64(b.Number), 7))
+		addenda := 0
+		for _, e := range b.Entries {
+			if err := checkRouting(e.RDFI); err != nil {
+				return nil, err
+			}
+			indicator := "0"
+			if e.Return != nil {
+				indicator = "1"
+			}
+			records = append(records, "6"+e.TransactionCode+e.RDFI+nachaAlpha(e.Account, 17)+field(e.Amount, 10)+nachaAlpha(e.IndividualID, 15)+
+				nachaAlpha(e.Name, 22)+"  "+indicator+nachaAlpha(e.Trace, 15))
+			if r := e.Return; r != nil {
+				records = append(records, "7"+nachaReturnAddenda+nachaAlpha(r.Reason, 3)+nachaAlpha(r.OriginalTrace, 15)+nachaAlpha("", 6)+
+					nachaAlpha(r.OriginalRDFI, 8)+nachaAlpha(r.Information, 44)+nachaAlpha(e.Trace, 15))
+				addenda++
+			}
+		}
+		debit, credit := nachaTotals(b.Entries)
+		records = append(records, "8"+b.ServiceClass+field(int64(len(b.Entries)+addenda), 6)+field(nachaEntryHash(b.Entries), 10)+
+			field(debit, 12)+field(credit, 12)+nachaAlpha(b.CompanyID, 10)+nachaAlpha("", 25)+b.ODFI+field(int64(b.Number), 7))
+		count += len(b.Entries) + addenda
+		all = append(all, b.Entries...)
+	}
+
+	blocks := (len(records) + 1 + nachaBlockingFactor - 1) / nachaBlockingFactor
+	debit, credit := nachaTotals(all)
+	records = append(records, "9"+field(int64(len(f.Batches)), 6)+field(int64(blocks), 6)+field(int64(count), 8)+
+		field(nachaEntryHash(all), 10)+field(debit, 12)+field(credit, 12)+nachaAlpha("", 39))
+	for len(records)%nachaBlockingFactor != 0 {
+		records = append(records, strings.Repeat("9", nachaRecordLength))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		if len(r) != nachaRecordLength {
+			return nil, fmt.Errorf("record %q is %v characters, not %v", r, len(r), nachaRecordLength)
+		}
+		buf.WriteString(r)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseNACHA reads a file and checks the lengths and the order of the records, and the batch and file control totals.
+// the padding records of 9 are skipped.
+func ParseNACHA(data []byte) (*NACHAFile, error) {
+	f := &NACHAFile{}
+	var batch *NACHABatch
+	var entry *NACHAEntry
+	var all []*NACHAEntry
+	count, closed := 0, false
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	n := 0
+	for s.Scan() {
+		n++
+		r := strings.TrimRight(s.Text(), "\r")
+		if r == "" {
+			continue
+		}
+		if len(r) != nachaRecordLength {
+			return nil, fmt.Errorf("record %v is %v characters, not %v", n, len(r), nachaRecordLength)
+		}
+		if closed {
+			if r != strings.Repeat("9", nachaRecordLength) {
+				return nil, fmt.Errorf("record %v is after the file control record", n)
+			}
+			continue
+		}
+		unexpected := fmt.Errorf("record %v of type %v is out of order", n, r[:1])
+
+		switch r[0] {
+		case '1':
+			if n != 1 {
+				return nil, unexpected
+			}
+			f.Destination = strings.TrimSpace(r[3:13])
+			f.Origin = strings.TrimSpace(r[13:23])
+			at, err := time.Parse("0601021504", r[23:33])
+			if err != nil {
+				return nil, fmt.Errorf("creation date of record %v is wrong: %v", n, err)
+			}
+			f.CreatedAt = at
+			f.IDModifier = r[33:34]
+			f.DestinationName = strings.TrimSpace(r[40:63])
+			f.OriginName = strings.TrimSpace(r[63:86])
+		case '5':
+			if n == 1 || batch != nil {
+				return nil, unexpected
+			}
+			batch = &NACHABatch{
+				ServiceClass:     r[1:4],
+				CompanyName:      strings.TrimSpace(r[4:20]),
+				CompanyID:        strings.TrimSpace(r[40:50]),
+				SEC:              r[50:53],
+				EntryDescription: strings.TrimSpace(r[53:63]),
+				ODFI:             r[79:87],
+			}
+			batch.EffectiveDate, _ = time.Parse("060102", r[69:75])
+			batch.Number, _ = strconv.Atoi(r[87:94])
+			f.Batches = append(f.Batches, batch)
+		case '6':
+			if batch == nil {
+				return nil, unexpected
+			}
+			amount, err := strconv.ParseInt(r[29:39], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("amount of record %v is not a number: %q", n, r[29:39])
+			}
+			entry = &NACHAEntry{
+				TransactionCode: r[1:3],
+				RDFI:            r[3:12],
+				Account:         strings.TrimSpace(r[12:29]),
+				Amount:          amount,
+				IndividualID:    strings.TrimSpace(r[39:54]),
+				Name:            strings.TrimSpace(r[54:76]),
+				Trace:           r[79:94],
+			}
+			batch.Entries = append(batch.Entries, entry)
+			count++
+		case '7':
+			if entry == nil || entry.Return != nil {
+				return nil, unexpected
+			}
+			if r[1:3] == nachaReturnAddenda {
+				entry.Return = &NACHAReturn{
+					Reason:        r[3:6],
+					OriginalTrace: r[6:21],
+					OriginalRDFI:  r[27:35],
+					Information:   strings.TrimSpace(r[35:79]),
+				}
+			}
+			count++
+		case '8':
+			if batch == nil {
+				return nil, unexpected
+			}
+			err := checkNACHAControl(fmt.Sprintf("batch %v", batch.Number), r[4:10], r[10:20], r[20:32], r[32:44], batch.Entries, len(batch.Entries)+addendaCount(batch.Entries))
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, batch.Entries...)
+			batch, entry = nil, nil
+		case '9':
+			if batch != nil || n == 1 {
+				return nil, unexpected
+			}
+			if batches, _ := strconv.Atoi(r[1:7]); batches != len(f.Batches) {
+				return nil, fmt.Errorf("file control has %v batches, but there are %v", r[1:7], len(f.Batches))
+			}
+			err := checkNACHAControl("file", r[13:21], r[21:31], r[31:43], r[43:55], all, count)
+			if err != nil {
+				return nil, err
+			}
+			closed = true
+		default:
+			return nil, fmt.Errorf("record %v has unknown type %q", n, r[:1])
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, fmt.Errorf("file control record is missing")
+	}
+	return f, nil
+}
+
+func addendaCount(es []*NACHAEntry) int {
+	n := 0
+	for _, e := range es {
+		if e.Return != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// checkNACHAControl compares the count, the entry hash and the totals of a control record with the entries.
+func checkNACHAControl(scope string, count string, hash string, debit string, credit string, es []*NACHAEntry, records int) error {
+	wantDebit, wantCredit := nachaTotals(es)
+	for _, c := range []struct {
+		name string
+		got  string
+		want int64
+	}{{"entry and addenda count", count, int64(records)}, {"entry hash", hash, nachaEntryHash(es)}, {"total debit", debit, wantDebit}, {"total credit", credit, wantCredit}} {
+		v, err := strconv.ParseInt(c.got, 10, 64)
+		if err != nil || v != c.want {
+			return fmt.Errorf("%v of %v control is %v, but the entries make %v", c.name, scope, c.got, c.want)
+		}
+	}
+	return nil
+}
+
+// checkRouting checks the 9 digit routing number by its check digit, whose weights are 3, 7 and 1.
+func checkRouting(r string) error {
+	if len(r) != 9 {
+		return fmt.Errorf("routing number %q is not 9 digits", r)
+	}
+	sum := 0
+	for i, c := range r {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("routing number %q is not 9 digits", r)
+		}
+		sum += int(c-'0') * []int{3, 7, 1}[i%3]
+	}
+	if sum%10 != 0 {
+		return fmt.Errorf("check digit of routing number %v is wrong", r)
+	}
+	return nil
+}
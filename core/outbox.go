@@ -0,0 +1,197 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	AccountCreated   = "AccountCreated"
+	FundsDeposited   = "FundsDeposited"
+	FundsWithdrawn   = "FundsWithdrawn"
+	FundsTransferred = "FundsTransferred"
+	AccountDeleted   = "AccountDeleted"
+)
+
+// domainEvents are the types of every domain event written to the outbox.
+var domainEvents = map[string]bool{
+	AccountCreated:           true,
+	AccountDeleted:           true,
+	CardAuthorized:           true,
+	CardIssued:               true,
+	CardPaymentClosed:        true,
+	FeeCharged:               true,
+	FundsDeposited:           true,
+	FundsTransferred:         true,
+	FundsWithdrawn:           true,
+	InterestPosted:           true,
+	LoanClosed:               true,
+	LoanDisbursed:            true,
+	LoanInstallmentOverdue:   true,
+	LoanRepaid:               true,
+	OverdraftInterestCharged: true,
+	TermDepositClosed:        true,
+	TermDepositOpened:        true,
+	TermDepositRenewed:       true,
+	TransferReversed:         true,
+}
+
+// DomainEvent is an event written to the outbox table.
+type DomainEvent struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	Account int             `json:"account"`
+	Payload json.RawMessage `json:"payload"`
+	At      time.Time       `json:"at"`
+}
+
+// Funds is the payload of FundsDeposited and FundsWithdrawn.
+type Funds struct {
+	Account int     `json:"account"`
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"`
+}
+
+// FundsTransfer is the payload of FundsTransferred.
+// Credited, CreditedCurrency and Rate are set when the amount is converted into the currency of To.
+type FundsTransfer struct {
+	ID               int64   `json:"id"`
+	From             int     `json:"from"`
+	To               int     `json:"to"`
+	Amount           float64 `json:"amount"`
+	Currency         string  `json:"currency"`
+	Credited         float64 `json:"credited,omitempty"`
+	CreditedCurrency string  `json:"credited_currency,omitempty"`
+	Rate             float64 `json:"rate,omitempty"`
+}
+
+// OutboxHandler delivers a domain event. an event is delivered again when the handler returns an error.
+type OutboxHandler func(e *DomainEvent) error
+
+// outboxLock is the key of the advisory lock which lets only one relay run at a time.
+const outboxLock = 20231001
+
+// enqueue writes a domain event into the outbox in the transaction of the change.
+func (nb *netBank) enqueue(tx *sql.Tx, class string, num int, payload any) error {
+	bs, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	q := `
+	INSERT INTO outbox (account_id, event, payload)
+	VALUES ($1, $2, $3);
+	`
+	_, err = tx.ExecContext(context.Background(), q, num, class, string(bs))
+	return err
+}
+
+// RelayOutbox delivers at most limit undelivered events to h in the order they were written.
+// when h fails on an event, the later events of the same account are not delivered in this round
+// to keep the order per account. it returns the number of delivered events.
+func (nb *netBank) RelayOutbox(h OutboxHandler, limit int) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", outboxLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		// another relay is running.
+		return 0, nil
+	}
+
+	q := `
+	SELECT id, event, account_id, payload, created_at
+	FROM outbox
+	WHERE delivered_at IS NULL
+	ORDER BY id
+	LIMIT $1;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	es := []*DomainEvent{}
+	for rows.Next() {
+		e := &DomainEvent{}
+		var payload string
+		err := rows.Scan(&e.ID, &e.Type, &e.Account, &payload, &e.At)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		e.Payload = json.RawMessage(payload)
+		es = append(es, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	blocked := map[int]bool{}
+	for _, e := range es {
+		if blocked[e.Account] {
+			continue
+		}
+		err := h(e)
+		if err != nil {
+			log.Printf("failed to deliver %v(ID: %v): %v", e.Type, e.ID, err)
+			blocked[e.Account] = true
+			continue
+		}
+
+		_, err = tx.ExecContext(context.Background(), "UPDATE outbox SET delivered_at=now() WHERE id=$1;", e.ID)
+		if err != nil {
+			return 0, err
+		}
+		delivered++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return delivered, nil
+}
+
+// RunOutboxRelay delivers the outbox to h every interval until ctx is done.
+func RunOutboxRelay(ctx context.Context, interval time.Duration, h OutboxHandler) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the outbox relay: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// keep relaying without waiting while the outbox is full.
+		n, err := nb.RelayOutbox(h, 100)
+		if err != nil {
+			log.Printf("failed to relay the outbox: %v", err)
+		}
+		if n == 100 && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
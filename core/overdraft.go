@@ -0,0 +1,269 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	OverdraftInterestCharged = "OverdraftInterestCharged"
+
+	overdraftLock = 20231003
+)
+
+// Overdraft lets the balance of the account go negative up to Limit.
+// Rate is the annual interest rate charged daily on the negative balance, e.g. 0.15 for 15%.
+type Overdraft struct {
+	Account   int        `json:"account"`
+	Limit     float64    `json:"limit"`
+	Rate      float64    `json:"rate"`
+	AccruedOn string     `json:"accrued_on,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// overdraftLimit returns the overdraft limit of the account, or zero when it has no overdraft.
+func overdraftLimit(tx *sql.Tx, num int) (float64, error) {
+	q := `SELECT COALESCE((SELECT limit_amount FROM overdraft WHERE account_id=$1), 0);`
+	var limit float64
+	err := tx.QueryRowContext(context.Background(), q, num).Scan(&limit)
+	if err != nil {
+		return 0, err
+	}
+	return limit, nil
+}
+
+// GetOverdraft returns the overdraft of the account. an account without overdraft has zero limit.
+func (nb *netBank) GetOverdraft(num int) (*Overdraft, error) {
+	q := `
+	SELECT a.id, COALESCE(o.limit_amount, 0), COALESCE(o.rate, 0), o.accrued_on, o.updated_at
+	FROM account a
+	LEFT JOIN overdraft o ON o.account_id=a.id
+	WHERE a.id=$1;
+	`
+	o := &Overdraft{}
+	var (
+		accruedOn sql.NullTime
+		updatedAt sql.NullTime
+	)
+	err := nb.db.QueryRowContext(context.Background(), q, num).Scan(&o.Account, &o.Limit, &o.Rate, &accruedOn, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if accruedOn.Valid {
+		o.AccruedOn = accruedOn.Time.Format(dateLayout)
+	}
+	if updatedAt.Valid {
+		o.UpdatedAt = &updatedAt.Time
+	}
+	return o, nil
+}
+
+// SetOverdraft sets the overdraft of the account by staff.
+// the interest until today is charged at the previous rate before the change.
+func (nb *netBank) SetOverdraft(num int, limit float64, rate float64) (*Overdraft, error) {
+	if limit < 0 {
+		return nil, fmt.Errorf("overdraft limit is less than zero. your input is %v", limit)
+	}
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("overdraft rate must be between 0 and 1. your input is %v", rate)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := balances[num]; !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	today := truncateDate(time.Now())
+	e, err := nb.chargeOverdraft(tx, num, today)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	INSERT INTO overdraft (account_id, limit_amount, rate, accrued_on)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (account_id) DO UPDATE
+	SET limit_amount=EXCLUDED.limit_amount, rate=EXCLUDED.rate, accrued_on=EXCLUDED.accrued_on, updated_at=now();
+	`
+	_, err = tx.ExecContext(context.Background(), q, num, limit, rate, today)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		publish(e)
+	}
+	return nb.GetOverdraft(num)
+}
+
+// chargeOverdraft charges the interest from the last accrual until today on the negative balance,
+// and returns the event to publish, or nil when nothing is charged. the account must be locked.
+func (nb *netBank) chargeOverdraft(tx *sql.Tx, num int, today time.Time) (*Event, error) {
+	q := `
+	SELECT a.balance, a.currency, o.rate, o.accrued_on
+	FROM account a
+	JOIN overdraft o ON o.account_id=a.id
+	WHERE a.id=$1;
+	`
+	var (
+		balance   float64
+		currency  string
+		rate      float64
+		accruedOn time.Time
+	)
+	err := tx.QueryRowContext(context.Background(), q, num).Scan(&balance, &currency, &rate, &accruedOn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	days := math.Round(today.Sub(truncateDate(accruedOn)).Hours() / 24)
+	if days <= 0 {
+		return nil, nil
+	}
+
+	q = `UPDATE overdraft SET accrued_on=$2 WHERE account_id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, num, today)
+	if err != nil {
+		return nil, err
+	}
+
+	// the interest is rounded to the minor unit, and the balance at the time of the charge is used for the days since the last one.
+	interest := roundAmount(-balance*rate*days/365, currency)
+	if interest <= 0 {
+		return nil, nil
+	}
+
+	q = `UPDATE account SET balance=balance-$1 WHERE id=$2;`
+	_, err = tx.ExecContext(context.Background(), q, interest, num)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := nb.record(tx, BalanceChanged, num, -interest, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, OverdraftInterestCharged, num, &Funds{Account: num, Amount: interest, Balance: e.Balance})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ChargeOverdraftInterest charges the interest of the overdrafts not accrued until the day of now,
+// and returns the number of charged accounts.
+func (nb *netBank) ChargeOverdraftInterest(now time.Time) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", overdraftLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	today := truncateDate(now)
+	q := `
+	SELECT account_id
+	FROM overdraft
+	WHERE rate>0 AND accrued_on<$1
+	ORDER BY account_id;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, today)
+	if err != nil {
+		return 0, err
+	}
+	nums := []int{}
+	for rows.Next() {
+		var num int
+		err := rows.Scan(&num)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		nums = append(nums, num)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := []*Event{}
+	for _, num := range nums {
+		_, err := lockBalances(tx, num)
+		if err != nil {
+			return 0, err
+		}
+		e, err := nb.chargeOverdraft(tx, num, today)
+		if err != nil {
+			return 0, err
+		}
+		if e != nil {
+			published = append(published, e)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	publish(published...)
+	return len(published), nil
+}
+
+// RunOverdraftInterest charges the overdraft interest every interval until ctx is done.
+func RunOverdraftInterest(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the overdraft interest: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.ChargeOverdraftInterest(time.Now())
+		if err != nil {
+			log.Printf("failed to charge overdraft interest: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
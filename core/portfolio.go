@@ -0,0 +1,48 @@
+package core
+
+// Portfolio is everything a customer holds in the bank.
+type Portfolio struct {
+	ID int `json:"id"`
+	Customer
+	Accounts     []*Account     `json:"accounts"`
+	TermDeposits []*TermDeposit `json:"term_deposits"`
+	Loans        []*Loan        `json:"loans"`
+	// Total is the balances of the accounts and the principals of the active term deposits.
+	Total float64 `json:"total"`
+	// Debt is the outstanding principal of the active loans.
+	Debt float64 `json:"debt"`
+}
+
+// GetPortfolio returns the accounts, the term deposits and the loans of the customer.
+func (nb *netBank) GetPortfolio(id int) (*Portfolio, error) {
+	// a customer has the account of the same id.
+	a, err := nb.GetAccount(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := nb.GetTermDeposits(a.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	ls, err := nb.GetLoans(a.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Portfolio{ID: id, Customer: a.Customer, Accounts: []*Account{a}, TermDeposits: ds, Loans: ls, Total: a.Balance}
+	for _, d := range ds {
+		if d.Status == DepositActive {
+			p.Total += d.Principal
+		}
+	}
+	for _, l := range ls {
+		if l.Status == LoanActive {
+			p.Debt += l.Outstanding
+		}
+	}
+	p.Total = roundAmount(p.Total, a.Currency)
+	p.Debt = roundAmount(p.Debt, a.Currency)
+	return p, nil
+}
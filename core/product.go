@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ProductChecking = "checking"
+	ProductSavings  = "savings"
+)
+
+// Product is a kind of account. InterestRate is the annual rate, e.g. 0.01 for 1%,
+// and RateTiers overrides it by the balance.
+type Product struct {
+	Code         string      `json:"code"`
+	Name         string      `json:"name"`
+	InterestRate float64     `json:"interest_rate"`
+	RateTiers    []*RateTier `json:"rate_tiers,omitempty"`
+}
+
+// RateTier is the annual rate of balances from From. the whole balance earns the rate of its tier.
+type RateTier struct {
+	From float64 `json:"from"`
+	Rate float64 `json:"rate"`
+}
+
+// rate returns the annual rate of the balance.
+func (p *Product) rate(balance float64) float64 {
+	rate := p.InterestRate
+	for _, t := range p.RateTiers {
+		if balance >= t.From {
+			rate = t.Rate
+		}
+	}
+	return rate
+}
+
+func (p *Product) validate() error {
+	if p.Code == "" {
+		return fmt.Errorf("code of product is empty")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("name of product is empty")
+	}
+	if p.InterestRate < 0 || p.InterestRate > 1 {
+		return fmt.Errorf("interest rate must be between 0 and 1. your input is %v", p.InterestRate)
+	}
+	for i, t := range p.RateTiers {
+		if t.Rate < 0 || t.Rate > 1 {
+			return fmt.Errorf("interest rate must be between 0 and 1. your input is %v", t.Rate)
+		}
+		if i > 0 && t.From <= p.RateTiers[i-1].From {
+			return fmt.Errorf("rate tiers must be in ascending order of from")
+		}
+	}
+	return nil
+}
+
+const productColumns = `code, name, interest_rate, rate_tiers`
+
+func scanProduct(row interface{ Scan(...any) error }) (*Product, error) {
+	p := &Product{}
+	var tiers []byte
+	err := row.Scan(&p.Code, &p.Name, &p.InterestRate, &tiers)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(tiers, &p.RateTiers)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (nb *netBank) GetProduct(code string) (*Product, error) {
+	q := `SELECT ` + productColumns + ` FROM product WHERE code=$1;`
+	return scanProduct(nb.db.QueryRowContext(context.Background(), q, code))
+}
+
+func (nb *netBank) GetProducts() ([]*Product, error) {
+	q := `SELECT ` + productColumns + ` FROM product ORDER BY code;`
+	rows, err := nb.db.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ps := []*Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, rows.Err()
+}
+
+// SetProduct creates or updates the product by staff. the new rates apply from the next accrual.
+func (nb *netBank) SetProduct(p *Product) (*Product, error) {
+	err := p.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	tiers, err := json.Marshal(p.RateTiers)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	INSERT INTO product (code, name, interest_rate, rate_tiers)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (code) DO UPDATE
+	SET name=EXCLUDED.name, interest_rate=EXCLUDED.interest_rate, rate_tiers=EXCLUDED.rate_tiers
+	RETURNING ` + productColumns + `;`
+	return scanProduct(nb.db.QueryRowContext(context.Background(), q, p.Code, p.Name, p.InterestRate, string(tiers)))
+}
@@ -0,0 +1,125 @@
+package rates
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File reads the rates from a CSV or JSON file every time, so that the file can be replaced while running.
+//
+// a CSV file has the rows of base,quote,rate and an optional effective_at, with or without the header.
+// a JSON file is either an array of Rate, or an object of pairs like {"USD/JPY": 150.1} effective at any time.
+type File struct {
+	Path string
+}
+
+func (f *File) Rate(base string, quote string, at time.Time) (*Rate, error) {
+	h, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return h.Rate(base, quote, at)
+}
+
+func (f *File) load() (history, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rs []*Rate
+	if strings.EqualFold(filepath.Ext(f.Path), ".csv") {
+		rs, err = readCSV(file)
+	} else {
+		rs, err = readJSON(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates in %v: %w", f.Path, err)
+	}
+	return newHistory(rs), nil
+}
+
+func readCSV(r io.Reader) ([]*Rate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := []*Rate{}
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "base") {
+			continue
+		}
+		if len(record) != 3 && len(record) != 4 {
+			return nil, fmt.Errorf("line %v has %v fields. it must be base,quote,rate[,effective_at]", i+1, len(record))
+		}
+		rate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %v has %v as rate", i+1, record[2])
+		}
+		r := &Rate{Base: strings.ToUpper(record[0]), Quote: strings.ToUpper(record[1]), Rate: rate}
+		if len(record) == 4 && record[3] != "" {
+			r.EffectiveAt, err = parseTime(record[3])
+			if err != nil {
+				return nil, fmt.Errorf("line %v has %v as effective_at", i+1, record[3])
+			}
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func readJSON(r io.Reader) ([]*Rate, error) {
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := []*Rate{}
+	if strings.HasPrefix(strings.TrimSpace(string(bs)), "[") {
+		err = json.Unmarshal(bs, &rs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		pairs := map[string]float64{}
+		err = json.Unmarshal(bs, &pairs)
+		if err != nil {
+			return nil, err
+		}
+		for pair, rate := range pairs {
+			base, quote, ok := strings.Cut(pair, "/")
+			if !ok {
+				return nil, fmt.Errorf("got %v as pair. it must be like USD/JPY", pair)
+			}
+			rs = append(rs, &Rate{Base: base, Quote: quote, Rate: rate})
+		}
+	}
+
+	for _, r := range rs {
+		if r.Rate <= 0 {
+			return nil, fmt.Errorf("rate of %v/%v is %v", r.Base, r.Quote, r.Rate)
+		}
+	}
+	return rs, nil
+}
+
+// parseTime accepts RFC 3339 and a date, which is the beginning of the day in UTC.
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -0,0 +1,82 @@
+// Package rates provides the exchange rates used to convert money between currencies.
+// a rate has a time from which it is effective, and providers keep the past rates as history.
+package rates
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrNoRate is matched by errors.Is() when no rate of the pair is effective at the time.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rate is a mid rate effective from EffectiveAt. one Base is Rate of Quote.
+type Rate struct {
+	Base        string    `json:"base"`
+	Quote       string    `json:"quote"`
+	Rate        float64   `json:"rate"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+// Provider gives the mid rate of the pair effective at the time.
+// the inverse of the opposite pair is given when only it is known.
+type Provider interface {
+	Rate(base string, quote string, at time.Time) (*Rate, error)
+}
+
+func noRate(base string, quote string) error {
+	return fmt.Errorf("%w from %v to %v", ErrNoRate, base, quote)
+}
+
+func (r *Rate) inverse() *Rate {
+	return &Rate{Base: r.Quote, Quote: r.Base, Rate: 1 / r.Rate, EffectiveAt: r.EffectiveAt}
+}
+
+// history is the rates of all pairs ordered by the effective time.
+type history []*Rate
+
+func newHistory(rs []*Rate) history {
+	h := make(history, len(rs))
+	copy(h, rs)
+	sort.SliceStable(h, func(i, j int) bool { return h[i].EffectiveAt.Before(h[j].EffectiveAt) })
+	return h
+}
+
+// latest returns the last rate of the pair effective at the time, or nil.
+func (h history) latest(base string, quote string, at time.Time) *Rate {
+	var found *Rate
+	for _, r := range h {
+		if r.EffectiveAt.After(at) {
+			break
+		}
+		if r.Base == base && r.Quote == quote {
+			found = r
+		}
+	}
+	return found
+}
+
+func (h history) Rate(base string, quote string, at time.Time) (*Rate, error) {
+	if r := h.latest(base, quote, at); r != nil {
+		return r, nil
+	}
+	if r := h.latest(quote, base, at); r != nil {
+		return r.inverse(), nil
+	}
+	return nil, noRate(base, quote)
+}
+
+// Fixed gives the same rates at any time. it is keyed by pairs like "USD/JPY", and is meant for tests.
+type Fixed map[string]float64
+
+func (f Fixed) Rate(base string, quote string, at time.Time) (*Rate, error) {
+	if rate, ok := f[base+"/"+quote]; ok && rate > 0 {
+		return &Rate{Base: base, Quote: quote, Rate: rate}, nil
+	}
+	if rate, ok := f[quote+"/"+base]; ok && rate > 0 {
+		return (&Rate{Base: quote, Quote: base, Rate: rate}).inverse(), nil
+	}
+	return nil, noRate(base, quote)
+}
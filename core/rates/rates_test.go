@@ -0,0 +1,78 @@
+package rates
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFixed(t *testing.T) {
+	p := Fixed{"USD/JPY": 150}
+
+	r, err := p.Rate("USD", "JPY", time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, float64(150), r.Rate)
+
+	r, err = p.Rate("JPY", "USD", time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, "JPY", r.Base)
+	assert.Equal(t, 1/float64(150), r.Rate)
+
+	_, err = p.Rate("USD", "EUR", time.Now())
+	assert.Assert(t, errors.Is(err, ErrNoRate))
+	assert.Error(t, err, "no exchange rate from USD to EUR")
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	type fixture struct {
+		name    string
+		path    string
+		at      time.Time
+		base    string
+		quote   string
+		rate    float64
+		wantErr string
+	}
+
+	csv := write("rates.csv", "base,quote,rate,effective_at\nUSD,JPY,140,2023-01-01\nUSD,JPY,150,2023-07-01T09:00:00Z\neur,usd,1.1\n")
+	json := write("rates.json", `[{"base":"USD","quote":"JPY","rate":140,"effective_at":"2023-01-01T00:00:00Z"},{"base":"USD","quote":"JPY","rate":150,"effective_at":"2023-07-01T09:00:00Z"}]`)
+	pairs := write("pairs.json", `{"USD/JPY": 150.1}`)
+	broken := write("broken.csv", "USD,JPY,abc\n")
+
+	fs := make([]*fixture, 8)
+	fs[0] = &fixture{"csv before the new rate", csv, time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC), "USD", "JPY", 140, ""}
+	fs[1] = &fixture{"csv after the new rate", csv, time.Date(2023, 7, 1, 9, 0, 0, 0, time.UTC), "USD", "JPY", 150, ""}
+	fs[2] = &fixture{"csv before any rate", csv, time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC), "USD", "JPY", 0, "no exchange rate from USD to JPY"}
+	fs[3] = &fixture{"csv inverse without effective_at", csv, time.Now(), "USD", "EUR", 1 / 1.1, ""}
+	fs[4] = &fixture{"json history", json, time.Date(2023, 6, 30, 0, 0, 0, 0, time.UTC), "USD", "JPY", 140, ""}
+	fs[5] = &fixture{"json pairs", pairs, time.Now(), "JPY", "USD", 1 / 150.1, ""}
+	fs[6] = &fixture{"broken csv", broken, time.Now(), "USD", "JPY", 0, "failed to read exchange rates in " + broken + ": line 1 has abc as rate"}
+	fs[7] = &fixture{"missing file", filepath.Join(dir, "missing.json"), time.Now(), "USD", "JPY", 0, "open " + filepath.Join(dir, "missing.json") + ": no such file or directory"}
+
+	for _, f := range fs {
+		t.Run(f.name, func(t *testing.T) {
+			r, err := (&File{Path: f.path}).Rate(f.base, f.quote, f.at)
+			if f.wantErr != "" {
+				assert.Error(t, err, f.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, math.Abs(r.Rate-f.rate) < 1e-12, "got %v", r.Rate)
+		})
+	}
+}
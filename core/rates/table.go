@@ -0,0 +1,104 @@
+package rates
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Table reads the rates maintained by staff in the fx_rate table. a new rate is added to the history
+// instead of overwriting the old one, so that a rate effective at any past time can be found.
+type Table struct {
+	DB *sql.DB
+}
+
+const columns = `base, quote, rate, effective_at`
+
+func scanRate(row interface{ Scan(...any) error }) (*Rate, error) {
+	r := &Rate{}
+	err := row.Scan(&r.Base, &r.Quote, &r.Rate, &r.EffectiveAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (t *Table) Rate(base string, quote string, at time.Time) (*Rate, error) {
+	q := `
+	SELECT ` + columns + ` FROM fx_rate
+	WHERE base=$1 AND quote=$2 AND effective_at<=$3
+	ORDER BY effective_at DESC
+	LIMIT 1;
+	`
+	r, err := scanRate(t.DB.QueryRowContext(context.Background(), q, base, quote, at))
+	if err == nil {
+		return r, nil
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	r, err = scanRate(t.DB.QueryRowContext(context.Background(), q, quote, base, at))
+	if err == sql.ErrNoRows {
+		return nil, noRate(base, quote)
+	} else if err != nil {
+		return nil, err
+	}
+	return r.inverse(), nil
+}
+
+// Set adds the rate to the history. zero EffectiveAt is now, and a rate at the same time is replaced.
+func (t *Table) Set(r *Rate) (*Rate, error) {
+	if r.Base == r.Quote {
+		return nil, fmt.Errorf("base and quote of exchange rate are the same %v", r.Base)
+	}
+	if r.Rate <= 0 {
+		return nil, fmt.Errorf("exchange rate is less than zero. your input is %v", r.Rate)
+	}
+	at := r.EffectiveAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	q := `
+	INSERT INTO fx_rate (base, quote, rate, effective_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (base, quote, effective_at) DO UPDATE
+	SET rate=EXCLUDED.rate
+	RETURNING ` + columns + `;`
+	return scanRate(t.DB.QueryRowContext(context.Background(), q, r.Base, r.Quote, r.Rate, at))
+}
+
+// Current returns the rate of every pair effective at the time.
+func (t *Table) Current(at time.Time) ([]*Rate, error) {
+	q := `
+	SELECT DISTINCT ON (base, quote) ` + columns + ` FROM fx_rate
+	WHERE effective_at<=$1
+	ORDER BY base, quote, effective_at DESC;
+	`
+	return t.query(q, at)
+}
+
+// History returns the rates of the pair from the newest, including the ones effective in the future.
+func (t *Table) History(base string, quote string) ([]*Rate, error) {
+	q := `SELECT ` + columns + ` FROM fx_rate WHERE base=$1 AND quote=$2 ORDER BY effective_at DESC;`
+	return t.query(q, base, quote)
+}
+
+func (t *Table) query(q string, args ...any) ([]*Rate, error) {
+	rows, err := t.DB.QueryContext(context.Background(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rs := []*Rate{}
+	for rows.Next() {
+		r, err := scanRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
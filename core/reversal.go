@@ -0,0 +1,349 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	ReversalPending   = "pending"
+	ReversalCompleted = "completed"
+	ReversalRejected  = "rejected"
+
+	TransferReversed = "TransferReversed"
+
+	// reversals above this amount need staff approval unless REVERSAL_APPROVAL_THRESHOLD is set.
+	defaultReversalThreshold = 10000
+)
+
+// ErrReversalNotPending is matched by errors.Is() when a reversal is already approved or rejected.
+var ErrReversalNotPending = errors.New("reversal is not pending")
+
+// TransferRecord is a record of money moved by Transfer().
+// a reversal is also a transfer, which refers to the original by ReversalOf.
+type TransferRecord struct {
+	ID       int64   `json:"id"`
+	From     int     `json:"from"`
+	To       int     `json:"to"`
+	Amount   float64 `json:"amount"`
+	Refunded float64 `json:"refunded"`
+	Currency string  `json:"currency"`
+	// Credited, CreditedCurrency and Rate are set when the amount was converted into the currency of To.
+	Credited         float64     `json:"credited,omitempty"`
+	CreditedCurrency string      `json:"credited_currency,omitempty"`
+	Rate             float64     `json:"rate,omitempty"`
+	ReversalOf       int64       `json:"reversal_of,omitempty"`
+	Reversals        []*Reversal `json:"reversals,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+// Reversal moves the amount of a transfer back to the sender.
+// Transfer is the original and Refund is the transfer which moved the money back.
+type Reversal struct {
+	ID        int64      `json:"id"`
+	Transfer  int64      `json:"transfer"`
+	Amount    float64    `json:"amount"`
+	Reason    string     `json:"reason,omitempty"`
+	Status    string     `json:"status"`
+	Refund    int64      `json:"refund,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+func reversalThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("REVERSAL_APPROVAL_THRESHOLD"), 64)
+	if err != nil {
+		return defaultReversalThreshold
+	}
+	return threshold
+}
+
+const transferColumns = `id, sender, reciever, amount, refunded, currency, COALESCE(credited, 0), COALESCE(credited_currency, ''), COALESCE(rate, 0), COALESCE(reversal_of, 0), created_at`
+
+func scanTransfer(row interface{ Scan(...any) error }) (*TransferRecord, error) {
+	t := &TransferRecord{}
+	err := row.Scan(&t.ID, &t.From, &t.To, &t.Amount, &t.Refunded, &t.Currency, &t.Credited, &t.CreditedCurrency, &t.Rate, &t.ReversalOf, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+const reversalColumns = `id, transfer_id, amount, reason, status, COALESCE(refund_id, 0), created_at, decided_at`
+
+func scanReversal(row interface{ Scan(...any) error }) (*Reversal, error) {
+	r := &Reversal{}
+	var decidedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.Transfer, &r.Amount, &r.Reason, &r.Status, &r.Refund, &r.CreatedAt, &decidedAt)
+	if err != nil {
+		return nil, err
+	}
+	if decidedAt.Valid {
+		r.DecidedAt = &decidedAt.Time
+	}
+	return r, nil
+}
+
+// GetTransfer returns the transfer with its reversals.
+func (nb *netBank) GetTransfer(id int64) (*TransferRecord, error) {
+	q := `SELECT ` + transferColumns + ` FROM transfer WHERE id=$1;`
+	t, err := scanTransfer(nb.db.QueryRowContext(context.Background(), q, id))
+	if err != nil {
+		return nil, err
+	}
+
+	q = `SELECT ` + reversalColumns + ` FROM reversal WHERE transfer_id=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanReversal(rows)
+		if err != nil {
+			return nil, err
+		}
+		t.Reversals = append(t.Reversals, r)
+	}
+	return t, rows.Err()
+}
+
+// GetTransfers returns the transfers sent or recieved by the account, newest first.
+func (nb *netBank) GetTransfers(num int) ([]*TransferRecord, error) {
+	q := `SELECT ` + transferColumns + ` FROM transfer WHERE sender=$1 OR reciever=$1 ORDER BY id DESC;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ts := []*TransferRecord{}
+	for rows.Next() {
+		t, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, rows.Err()
+}
+
+// ReverseTransfer moves the amount of the transfer back to the sender. zero amount reverses the rest of the transfer.
+// a reversal above the threshold waits for staff approval with ApproveReversal(). a transfer with a clearing account
+// of the bank is paid to another bank, so it is reversed only by the returns of the other bank.
+func (nb *netBank) ReverseTransfer(id int64, amount float64, reason string) (*Reversal, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	r, es, err := nb.reverseTransfer(tx, id, amount, reason, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return r, nil
+}
+
+// reverseTransfer is ReverseTransfer() in the transaction. the events are published by the caller after commit.
+// bySettlement is true only for the returns of other banks, which may reverse transfers with the clearing accounts.
+func (nb *netBank) reverseTransfer(tx *sql.Tx, id int64, amount float64, reason string, bySettlement bool) (*Reversal, []*Event, error) {
+	q := `SELECT ` + transferColumns + ` FROM transfer WHERE id=$1 FOR UPDATE;`
+	t, err := scanTransfer(tx.QueryRowContext(context.Background(), q, id))
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.ReversalOf != 0 {
+		return nil, nil, fmt.Errorf("transfer(ID: %v) is a reversal of transfer(ID: %v) and cannot be reversed", id, t.ReversalOf)
+	}
+	// the money in a clearing account is still paid to the other bank, so a refund from it would be paid twice.
+	if !bySettlement && (t.From < 0 || t.To < 0) {
+		return nil, nil, fmt.Errorf("transfer(ID: %v) is with another bank and is reversed only by its return", id)
+	}
+	// pending reversals are counted so that approvals cannot refund more than the transfer.
+	var pending float64
+	q = `SELECT COALESCE(SUM(amount), 0) FROM reversal WHERE transfer_id=$1 AND status=$2;`
+	err = tx.QueryRowContext(context.Background(), q, id, ReversalPending).Scan(&pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	rest := t.Amount - t.Refunded - pending
+	if rest <= 0 {
+		return nil, nil, fmt.Errorf("transfer(ID: %v) is already reversed", id)
+	}
+	if amount == 0 {
+		amount = rest
+	}
+	if amount < 0 || amount > rest {
+		return nil, nil, fmt.Errorf("amount of reversal must be between 0 and %v. your input is %v", rest, amount)
+	}
+
+	q = `
+	INSERT INTO reversal (transfer_id, amount, reason, status)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + reversalColumns + `;`
+	r, err := scanReversal(tx.QueryRowContext(context.Background(), q, id, amount, reason, ReversalPending))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var es []*Event
+	if amount <= reversalThreshold() {
+		r, es, err = nb.completeReversal(tx, t, r)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return r, es, nil
+}
+
+// ApproveReversal completes a pending reversal by staff.
+func (nb *netBank) ApproveReversal(id int64) (*Reversal, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	r, err := lockPendingReversal(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + transferColumns + ` FROM transfer WHERE id=$1 FOR UPDATE;`
+	t, err := scanTransfer(tx.QueryRowContext(context.Background(), q, r.Transfer))
+	if err != nil {
+		return nil, err
+	}
+
+	r, es, err := nb.completeReversal(tx, t, r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return r, nil
+}
+
+// RejectReversal rejects a pending reversal by staff.
+func (nb *netBank) RejectReversal(id int64) (*Reversal, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = lockPendingReversal(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	UPDATE reversal
+	SET status=$2, decided_at=now()
+	WHERE id=$1
+	RETURNING ` + reversalColumns + `;`
+	r, err := scanReversal(tx.QueryRowContext(context.Background(), q, id, ReversalRejected))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetPendingReversals returns the reversals waiting for staff approval.
+func (nb *netBank) GetPendingReversals() ([]*Reversal, error) {
+	q := `SELECT ` + reversalColumns + ` FROM reversal WHERE status=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, ReversalPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rs := []*Reversal{}
+	for rows.Next() {
+		r, err := scanReversal(rows)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+func lockPendingReversal(tx *sql.Tx, id int64) (*Reversal, error) {
+	q := `SELECT ` + reversalColumns + ` FROM reversal WHERE id=$1 FOR UPDATE;`
+	r, err := scanReversal(tx.QueryRowContext(context.Background(), q, id))
+	if err != nil {
+		return nil, err
+	}
+	if r.Status != ReversalPending {
+		return nil, fmt.Errorf("reversal(ID: %v) is already %v: %w", id, r.Status, ErrReversalNotPending)
+	}
+	return r, nil
+}
+
+// completeReversal moves the money back and links the refund and the original both ways.
+// the amount of a reversal is in the currency of the sender, and a converted transfer is refunded at its own rate,
+// so the reciever gives back the part of what was credited and the sender gets back the amount of the reversal.
+func (nb *netBank) completeReversal(tx *sql.Tx, t *TransferRecord, r *Reversal) (*Reversal, []*Event, error) {
+	money := r.Amount
+	var fixed *conversion
+	if t.CreditedCurrency != "" {
+		money = roundAmount(t.Credited*r.Amount/t.Amount, t.CreditedCurrency)
+		fixed = &conversion{credited: r.Amount, rate: 1 / t.Rate}
+	}
+
+	// a refund is not spent by the reciever, so neither the limits nor the fee apply.
+	refund, es, err := nb.moveFundsAt(tx, t.To, t.From, money, false, "", fixed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q := `UPDATE transfer SET reversal_of=$2 WHERE id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, refund, t.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	q = `UPDATE transfer SET refunded=refunded+$2 WHERE id=$1;`
+	_, err = tx.ExecContext(context.Background(), q, t.ID, r.Amount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q = `
+	UPDATE reversal
+	SET status=$2, refund_id=$3, decided_at=now()
+	WHERE id=$1
+	RETURNING ` + reversalColumns + `;`
+	r, err = scanReversal(tx.QueryRowContext(context.Background(), q, r.ID, ReversalCompleted, refund))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = nb.enqueue(tx, TransferReversed, t.From, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, es, nil
+}
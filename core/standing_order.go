@@ -0,0 +1,423 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OrderActive    = "active"
+	OrderCancelled = "cancelled"
+	OrderFinished  = "finished"
+
+	RunSucceeded = "succeeded"
+	RunRetrying  = "retrying"
+	RunFailed    = "failed"
+
+	dateLayout = "2006-01-02"
+
+	// standingOrderLock is the key of the advisory lock which lets only one scheduler run at a time.
+	standingOrderLock = 20231002
+)
+
+// StandingOrder transfers the amount from an account to another on every due date of the schedule.
+// the schedule is "daily", "weekly:<weekday>" (0 is Sunday) or "monthly:<day>".
+// when the day of a monthly order doesn't exist in a month, it is due on the last day of the month.
+// a failure by insufficient funds is retried Retries times every RetryHours hours.
+type StandingOrder struct {
+	ID         int        `json:"id"`
+	From       int        `json:"from"`
+	To         AccountRef `json:"to"`
+	Amount     float64    `json:"amount"`
+	Schedule   string     `json:"schedule"`
+	Start      string     `json:"start"`
+	End        string     `json:"end,omitempty"`
+	NextRun    string     `json:"next_run"`
+	Retries    int        `json:"retries"`
+	RetryHours int        `json:"retry_hours"`
+	Status     string     `json:"status"`
+}
+
+// StandingOrderRun is the outcome of an execution of a standing order.
+type StandingOrderRun struct {
+	ID      int64     `json:"id"`
+	Order   int       `json:"order"`
+	DueDate string    `json:"due_date"`
+	Attempt int       `json:"attempt"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	RunAt   time.Time `json:"run_at"`
+}
+
+// Schedule is a parsed schedule rule of a standing order.
+type Schedule struct {
+	Period string
+	Day    int
+}
+
+func ParseSchedule(rule string) (*Schedule, error) {
+	period, param, _ := strings.Cut(rule, ":")
+	switch period {
+	case "daily":
+		if param != "" {
+			break
+		}
+		return &Schedule{Period: period}, nil
+	case "weekly":
+		day, err := strconv.Atoi(param)
+		if err != nil || day < 0 || day > 6 {
+			break
+		}
+		return &Schedule{Period: period, Day: day}, nil
+	case "monthly":
+		day, err := strconv.Atoi(param)
+		if err != nil || day < 1 || day > 31 {
+			break
+		}
+		return &Schedule{Period: period, Day: day}, nil
+	}
+	return nil, fmt.Errorf("got %v as invalid schedule. use daily, weekly:<0-6> or monthly:<1-31>", rule)
+}
+
+// Next returns the first due date on or after the date.
+func (s *Schedule) Next(date time.Time) time.Time {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch s.Period {
+	case "weekly":
+		return date.AddDate(0, 0, (s.Day-int(date.Weekday())+7)%7)
+	case "monthly":
+		due := monthDay(date.Year(), date.Month(), s.Day)
+		if due.Before(date) {
+			due = monthDay(date.Year(), date.Month()+1, s.Day)
+		}
+		return due
+	default:
+		return date
+	}
+}
+
+// monthDay returns the day of the month, or the last day when the month is shorter.
+func monthDay(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	if day > last.Day() {
+		return last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func (nb *netBank) CreateStandingOrder(o *StandingOrder) (*StandingOrder, error) {
+	if o.Amount <= 0 {
+		return nil, fmt.Errorf("amount of standing order is less than zero. your input is %v", o.Amount)
+	}
+	if o.From == int(o.To) {
+		return nil, fmt.Errorf("standing order cannot transfer to the same account")
+	}
+	s, err := ParseSchedule(o.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	start, err := time.Parse(dateLayout, o.Start)
+	if err != nil {
+		return nil, fmt.Errorf("got %v as invalid start date", o.Start)
+	}
+	// the scheduler would pay every due date missed since a past start at once.
+	if start.Before(truncateDate(time.Now())) {
+		return nil, fmt.Errorf("start date of standing order is before today. your input is %v", o.Start)
+	}
+	var end sql.NullTime
+	if o.End != "" {
+		end.Time, err = time.Parse(dateLayout, o.End)
+		if err != nil {
+			return nil, fmt.Errorf("got %v as invalid end date", o.End)
+		}
+		end.Valid = true
+	}
+	next := s.Next(start)
+	if end.Valid && next.After(end.Time) {
+		return nil, fmt.Errorf("standing order has no due date between %v and %v", o.Start, o.End)
+	}
+	if o.Retries < 0 {
+		return nil, fmt.Errorf("got %v as invalid retries", o.Retries)
+	}
+	retryHours := o.RetryHours
+	if retryHours <= 0 {
+		retryHours = 24
+	}
+
+	_, err = nb.GetAccount(o.From)
+	if err != nil {
+		return nil, fmt.Errorf("sender's account(ID: %v) is not found: %w", o.From, err)
+	}
+	_, err = nb.GetAccount(int(o.To))
+	if err != nil {
+		return nil, fmt.Errorf("reciever's account(ID: %v) is not found: %w", o.To, err)
+	}
+
+	q := `
+	INSERT INTO standing_order (source, destination, amount, schedule, start_date, end_date, next_run, retries, retry_hours)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id;
+	`
+	var id int
+	row := nb.db.QueryRowContext(context.Background(), q, o.From, int(o.To), o.Amount, o.Schedule, start, end, next, o.Retries, retryHours)
+	err = row.Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return nb.GetStandingOrder(id)
+}
+
+const standingOrderColumns = `id, source, destination, amount, schedule, start_date, end_date, next_run, retries, retry_hours, status`
+
+func scanStandingOrder(row interface{ Scan(...any) error }) (*StandingOrder, error) {
+	o := &StandingOrder{}
+	var (
+		start time.Time
+		end   sql.NullTime
+		next  time.Time
+	)
+	err := row.Scan(&o.ID, &o.From, &o.To, &o.Amount, &o.Schedule, &start, &end, &next, &o.Retries, &o.RetryHours, &o.Status)
+	if err != nil {
+		return nil, err
+	}
+	o.Start = start.Format(dateLayout)
+	if end.Valid {
+		o.End = end.Time.Format(dateLayout)
+	}
+	o.NextRun = next.Format(dateLayout)
+	return o, nil
+}
+
+func (nb *netBank) GetStandingOrder(id int) (*StandingOrder, error) {
+	q := `SELECT ` + standingOrderColumns + ` FROM standing_order WHERE id=$1;`
+	row := nb.db.QueryRowContext(context.Background(), q, id)
+	return scanStandingOrder(row)
+}
+
+// GetStandingOrders returns the standing orders paid from the account.
+func (nb *netBank) GetStandingOrders(num int) ([]*StandingOrder, error) {
+	q := `SELECT ` + standingOrderColumns + ` FROM standing_order WHERE source=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []*StandingOrder{}
+	for rows.Next() {
+		o, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// CancelStandingOrder stops the standing order of the account. the runs are kept.
+func (nb *netBank) CancelStandingOrder(num int, id int) (*StandingOrder, error) {
+	q := `
+	UPDATE standing_order
+	SET status=$3, retry_at=NULL
+	WHERE id=$1 AND source=$2
+	RETURNING ` + standingOrderColumns + `;`
+	row := nb.db.QueryRowContext(context.Background(), q, id, num, OrderCancelled)
+	return scanStandingOrder(row)
+}
+
+func (nb *netBank) GetStandingOrderRuns(id int) ([]*StandingOrderRun, error) {
+	q := `
+	SELECT id, order_id, due_date, attempt, status, error, run_at
+	FROM standing_order_run
+	WHERE order_id=$1
+	ORDER BY id;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*StandingOrderRun{}
+	for rows.Next() {
+		r := &StandingOrderRun{}
+		var due time.Time
+		err := rows.Scan(&r.ID, &r.Order, &due, &r.Attempt, &r.Status, &r.Error, &r.RunAt)
+		if err != nil {
+			return nil, err
+		}
+		r.DueDate = due.Format(dateLayout)
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// RunStandingOrders executes the standing orders due at now through the same logic as Transfer,
+// and returns the number of executed orders. every execution is recorded as a run.
+func (nb *netBank) RunStandingOrders(now time.Time) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", standingOrderLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	q := `
+	SELECT id, source, destination, amount, schedule, end_date, next_run, retries, retry_hours, attempt
+	FROM standing_order
+	WHERE status=$1 AND ((retry_at IS NULL AND next_run<=$2) OR retry_at<=$3)
+	ORDER BY id;
+	`
+	// the due dates are in UTC, so the date of now is taken in UTC regardless of the location of the server.
+	rows, err := tx.QueryContext(context.Background(), q, OrderActive, now.UTC().Format(dateLayout), now)
+	if err != nil {
+		return 0, err
+	}
+
+	type due struct {
+		id         int
+		from       int
+		to         int
+		amount     float64
+		schedule   string
+		end        sql.NullTime
+		next       time.Time
+		retries    int
+		retryHours int
+		attempt    int
+	}
+	ds := []*due{}
+	for rows.Next() {
+		d := &due{}
+		err := rows.Scan(&d.id, &d.from, &d.to, &d.amount, &d.schedule, &d.end, &d.next, &d.retries, &d.retryHours, &d.attempt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ds = append(ds, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := []*Event{}
+	for _, d := range ds {
+		// a failed transfer is rolled back to the savepoint without aborting the other orders.
+		_, err := tx.ExecContext(context.Background(), "SAVEPOINT standing_order;")
+		if err != nil {
+			return 0, err
+		}
+		_, es, transferErr := nb.transfer(tx, d.from, d.to, d.amount, "")
+		if transferErr != nil {
+			_, err = tx.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT standing_order;")
+		} else {
+			_, err = tx.ExecContext(context.Background(), "RELEASE SAVEPOINT standing_order;")
+			published = append(published, es...)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		attempt := d.attempt + 1
+		status := RunSucceeded
+		message := ""
+		if transferErr != nil {
+			status = RunFailed
+			message = transferErr.Error()
+			if errors.Is(transferErr, ErrInsufficientFunds) && attempt <= d.retries {
+				status = RunRetrying
+			}
+		}
+
+		q := `
+		INSERT INTO standing_order_run (order_id, due_date, attempt, status, error, run_at)
+		VALUES ($1, $2, $3, $4, $5, $6);
+		`
+		_, err = tx.ExecContext(context.Background(), q, d.id, d.next, attempt, status, message, now)
+		if err != nil {
+			return 0, err
+		}
+
+		if status == RunRetrying {
+			q := `
+			UPDATE standing_order
+			SET attempt=$2, retry_at=$3
+			WHERE id=$1;
+			`
+			_, err = tx.ExecContext(context.Background(), q, d.id, attempt, now.Add(time.Duration(d.retryHours)*time.Hour))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		// move on to the next due date after success or giving up.
+		s, err := ParseSchedule(d.schedule)
+		if err != nil {
+			return 0, err
+		}
+		next := s.Next(d.next.AddDate(0, 0, 1))
+		orderStatus := OrderActive
+		if d.end.Valid && next.After(d.end.Time) {
+			orderStatus = OrderFinished
+		}
+		q = `
+		UPDATE standing_order
+		SET attempt=0, retry_at=NULL, next_run=$2, status=$3
+		WHERE id=$1;
+		`
+		_, err = tx.ExecContext(context.Background(), q, d.id, next, orderStatus)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	publish(published...)
+	return len(ds), nil
+}
+
+// RunStandingOrderScheduler executes due standing orders every interval until ctx is done.
+func RunStandingOrderScheduler(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the standing order scheduler: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.RunStandingOrders(time.Now())
+		if err != nil {
+			log.Printf("failed to run standing orders: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the formats of statements for personal finance apps.
+const (
+	StatementOFX = "ofx"
+	StatementQIF = "qif"
+	StatementCSV = "csv"
+)
+
+const (
+	// how long a download token can be used unless DOWNLOAD_TOKEN_TTL is set in seconds.
+	defaultDownloadTokenTTL = 15 * time.Minute
+	ofxHeader               = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n" +
+		`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n"
+	ofxDateLayout = "20060102150405.000"
+	// NAME of STMTTRN is up to 32 characters.
+	ofxNameLength = 32
+)
+
+// ErrInvalidDownloadToken is matched by errors.Is() when a statement is downloaded without a valid token of the account.
+var ErrInvalidDownloadToken = errors.New("invalid download token")
+
+// StatementCSVHeader is the layout of the CSV statement. a row is a transaction:
+//   - id: the id of the journal entry, which never changes
+//   - date: the date of the transaction in UTC as YYYY-MM-DD
+//   - type: the event of the journal, e.g. balance-changed
+//   - description: the transaction in words, e.g. Transfer to JP47NETB0000003003
+//   - counterparty: the identifier of the other account, empty for cash and the bank
+//   - amount: the signed amount with a decimal point, negative for debits
+//   - currency: the ISO 4217 code of the account
+//   - balance: the balance after the transaction
+var StatementCSVHeader = []string{"id", "date", "type", "description", "counterparty", "amount", "currency", "balance"}
+
+// DownloadToken lets its holder download the statements of the account until it expires.
+// only the hash of Token is stored, so it is shown once when it is issued.
+type DownloadToken struct {
+	Token     string    `json:"token"`
+	Account   int       `json:"account"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PersonalStatement is the transactions of the account between the dates for personal finance apps.
+// the balances of the entries are the running balances after them.
+type PersonalStatement struct {
+	Account   *Account
+	From      time.Time
+	To        time.Time
+	Opening   float64
+	Closing   float64
+	Entries   []*Event
+	CreatedAt time.Time
+}
+
+func downloadTokenTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("DOWNLOAD_TOKEN_TTL"))
+	if err != nil || seconds <= 0 {
+		return defaultDownloadTokenTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func hashDownloadToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueDownloadToken issues a token to download the statements of the account. it can be used until it expires,
+// so that a personal finance app can fetch the statements again by the same URL.
+func (nb *netBank) IssueDownloadToken(num int) (*DownloadToken, error) {
+	_, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	t := &DownloadToken{Token: token, Account: num, ExpiresAt: time.Now().Add(downloadTokenTTL()).UTC().Truncate(time.Second)}
+	q := `INSERT INTO download_token (token_hash, account_id, expires_at) VALUES ($1, $2, $3);`
+	_, err = nb.db.ExecContext(context.Background(), q, hashDownloadToken(token), num, t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkDownloadToken returns ErrInvalidDownloadToken unless the token is of the account and not expired.
+func (nb *netBank) checkDownloadToken(num int, token string) error {
+	var account int
+	q := `SELECT account_id FROM download_token WHERE token_hash=$1 AND expires_at>now();`
+	err := nb.db.QueryRowContext(context.Background(), q, hashDownloadToken(token)).Scan(&account)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && account != num) {
+		return fmt.Errorf("the token is not of account(ID: %v) or expired: %w", num, ErrInvalidDownloadToken)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ExportStatement renders the journal of the account between the dates in the format, ofx, qif or csv.
+// the token must be issued for the account by IssueDownloadToken.
+func (nb *netBank) ExportStatement(num int, token string, format string, from time.Time, to time.Time) ([]byte, error) {
+	if format != StatementOFX && format != StatementQIF && format != StatementCSV {
+		return nil, fmt.Errorf("format %v is not one of %v, %v and %v", format, StatementOFX, StatementQIF, StatementCSV)
+	}
+	if truncateDate(from).After(truncateDate(to)) {
+		return nil, fmt.Errorf("from %v is after to %v", from.Format(dateLayout), to.Format(dateLayout))
+	}
+	err := nb.checkDownloadToken(num, token)
+	if err != nil {
+		return nil, err
+	}
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	es, closing, err := journalBetween(nb.db, a, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newPersonalStatement(a, es, closing, truncateDate(from), truncateDate(to), time.Now())
+	switch format {
+	case StatementOFX:
+		return EncodeOFX(s)
+	case StatementQIF:
+		return EncodeQIF(s), nil
+	}
+	return EncodeCSV(s)
+}
+
+// newPersonalStatement is the statement of the entries between the dates. the opening balance is the closing one without the entries,
+// and the running balances are counted from it.
+func newPersonalStatement(a *Account, es []*Event, closing float64, from time.Time, to time.Time, now time.Time) *PersonalStatement {
+	s := &PersonalStatement{Account: a, From: from, To: to, Closing: closing, Entries: []*Event{}, CreatedAt: now}
+	opening := closing
+	for _, e := range es {
+		opening -= e.Amount
+	}
+	s.Opening = roundAmount(opening, a.Currency)
+
+	balance := s.Opening
+	for _, e := range es {
+		balance = roundAmount(balance+e.Amount, a.Currency)
+		entry := *e
+		entry.Balance = balance
+		s.Entries = append(s.Entries, &entry)
+	}
+	return s
+}
+
+// describeEvent is the transaction of the entry in words, which is the payee of personal finance apps.
+func describeEvent(e *Event) string {
+	switch {
+	case e.Type == BalanceChanged && e.Counterparty > 0 && e.Amount > 0:
+		return "Transfer from " + IBAN(e.Counterparty)
+	case e.Type == BalanceChanged && e.Counterparty > 0:
+		return "Transfer to " + IBAN(e.Counterparty)
+	case e.Type == BalanceChanged && e.Counterparty == DomesticClearingAccount:
+		return "Domestic transfer"
+	case e.Type == BalanceChanged && e.Amount > 0:
+		return "Deposit"
+	case e.Type == BalanceChanged:
+		return "Withdrawal"
+	case e.Type == FeePosted:
+		return "Fee"
+	case e.Type == InterestCredited:
+		return "Interest"
+	case e.Type == LoanRepayment:
+		return "Loan repayment"
+	}
+	return e.Type
+}
+
+// ofxType is TRNTYPE of OFX for the entry.
+func ofxType(e *Event) string {
+	switch {
+	case e.Type == BalanceChanged && e.Counterparty != 0:
+		return "XFER"
+	case e.Type == BalanceChanged && e.Amount > 0:
+		return "DEP"
+	case e.Type == BalanceChanged:
+		return "CASH"
+	case e.Type == FeePosted:
+		return "FEE"
+	case e.Type == InterestCredited:
+		return "INT"
+	case e.Type == LoanRepayment:
+		return "PAYMENT"
+	case e.Amount > 0:
+		return "CREDIT"
+	}
+	return "DEBIT"
+}
+
+func formatStatementAmount(v float64, currency string) string {
+	return strconv.FormatFloat(roundAmount(v, currency), 'f', currencies[currency], 64)
+}
+
+func formatOFXDate(t time.Time) string {
+	return t.UTC().Format(ofxDateLayout) + "[0:GMT]"
+}
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxDocument struct {
+	XMLName           xml.Name      `xml:"OFX"`
+	Status            ofxStatus     `xml:"SIGNONMSGSRSV1>SONRS>STATUS"`
+	ServerDate        string        `xml:"SIGNONMSGSRSV1>SONRS>DTSERVER"`
+	Language          string        `xml:"SIGNONMSGSRSV1>SONRS>LANGUAGE"`
+	TransactionID     string        `xml:"BANKMSGSRSV1>STMTTRNRS>TRNUID"`
+	TransactionStatus ofxStatus     `xml:"BANKMSGSRSV1>STMTTRNRS>STATUS"`
+	Statement         *ofxStatement `xml:"BANKMSGSRSV1>STMTTRNRS>STMTRS"`
+}
+
+type ofxStatement struct {
+	Currency     string            `xml:"CURDEF"`
+	BankID       string            `xml:"BANKACCTFROM>BANKID"`
+	AccountID    string            `xml:"BANKACCTFROM>ACCTID"`
+	AccountType  string            `xml:"BANKACCTFROM>ACCTTYPE"`
+	Start        string            `xml:"BANKTRANLIST>DTSTART"`
+	End          string            `xml:"BANKTRANLIST>DTEND"`
+	Transactions []*ofxTransaction `xml:"BANKTRANLIST>STMTTRN"`
+	Balance      string            `xml:"LEDGERBAL>BALAMT"`
+	BalanceAt    string            `xml:"LEDGERBAL>DTASOF"`
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	ID     string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+// EncodeOFX renders the statement as OFX 2.2. FITID is the id of the journal entry, by which apps skip the transactions
+// imported before. OFX has no running balance, so it is in MEMO.
+func EncodeOFX(s *PersonalStatement) ([]byte, error) {
+	a := s.Account
+	end := s.To.AddDate(0, 0, 1).Add(-time.Second)
+	st := &ofxStatement{
+		Currency:     a.Currency,
+		BankID:       zenginBankCode(),
+		AccountID:    IBAN(a.Number),
+		AccountType:  "CHECKING",
+		Start:        formatOFXDate(s.From),
+		End:          formatOFXDate(end),
+		Transactions: []*ofxTransaction{},
+		Balance:      formatStatementAmount(s.Closing, a.Currency),
+		BalanceAt:    formatOFXDate(end),
+	}
+	for _, e := range s.Entries {
+		name := []rune(describeEvent(e))
+		if len(name) > ofxNameLength {
+			name = name[:ofxNameLength]
+		}
+		st.Transactions = append(st.Transactions, &ofxTransaction{
+			Type:   ofxType(e),
+			Posted: formatOFXDate(e.At),
+			Amount: formatStatementAmount(e.Amount, a.Currency),
+			ID:     strconv.FormatInt(e.ID, 10),
+			Name:   string(name),
+			Memo:   "Balance " + formatStatementAmount(e.Balance, a.Currency),
+		})
+	}
+	doc := &ofxDocument{
+		Status:            ofxStatus{Severity: "INFO"},
+		ServerDate:        formatOFXDate(s.CreatedAt),
+		Language:          "ENG",
+		TransactionID:     fmt.Sprintf("%v-%v-%v", a.Number, s.From.Format("20060102"), s.To.Format("20060102")),
+		TransactionStatus: ofxStatus{Severity: "INFO"},
+		Statement:         st,
+	}
+
+	var b bytes.Buffer
+	b.WriteString(ofxHeader)
+	enc := xml.NewEncoder(&b)
+	enc.Indent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// qifText drops line breaks, which end a field of QIF.
+func qifText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// EncodeQIF renders the statement as QIF of a bank account. N, the number of a transaction, is the id of the journal entry,
+// and M, the memo, has the running balance. the dates are MM/DD/YYYY.
+func EncodeQIF(s *PersonalStatement) []byte {
+	var b bytes.Buffer
+	b.WriteString("!Type:Bank\n")
+	for _, e := range s.Entries {
+		fmt.Fprintf(&b, "D%v\n", e.At.UTC().Format("01/02/2006"))
+		fmt.Fprintf(&b, "T%v\n", formatStatementAmount(e.Amount, s.Account.Currency))
+		fmt.Fprintf(&b, "N%v\n", e.ID)
+		fmt.Fprintf(&b, "P%v\n", qifText(describeEvent(e)))
+		fmt.Fprintf(&b, "MBalance %v\n", formatStatementAmount(e.Balance, s.Account.Currency))
+		b.WriteString("^\n")
+	}
+	return b.Bytes()
+}
+
+// EncodeCSV renders the statement as CSV with StatementCSVHeader. the lines are separated by CRLF.
+func EncodeCSV(s *PersonalStatement) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.UseCRLF = true
+	err := w.Write(StatementCSVHeader)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range s.Entries {
+		counterparty := ""
+		if e.Counterparty > 0 {
+			counterparty = IBAN(e.Counterparty)
+		}
+		err := w.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.At.UTC().Format(dateLayout),
+			e.Type,
+			describeEvent(e),
+			counterparty,
+			formatStatementAmount(e.Amount, s.Account.Currency),
+			s.Account.Currency,
+			formatStatementAmount(e.Balance, s.Account.Currency),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,534 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	MaturityRollover = "rollover"
+	MaturityPayout   = "payout"
+
+	DepositActive     = "active"
+	DepositMatured    = "matured"
+	DepositRolledOver = "rolled-over"
+	DepositBroken     = "broken"
+
+	TermDepositOpened  = "TermDepositOpened"
+	TermDepositClosed  = "TermDepositClosed"
+	TermDepositRenewed = "TermDepositRenewed"
+
+	termDepositLock = 20231005
+)
+
+// ErrDepositNotActive is matched by errors.Is() when a term deposit is already matured or broken.
+var ErrDepositNotActive = errors.New("term deposit is not active")
+
+// TermRate is the annual rate of term deposits of the term, and PenaltyRate is the part of the principal
+// charged when a deposit is broken before maturity.
+type TermRate struct {
+	TermMonths  int     `json:"term_months"`
+	Rate        float64 `json:"rate"`
+	PenaltyRate float64 `json:"penalty_rate"`
+}
+
+// TermDeposit is money moved out of an account for a term. it is paid back to the account with interest at maturity,
+// or rolled over into a new deposit with the interest.
+type TermDeposit struct {
+	ID          int64      `json:"id"`
+	Account     int        `json:"account"`
+	Principal   float64    `json:"principal"`
+	TermMonths  int        `json:"term_months"`
+	Rate        float64    `json:"rate"`
+	PenaltyRate float64    `json:"penalty_rate"`
+	Instruction string     `json:"instruction"`
+	StartDate   string     `json:"start_date"`
+	Maturity    string     `json:"maturity"`
+	Status      string     `json:"status"`
+	Interest    float64    `json:"interest,omitempty"`
+	Penalty     float64    `json:"penalty,omitempty"`
+	RolledFrom  int64      `json:"rolled_from,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+// interest returns the interest at maturity rounded to the minor unit of the currency.
+func (d *TermDeposit) interest(currency string) float64 {
+	return roundAmount(d.Principal*d.Rate*float64(d.TermMonths)/12, currency)
+}
+
+const termDepositColumns = `id, account_id, principal, term_months, rate, penalty_rate, instruction,
+	start_date, maturity, status, interest, penalty, COALESCE(rolled_from, 0), closed_at`
+
+func scanTermDeposit(row interface{ Scan(...any) error }) (*TermDeposit, error) {
+	d := &TermDeposit{}
+	var (
+		start    time.Time
+		maturity time.Time
+		closedAt sql.NullTime
+	)
+	err := row.Scan(&d.ID, &d.Account, &d.Principal, &d.TermMonths, &d.Rate, &d.PenaltyRate, &d.Instruction,
+		&start, &maturity, &d.Status, &d.Interest, &d.Penalty, &d.RolledFrom, &closedAt)
+	if err != nil {
+		return nil, err
+	}
+	d.StartDate = start.Format(dateLayout)
+	d.Maturity = maturity.Format(dateLayout)
+	if closedAt.Valid {
+		d.ClosedAt = &closedAt.Time
+	}
+	return d, nil
+}
+
+func getTermRate(q querier, months int) (*TermRate, error) {
+	r := &TermRate{}
+	query := `SELECT term_months, rate, penalty_rate FROM term_rate WHERE term_months=$1;`
+	err := q.QueryRowContext(context.Background(), query, months).Scan(&r.TermMonths, &r.Rate, &r.PenaltyRate)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("term of %v months is not offered", months)
+	} else if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (nb *netBank) GetTermRates() ([]*TermRate, error) {
+	q := `SELECT term_months, rate, penalty_rate FROM term_rate ORDER BY term_months;`
+	rows, err := nb.db.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rs := []*TermRate{}
+	for rows.Next() {
+		r := &TermRate{}
+		err := rows.Scan(&r.TermMonths, &r.Rate, &r.PenaltyRate)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+// SetTermRate offers the term at the rates by staff. running deposits keep their rates.
+func (nb *netBank) SetTermRate(r *TermRate) (*TermRate, error) {
+	if r.TermMonths <= 0 {
+		return nil, fmt.Errorf("term is less than zero. your input is %v", r.TermMonths)
+	}
+	if r.Rate < 0 || r.Rate > 1 {
+		return nil, fmt.Errorf("interest rate must be between 0 and 1. your input is %v", r.Rate)
+	}
+	if r.PenaltyRate < 0 || r.PenaltyRate > 1 {
+		return nil, fmt.Errorf("penalty rate must be between 0 and 1. your input is %v", r.PenaltyRate)
+	}
+
+	q := `
+	INSERT INTO term_rate (term_months, rate, penalty_rate)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (term_months) DO UPDATE
+	SET rate=EXCLUDED.rate, penalty_rate=EXCLUDED.penalty_rate;
+	`
+	_, err := nb.db.ExecContext(context.Background(), q, r.TermMonths, r.Rate, r.PenaltyRate)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// insertTermDeposit starts a deposit of the principal on start at the current rate of the term.
+func insertTermDeposit(tx *sql.Tx, num int, principal float64, months int, instruction string, start time.Time, rolledFrom int64) (*TermDeposit, error) {
+	r, err := getTermRate(tx, months)
+	if err != nil {
+		return nil, err
+	}
+
+	var from any
+	if rolledFrom != 0 {
+		from = rolledFrom
+	}
+	q := `
+	INSERT INTO term_deposit (account_id, principal, term_months, rate, penalty_rate, instruction, start_date, maturity, rolled_from)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING ` + termDepositColumns + `;`
+	maturity := start.AddDate(0, months, 0)
+	return scanTermDeposit(tx.QueryRowContext(context.Background(), q, num, principal, months, r.Rate, r.PenaltyRate,
+		instruction, start.Format(dateLayout), maturity.Format(dateLayout), from))
+}
+
+// OpenTermDeposit moves the amount of the balance into a new term deposit.
+func (nb *netBank) OpenTermDeposit(num int, amount float64, months int, instruction string) (*TermDeposit, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount of term deposit is less than zero. your input is %v", amount)
+	}
+	if instruction == "" {
+		instruction = MaturityPayout
+	}
+	if instruction != MaturityRollover && instruction != MaturityPayout {
+		return nil, fmt.Errorf("maturity instruction must be %v or %v. your input is %v", MaturityRollover, MaturityPayout, instruction)
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	balances, err := lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+	balance, ok := balances[num]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	err = checkFunds(tx, num, balance, amount, "your")
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := insertTermDeposit(tx, num, amount, months, instruction, truncateDate(time.Now()), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `UPDATE account SET balance=balance-$1 WHERE id=$2;`
+	_, err = tx.ExecContext(context.Background(), q, amount, num)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := nb.record(tx, BalanceChanged, num, -amount, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = nb.enqueue(tx, TermDepositOpened, num, d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(e)
+	return d, nil
+}
+
+func (nb *netBank) GetTermDeposits(num int) ([]*TermDeposit, error) {
+	q := `SELECT ` + termDepositColumns + ` FROM term_deposit WHERE account_id=$1 ORDER BY id;`
+	rows, err := nb.db.QueryContext(context.Background(), q, num)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ds := []*TermDeposit{}
+	for rows.Next() {
+		d, err := scanTermDeposit(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+// closeTermDeposit pays the principal and the interest minus the penalty back to the account.
+// the interest is paid by InterestExpenseAccount and the penalty is earned by FeeIncomeAccount of the currency of the account.
+func (nb *netBank) closeTermDeposit(tx *sql.Tx, d *TermDeposit, status string, interest float64, penalty float64) (*TermDeposit, []*Event, error) {
+	q := `
+	UPDATE term_deposit
+	SET status=$2, interest=$3, penalty=$4, closed_at=now()
+	WHERE id=$1
+	RETURNING ` + termDepositColumns + `;`
+	d, err := scanTermDeposit(tx.QueryRowContext(context.Background(), q, d.ID, status, interest, penalty))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currency, err := accountCurrency(tx, d.Account)
+	if err != nil {
+		return nil, nil, err
+	}
+	expense, err := internalAccount(tx, InterestExpenseAccount, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+	income, err := internalAccount(tx, FeeIncomeAccount, currency)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	es := []*Event{}
+	if status == DepositRolledOver {
+		// the money stays in the bank, and only the interest is paid into the new deposit.
+		if interest > 0 {
+			_, err = tx.ExecContext(context.Background(), `UPDATE account SET balance=balance-$1 WHERE id=$2;`, interest, expense)
+			if err != nil {
+				return nil, nil, err
+			}
+			e, err := nb.record(tx, InterestCredited, expense, -interest, d.Account)
+			if err != nil {
+				return nil, nil, err
+			}
+			es = append(es, e)
+		}
+		return d, es, nil
+	}
+
+	_, err = tx.ExecContext(context.Background(), `UPDATE account SET balance=balance+$1 WHERE id=$2;`, d.Principal-penalty, d.Account)
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := nb.record(tx, BalanceChanged, d.Account, d.Principal-penalty, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	es = append(es, e)
+
+	if interest > 0 {
+		_, err = tx.ExecContext(context.Background(), `UPDATE account SET balance=balance+$1 WHERE id=$2;`, interest, d.Account)
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = tx.ExecContext(context.Background(), `UPDATE account SET balance=balance-$1 WHERE id=$2;`, interest, expense)
+		if err != nil {
+			return nil, nil, err
+		}
+		credited, err := nb.record(tx, InterestCredited, d.Account, interest, expense)
+		if err != nil {
+			return nil, nil, err
+		}
+		paid, err := nb.record(tx, InterestCredited, expense, -interest, d.Account)
+		if err != nil {
+			return nil, nil, err
+		}
+		es = append(es, credited, paid)
+	}
+
+	if penalty > 0 {
+		_, err = tx.ExecContext(context.Background(), `UPDATE account SET balance=balance+$1 WHERE id=$2;`, penalty, income)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := nb.record(tx, FeePosted, income, penalty, d.Account)
+		if err != nil {
+			return nil, nil, err
+		}
+		es = append(es, e)
+	}
+
+	err = nb.enqueue(tx, TermDepositClosed, d.Account, d)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, es, nil
+}
+
+// deleteTermDeposits deletes the closed deposits of the account which is being deleted in the transaction.
+// an account with an active deposit cannot be deleted, because its principal would be lost.
+func deleteTermDeposits(tx *sql.Tx, num int) error {
+	var active int
+	q := `SELECT COUNT(*) FROM term_deposit WHERE account_id=$1 AND status=$2;`
+	err := tx.QueryRowContext(context.Background(), q, num, DepositActive).Scan(&active)
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return fmt.Errorf("account(ID: %v) has %v active term deposits. break them before deleting it: %w", num, active, ErrAccountInUse)
+	}
+
+	_, err = tx.ExecContext(context.Background(), `DELETE FROM term_deposit WHERE account_id=$1;`, num)
+	return err
+}
+
+// BreakTermDeposit closes the deposit before maturity. the principal is paid back without interest
+// and the penalty of the term is charged. a deposit already at maturity is matured instead.
+func (nb *netBank) BreakTermDeposit(num int, id int64) (*TermDeposit, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// lock the account before the deposit in the same order as the maturity job.
+	_, err = lockBalances(tx, num)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `SELECT ` + termDepositColumns + ` FROM term_deposit WHERE id=$1 AND account_id=$2 FOR UPDATE;`
+	d, err := scanTermDeposit(tx.QueryRowContext(context.Background(), q, id, num))
+	if err != nil {
+		return nil, err
+	}
+	if d.Status != DepositActive {
+		return nil, fmt.Errorf("term deposit(ID: %v) is already %v: %w", id, d.Status, ErrDepositNotActive)
+	}
+
+	maturity, err := time.Parse(dateLayout, d.Maturity)
+	if err != nil {
+		return nil, err
+	}
+	var es []*Event
+	if !maturity.After(truncateDate(time.Now())) {
+		// the deposit is due and waits for the maturity job, so it is matured with the interest instead of the penalty.
+		d, es, err = nb.matureTermDeposit(tx, d)
+	} else {
+		var currency string
+		currency, err = accountCurrency(tx, num)
+		if err != nil {
+			return nil, err
+		}
+		penalty := roundAmount(d.Principal*d.PenaltyRate, currency)
+		d, es, err = nb.closeTermDeposit(tx, d, DepositBroken, 0, penalty)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	publish(es...)
+	return d, nil
+}
+
+// MatureTermDeposits pays out or rolls over the deposits maturing by the day of now,
+// and returns the number of matured deposits.
+func (nb *netBank) MatureTermDeposits(now time.Time) (int, error) {
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked bool
+	row := tx.QueryRowContext(context.Background(), "SELECT pg_try_advisory_xact_lock($1);", termDepositLock)
+	err = row.Scan(&locked)
+	if err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	q := `
+	SELECT ` + termDepositColumns + `
+	FROM term_deposit
+	WHERE status=$1 AND maturity<=$2
+	ORDER BY id;
+	`
+	rows, err := tx.QueryContext(context.Background(), q, DepositActive, truncateDate(now).Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+	ds := []*TermDeposit{}
+	for rows.Next() {
+		d, err := scanTermDeposit(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ds = append(ds, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := []*Event{}
+	for _, d := range ds {
+		_, err := lockBalances(tx, d.Account)
+		if err != nil {
+			return 0, err
+		}
+		// a deposit broken after it was read is skipped.
+		var status string
+		err = tx.QueryRowContext(context.Background(), `SELECT status FROM term_deposit WHERE id=$1 FOR UPDATE;`, d.ID).Scan(&status)
+		if err != nil {
+			return 0, err
+		}
+		if status != DepositActive {
+			continue
+		}
+
+		_, es, err := nb.matureTermDeposit(tx, d)
+		if err != nil {
+			return 0, err
+		}
+		published = append(published, es...)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	publish(published...)
+	return len(ds), nil
+}
+
+// matureTermDeposit pays out the deposit with the interest, or rolls it over into a new deposit of the same term
+// from the maturity. the account and the deposit must be locked.
+func (nb *netBank) matureTermDeposit(tx *sql.Tx, d *TermDeposit) (*TermDeposit, []*Event, error) {
+	currency, err := accountCurrency(tx, d.Account)
+	if err != nil {
+		return nil, nil, err
+	}
+	interest := d.interest(currency)
+	if d.Instruction != MaturityRollover {
+		return nb.closeTermDeposit(tx, d, DepositMatured, interest, 0)
+	}
+
+	closed, es, err := nb.closeTermDeposit(tx, d, DepositRolledOver, interest, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	maturity, err := time.Parse(dateLayout, d.Maturity)
+	if err != nil {
+		return nil, nil, err
+	}
+	renewed, err := insertTermDeposit(tx, d.Account, d.Principal+interest, d.TermMonths, d.Instruction, maturity, d.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = nb.enqueue(tx, TermDepositRenewed, d.Account, []*TermDeposit{closed, renewed})
+	if err != nil {
+		return nil, nil, err
+	}
+	return closed, es, nil
+}
+
+// RunTermDepositMaturity matures term deposits every interval until ctx is done.
+func RunTermDepositMaturity(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the term deposit maturity: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.MatureTermDeposits(time.Now())
+		if err != nil {
+			log.Printf("failed to mature term deposits: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -67,8 +67,35 @@ func DeleteTestData() error {
 	defer tx.Rollback()
 
 	q := `
-	DELETE FROM account;
-	DELETE FROM customer;
+	-- the loans and the term deposits keep their accounts from being deleted.
+	DELETE FROM loan;
+	DELETE FROM term_deposit;
+	DELETE FROM account WHERE id>0;
+	DELETE FROM customer WHERE id>0;
+	UPDATE account SET balance=0 WHERE id<0;
+	DELETE FROM journal;
+	DELETE FROM outbox;
+	DELETE FROM webhook;
+	DELETE FROM standing_order;
+	DELETE FROM ach_entry;
+	DELETE FROM ach_file;
+	DELETE FROM reversal;
+	DELETE FROM transfer;
+	DELETE FROM limit_rule;
+	DELETE FROM limit_usage;
+	DELETE FROM fee_schedule;
+	DELETE FROM fee_charge;
+	DELETE FROM interest_accrual;
+	DELETE FROM card;
+	DELETE FROM fx_rate;
+	DELETE FROM fx_quote;
+	DELETE FROM outgoing_transfer;
+	DELETE FROM bank_branch;
+	DELETE FROM financial_institution;
+	DELETE FROM download_token;
+	DELETE FROM account_credential;
+	-- the statements reject DELETE, and TRUNCATE does not fire the trigger.
+	TRUNCATE monthly_statement;
 	`
 	_, err = tx.ExecContext(context.Background(), q)
 	if err != nil {
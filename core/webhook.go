@@ -0,0 +1,380 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// AnyEvent subscribes a webhook to every domain event.
+	AnyEvent = "*"
+
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+
+	// a delivery is dead after this number of failed attempts.
+	webhookMaxAttempts = 8
+
+	// a claimed delivery is sent again after this lease when its dispatcher stops before recording the result.
+	webhookLease = 10 * time.Minute
+)
+
+// Webhook is an endpoint which receives domain events of the type as signed JSON POSTs.
+type Webhook struct {
+	ID     int    `json:"id"`
+	URL    string `json:"url"`
+	Event  string `json:"event"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is a domain event to be delivered to a webhook.
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	Webhook       int        `json:"webhook"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+// SignWebhook returns the signature of a webhook request sent at t.
+// receivers compute it with their secret and compare it with X-NetBank-Signature header.
+func SignWebhook(secret string, t int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", t)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", t, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// webhookBackoff returns the wait before the next attempt after attempts failures.
+func webhookBackoff(attempts int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d > 6*time.Hour {
+			return 6 * time.Hour
+		}
+	}
+	return d
+}
+
+func (nb *netBank) CreateWebhook(w *Webhook) (*Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("got %v as invalid webhook url", w.URL)
+	}
+	if w.Event == "" {
+		return nil, fmt.Errorf("webhook has empty event")
+	}
+	if w.Event != AnyEvent && !domainEvents[w.Event] {
+		return nil, fmt.Errorf("got %v as unknown webhook event", w.Event)
+	}
+
+	secret := w.Secret
+	if secret == "" {
+		bs := make([]byte, 32)
+		_, err := rand.Read(bs)
+		if err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(bs)
+	}
+
+	q := `
+	INSERT INTO webhook (url, event, secret)
+	VALUES ($1, $2, $3)
+	RETURNING id;
+	`
+	created := &Webhook{URL: w.URL, Event: w.Event, Secret: secret}
+	row := nb.db.QueryRowContext(context.Background(), q, w.URL, w.Event, secret)
+	err = row.Scan(&created.ID)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetWebhooks returns registered webhooks without their secrets.
+func (nb *netBank) GetWebhooks() ([]*Webhook, error) {
+	q := `
+	SELECT id, url, event
+	FROM webhook
+	ORDER BY id;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ws := []*Webhook{}
+	for rows.Next() {
+		w := &Webhook{}
+		err := rows.Scan(&w.ID, &w.URL, &w.Event)
+		if err != nil {
+			return nil, err
+		}
+		ws = append(ws, w)
+	}
+	return ws, rows.Err()
+}
+
+func (nb *netBank) DeleteWebhook(id int) error {
+	res, err := nb.db.ExecContext(context.Background(), "DELETE FROM webhook WHERE id=$1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EnqueueWebhooks creates deliveries of the domain event for the webhooks subscribing it.
+// it is an OutboxHandler, and enqueuing the same event twice creates no duplicate.
+func (nb *netBank) EnqueueWebhooks(e *DomainEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	q := `
+	INSERT INTO webhook_delivery (webhook_id, outbox_id, event, body)
+	SELECT id, $1, $2, $3
+	FROM webhook
+	WHERE event=$2 OR event=$4
+	ON CONFLICT (webhook_id, outbox_id) DO NOTHING;
+	`
+	_, err = nb.db.ExecContext(context.Background(), q, e.ID, e.Type, string(body), AnyEvent)
+	return err
+}
+
+const deliveryColumns = `id, webhook_id, event, status, attempts, next_attempt_at, last_error, delivered_at`
+
+func scanDelivery(row interface{ Scan(...any) error }) (*WebhookDelivery, error) {
+	d := &WebhookDelivery{}
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.Webhook, &d.Event, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.LastError, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveries returns deliveries of the webhook, newest first.
+func (nb *netBank) GetWebhookDeliveries(webhook int) ([]*WebhookDelivery, error) {
+	q := `SELECT ` + deliveryColumns + `
+	FROM webhook_delivery
+	WHERE webhook_id=$1
+	ORDER BY id DESC;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, webhook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ds := []*WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, rows.Err()
+}
+
+// RedeliverWebhook makes the delivery pending again regardless of its status.
+func (nb *netBank) RedeliverWebhook(id int64) (*WebhookDelivery, error) {
+	q := `
+	UPDATE webhook_delivery
+	SET status=$2, attempts=0, next_attempt_at=now(), last_error=''
+	WHERE id=$1
+	RETURNING ` + deliveryColumns + `;`
+	row := nb.db.QueryRowContext(context.Background(), q, id, DeliveryPending)
+	return scanDelivery(row)
+}
+
+// DispatchWebhooks sends at most limit pending deliveries whose next attempt is due at now,
+// and returns the number of successful deliveries.
+// a failed delivery is retried with exponential backoff, and becomes dead after webhookMaxAttempts.
+func (nb *netBank) DispatchWebhooks(client *http.Client, now time.Time, limit int) (int, error) {
+	ds, err := nb.claimDeliveries(now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	// the requests are sent without any transaction, so a slow receiver holds neither a connection nor a lock.
+	errs := make([]error, len(ds))
+	for i, d := range ds {
+		errs[i] = sendWebhook(client, d.url, d.secret, d.id, []byte(d.body))
+	}
+
+	tx, err := nb.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// a result is not recorded when the lease has expired and another dispatcher has claimed the delivery again.
+	delivered := 0
+	for i, d := range ds {
+		if errs[i] == nil {
+			q := `
+			UPDATE webhook_delivery
+			SET status=$3, last_error='', delivered_at=now()
+			WHERE id=$1 AND attempts=$2;
+			`
+			_, err = tx.ExecContext(context.Background(), q, d.id, d.attempts, DeliveryDelivered)
+			if err != nil {
+				return 0, err
+			}
+			delivered++
+			continue
+		}
+
+		status := DeliveryPending
+		if d.attempts >= webhookMaxAttempts {
+			status = DeliveryDead
+		}
+		q := `
+		UPDATE webhook_delivery
+		SET status=$3, last_error=$4, next_attempt_at=$5
+		WHERE id=$1 AND attempts=$2;
+		`
+		_, err = tx.ExecContext(context.Background(), q, d.id, d.attempts, status, errs[i].Error(), now.Add(webhookBackoff(d.attempts)))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return delivered, nil
+}
+
+type claimedDelivery struct {
+	id       int64
+	attempts int
+	body     string
+	url      string
+	secret   string
+}
+
+// claimDeliveries counts an attempt of the due deliveries and leases them to the caller for webhookLease,
+// so that the other dispatchers skip them after the claim is committed.
+func (nb *netBank) claimDeliveries(now time.Time, limit int) ([]*claimedDelivery, error) {
+	// SKIP LOCKED lets several dispatchers claim the deliveries at the same time.
+	q := `
+	UPDATE webhook_delivery AS d
+	SET attempts=d.attempts+1, next_attempt_at=$4
+	FROM webhook AS w
+	WHERE d.webhook_id=w.id AND d.id IN (
+		SELECT id
+		FROM webhook_delivery
+		WHERE status=$1 AND next_attempt_at<=$2
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.attempts, d.body, w.url, w.secret;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, DeliveryPending, now, limit, now.Add(webhookLease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ds := []*claimedDelivery{}
+	for rows.Next() {
+		d := &claimedDelivery{}
+		err := rows.Scan(&d.id, &d.attempts, &d.body, &d.url, &d.secret)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING has no order, and the deliveries are sent in the order they were made.
+	sort.Slice(ds, func(i, j int) bool { return ds[i].id < ds[j].id })
+	return ds, nil
+}
+
+func sendWebhook(client *http.Client, url string, secret string, id int64, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-NetBank-Delivery", strconv.FormatInt(id, 10))
+	req.Header.Set("X-NetBank-Signature", SignWebhook(secret, time.Now().Unix(), body))
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %v", res.Status)
+	}
+	return nil
+}
+
+// RunWebhookDispatcher sends due deliveries every interval until ctx is done.
+func RunWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	nb, err := NewNetBank()
+	if err != nil {
+		log.Printf("failed to start the webhook dispatcher: %v", err)
+		return
+	}
+	defer nb.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := nb.DispatchWebhooks(client, time.Now(), 20)
+		if err != nil {
+			log.Printf("failed to dispatch webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
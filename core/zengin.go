@@ -0,0 +1,569 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// 全銀協フォーマットの総合振込. every record is 120 bytes in Shift_JIS, and records are separated by CRLF.
+const (
+	zenginRecordLength = 120
+	// ZenginTotalTransfer is the kind code of 総合振込 in the header.
+	ZenginTotalTransfer = "21"
+	// the code type of the header. 0 is Shift_JIS and 1 is EBCDIC, which is not supported.
+	zenginShiftJIS = "0"
+	// 預金種目. the accounts of the bank are all 普通.
+	zenginOrdinaryDeposit = "1"
+	// 振込指定区分. 7 is 電信振込.
+	zenginTelegraphic = "7"
+
+	zenginHeader  = "1"
+	zenginData    = "2"
+	zenginTrailer = "8"
+	zenginEnd     = "9"
+
+	// the bank code of the bank in zengin files unless ZENGIN_BANK_CODE is set.
+	defaultZenginBankCode = "9999"
+	zenginBankName        = "ﾈﾂﾄﾊﾞﾝｸ"
+	zenginBranchCode      = "001"
+	zenginBranchName      = "ﾎﾝﾃﾝ"
+
+	// the digits of 口座番号. accounts with a larger id cannot be in zengin files.
+	zenginAccountDigits = 7
+)
+
+type zenginField struct {
+	name    string
+	width   int
+	numeric bool
+}
+
+var (
+	zenginHeaderFields = []zenginField{
+		{"data type", 1, true}, {"kind", 2, true}, {"code type", 1, true}, {"requester code", 10, true},
+		{"requester name", 40, false}, {"date", 4, true}, {"bank", 4, true}, {"bank name", 15, false},
+		{"branch", 3, true}, {"branch name", 15, false}, {"deposit type", 1, true}, {"account", 7, true},
+		{"dummy", 17, false},
+	}
+	zenginDataFields = []zenginField{
+		{"data type", 1, true}, {"bank", 4, true}, {"bank name", 15, false}, {"branch", 3, true},
+		{"branch name", 15, false}, {"clearing house", 4, false}, {"deposit type", 1, true}, {"account", 7, true},
+		{"name", 30, false}, {"amount", 10, true}, {"new code", 1, true}, {"customer code 1", 10, false},
+		{"customer code 2", 10, false}, {"transfer type", 1, false}, {"mark", 1, false}, {"dummy", 7, false},
+	}
+	zenginTrailerFields = []zenginField{
+		{"data type", 1, true}, {"count", 6, true}, {"amount", 12, true}, {"dummy", 101, false},
+	}
+	zenginEndFields = []zenginField{
+		{"data type", 1, true}, {"dummy", 119, false},
+	}
+)
+
+// ZenginHeader is the header record. Date is MMDD of 取組日.
+type ZenginHeader struct {
+	Kind          string `json:"kind"`
+	RequesterCode string `json:"requester_code"`
+	RequesterName string `json:"requester_name"`
+	Date          string `json:"date"`
+	Bank          string `json:"bank"`
+	BankName      string `json:"bank_name"`
+	Branch        string `json:"branch"`
+	BranchName    string `json:"branch_name"`
+	DepositType   string `json:"deposit_type"`
+	Account       string `json:"account"`
+}
+
+// ZenginRecord is a data record, which is a transfer to the account.
+type ZenginRecord struct {
+	Line          int    `json:"line"`
+	Bank          string `json:"bank"`
+	BankName      string `json:"bank_name"`
+	Branch        string `json:"branch"`
+	BranchName    string `json:"branch_name"`
+	DepositType   string `json:"deposit_type"`
+	Account       string `json:"account"`
+	Name          string `json:"name"`
+	Amount        int64  `json:"amount"`
+	CustomerCode1 string `json:"customer_code_1,omitempty"`
+	CustomerCode2 string `json:"customer_code_2,omitempty"`
+}
+
+// ZenginFile is a 総合振込 file. Count and Amount are the totals in the trailer record.
+type ZenginFile struct {
+	Header  *ZenginHeader   `json:"header"`
+	Records []*ZenginRecord `json:"records"`
+	Count   int             `json:"count"`
+	Amount  int64           `json:"amount"`
+}
+
+// ZenginIssue is a problem found in a zengin file. Line is the number of the record from 1, and 0 is the whole file.
+type ZenginIssue struct {
+	Line  int    `json:"line"`
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+// ZenginImport is the validation report of a zengin file and the batch transfer made from it.
+// the batch is sent only when the file has no issues, and Result is its outcome.
+type ZenginImport struct {
+	Sender int            `json:"sender"`
+	Count  int            `json:"count"`
+	Amount int64          `json:"amount"`
+	Trades []*Trade       `json:"trades"`
+	Issues []*ZenginIssue `json:"issues"`
+	Valid  bool           `json:"valid"`
+	Result *BatchResult   `json:"result,omitempty"`
+}
+
+func zenginBankCode() string {
+	code := os.Getenv("ZENGIN_BANK_CODE")
+	if _, err := strconv.Atoi(code); err != nil || len(code) != 4 {
+		return defaultZenginBankCode
+	}
+	return code
+}
+
+// small kana are written as the large ones in zengin files.
+var zenginSmallKana = strings.NewReplacer(
+	"ｧ", "ｱ", "ｨ", "ｲ", "ｩ", "ｳ", "ｪ", "ｴ", "ｫ", "ｵ", "ｯ", "ﾂ", "ｬ", "ﾔ", "ｭ", "ﾕ", "ｮ", "ﾖ", "ヮ", "ﾜ", "ｰ", "-",
+)
+
+// ZenginKana converts the text into the characters of zengin files, which are upper case letters, digits,
+// half-width katakana and a few symbols. hiragana and full-width characters are converted, and the others are an error.
+func ZenginKana(s string) (string, error) {
+	var b strings.Builder
+	for _, r := range s {
+		// hiragana is moved to the same katakana.
+		if 'ぁ' <= r && r <= 'ゖ' {
+			r += 'ァ' - 'ぁ'
+		}
+		b.WriteRune(r)
+	}
+	// voiced kana are decomposed so that the marks become ﾞ and ﾟ.
+	narrow := width.Narrow.String(norm.NFD.String(b.String()))
+	narrow = zenginSmallKana.Replace(strings.ToUpper(narrow))
+
+	for _, r := range narrow {
+		switch {
+		case 'A' <= r && r <= 'Z', '0' <= r && r <= '9', 'ｦ' <= r && r <= 'ﾟ', strings.ContainsRune(" ().,-/", r):
+		default:
+			return "", fmt.Errorf("%q in %v cannot be written in zengin", r, s)
+		}
+	}
+	return narrow, nil
+}
+
+// formatZengin lays out the values in the fields. texts are left-justified and numbers are right-justified with zeros.
+func formatZengin(fields []zenginField, values ...string) (string, error) {
+	var b strings.Builder
+	for i, f := range fields {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		n := utf8.RuneCountInString(v)
+		if n > f.width {
+			return "", fmt.Errorf("%v %v is longer than %v characters", f.name, v, f.width)
+		}
+		if f.numeric {
+			b.WriteString(strings.Repeat("0", f.width-n) + v)
+		} else {
+			b.WriteString(v + strings.Repeat(" ", f.width-n))
+		}
+	}
+	return b.String(), nil
+}
+
+// EncodeZengin renders the file in Shift_JIS. the texts must be converted by ZenginKana() beforehand.
+// Count and Amount of the file are ignored and the totals of the records are written.
+func EncodeZengin(f *ZenginFile) ([]byte, error) {
+	h := f.Header
+	kind := h.Kind
+	if kind == "" {
+		kind = ZenginTotalTransfer
+	}
+	records := []string{}
+	header, err := formatZengin(zenginHeaderFields, zenginHeader, kind, zenginShiftJIS, h.RequesterCode, h.RequesterName,
+		h.Date, h.Bank, h.BankName, h.Branch, h.BranchName, h.DepositType, h.Account)
+	if err != nil {
+		return nil, err
+	}
+	records = append(records, header)
+
+	var total int64
+	for _, r := range f.Records {
+		data, err := formatZengin(zenginDataFields, zenginData, r.Bank, r.BankName, r.Branch, r.BranchName, "",
+			r.DepositType, r.Account, r.Name, strconv.FormatInt(r.Amount, 10), "0", r.CustomerCode1, r.CustomerCode2, zenginTelegraphic)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, data)
+		total += r.Amount
+	}
+
+	trailer, err := formatZengin(zenginTrailerFields, zenginTrailer, strconv.Itoa(len(f.Records)), strconv.FormatInt(total, 10))
+	if err != nil {
+		return nil, err
+	}
+	end, _ := formatZengin(zenginEndFields, zenginEnd)
+	records = append(records, trailer, end)
+
+	var buf bytes.Buffer
+	encoder := japanese.ShiftJIS.NewEncoder()
+	for _, r := range records {
+		bs, err := encoder.Bytes([]byte(r))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %q in Shift_JIS: %w", r, err)
+		}
+		// a full-width character takes 2 bytes, which breaks the fixed width.
+		if len(bs) != zenginRecordLength {
+			return nil, fmt.Errorf("record %q is %v bytes in Shift_JIS. use ZenginKana() for the texts", r, len(bs))
+		}
+		buf.Write(bs)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// splitZengin cuts the data into records. the records may be separated by CRLF, LF or nothing.
+func splitZengin(data []byte) ([][]byte, error) {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	lines := bytes.Split(bytes.TrimRight(data, "\n\x1a"), []byte("\n"))
+	if len(lines) == 1 && len(lines[0]) > zenginRecordLength {
+		if len(lines[0])%zenginRecordLength != 0 {
+			return nil, fmt.Errorf("file of %v bytes is not made of %v byte records", len(lines[0]), zenginRecordLength)
+		}
+		records := [][]byte{}
+		for i := 0; i < len(lines[0]); i += zenginRecordLength {
+			records = append(records, lines[0][i:i+zenginRecordLength])
+		}
+		return records, nil
+	}
+	return lines, nil
+}
+
+// parseZenginRecord returns the values of the fields. numeric fields must be digits.
+func parseZenginRecord(fields []zenginField, record []byte, line int) ([]string, []*ZenginIssue) {
+	if len(record) != zenginRecordLength {
+		return nil, []*ZenginIssue{{Line: line, Error: fmt.Sprintf("record is %v bytes. it must be %v bytes", len(record), zenginRecordLength)}}
+	}
+
+	decoder := japanese.ShiftJIS.NewDecoder()
+	values := make([]string, len(fields))
+	var issues []*ZenginIssue
+	offset := 0
+	for i, f := range fields {
+		bs, err := decoder.Bytes(record[offset : offset+f.width])
+		offset += f.width
+		if err != nil {
+			issues = append(issues, &ZenginIssue{Line: line, Field: f.name, Error: "not Shift_JIS"})
+			continue
+		}
+		v := string(bs)
+		if f.numeric {
+			if strings.Trim(v, "0123456789") != "" {
+				issues = append(issues, &ZenginIssue{Line: line, Field: f.name, Error: fmt.Sprintf("%q is not a number", v)})
+			}
+		} else {
+			v = strings.TrimRight(v, " ")
+		}
+		values[i] = v
+	}
+	return values, issues
+}
+
+// ParseZengin reads a 総合振込 file in Shift_JIS. the file is returned with the issues found in it,
+// which include broken records, records out of order and totals which don't match the trailer.
+func ParseZengin(data []byte) (*ZenginFile, []*ZenginIssue) {
+	records, err := splitZengin(data)
+	if err != nil {
+		return nil, []*ZenginIssue{{Error: err.Error()}}
+	}
+
+	f := &ZenginFile{Records: []*ZenginRecord{}}
+	issues := []*ZenginIssue{}
+	var (
+		trailer bool
+		end     bool
+		total   int64
+	)
+	for i, record := range records {
+		line := i + 1
+		if len(record) == 0 {
+			issues = append(issues, &ZenginIssue{Line: line, Error: "record is empty"})
+			continue
+		}
+		if end {
+			issues = append(issues, &ZenginIssue{Line: line, Error: "record is after the end record"})
+			continue
+		}
+
+		switch string(record[0]) {
+		case zenginHeader:
+			vs, is := parseZenginRecord(zenginHeaderFields, record, line)
+			issues = append(issues, is...)
+			if vs == nil {
+				continue
+			}
+			if line != 1 {
+				issues = append(issues, &ZenginIssue{Line: line, Error: "header record must be the first"})
+			}
+			f.Header = &ZenginHeader{Kind: vs[1], RequesterCode: vs[3], RequesterName: vs[4], Date: vs[5], Bank: vs[6],
+				BankName: vs[7], Branch: vs[8], BranchName: vs[9], DepositType: vs[10], Account: vs[11]}
+			if vs[1] != ZenginTotalTransfer {
+				issues = append(issues, &ZenginIssue{Line: line, Field: "kind", Error: fmt.Sprintf("%v is not %v (総合振込)", vs[1], ZenginTotalTransfer)})
+			}
+			if vs[2] != zenginShiftJIS {
+				issues = append(issues, &ZenginIssue{Line: line, Field: "code type", Error: fmt.Sprintf("%v is not %v (Shift_JIS)", vs[2], zenginShiftJIS)})
+			}
+		case zenginData:
+			vs, is := parseZenginRecord(zenginDataFields, record, line)
+			issues = append(issues, is...)
+			if vs == nil {
+				continue
+			}
+			if f.Header == nil || trailer {
+				issues = append(issues, &ZenginIssue{Line: line, Error: "data record must be between the header and the trailer"})
+			}
+			amount, _ := strconv.ParseInt(vs[9], 10, 64)
+			if amount <= 0 {
+				issues = append(issues, &ZenginIssue{Line: line, Field: "amount", Error: fmt.Sprintf("%v is not more than zero", vs[9])})
+			}
+			total += amount
+			f.Records = append(f.Records, &ZenginRecord{Line: line, Bank: vs[1], BankName: vs[2], Branch: vs[3], BranchName: vs[4],
+				DepositType: vs[6], Account: vs[7], Name: vs[8], Amount: amount, CustomerCode1: vs[11], CustomerCode2: vs[12]})
+		case zenginTrailer:
+			vs, is := parseZenginRecord(zenginTrailerFields, record, line)
+			issues = append(issues, is...)
+			if vs == nil {
+				continue
+			}
+			trailer = true
+			f.Count, _ = strconv.Atoi(vs[1])
+			f.Amount, _ = strconv.ParseInt(vs[2], 10, 64)
+			if f.Count != len(f.Records) {
+				issues = append(issues, &ZenginIssue{Line: line, Field: "count", Error: fmt.Sprintf("trailer has %v records, but the file has %v", f.Count, len(f.Records))})
+			}
+			if f.Amount != total {
+				issues = append(issues, &ZenginIssue{Line: line, Field: "amount", Error: fmt.Sprintf("trailer has %v in total, but the records are %v", f.Amount, total)})
+			}
+		case zenginEnd:
+			_, is := parseZenginRecord(zenginEndFields, record, line)
+			issues = append(issues, is...)
+			end = true
+		default:
+			issues = append(issues, &ZenginIssue{Line: line, Field: "data type", Error: fmt.Sprintf("%q is not a data type", record[0])})
+		}
+	}
+
+	if f.Header == nil {
+		issues = append(issues, &ZenginIssue{Error: "file has no header record"})
+	}
+	if !trailer {
+		issues = append(issues, &ZenginIssue{Error: "file has no trailer record"})
+	}
+	if !end {
+		issues = append(issues, &ZenginIssue{Error: "file has no end record"})
+	}
+	return f, issues
+}
+
+func zenginAccount(num int) (string, error) {
+	s := strconv.Itoa(num)
+	if num <= 0 || len(s) > zenginAccountDigits {
+		return "", fmt.Errorf("account(ID: %v) doesnt fit %v digits of zengin", num, zenginAccountDigits)
+	}
+	return s, nil
+}
+
+// checkZenginAccount checks that the account is in JPY, which is the only currency of zengin files.
+func (nb *netBank) checkZenginAccount(num int) (*Account, error) {
+	a, err := nb.GetAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	if a.Currency != "JPY" {
+		return nil, fmt.Errorf("account(ID: %v) is in %v, but zengin files are in JPY: %w", num, a.Currency, ErrCurrencyMismatch)
+	}
+	return a, nil
+}
+
+// ExportZengin renders the transfers sent from the account between the dates as a 総合振込 file.
+// reversals are not included, and 取組日 is today.
+func (nb *netBank) ExportZengin(num int, from time.Time, to time.Time) ([]byte, error) {
+	a, err := nb.checkZenginAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	account, err := zenginAccount(num)
+	if err != nil {
+		return nil, err
+	}
+	name, err := ZenginKana(a.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	bank := zenginBankCode()
+	f := &ZenginFile{
+		Header: &ZenginHeader{
+			RequesterCode: strconv.Itoa(num),
+			RequesterName: name,
+			Date:          time.Now().Format("0102"),
+			Bank:          bank,
+			BankName:      zenginBankName,
+			Branch:        zenginBranchCode,
+			BranchName:    zenginBranchName,
+			DepositType:   zenginOrdinaryDeposit,
+			Account:       account,
+		},
+		Records: []*ZenginRecord{},
+	}
+
+	// transfers to other banks are to the clearing account, and their records are of the beneficiaries.
+	q := `
+	SELECT transfer.id, reciever, transfer.amount, username,
+		outgoing_transfer.bank_code, financial_institution.kana, outgoing_transfer.branch_code, bank_branch.kana,
+		outgoing_transfer.account_type, outgoing_transfer.account_number, outgoing_transfer.name
+	FROM transfer
+	INNER JOIN customer ON customer.id=transfer.reciever
+	LEFT JOIN outgoing_transfer ON outgoing_transfer.transfer_id=transfer.id
+	LEFT JOIN financial_institution ON financial_institution.code=outgoing_transfer.bank_code
+	LEFT JOIN bank_branch ON bank_branch.bank_code=outgoing_transfer.bank_code AND bank_branch.code=outgoing_transfer.branch_code
+	WHERE sender=$1 AND reversal_of IS NULL AND created_at>=$2 AND created_at<$3
+	ORDER BY transfer.id;
+	`
+	rows, err := nb.db.QueryContext(context.Background(), q, num, truncateDate(from), truncateDate(to).AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id       int64
+			reciever int
+			amount   float64
+			username string
+			b        struct{ bank, bankName, branch, branchName, accountType, account, name sql.NullString }
+		)
+		err := rows.Scan(&id, &reciever, &amount, &username,
+			&b.bank, &b.bankName, &b.branch, &b.branchName, &b.accountType, &b.account, &b.name)
+		if err != nil {
+			return nil, err
+		}
+		if amount != float64(int64(amount)) {
+			return nil, fmt.Errorf("amount %v of transfer(ID: %v) is not in yen", amount, id)
+		}
+		if b.bank.Valid {
+			f.Records = append(f.Records, &ZenginRecord{
+				Bank:          b.bank.String,
+				BankName:      b.bankName.String,
+				Branch:        b.branch.String,
+				BranchName:    b.branchName.String,
+				DepositType:   b.accountType.String,
+				Account:       b.account.String,
+				Name:          b.name.String,
+				Amount:        int64(amount),
+				CustomerCode1: strconv.FormatInt(id, 10),
+			})
+			continue
+		}
+		account, err := zenginAccount(reciever)
+		if err != nil {
+			return nil, err
+		}
+		name, err := ZenginKana(username)
+		if err != nil {
+			return nil, err
+		}
+		if utf8.RuneCountInString(name) > 30 {
+			name = string([]rune(name)[:30])
+		}
+		f.Records = append(f.Records, &ZenginRecord{
+			Bank:          bank,
+			BankName:      zenginBankName,
+			Branch:        zenginBranchCode,
+			BranchName:    zenginBranchName,
+			DepositType:   zenginOrdinaryDeposit,
+			Account:       account,
+			Name:          name,
+			Amount:        int64(amount),
+			CustomerCode1: strconv.FormatInt(id, 10),
+		})
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return EncodeZengin(f)
+}
+
+// ImportZengin validates a 総合振込 file from the account and sends its records as a batch transfer.
+// the file must be of the account, the recievers must be accounts of the bank and their names must match.
+// nothing is sent when the file has any issue or dryRun is true.
+func (nb *netBank) ImportZengin(num int, data []byte, mode string, dryRun bool) (*ZenginImport, error) {
+	_, err := nb.checkZenginAccount(num)
+	if err != nil {
+		return nil, err
+	}
+
+	f, issues := ParseZengin(data)
+	report := &ZenginImport{Sender: num, Trades: []*Trade{}, Issues: issues}
+	if f == nil {
+		return report, nil
+	}
+
+	bank := zenginBankCode()
+	if h := f.Header; h != nil {
+		if h.Bank != bank {
+			report.Issues = append(report.Issues, &ZenginIssue{Line: 1, Field: "bank", Error: fmt.Sprintf("%v is not the bank code %v", h.Bank, bank)})
+		}
+		if n, _ := strconv.Atoi(h.Account); n != num {
+			report.Issues = append(report.Issues, &ZenginIssue{Line: 1, Field: "account", Error: fmt.Sprintf("file is from account %v, not %v", h.Account, num)})
+		}
+	}
+
+	for _, r := range f.Records {
+		report.Count++
+		report.Amount += r.Amount
+		if r.Bank != bank {
+			report.Issues = append(report.Issues, &ZenginIssue{Line: r.Line, Field: "bank", Error: fmt.Sprintf("transfer to bank %v is not supported", r.Bank)})
+			continue
+		}
+		to, _ := strconv.Atoi(r.Account)
+		a, err := nb.GetAccount(to)
+		if err != nil {
+			report.Issues = append(report.Issues, &ZenginIssue{Line: r.Line, Field: "account", Error: fmt.Sprintf("account(ID: %v) doesnt exist", to)})
+			continue
+		}
+		name, err := ZenginKana(a.Name)
+		if err != nil || !strings.HasPrefix(name, r.Name) || r.Name == "" {
+			report.Issues = append(report.Issues, &ZenginIssue{Line: r.Line, Field: "name", Error: fmt.Sprintf("%v is not the name of account(ID: %v)", r.Name, to)})
+			continue
+		}
+		report.Trades = append(report.Trades, &Trade{Class: "transfer", Amount: float64(r.Amount), To: AccountRef(to), Currency: "JPY"})
+	}
+
+	report.Valid = len(report.Issues) == 0
+	if !report.Valid || dryRun {
+		return report, nil
+	}
+	report.Result, err = nb.BatchTransfer(num, report.Trades, mode)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -7,6 +7,7 @@ replace github.com/hiroyuki-takayama-RAIX/api v0.0.0 => ./api
 require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/hiroyuki-takayama-RAIX/api v0.0.0
+	github.com/hiroyuki-takayama-RAIX/core v0.0.0
 )
 
 require (
@@ -18,7 +19,6 @@ require (
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.14.0 // indirect
 	github.com/goccy/go-json v0.10.2 // indirect
-	github.com/hiroyuki-takayama-RAIX/core v0.0.0 // indirect
 	github.com/jackc/chunkreader/v2 v2.0.1 // indirect
 	github.com/jackc/pgconn v1.14.0 // indirect
 	github.com/jackc/pgio v1.0.0 // indirect
@@ -1,19 +1,68 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hiroyuki-takayama-RAIX/api"
+	"github.com/hiroyuki-takayama-RAIX/core"
 )
 
 func main() {
 	env := os.Getenv("Env")
 	if env == "prod" {
 		gin.SetMode(gin.ReleaseMode)
+
+		// several instances run in production, so events are delivered through the db.
+		bus, err := core.NewPostgresBus()
+		if err != nil {
+			log.Fatalf("failed to start the event bus: %v", err)
+		}
+		defer bus.Close()
+		core.SetEventBus(bus)
+	}
+
+	// domain events in the outbox are delivered to webhooks.
+	hooks, err := core.NewNetBank()
+	if err != nil {
+		log.Fatalf("failed to initialize netbank instance: %v", err)
+	}
+	defer hooks.Close()
+
+	// the codes of domestic banks are reloaded from the CSV on every start when it is given.
+	if path := os.Getenv("BANK_CODES_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("failed to open the bank codes: %v", err)
+		}
+		loaded, err := hooks.LoadBankCodes(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("failed to load the bank codes: %v", err)
+		}
+		log.Printf("loaded %v banks and %v branches from %v", loaded.Banks, loaded.Branches, path)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go core.RunOutboxRelay(ctx, time.Second, hooks.EnqueueWebhooks)
+	go core.RunWebhookDispatcher(ctx, time.Second)
+	go core.RunStandingOrderScheduler(ctx, time.Minute)
+	go core.RunHoldExpiry(ctx, time.Minute)
+	go core.RunOverdraftInterest(ctx, time.Hour)
+	go core.RunInterestJobs(ctx, time.Hour)
+	go core.RunTermDepositMaturity(ctx, time.Hour)
+	go core.RunLoanRepayments(ctx, time.Hour)
+	// statements are signed, so they are generated only when the key is given.
+	if os.Getenv("STATEMENT_SIGNING_KEY") != "" {
+		go core.RunMonthlyStatements(ctx, time.Hour)
 	}
 
 	router := gin.Default()
+	router.Use(api.ResolveAccountID)
 	router.GET("/accounts", api.GetAccounts)
 	router.GET("/accounts/:id", api.GetAccount)
 	router.POST("/accounts", api.CreateAccount)
@@ -21,6 +70,89 @@ func main() {
 	router.PUT("/accounts/:id", api.UpdateAccount)
 	router.GET("/accounts/:id/balance", api.GetBalance)
 	router.PATCH("/accounts/:id/balance", api.FinancialTransaction)
+	router.GET("/accounts/:id/events", api.AccountHolder, api.AccountEvents)
+	router.POST("/accounts/:id/standing-orders", api.CreateStandingOrder)
+	router.GET("/accounts/:id/standing-orders", api.GetStandingOrders)
+	router.DELETE("/accounts/:id/standing-orders/:order", api.CancelStandingOrder)
+	router.GET("/accounts/:id/standing-orders/:order/runs", api.GetStandingOrderRuns)
+	router.POST("/accounts/:id/holds", api.AccountHolder, api.PlaceHold)
+	router.GET("/accounts/:id/holds", api.AccountHolder, api.GetHolds)
+	router.POST("/accounts/:id/holds/:hold/capture", api.AccountHolder, api.CaptureHold)
+	router.POST("/accounts/:id/holds/:hold/release", api.AccountHolder, api.ReleaseHold)
+	router.GET("/accounts/:id/transfers", api.GetTransfers)
+	router.POST("/accounts/:id/batch-transfers", api.BatchTransfer)
+	router.GET("/transfers/:id", api.GetTransfer)
+	router.POST("/transfers/:id/reversals", api.TransferSender, api.ReverseTransfer)
+	router.GET("/accounts/:id/overdraft", api.GetOverdraft)
+	router.GET("/accounts/:id/limits", api.GetLimits)
+	router.GET("/accounts/:id/fees/quote", api.QuoteFee)
+	router.GET("/accounts/:id/interest", api.GetInterest)
+	router.GET("/products", api.GetProducts)
+	router.POST("/accounts/:id/term-deposits", api.OpenTermDeposit)
+	router.GET("/accounts/:id/term-deposits", api.GetTermDeposits)
+	router.POST("/accounts/:id/term-deposits/:deposit/break", api.BreakTermDeposit)
+	router.GET("/term-rates", api.GetTermRates)
+	router.GET("/fx-rates", api.GetFXRates)
+	router.GET("/fx-rates/:base/:quote/history", api.GetFXRateHistory)
+	router.GET("/fx/quote", api.QuoteFX)
+	router.GET("/customers/:id", api.GetPortfolio)
+	router.GET("/accounts/:id/loans", api.GetLoans)
+	router.GET("/loans/:id", api.GetLoan)
+	router.GET("/loans/:id/schedule", api.GetLoanSchedule)
+	router.GET("/loans/:id/statement", api.GetLoanStatement)
+	router.GET("/loans/:id/payoff", api.QuotePayoff)
+	router.POST("/loans/:id/payoff", api.PayOffLoan)
+	router.POST("/accounts/:id/cards", api.IssueCard)
+	router.GET("/accounts/:id/cards", api.GetCards)
+	router.PATCH("/accounts/:id/cards/:card", api.SetCardStatus)
+	router.GET("/accounts/:id/zengin", api.ExportZengin)
+	router.POST("/accounts/:id/zengin", api.ImportZengin)
+	router.POST("/accounts/:id/pain001", api.AccountHolder, api.ImportPain001)
+	router.GET("/accounts/:id/camt053", api.AccountHolder, api.StatementCamt053)
+	router.GET("/accounts/:id/statements/mt940", api.AccountHolder, api.ExportMT940)
+	router.POST("/accounts/:id/statements/tokens", api.AccountHolder, api.IssueDownloadToken)
+	router.GET("/accounts/:id/statements/download", api.ExportStatement)
+	router.GET("/accounts/:id/statements", api.GetMonthlyStatements)
+	router.GET("/accounts/:id/statements/:statement", api.GetMonthlyStatement)
+	router.POST("/statements/verify", api.VerifyStatement)
+	router.GET("/statements/public-key", api.GetStatementPublicKey)
+	router.POST("/accounts/:id/domestic-transfers", api.SendDomesticTransfer)
+	router.POST("/accounts/:id/ach-transfers", api.OriginateACH)
+	router.GET("/banks/:code", api.GetFinancialInstitution)
+	router.GET("/banks/:code/branches", api.GetBranches)
+	router.GET("/banks/:code/branches/:branch", api.GetBranch)
+	router.POST("/beneficiaries/check", api.CheckBeneficiary)
+	router.POST("/card-authorizations", api.Authorize)
+	router.GET("/card-authorizations/:id", api.GetAuthorization)
+	router.POST("/card-authorizations/:id/clear", api.AdminOnly, api.ClearAuthorization)
+	router.POST("/card-authorizations/:id/void", api.AdminOnly, api.VoidAuthorization)
+
+	admin := router.Group("/admin", api.AdminOnly)
+	admin.POST("/webhooks", api.CreateWebhook)
+	admin.GET("/webhooks", api.GetWebhooks)
+	admin.DELETE("/webhooks/:id", api.DeleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", api.GetWebhookDeliveries)
+	admin.POST("/webhook-deliveries/:id/redeliver", api.RedeliverWebhook)
+	admin.GET("/reversals", api.GetPendingReversals)
+	admin.POST("/reversals/:id/approve", api.ApproveReversal)
+	admin.POST("/reversals/:id/reject", api.RejectReversal)
+	admin.POST("/accounts/:id/credentials", api.IssueAccountCredential)
+	admin.PUT("/accounts/:id/overdraft", api.SetOverdraft)
+	admin.PUT("/limits", api.SetDefaultLimits)
+	admin.PUT("/tiers/:tier/limits", api.SetTierLimits)
+	admin.PUT("/accounts/:id/limits", api.SetAccountLimits)
+	admin.PUT("/customers/:id/tier", api.SetCustomerTier)
+	admin.PUT("/products/:product", api.SetProduct)
+	admin.GET("/products/:product/fees", api.GetFeeSchedules)
+	admin.PUT("/products/:product/fees/:operation", api.SetFeeSchedule)
+	admin.PUT("/term-rates/:term", api.SetTermRate)
+	admin.POST("/loans", api.DisburseLoan)
+	admin.PUT("/fx-rates/:base/:quote", api.SetFXRate)
+	admin.PUT("/banks", api.LoadBankCodes)
+	admin.GET("/ach-entries", api.GetACHEntries)
+	admin.POST("/ach-files", api.ExportNACHA)
+	admin.GET("/ach-files/:id", api.GetACHFile)
+	admin.POST("/ach-returns", api.ProcessACHReturns)
 
 	if env == "prod" {
 		router.Run("0.0.0.0:80")
@@ -10,11 +10,492 @@ CREATE TABLE customer (
     phone VARCHAR(53)
 );
 
+-- every account is opened as one of the products.
+-- interest_rate is the annual rate, and rate_tiers is a list of {"from", "rate"} overriding it by the balance.
+CREATE TABLE product (
+  code VARCHAR(32) PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  interest_rate FLOAT NOT NULL DEFAULT 0,
+  rate_tiers JSONB NOT NULL DEFAULT 'null'
+);
+
+INSERT INTO product (code, name) VALUES ('checking', 'Checking account');
+INSERT INTO product (code, name, interest_rate, rate_tiers)
+VALUES ('savings', 'Savings account', 0.001, '[{"from": 10000, "rate": 0.002}]');
+
 CREATE TABLE account (
   id INT PRIMARY KEY,
   balance FLOAT,
+  product VARCHAR(32) NOT NULL DEFAULT 'checking' REFERENCES product(code),
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
   FOREIGN KEY (id) REFERENCES customer(id)
 );
 
+-- internal accounts of the bank have negative ids.
+INSERT INTO customer (id, username, addr, phone) VALUES (-1, 'NetBank fee income', '', '');
+INSERT INTO account (id, balance) VALUES (-1, 0);
+INSERT INTO customer (id, username, addr, phone) VALUES (-2, 'NetBank interest expense', '', '');
+INSERT INTO account (id, balance) VALUES (-2, 0);
+INSERT INTO customer (id, username, addr, phone) VALUES (-3, 'NetBank loan interest income', '', '');
+INSERT INTO account (id, balance) VALUES (-3, 0);
+INSERT INTO customer (id, username, addr, phone) VALUES (-4, 'NetBank domestic clearing', '', '');
+INSERT INTO account (id, balance, currency) VALUES (-4, 0, 'JPY');
+INSERT INTO customer (id, username, addr, phone) VALUES (-5, 'NetBank ACH clearing', '', '');
+INSERT INTO account (id, balance, currency) VALUES (-5, 0, 'USD');
+
+-- the internal accounts which book the money of the bank by currency. role is the id of the one in USD above,
+-- and the accounts of the other currencies are opened from internal_account_id when they are used first.
+CREATE TABLE internal_account (
+  role INT NOT NULL,
+  currency CHAR(3) NOT NULL,
+  account_id INT NOT NULL UNIQUE REFERENCES account(id),
+  PRIMARY KEY (role, currency)
+);
+INSERT INTO internal_account (role, currency, account_id) VALUES (-1, 'USD', -1), (-2, 'USD', -2), (-3, 'USD', -3);
+CREATE SEQUENCE internal_account_id INCREMENT BY -1 MINVALUE -2147483648 MAXVALUE -100 START WITH -100;
+
 --   FOREIGN KEY (id) REFERENCES production.customer(id)
--- );
\ No newline at end of file
+-- );
+-- every change on an account is recorded in the journal.
+-- the journal has no foreign key to account so that the history remains after the account is closed.
+CREATE TABLE journal (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  event VARCHAR(32) NOT NULL,
+  amount FLOAT NOT NULL DEFAULT 0,
+  balance FLOAT NOT NULL DEFAULT 0,
+  counterparty INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX journal_account_id ON journal (account_id, id);
+
+-- domain events are written in the same transaction as the change, and delivered by the relay.
+CREATE TABLE outbox (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  event VARCHAR(64) NOT NULL,
+  payload JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX outbox_undelivered ON outbox (id) WHERE delivered_at IS NULL;
+
+-- operators register webhooks per event type through the admin api.
+CREATE TABLE webhook (
+  id SERIAL PRIMARY KEY,
+  url VARCHAR(2048) NOT NULL,
+  event VARCHAR(64) NOT NULL,
+  secret VARCHAR(128) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE webhook_delivery (
+  id BIGSERIAL PRIMARY KEY,
+  webhook_id INT NOT NULL REFERENCES webhook(id) ON DELETE CASCADE,
+  outbox_id BIGINT NOT NULL,
+  event VARCHAR(64) NOT NULL,
+  body JSONB NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'pending',
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_error TEXT NOT NULL DEFAULT '',
+  delivered_at TIMESTAMPTZ,
+  UNIQUE (webhook_id, outbox_id)
+);
+
+CREATE INDEX webhook_delivery_pending ON webhook_delivery (next_attempt_at) WHERE status='pending';
+
+-- standing orders transfer money on every due date of the schedule.
+CREATE TABLE standing_order (
+  id SERIAL PRIMARY KEY,
+  source INT NOT NULL,
+  destination INT NOT NULL,
+  amount FLOAT NOT NULL,
+  schedule VARCHAR(32) NOT NULL,
+  start_date DATE NOT NULL,
+  end_date DATE,
+  next_run DATE NOT NULL,
+  retries INT NOT NULL DEFAULT 0,
+  retry_hours INT NOT NULL DEFAULT 24,
+  attempt INT NOT NULL DEFAULT 0,
+  retry_at TIMESTAMPTZ,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE standing_order_run (
+  id BIGSERIAL PRIMARY KEY,
+  order_id INT NOT NULL REFERENCES standing_order(id) ON DELETE CASCADE,
+  due_date DATE NOT NULL,
+  attempt INT NOT NULL,
+  status VARCHAR(16) NOT NULL,
+  error TEXT NOT NULL DEFAULT '',
+  run_at TIMESTAMPTZ NOT NULL
+);
+
+-- holds reserve funds of an account. the available balance is the balance without active holds.
+CREATE TABLE hold (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES account(id) ON DELETE CASCADE,
+  amount FLOAT NOT NULL,
+  captured FLOAT NOT NULL DEFAULT 0,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  reference VARCHAR(64) NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX hold_active ON hold (account_id) WHERE status='active';
+
+-- every transfer is recorded to be reversed later. a reversal is a transfer referring to the original.
+CREATE TABLE transfer (
+  id BIGSERIAL PRIMARY KEY,
+  sender INT NOT NULL,
+  reciever INT NOT NULL,
+  amount FLOAT NOT NULL,
+  refunded FLOAT NOT NULL DEFAULT 0,
+  fee FLOAT NOT NULL DEFAULT 0,
+  reversal_of BIGINT REFERENCES transfer(id),
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  -- credited, credited_currency and rate are set when the amount is converted into the currency of the reciever.
+  credited FLOAT,
+  credited_currency CHAR(3),
+  rate FLOAT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX transfer_sender ON transfer (sender);
+CREATE INDEX transfer_reciever ON transfer (reciever);
+
+CREATE TABLE reversal (
+  id BIGSERIAL PRIMARY KEY,
+  transfer_id BIGINT NOT NULL REFERENCES transfer(id),
+  amount FLOAT NOT NULL,
+  reason VARCHAR(255) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL,
+  refund_id BIGINT REFERENCES transfer(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  decided_at TIMESTAMPTZ
+);
+
+-- the balance of an account can go negative up to limit_amount, and rate is the annual interest on the negative balance.
+CREATE TABLE overdraft (
+  account_id INT PRIMARY KEY REFERENCES account(id) ON DELETE CASCADE,
+  limit_amount FLOAT NOT NULL DEFAULT 0,
+  rate FLOAT NOT NULL DEFAULT 0,
+  accrued_on DATE NOT NULL DEFAULT CURRENT_DATE,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- limits on withdrawals and transfers. scope is 'account' with the id as key, 'tier' with the name as key, or 'default' with empty key.
+-- a NULL limit falls back to the next scope. the limits are in the currency and applied to the accounts in it.
+CREATE TABLE limit_rule (
+  scope VARCHAR(16) NOT NULL,
+  key VARCHAR(64) NOT NULL DEFAULT '',
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  per_transaction FLOAT,
+  daily FLOAT,
+  monthly FLOAT,
+  per_counterparty FLOAT,
+  PRIMARY KEY (scope, key, currency)
+);
+
+CREATE TABLE customer_tier (
+  customer_id INT PRIMARY KEY REFERENCES customer(id) ON DELETE CASCADE,
+  tier VARCHAR(64) NOT NULL
+);
+
+-- money counted against the limits. counterparty is 0 for a withdrawal.
+CREATE TABLE limit_usage (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  counterparty INT NOT NULL DEFAULT 0,
+  amount FLOAT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX limit_usage_account_id ON limit_usage (account_id, created_at);
+
+-- fees of withdrawals and transfers by product and currency. the amounts are in the currency. tiers is a list of {"up_to", "fee"}.
+CREATE TABLE fee_schedule (
+  product VARCHAR(32) NOT NULL REFERENCES product(code),
+  operation VARCHAR(16) NOT NULL,
+  currency CHAR(3) NOT NULL DEFAULT 'USD',
+  kind VARCHAR(16) NOT NULL,
+  flat FLOAT NOT NULL DEFAULT 0,
+  rate FLOAT NOT NULL DEFAULT 0,
+  tiers JSONB NOT NULL DEFAULT 'null',
+  free_per_month INT NOT NULL DEFAULT 0,
+  PRIMARY KEY (product, operation, currency)
+);
+
+-- every charged operation including free ones, to count the free quota.
+CREATE TABLE fee_charge (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  operation VARCHAR(16) NOT NULL,
+  amount FLOAT NOT NULL,
+  fee FLOAT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX fee_charge_account_id ON fee_charge (account_id, created_at);
+
+-- interest of the end-of-day balance. one row per account and day makes the accrual idempotent.
+CREATE TABLE interest_accrual (
+  account_id INT NOT NULL,
+  day DATE NOT NULL,
+  balance FLOAT NOT NULL,
+  rate FLOAT NOT NULL,
+  amount FLOAT NOT NULL,
+  posted_at TIMESTAMPTZ,
+  PRIMARY KEY (account_id, day)
+);
+
+-- rates of term deposits by term. penalty_rate is the part of the principal charged when a deposit is broken early.
+CREATE TABLE term_rate (
+  term_months INT PRIMARY KEY,
+  rate FLOAT NOT NULL,
+  penalty_rate FLOAT NOT NULL DEFAULT 0
+);
+
+INSERT INTO term_rate (term_months, rate, penalty_rate) VALUES
+  (3, 0.002, 0.005),
+  (6, 0.003, 0.01),
+  (12, 0.005, 0.02);
+
+-- money moved out of an account for a term. rate and penalty_rate are fixed when the deposit starts.
+-- an account with a deposit cannot be deleted, and DeleteAccount deletes the closed deposits before the account.
+CREATE TABLE term_deposit (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES account(id) ON DELETE RESTRICT,
+  principal FLOAT NOT NULL,
+  term_months INT NOT NULL,
+  rate FLOAT NOT NULL,
+  penalty_rate FLOAT NOT NULL,
+  instruction VARCHAR(16) NOT NULL,
+  start_date DATE NOT NULL,
+  maturity DATE NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  interest FLOAT NOT NULL DEFAULT 0,
+  penalty FLOAT NOT NULL DEFAULT 0,
+  rolled_from BIGINT REFERENCES term_deposit(id),
+  closed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX term_deposit_maturity ON term_deposit (status, maturity);
+
+-- loans lent to accounts. outstanding is the principal not repaid yet. an account with a loan cannot be deleted,
+-- and DeleteAccount deletes the loans paid off before the account.
+CREATE TABLE loan (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES account(id) ON DELETE RESTRICT,
+  principal FLOAT NOT NULL,
+  rate FLOAT NOT NULL,
+  term_months INT NOT NULL,
+  method VARCHAR(16) NOT NULL,
+  late_fee FLOAT NOT NULL DEFAULT 0,
+  outstanding FLOAT NOT NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  disbursed_on DATE NOT NULL,
+  closed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE loan_installment (
+  loan_id BIGINT NOT NULL REFERENCES loan(id) ON DELETE CASCADE,
+  seq INT NOT NULL,
+  due_date DATE NOT NULL,
+  principal FLOAT NOT NULL,
+  interest FLOAT NOT NULL,
+  late_fee FLOAT NOT NULL DEFAULT 0,
+  status VARCHAR(16) NOT NULL DEFAULT 'due',
+  paid_at TIMESTAMPTZ,
+  PRIMARY KEY (loan_id, seq)
+);
+
+CREATE INDEX loan_installment_due_date ON loan_installment (status, due_date);
+
+-- money collected for loans. seq is NULL for the early payoff.
+CREATE TABLE loan_payment (
+  id BIGSERIAL PRIMARY KEY,
+  loan_id BIGINT NOT NULL REFERENCES loan(id) ON DELETE CASCADE,
+  account_id INT NOT NULL,
+  seq INT,
+  principal FLOAT NOT NULL,
+  interest FLOAT NOT NULL,
+  late_fee FLOAT NOT NULL DEFAULT 0,
+  amount FLOAT NOT NULL,
+  balance FLOAT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- virtual debit cards. the card number and the cvv are stored only as hmacs keyed by CARD_SECRET,
+-- and the last 4 digits of the number to show. failed_cvv counts the wrong cvvs in a row.
+CREATE TABLE card (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES account(id) ON DELETE CASCADE,
+  pan_hash CHAR(64) NOT NULL UNIQUE,
+  pan_last4 CHAR(4) NOT NULL,
+  expires_on DATE NOT NULL,
+  cvv_hash CHAR(64) NOT NULL,
+  failed_cvv INT NOT NULL DEFAULT 0,
+  status VARCHAR(16) NOT NULL DEFAULT 'active',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- card payments authorized by merchants. an approved one holds the amount until it is cleared or voided.
+CREATE TABLE card_authorization (
+  id BIGSERIAL PRIMARY KEY,
+  card_id BIGINT NOT NULL REFERENCES card(id) ON DELETE CASCADE,
+  account_id INT NOT NULL,
+  amount FLOAT NOT NULL,
+  cleared FLOAT NOT NULL DEFAULT 0,
+  merchant VARCHAR(128) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL,
+  reason VARCHAR(32) NOT NULL DEFAULT '',
+  hold_id BIGINT REFERENCES hold(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- mid rates of currency pairs set by staff. one base is rate of quote. a new rate is added as the history
+-- and the latest one which is effective at the time is used.
+CREATE TABLE fx_rate (
+  id BIGSERIAL PRIMARY KEY,
+  base CHAR(3) NOT NULL,
+  quote CHAR(3) NOT NULL,
+  rate FLOAT NOT NULL,
+  effective_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (base, quote, effective_at)
+);
+
+-- rates fixed for a while. a quote is redeemed by one transfer.
+CREATE TABLE fx_quote (
+  id VARCHAR(32) PRIMARY KEY,
+  base CHAR(3) NOT NULL,
+  quote CHAR(3) NOT NULL,
+  rate FLOAT NOT NULL,
+  mid FLOAT NOT NULL,
+  amount FLOAT,
+  converted FLOAT,
+  expires_at TIMESTAMPTZ NOT NULL,
+  redeemed_at TIMESTAMPTZ,
+  transfer_id BIGINT REFERENCES transfer(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- 金融機関コード and 支店コード of domestic banks. kana are in half-width.
+CREATE TABLE financial_institution (
+  code CHAR(4) PRIMARY KEY,
+  name VARCHAR(64) NOT NULL,
+  kana VARCHAR(64) NOT NULL
+);
+
+CREATE TABLE bank_branch (
+  bank_code CHAR(4) NOT NULL REFERENCES financial_institution(code) ON DELETE CASCADE,
+  code CHAR(3) NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  kana VARCHAR(64) NOT NULL,
+  PRIMARY KEY (bank_code, code)
+);
+
+-- transfers to accounts of other banks. the money is sent to the clearing account (-4).
+-- the beneficiary is kept as it was sent even if the codes are reloaded.
+CREATE TABLE outgoing_transfer (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  transfer_id BIGINT NOT NULL REFERENCES transfer(id) ON DELETE CASCADE,
+  bank_code CHAR(4) NOT NULL,
+  branch_code CHAR(3) NOT NULL,
+  account_type CHAR(1) NOT NULL,
+  account_number CHAR(7) NOT NULL,
+  name VARCHAR(30) NOT NULL,
+  amount FLOAT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the credential of the holder of an account, which is issued by staff. only the sha-256 of the token is stored.
+CREATE TABLE account_credential (
+  account_id INT PRIMARY KEY REFERENCES account(id) ON DELETE CASCADE,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- tokens to download statements of an account by personal finance apps. only the sha-256 of the token is stored.
+CREATE TABLE download_token (
+  token_hash CHAR(64) PRIMARY KEY,
+  account_id INT NOT NULL REFERENCES account(id) ON DELETE CASCADE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- monthly statements are archived as they were issued. content_hash is the sha-256 of content and signature is
+-- the ed25519 signature of content by STATEMENT_SIGNING_KEY. rows can not be updated or deleted.
+CREATE TABLE monthly_statement (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  month DATE NOT NULL,
+  currency CHAR(3) NOT NULL,
+  opening FLOAT NOT NULL,
+  fees FLOAT NOT NULL,
+  interest FLOAT NOT NULL,
+  closing FLOAT NOT NULL,
+  transactions INT NOT NULL,
+  content BYTEA NOT NULL,
+  content_hash CHAR(64) NOT NULL,
+  signature VARCHAR(88) NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (account_id, month)
+);
+CREATE INDEX monthly_statement_content_hash ON monthly_statement (content_hash);
+
+CREATE FUNCTION reject_statement_change() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'monthly statements are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER monthly_statement_immutable BEFORE UPDATE OR DELETE ON monthly_statement
+FOR EACH ROW EXECUTE FUNCTION reject_statement_change();
+
+-- NACHA files sent to the receiving point.
+CREATE TABLE ach_file (
+  id BIGSERIAL PRIMARY KEY,
+  content BYTEA NOT NULL,
+  entries INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- ACH credits and debits with accounts of US banks. credits are sent to the ACH clearing account (-5), and debits are
+-- advanced from it until they settle. trace is the trace number in the file, by which returns are matched.
+CREATE TABLE ach_entry (
+  id BIGSERIAL PRIMARY KEY,
+  account_id INT NOT NULL,
+  transfer_id BIGINT NOT NULL REFERENCES transfer(id) ON DELETE CASCADE,
+  direction VARCHAR(8) NOT NULL,
+  routing CHAR(9) NOT NULL,
+  account_number VARCHAR(17) NOT NULL,
+  account_type VARCHAR(8) NOT NULL,
+  name VARCHAR(22) NOT NULL,
+  amount FLOAT NOT NULL,
+  trace CHAR(15) UNIQUE,
+  status VARCHAR(16) NOT NULL,
+  file_id BIGINT REFERENCES ach_file(id),
+  return_code CHAR(3),
+  return_note VARCHAR(255),
+  reversal_id BIGINT REFERENCES reversal(id),
+  -- the hold on the money of a debit until the return window passes.
+  hold_id BIGINT REFERENCES hold(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- the ACH clearing account goes negative by the debits advanced before they settle. the overdraft is only used by
+-- OriginateACH and the returns, because the internal accounts are rejected by every route of customers.
+INSERT INTO overdraft (account_id, limit_amount, rate) VALUES (-5, 1000000000, 0);